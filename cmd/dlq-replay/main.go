@@ -0,0 +1,209 @@
+// Command dlq-replay republishes messages from a dead-letter topic to the
+// topic they originally came from, recorded by the services in the
+// x-original-topic header, or to -to. Keys and headers are preserved apart
+// from the DLQ's own x-error and x-original-topic. It reads every partition
+// from the beginning up to the end offset seen at startup, then exits;
+// nothing is committed, so narrow a rerun with -since/-until rather than
+// replaying the same messages twice.
+//
+//	go run ./cmd/dlq-replay -dlq orders.created.dlq -event-type OrderCreated -rate 20
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// dlqHeaders are added by sendToDLQ in the services and removed on replay.
+var dlqHeaders = map[string]bool{"x-error": true, "x-original-topic": true}
+
+type filter struct {
+	eventType    string
+	since, until time.Time
+}
+
+// match reports whether m passes the -event-type, -since and -until filters.
+func (f filter) match(m kafka.Message) bool {
+	if f.eventType != "" && header(m, "event-type") != f.eventType {
+		return false
+	}
+	if !f.since.IsZero() && m.Time.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !m.Time.Before(f.until) {
+		return false
+	}
+	return true
+}
+
+func header(m kafka.Message, key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// replayMessage builds the message to republish, or returns an error when
+// there is no destination topic.
+func replayMessage(m kafka.Message, to string) (kafka.Message, error) {
+	if to == "" {
+		to = header(m, "x-original-topic")
+	}
+	if to == "" {
+		return kafka.Message{}, fmt.Errorf("partition %d offset %d: no x-original-topic header and no -to", m.Partition, m.Offset)
+	}
+	headers := make([]kafka.Header, 0, len(m.Headers))
+	for _, h := range m.Headers {
+		if !dlqHeaders[h.Key] {
+			headers = append(headers, h)
+		}
+	}
+	return kafka.Message{Topic: to, Key: m.Key, Value: m.Value, Headers: headers}, nil
+}
+
+// messageWriter is the part of kafka.Writer replay uses.
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// replay waits for the next tick of the rate limit, then republishes out.
+func replay(ctx context.Context, w messageWriter, tick <-chan time.Time, out kafka.Message) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-tick:
+	}
+	return w.WriteMessages(ctx, out)
+}
+
+// rateInterval is the ticker period for -rate messages per second. A rate
+// above one per nanosecond would make it zero, which NewTicker rejects.
+func rateInterval(rate float64) (time.Duration, error) {
+	if !(rate > 0) || math.IsInf(rate, 1) {
+		return 0, fmt.Errorf("-rate must be a positive number, got %v", rate)
+	}
+	d := time.Duration(float64(time.Second) / rate)
+	if d <= 0 {
+		return 0, fmt.Errorf("-rate %v is above the maximum of 1e9", rate)
+	}
+	return d, nil
+}
+
+func parseTime(name, s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		log.Fatalf("invalid -%s: %v", name, err)
+	}
+	return t
+}
+
+func main() {
+	brokersFlag := flag.String("brokers", "localhost:9093", "comma-separated Kafka brokers")
+	dlq := flag.String("dlq", "", "dead-letter topic to read (required)")
+	to := flag.String("to", "", "topic to republish to (default: each message's x-original-topic)")
+	eventType := flag.String("event-type", "", "only replay messages with this event-type header")
+	since := flag.String("since", "", "only replay messages written at or after this RFC 3339 time")
+	until := flag.String("until", "", "only replay messages written before this RFC 3339 time")
+	rate := flag.Float64("rate", 10, "maximum messages republished per second")
+	dryRun := flag.Bool("dry-run", false, "list what would be replayed without writing")
+	flag.Parse()
+
+	if *dlq == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	interval, err := rateInterval(*rate)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	brokers := strings.Split(*brokersFlag, ",")
+	f := filter{eventType: *eventType, since: parseTime("since", *since), until: parseTime("until", *until)}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	conn, err := kafka.DialContext(ctx, "tcp", brokers[0])
+	if err != nil {
+		log.Fatalf("dial %s: %v", brokers[0], err)
+	}
+	partitions, err := conn.ReadPartitions(*dlq)
+	conn.Close()
+	if err != nil {
+		log.Fatalf("read partitions of %s: %v", *dlq, err)
+	}
+
+	w := &kafka.Writer{Addr: kafka.TCP(brokers...), Balancer: &kafka.Hash{}, RequiredAcks: kafka.RequireAll}
+	defer w.Close()
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	var replayed, skipped int
+	for _, p := range partitions {
+		pc, err := kafka.DialLeader(ctx, "tcp", brokers[0], *dlq, p.ID)
+		if err != nil {
+			log.Fatalf("dial leader for partition %d: %v", p.ID, err)
+		}
+		first, last, err := pc.ReadOffsets()
+		pc.Close()
+		if err != nil {
+			log.Fatalf("read offsets of partition %d: %v", p.ID, err)
+		}
+		if first >= last {
+			continue
+		}
+		r := kafka.NewReader(kafka.ReaderConfig{Brokers: brokers, Topic: *dlq, Partition: p.ID})
+		if err := r.SetOffset(first); err != nil {
+			log.Fatalf("seek partition %d: %v", p.ID, err)
+		}
+		for offset := first; offset < last; {
+			m, err := r.ReadMessage(ctx)
+			if err != nil {
+				r.Close()
+				log.Fatalf("read partition %d: %v", p.ID, err)
+			}
+			offset = m.Offset + 1
+			if !f.match(m) {
+				skipped++
+				continue
+			}
+			out, err := replayMessage(m, *to)
+			if err != nil {
+				log.Printf("skipping: %v", err)
+				skipped++
+				continue
+			}
+			if *dryRun {
+				log.Printf("would replay partition %d offset %d key %s to %s: %s", m.Partition, m.Offset, m.Key, out.Topic, header(m, "x-error"))
+				replayed++
+				continue
+			}
+			if err := replay(ctx, w, tick.C, out); err != nil {
+				r.Close()
+				if ctx.Err() != nil {
+					log.Fatalf("interrupted after %d replayed", replayed)
+				}
+				log.Fatalf("replay partition %d offset %d to %s: %v", m.Partition, m.Offset, out.Topic, err)
+			}
+			replayed++
+		}
+		r.Close()
+	}
+	log.Printf("replayed %d, skipped %d from %s", replayed, skipped, *dlq)
+}
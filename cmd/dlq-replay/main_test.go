@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type captureWriter struct {
+	written []kafka.Message
+}
+
+func (w *captureWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	w.written = append(w.written, msgs...)
+	return nil
+}
+
+// TestReplayOneMessage sends one dead-lettered order back to the topic in
+// its x-original-topic header, keeping its key and headers but not the
+// DLQ's own.
+func TestReplayOneMessage(t *testing.T) {
+	dead := kafka.Message{
+		Topic: "orders.created.dlq",
+		Key:   []byte("o-1"),
+		Value: []byte(`{"orderId":"o-1"}`),
+		Headers: []kafka.Header{
+			{Key: "event-type", Value: []byte("OrderCreated")},
+			{Key: "x-error", Value: []byte("schema: missing items")},
+			{Key: "x-original-topic", Value: []byte("orders.created")},
+		},
+	}
+	out, err := replayMessage(dead, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tick := make(chan time.Time, 1)
+	tick <- time.Now()
+	w := &captureWriter{}
+	if err := replay(context.Background(), w, tick, out); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(w.written) != 1 {
+		t.Fatalf("wrote %d messages, want 1", len(w.written))
+	}
+	got := w.written[0]
+	if got.Topic != "orders.created" || string(got.Key) != "o-1" || string(got.Value) != string(dead.Value) {
+		t.Fatalf("replayed %s key %s: %s", got.Topic, got.Key, got.Value)
+	}
+	if len(got.Headers) != 1 || header(got, "event-type") != "OrderCreated" {
+		t.Fatalf("headers %v, want only event-type", got.Headers)
+	}
+}
+
+func TestReplayWithoutDestination(t *testing.T) {
+	if _, err := replayMessage(kafka.Message{Key: []byte("o-1")}, ""); err == nil {
+		t.Fatal("want an error without x-original-topic or -to")
+	}
+	out, err := replayMessage(kafka.Message{Key: []byte("o-1")}, "orders.created")
+	if err != nil || out.Topic != "orders.created" {
+		t.Fatalf("-to: %v, %v", out.Topic, err)
+	}
+}
+
+func TestRateInterval(t *testing.T) {
+	if d, err := rateInterval(20); err != nil || d != 50*time.Millisecond {
+		t.Fatalf("rate 20: %v, %v", d, err)
+	}
+	for _, rate := range []float64{0, -1, 2e9, math.NaN(), math.Inf(1)} {
+		if d, err := rateInterval(rate); err == nil {
+			t.Errorf("rate %v accepted as %v", rate, d)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+module kafka-microservice/cmd/smoketest
+
+go 1.21
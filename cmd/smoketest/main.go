@@ -0,0 +1,260 @@
+// Command smoketest drives one order through a running stack: it creates
+// the order via orders-api, follows it on notifications-api's SSE stream
+// until PAID, and checks stock-service decremented inventory. It exits
+// non-zero on the first failed step. On the way out it seeds the ordered
+// SKUs back to the quantities it found (a SKU that did not exist is left at
+// zero, since stock-service has no delete).
+//
+//	go run ./cmd/smoketest -items S1:2,S2:1
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OrderItem, CreateOrderRequest and OrderStatus mirror the payloads of
+// orders-api and notifications-api; the services are separate main
+// packages, so their types cannot be imported.
+type OrderItem struct {
+	SKU string `json:"sku"`
+	Qty int    `json:"qty"`
+}
+
+type CreateOrderRequest struct {
+	UserID   string      `json:"userId"`
+	Items    []OrderItem `json:"items"`
+	Total    json.Number `json:"total"`
+	Currency string      `json:"currency"`
+}
+
+type OrderStatus struct {
+	OrderID string `json:"orderId"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+func main() {
+	ordersURL := flag.String("orders-api", "http://localhost:8081", "orders-api base URL")
+	notifyURL := flag.String("notifications-api", "http://localhost:8083", "notifications-api base URL")
+	stockURL := flag.String("stock-service", "http://localhost:8084", "stock-service base URL")
+	itemsFlag := flag.String("items", "S1:1", "comma-separated sku:qty pairs to order")
+	userID := flag.String("user", "smoketest", "user id placed on the order")
+	total := flag.String("total", "12.50", "order total")
+	currency := flag.String("currency", "USD", "order currency")
+	timeout := flag.Duration("timeout", 30*time.Second, "time allowed for the whole run")
+	flag.Parse()
+
+	items, err := parseItems(*itemsFlag)
+	if err != nil {
+		log.Fatalf("invalid -items: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	if err := run(ctx, *ordersURL, *notifyURL, *stockURL, CreateOrderRequest{
+		UserID: *userID, Items: items, Total: json.Number(*total), Currency: *currency,
+	}); err != nil {
+		log.Printf("FAIL: %v", err)
+		os.Exit(1)
+	}
+	log.Println("PASS")
+}
+
+// parseItems turns "S1:2,S2:1" into order items, summing repeated SKUs.
+func parseItems(s string) ([]OrderItem, error) {
+	var items []OrderItem
+	index := map[string]int{}
+	for _, pair := range strings.Split(s, ",") {
+		sku, qtyStr, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		qty, err := strconv.Atoi(qtyStr)
+		if !ok || sku == "" || err != nil || qty < 1 {
+			return nil, fmt.Errorf("%q is not sku:qty with qty >= 1", pair)
+		}
+		if i, seen := index[sku]; seen {
+			items[i].Qty += qty
+			continue
+		}
+		index[sku] = len(items)
+		items = append(items, OrderItem{SKU: sku, Qty: qty})
+	}
+	return items, nil
+}
+
+func run(ctx context.Context, ordersURL, notifyURL, stockURL string, req CreateOrderRequest) error {
+	before, err := getStock(ctx, stockURL)
+	if err != nil {
+		return fmt.Errorf("read stock: %w", err)
+	}
+
+	// top up any SKU that could not cover the order, then put every
+	// quantity back as it was once the run is over
+	restore := map[string]int{}
+	topUp := map[string]int{}
+	for _, it := range req.Items {
+		restore[it.SKU] = before[it.SKU]
+		if before[it.SKU] < it.Qty {
+			topUp[it.SKU] = it.Qty
+			before[it.SKU] = it.Qty
+		}
+	}
+	defer func() {
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := postJSON(cleanupCtx, stockURL+"/seed", restore, nil); err != nil {
+			log.Printf("cleanup: restoring stock failed: %v", err)
+			return
+		}
+		log.Printf("cleanup: restored stock %v", restore)
+	}()
+	if len(topUp) > 0 {
+		if err := postJSON(ctx, stockURL+"/seed", topUp, nil); err != nil {
+			return fmt.Errorf("top up stock: %w", err)
+		}
+	}
+
+	var created struct {
+		OrderID    string `json:"orderId"`
+		OrderToken string `json:"orderToken"`
+	}
+	if err := postJSON(ctx, ordersURL+"/orders", req, &created); err != nil {
+		return fmt.Errorf("create order: %w", err)
+	}
+	log.Printf("created order %s", created.OrderID)
+
+	if err := waitForStatus(ctx, notifyURL, created.OrderID, created.OrderToken, "PAID"); err != nil {
+		return err
+	}
+	log.Printf("order %s is PAID", created.OrderID)
+
+	want := map[string]int{}
+	for _, it := range req.Items {
+		want[it.SKU] = before[it.SKU] - it.Qty
+	}
+	return waitForStock(ctx, stockURL, want)
+}
+
+// waitForStatus follows the order's SSE stream, with replay so a status
+// published before the subscription is not missed, until want arrives.
+// A terminal status other than want fails the run.
+func waitForStatus(ctx context.Context, notifyURL, orderID, token, want string) error {
+	q := url.Values{"orderId": {orderID}, "replay": {"true"}}
+	if token != "" {
+		q.Set("token", token)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, notifyURL+"/events?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("subscribe: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("subscribe: notifications-api returned %d", resp.StatusCode)
+	}
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var s OrderStatus
+		if err := json.Unmarshal([]byte(data), &s); err != nil {
+			return fmt.Errorf("bad status event %q: %w", data, err)
+		}
+		log.Printf("order %s status %s", s.OrderID, s.Status)
+		switch s.Status {
+		case want:
+			return nil
+		case "FAILED", "CANCELLED", "EXPIRED":
+			return fmt.Errorf("order reached %s (%s) instead of %s", s.Status, s.Reason, want)
+		}
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("no %s status before timeout", want)
+	}
+	return fmt.Errorf("status stream ended before %s: %v", want, sc.Err())
+}
+
+// waitForStock polls stock-service until every SKU in want has that quantity.
+func waitForStock(ctx context.Context, stockURL string, want map[string]int) error {
+	t := time.NewTicker(500 * time.Millisecond)
+	defer t.Stop()
+	for {
+		got, err := getStock(ctx, stockURL)
+		if err == nil {
+			done := true
+			for sku, qty := range want {
+				if got[sku] != qty {
+					done = false
+				}
+			}
+			if done {
+				log.Printf("stock decremented: %v", want)
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stock did not reach %v before timeout (last read %v, err %v)", want, got, err)
+		case <-t.C:
+		}
+	}
+}
+
+func getStock(ctx context.Context, stockURL string) (map[string]int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, stockURL+"/stock", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("stock-service returned %d", resp.StatusCode)
+	}
+	stock := map[string]int{}
+	return stock, json.NewDecoder(resp.Body).Decode(&stock)
+}
+
+// postJSON sends body and, when out is non-nil, decodes the response into it.
+func postJSON(ctx context.Context, u string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %d: %s", u, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
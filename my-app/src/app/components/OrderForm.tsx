@@ -10,7 +10,7 @@ interface OrderItem {
 }
 
 interface OrderFormProps {
-  onOrderCreated: (orderId: string) => void;
+  onOrderCreated: (orderId: string, orderToken?: string) => void;
 }
 
 // Product catalog with prices
@@ -77,8 +77,8 @@ export default function OrderForm({ onOrderCreated }: OrderFormProps) {
         currency,
       });
 
-      const { orderId } = response.data;
-      onOrderCreated(orderId);
+      const { orderId, orderToken } = response.data;
+      onOrderCreated(orderId, orderToken);
       
       // Reset form after successful order
       setItems([{ sku: 'S1', qty: 1, price: PRODUCTS.S1.price }]);
@@ -86,10 +86,11 @@ export default function OrderForm({ onOrderCreated }: OrderFormProps) {
     } catch (err) {
       if (axios.isAxiosError(err) && err.response) {
         // Handle stock validation errors specifically
-        if (err.response.status === 409) {
-          setError(`Stock Error: ${err.response.data.error}`);
+        const { code, message } = err.response.data ?? {};
+        if (code === 'INSUFFICIENT_STOCK' || code === 'UNKNOWN_SKU') {
+          setError(`Stock Error: ${message}`);
         } else {
-          setError(err.response.data.error || 'Failed to create order');
+          setError(message || 'Failed to create order');
         }
       } else {
         setError(err instanceof Error ? err.message : 'Failed to create order');
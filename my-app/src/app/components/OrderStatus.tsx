@@ -11,9 +11,11 @@ interface OrderStatus {
 
 interface OrderStatusProps {
   orderId: string | null;
+  // Signed by orders-api; required when ORDER_TOKEN_SECRET is set
+  orderToken?: string | null;
 }
 
-export default function OrderStatus({ orderId }: OrderStatusProps) {
+export default function OrderStatus({ orderId, orderToken }: OrderStatusProps) {
   const [statuses, setStatuses] = useState<OrderStatus[]>([]);
   const [error, setError] = useState<string | null>(null);
   const [connected, setConnected] = useState(false);
@@ -26,8 +28,9 @@ export default function OrderStatus({ orderId }: OrderStatusProps) {
       eventSourceRef.current.close();
     }
 
+    const tokenParam = orderToken ? `&token=${encodeURIComponent(orderToken)}` : '';
     const eventSource = new EventSource(
-      `http://localhost:8083/events?orderId=${orderIdToConnect}`
+      `http://localhost:8083/events?orderId=${orderIdToConnect}${tokenParam}`
     );
 
     eventSource.onopen = () => {
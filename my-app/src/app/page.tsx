@@ -8,6 +8,7 @@ import EventStreamViewer from './components/EventStreamViewer';
 
 export default function Home() {
   const [currentOrderId, setCurrentOrderId] = useState<string | null>(null);
+  const [currentOrderToken, setCurrentOrderToken] = useState<string | null>(null);
   const [activeTab, setActiveTab] = useState<'orders' | 'stock'>('orders');
 
   return (
@@ -50,11 +51,16 @@ export default function Home() {
             <div className="grid grid-cols-1 xl:grid-cols-2 gap-8">
               <div>
                               <h2 className="text-2xl font-semibold mb-6 text-gray-900">Create Order</h2>
-              <OrderForm onOrderCreated={setCurrentOrderId} />
+              <OrderForm
+                onOrderCreated={(orderId, orderToken) => {
+                  setCurrentOrderToken(orderToken ?? null);
+                  setCurrentOrderId(orderId);
+                }}
+              />
             </div>
             <div>
               <h2 className="text-2xl font-semibold mb-6 text-gray-900">Order Status</h2>
-              <OrderStatus orderId={currentOrderId} />
+              <OrderStatus orderId={currentOrderId} orderToken={currentOrderToken} />
             </div>
           </div>
           <div>
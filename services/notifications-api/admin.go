@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// requireAdmin guards an admin handler with the bearer token in ADMIN_TOKEN.
+// Admin endpoints are disabled entirely while ADMIN_TOKEN is unset.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	token := getenv("ADMIN_TOKEN", "")
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			w.WriteHeader(http.StatusForbidden)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "admin endpoints disabled: ADMIN_TOKEN not set"})
+			return
+		}
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid admin token"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// SubscriptionStats counts open /events subscribers.
+type SubscriptionStats struct {
+	Total  int            `json:"total"`
+	Max    int64          `json:"max"`
+	Orders map[string]int `json:"orders"`
+}
+
+func subscriptionStats() SubscriptionStats {
+	mu.RLock()
+	defer mu.RUnlock()
+	stats := SubscriptionStats{Max: maxSSEConnections, Orders: make(map[string]int, len(subs))}
+	for orderID, set := range subs {
+		if len(set) == 0 {
+			continue
+		}
+		stats.Orders[orderID] = len(set)
+		stats.Total += len(set)
+	}
+	return stats
+}
+
+// handleSubscriptions serves GET /admin/subscriptions.
+func handleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(subscriptionStats())
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSubscriptionsCountsClientsPerOrder(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+	for i := 0; i < 2; i++ {
+		ch, err := subscribe("o-subs", nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { unsubscribe("o-subs", ch) })
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/subscriptions", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	requireAdmin(handleSubscriptions)(rec, req)
+	var stats SubscriptionStats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatalf("status %d: %v", rec.Code, err)
+	}
+	if stats.Orders["o-subs"] != 2 || stats.Total != 2 {
+		t.Fatalf("stats %+v, want 2 subscribers on o-subs", stats)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// commitInterval maps COMMIT_INTERVAL onto ReaderConfig.CommitInterval. The
+// consumer commits each message with CommitMessages only after handling it.
+// With the default of 0 that commit is synchronous: it returns once the
+// broker has stored the offset, so a crash replays at most the message in
+// hand, at the cost of a broker round trip per message. A positive interval
+// makes CommitMessages return at once and flushes the latest offsets in the
+// background every interval, which is much faster but replays up to an
+// interval's worth of messages after a crash.
+func commitInterval() time.Duration {
+	v := getenv("COMMIT_INTERVAL", "0")
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		slog.Warn("invalid COMMIT_INTERVAL, committing synchronously", "value", v)
+		return 0
+	}
+	return d
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestSubscribeBroadcastConcurrently races subscribers coming and going
+// against statuses being delivered to the same order; run it with -race.
+func TestSubscribeBroadcastConcurrently(t *testing.T) {
+	const orderID = "o-race"
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				ch, err := subscribe(orderID, nil, false)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				unsubscribe(orderID, ch)
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				_ = sseNotifier{}.Notify(OrderStatus{OrderID: orderID, Status: "PAID"}, []byte(fmt.Sprint(i, j)))
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := subscriptionStats().Orders[orderID]; n != 0 {
+		t.Fatalf("%d subscribers left behind", n)
+	}
+}
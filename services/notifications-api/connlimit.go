@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxSSEConnections caps open /events subscriptions across all orders
+// (MAX_SSE_CONNECTIONS, default 10000). At the cap a new subscription is
+// refused, or with EVICT_ON_FULL=true makes room by closing the connection
+// that has gone longest without a status.
+var (
+	maxSSEConnections = func() int64 {
+		n, err := strconv.ParseInt(getenv("MAX_SSE_CONNECTIONS", "10000"), 10, 64)
+		if err != nil || n <= 0 {
+			return 10000
+		}
+		return n
+	}()
+	evictOnFull = getenv("EVICT_ON_FULL", "false") == "true"
+)
+
+var errTooManyConnections = errors.New("too many open connections")
+
+// connections counts open subscriptions. It only changes under mu but is
+// read without it.
+var connections int64
+
+// maxHeld caps the statuses held back for one subscriber during a replay.
+const maxHeld = 1024
+
+// subscriber is the bookkeeping kept per open subscription.
+type subscriber struct {
+	lastActive int64 // unix nanos of the subscribe or the last status sent
+	statuses   statusFilter
+
+	// while replaying, statuses that do not fit the channel wait in held
+	// rather than being dropped; see offer
+	mu        sync.Mutex
+	replaying bool
+	held      [][]byte
+}
+
+func newSubscriber(statuses statusFilter, replaying bool) *subscriber {
+	return &subscriber{lastActive: time.Now().UnixNano(), statuses: statuses, replaying: replaying}
+}
+
+func (s *subscriber) touch() { atomic.StoreInt64(&s.lastActive, time.Now().UnixNano()) }
+
+// offer hands payload to ch without blocking and reports whether it was
+// taken. During a replay the stream is not reading ch, so once ch is full
+// payloads queue in held, up to maxHeld, and keep queuing there until
+// endReplay so their order is kept.
+func (s *subscriber) offer(ch chan []byte, payload []byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.replaying && (len(s.held) > 0 || len(ch) == cap(ch)) {
+		if len(s.held) >= maxHeld {
+			return false
+		}
+		s.held = append(s.held, payload)
+		return true
+	}
+	select {
+	case ch <- payload:
+		return true
+	default:
+		return false
+	}
+}
+
+// endReplay stops holding statuses back. It returns how many statuses are
+// queued in ch ahead of the held ones, which come next and precede anything
+// offered from now on.
+func (s *subscriber) endReplay(ch chan []byte) (queued int, held [][]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queued, held = len(ch), s.held
+	s.replaying, s.held = false, nil
+	return queued, held
+}
+
+// evictIdleLocked closes the subscription idle the longest, ending its
+// stream, and reports whether there was one. Callers must hold mu.
+func evictIdleLocked() bool {
+	var (
+		victimOrder string
+		victim      chan []byte
+		oldest      int64
+	)
+	for orderID, set := range subs {
+		for ch, sub := range set {
+			if t := atomic.LoadInt64(&sub.lastActive); victim == nil || t < oldest {
+				victimOrder, victim, oldest = orderID, ch, t
+			}
+		}
+	}
+	if victim == nil {
+		return false
+	}
+	removeLocked(victimOrder, victim, "evicted")
+	return true
+}
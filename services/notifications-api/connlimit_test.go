@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func withConnectionCap(t *testing.T, max int64, evict bool) {
+	t.Helper()
+	prevMax, prevEvict := maxSSEConnections, evictOnFull
+	maxSSEConnections, evictOnFull = max, evict
+	t.Cleanup(func() { maxSSEConnections, evictOnFull = prevMax, prevEvict })
+}
+
+// TestConnectionCapEnforced fills every slot and expects the next subscribe,
+// and the /events request behind it, to be refused until one closes.
+func TestConnectionCapEnforced(t *testing.T) {
+	withConnectionCap(t, 3, false)
+	var open []chan []byte
+	for i := 0; i < 3; i++ {
+		ch, err := subscribe("o-cap", nil, false)
+		if err != nil {
+			t.Fatalf("subscription %d: %v", i, err)
+		}
+		open = append(open, ch)
+	}
+	defer func() {
+		for _, ch := range open {
+			unsubscribe("o-cap", ch)
+		}
+	}()
+	if _, err := subscribe("o-other", nil, false); !errors.Is(err, errTooManyConnections) {
+		t.Fatalf("subscribe at the cap: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	eventsHandler(nil, "", nil, time.Second, time.Second)(rec, httptest.NewRequest(http.MethodGet, "/events?orderId=o-other", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("/events at the cap: %d, want 503", rec.Code)
+	}
+
+	unsubscribe("o-cap", open[0])
+	open = open[1:]
+	ch, err := subscribe("o-other", nil, false)
+	if err != nil {
+		t.Fatalf("subscribe after one closed: %v", err)
+	}
+	unsubscribe("o-other", ch)
+}
+
+func TestEvictOnFullClosesIdlest(t *testing.T) {
+	withConnectionCap(t, 2, true)
+	idle, err := subscribe("o-idle", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	busy, err := subscribe("o-busy", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe("o-busy", busy)
+	mu.RLock()
+	atomic.StoreInt64(&subs["o-idle"][idle].lastActive, 1)
+	mu.RUnlock()
+
+	ch, err := subscribe("o-new", nil, false)
+	if err != nil {
+		t.Fatalf("subscribe with eviction: %v", err)
+	}
+	defer unsubscribe("o-new", ch)
+	if _, ok := <-idle; ok {
+		t.Fatal("idle subscription still open")
+	}
+	if n := atomic.LoadInt64(&connections); n != 2 {
+		t.Fatalf("%d connections, want 2", n)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// messageSource is the part of *kafka.Reader the consumer loop uses.
+type messageSource interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// maxFetchFailures is how many fetches in a row may fail before the loop
+// gives up, so the supervisor drops readiness and starts a fresh reader.
+// With the read backoff in between that is about 3s of failing reads.
+var maxFetchFailures = 6
+
+// consumeLoop hands each message of src to handle and commits it, until ctx
+// ends or maxFetchFailures fetches in a row fail. Only the latter returns an
+// error.
+func consumeLoop(ctx context.Context, src messageSource, poison *poisonHandler, handle func(kafka.Message)) error {
+	var backoff readBackoff
+	failures := 0
+	for {
+		if poison.wait(ctx) != nil {
+			slog.Info("context cancelled, stopping kafka consumer")
+			return nil
+		}
+		m, err := fetchBounded(ctx, src.FetchMessage)
+		if errors.Is(err, errReadIdle) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				slog.Info("context cancelled, stopping kafka consumer")
+				return nil
+			}
+			if failures++; failures >= maxFetchFailures {
+				return fmt.Errorf("%d fetches in a row failed: %w", failures, err)
+			}
+			if backoff.failed(ctx, err) != nil {
+				slog.Info("context cancelled, stopping kafka consumer")
+				return nil
+			}
+			continue
+		}
+		failures = 0
+		backoff.reset()
+		handle(m)
+		// commit only once the status has been handed to the notifiers;
+		// see commitInterval
+		if err := src.CommitMessages(ctx, m); err != nil && ctx.Err() == nil {
+			slog.Warn("commit failed", "error", err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+)
+
+// recentSet is a fixed-capacity set of keys that evicts the oldest entry once
+// full. It is used to drop statuses redelivered after a consumer rebalance.
+type recentSet struct {
+	mu   sync.Mutex
+	seen map[string]struct{}
+	ring []string
+	next int
+}
+
+func newRecentSet(capacity int) *recentSet {
+	return &recentSet{seen: make(map[string]struct{}, capacity), ring: make([]string, capacity)}
+}
+
+// add records key and reports whether it was new.
+func (s *recentSet) add(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.seen[key]; ok {
+		return false
+	}
+	if old := s.ring[s.next]; old != "" {
+		delete(s.seen, old)
+	}
+	s.ring[s.next] = key
+	s.next = (s.next + 1) % len(s.ring)
+	s.seen[key] = struct{}{}
+	return true
+}
+
+func dedupCapacity() int {
+	n, err := strconv.Atoi(getenv("DEDUP_CAPACITY", "10000"))
+	if err != nil || n < 1 {
+		return 10000
+	}
+	return n
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// TestBroadcastDropsRepeatedEventID feeds the two copies an ack-lost retry
+// leaves on the topic; subscribers must see the status once.
+func TestBroadcastDropsRepeatedEventID(t *testing.T) {
+	capture := &captureNotifier{}
+	prev := notifiers
+	notifiers = []Notifier{capture}
+	t.Cleanup(func() { notifiers = prev })
+
+	body := []byte(`{"orderId":"o-acklost","status":"PENDING","updatedAt":"t"}`)
+	for i := 0; i < 2; i++ {
+		m := kafka.Message{Key: []byte("o-acklost"), Headers: []kafka.Header{{Key: headerEventID, Value: []byte("evt-acklost")}}}
+		if err := broadcast(m, body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(capture.payloads) != 1 {
+		t.Fatalf("notified %d times, want 1", len(capture.payloads))
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// withFetchTuning applies FETCH_MIN_BYTES (1), FETCH_MAX_BYTES (10MB) and
+// MAX_WAIT (10s) to cfg.
+func withFetchTuning(cfg kafka.ReaderConfig) kafka.ReaderConfig {
+	cfg.MinBytes, cfg.MaxBytes, cfg.MaxWait = 1, 10e6, 10*time.Second
+	if n, err := strconv.Atoi(getenv("FETCH_MIN_BYTES", "1")); err == nil && n > 0 {
+		cfg.MinBytes = n
+	} else {
+		slog.Warn("invalid FETCH_MIN_BYTES, using the default", "default", cfg.MinBytes)
+	}
+	if n, err := strconv.Atoi(getenv("FETCH_MAX_BYTES", "10000000")); err == nil && n > 0 {
+		cfg.MaxBytes = n
+	} else {
+		slog.Warn("invalid FETCH_MAX_BYTES, using the default", "default", cfg.MaxBytes)
+	}
+	if d, err := time.ParseDuration(getenv("MAX_WAIT", "10s")); err == nil && d > 0 {
+		cfg.MaxWait = d
+	} else {
+		slog.Warn("invalid MAX_WAIT, using the default", "default", cfg.MaxWait)
+	}
+	if cfg.MinBytes > cfg.MaxBytes {
+		slog.Warn("FETCH_MIN_BYTES exceeds FETCH_MAX_BYTES, using FETCH_MAX_BYTES for both", "min", cfg.MinBytes, "max", cfg.MaxBytes)
+		cfg.MinBytes = cfg.MaxBytes
+	}
+	return cfg
+}
+
+// readTimeout bounds each fetch (READ_TIMEOUT, default 0 for no bound).
+var readTimeout = func() time.Duration {
+	d, err := time.ParseDuration(getenv("READ_TIMEOUT", "0"))
+	if err != nil || d < 0 {
+		slog.Warn("invalid READ_TIMEOUT, reads are unbounded")
+		return 0
+	}
+	return d
+}()
+
+// errReadIdle reports an idle READ_TIMEOUT; callers loop without backing off.
+var errReadIdle = errors.New("no message within READ_TIMEOUT")
+
+// fetchBounded calls fetch under READ_TIMEOUT, returning errReadIdle if that
+// expires while ctx itself is still live.
+func fetchBounded(ctx context.Context, fetch func(context.Context) (kafka.Message, error)) (kafka.Message, error) {
+	if readTimeout <= 0 {
+		return fetch(ctx)
+	}
+	readCtx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+	m, err := fetch(readCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(readCtx.Err(), context.DeadlineExceeded) {
+		return m, errReadIdle
+	}
+	return m, err
+}
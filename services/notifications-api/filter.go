@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// statusFilter is the set of statuses a subscriber asked for with
+// ?statuses=PAID,FAILED. A nil filter lets every status through.
+type statusFilter map[string]bool
+
+// parseStatusFilter reads a comma-separated status list. Names are matched
+// case-insensitively; an empty list yields nil, meaning all statuses.
+func parseStatusFilter(raw string) statusFilter {
+	var f statusFilter
+	for _, s := range strings.Split(raw, ",") {
+		if s = strings.ToUpper(strings.TrimSpace(s)); s == "" {
+			continue
+		}
+		if f == nil {
+			f = statusFilter{}
+		}
+		f[s] = true
+	}
+	return f
+}
+
+func (f statusFilter) allows(status string) bool {
+	return f == nil || f[status]
+}
+
+// allowsPayload is allows for an encoded OrderStatus, as buffered and
+// replayed statuses are held.
+func (f statusFilter) allowsPayload(payload []byte) bool {
+	if f == nil {
+		return true
+	}
+	var s OrderStatus
+	_ = json.Unmarshal(payload, &s)
+	return f[s.Status]
+}
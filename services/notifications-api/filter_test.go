@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestStatusFilterDelivery subscribes with ?statuses=paid, failed and
+// expects only the matching statuses of an order's lifecycle.
+func TestStatusFilterDelivery(t *testing.T) {
+	filtered, err := subscribe("o-filter", parseStatusFilter("paid, failed"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe("o-filter", filtered)
+	all, err := subscribe("o-filter", parseStatusFilter(""), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe("o-filter", all)
+
+	for _, status := range []string{"PENDING", "PAID", "SHIPPED"} {
+		s := OrderStatus{OrderID: "o-filter", Status: status}
+		payload, _ := json.Marshal(s)
+		if err := (sseNotifier{}).Notify(s, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := func(ch chan []byte) []string {
+		var out []string
+		for len(ch) > 0 {
+			var s OrderStatus
+			_ = json.Unmarshal(<-ch, &s)
+			out = append(out, s.Status)
+		}
+		return out
+	}
+	if g := got(filtered); len(g) != 1 || g[0] != "PAID" {
+		t.Fatalf("filtered subscriber got %v, want [PAID]", g)
+	}
+	if g := got(all); len(g) != 3 {
+		t.Fatalf("unfiltered subscriber got %v, want all three", g)
+	}
+}
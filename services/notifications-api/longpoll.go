@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// wantsLongPoll reports whether the client asked for JSON rather than an
+// event stream, as polling clients behind proxies that block SSE do.
+func wantsLongPoll(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/event-stream")
+}
+
+// longPoll answers /events for a polling client: it waits up to timeout for
+// the next status of orderID and returns it as a single JSON object, or 204
+// if none arrives. A status buffered while nobody was subscribed is returned
+// straight away; when several are buffered only the latest is, since a poller
+// only needs the current state. Only statuses allows are considered.
+func longPoll(w http.ResponseWriter, r *http.Request, orderID string, statuses statusFilter, timeout time.Duration) {
+	ch, err := subscribe(orderID, statuses, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer unsubscribe(orderID, ch)
+
+	w.Header().Set("Cache-Control", "no-cache")
+	var latest []byte
+	for _, msg := range undelivered.take(orderID) {
+		if statuses.allowsPayload(msg) {
+			latest = msg
+		}
+	}
+	if latest != nil {
+		writeStatus(w, latest)
+		return
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			// shutting down; let the client poll again
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeStatus(w, msg)
+	case <-timer.C:
+		w.WriteHeader(http.StatusNoContent)
+	case <-r.Context().Done():
+	}
+}
+
+func writeStatus(w http.ResponseWriter, status []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(status)
+}
@@ -4,8 +4,9 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -15,7 +16,12 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/segmentio/kafka-go"
+
+	"kafka-microservice/services/notifications-api/codec"
+	"kafka-microservice/services/notifications-api/logging"
+	"kafka-microservice/services/notifications-api/schema"
 )
 
 type OrderStatus struct {
@@ -23,6 +29,30 @@ type OrderStatus struct {
 	Status    string `json:"status"`
 	Reason    string `json:"reason,omitempty"`
 	UpdatedAt string `json:"updatedAt"`
+	// CorrelationID groups the events of one order; it reaches SSE clients
+	// as part of every frame
+	CorrelationID string `json:"correlationId,omitempty"`
+}
+
+// key identifies one delivery of a status for deduplication.
+func (s OrderStatus) key() string {
+	return s.OrderID + "|" + s.Status + "|" + s.UpdatedAt
+}
+
+func statusKey(payload []byte) string {
+	var s OrderStatus
+	_ = json.Unmarshal(payload, &s)
+	return s.key()
+}
+
+// flushEvents pushes the frames buffered in bw to the client. bufio keeps the
+// first write error, so a failed Fprintf surfaces here too, and rc reports a
+// connection that failed on the flush itself.
+func flushEvents(bw *bufio.Writer, rc *http.ResponseController) error {
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return rc.Flush()
 }
 
 func getenv(key, def string) string {
@@ -33,139 +63,347 @@ func getenv(key, def string) string {
 }
 
 func newReader(brokers []string, topic, group string) *kafka.Reader {
-	return kafka.NewReader(kafka.ReaderConfig{
+	return kafka.NewReader(withGroupTuning(withFetchTuning(withReaderLogging(kafka.ReaderConfig{
 		Brokers:     brokers,
 		GroupID:     group,
 		Topic:       topic,
-		MinBytes:    1,
-		MaxBytes:    10e6,
-		StartOffset: kafka.LastOffset,
-	})
+		StartOffset: startOffset(),
+
+		CommitInterval: commitInterval(),
+
+		GroupBalancers: groupBalancers(),
+	}))))
+}
+
+// startOffset maps START_OFFSET (first|last, default last) onto where a new
+// consumer group begins reading. Groups with committed offsets resume from
+// those regardless of this setting.
+func startOffset() int64 {
+	switch v := getenv("START_OFFSET", "last"); v {
+	case "first":
+		slog.Info("new consumer groups start from the first offset")
+		return kafka.FirstOffset
+	case "last":
+		slog.Info("new consumer groups start from the last offset")
+		return kafka.LastOffset
+	default:
+		slog.Warn("unknown START_OFFSET, using last", "value", v)
+		return kafka.LastOffset
+	}
+}
+
+// groupBalancers maps GROUP_BALANCER onto the partition assignment strategy.
+// Unset keeps kafka-go's default (range, then round-robin); rackaware prefers
+// partitions whose leader shares this consumer's RACK_ID.
+func groupBalancers() []kafka.GroupBalancer {
+	switch v := getenv("GROUP_BALANCER", ""); v {
+	case "":
+		return nil
+	case "range":
+		return []kafka.GroupBalancer{kafka.RangeGroupBalancer{}}
+	case "roundrobin":
+		return []kafka.GroupBalancer{kafka.RoundRobinGroupBalancer{}}
+	case "rackaware":
+		return []kafka.GroupBalancer{kafka.RackAffinityGroupBalancer{Rack: getenv("RACK_ID", "")}}
+	default:
+		slog.Warn("unknown GROUP_BALANCER, using default", "value", v)
+		return nil
+	}
 }
 
 var (
-	mu         sync.RWMutex
-	subs       = map[string][]chan []byte{}
-	kafkaReady int64 // 0 = not ready, 1 = ready
+	mu          sync.RWMutex
+	subs        = map[string]map[chan []byte]*subscriber{} // orderId -> subscriber set
+	kafkaReady  int64                                      // 0 = not ready, 1 = ready
+	lastMessage int64                                      // unix nanos of the last message read
+	lastPoll    int64                                      // unix nanos of the last fetch the reader completed, even an empty one
+	delivered   = newRecentSet(dedupCapacity())
+	closing     bool // set under mu once shutdown has closed every subscriber
+	notifiers   []Notifier
+	undelivered *undeliveredBuffer // nil unless BUFFER_UNDELIVERED=true
 )
 
-func subscribe(orderID string) chan []byte {
+var errShuttingDown = errors.New("shutting down")
+
+// consumerLiveness reports whether the consumer has shown signs of life within
+// window. A quiet topic still produces fetches, so only a consumer that has
+// stopped polling altogether goes stale. The returned reason tells a dead
+// consumer apart from an unreachable broker.
+func consumerLiveness(brokers []string, window time.Duration) (bool, string) {
+	now := time.Now()
+	if now.Sub(time.Unix(0, atomic.LoadInt64(&lastMessage))) < window ||
+		now.Sub(time.Unix(0, atomic.LoadInt64(&lastPoll))) < window {
+		return true, ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	conn, err := dialAny(ctx, brokers)
+	if err != nil {
+		return false, "broker unreachable: " + err.Error()
+	}
+	conn.Close()
+	return false, "consumer stalled: broker reachable but no fetch within " + window.String()
+}
+
+// subscribe opens a subscription to orderID's statuses, limited to those
+// statuses allows. With replaying set, live statuses are held back rather
+// than dropped until endReplay.
+func subscribe(orderID string, statuses statusFilter, replaying bool) (chan []byte, error) {
 	ch := make(chan []byte, 8)
 	mu.Lock()
-	subs[orderID] = append(subs[orderID], ch)
-	mu.Unlock()
-	return ch
+	defer mu.Unlock()
+	if closing {
+		return nil, errShuttingDown
+	}
+	if atomic.LoadInt64(&connections) >= maxSSEConnections && !(evictOnFull && evictIdleLocked()) {
+		return nil, errTooManyConnections
+	}
+	if subs[orderID] == nil {
+		subs[orderID] = map[chan []byte]*subscriber{}
+	}
+	subs[orderID][ch] = newSubscriber(statuses, replaying)
+	atomic.AddInt64(&connections, 1)
+	sseConnectionsOpened.Inc()
+	return ch, nil
+}
+
+// endReplay ends the replay phase of the subscription ch; see
+// subscriber.endReplay.
+func endReplay(orderID string, ch chan []byte) (int, [][]byte) {
+	mu.RLock()
+	sub, ok := subs[orderID][ch]
+	mu.RUnlock()
+	if !ok {
+		return 0, nil
+	}
+	return sub.endReplay(ch)
 }
 
 func unsubscribe(orderID string, ch chan []byte) {
 	mu.Lock()
-	arr := subs[orderID]
-	for i := range arr {
-		if arr[i] == ch {
-			arr = append(arr[:i], arr[i+1:]...)
-			break
-		}
+	defer mu.Unlock()
+	removeLocked(orderID, ch, "client")
+}
+
+// removeLocked drops and closes one subscription, counting it as closed for
+// reason. Callers must hold mu.
+func removeLocked(orderID string, ch chan []byte, reason string) {
+	set := subs[orderID]
+	if _, ok := set[ch]; !ok {
+		// shutdown or eviction may have closed and dropped this one already
+		return
+	}
+	delete(set, ch)
+	if len(set) == 0 {
+		delete(subs, orderID)
 	}
-	subs[orderID] = arr
-	mu.Unlock()
 	close(ch)
+	atomic.AddInt64(&connections, -1)
+	sseConnectionsClosed.WithLabelValues(reason).Inc()
+}
+
+// closeAllSubscribers ends every open /events stream and rejects new
+// subscriptions, so SSE handlers return before the HTTP server shuts down.
+func closeAllSubscribers() {
+	mu.Lock()
+	defer mu.Unlock()
+	closing = true
+	for orderID, set := range subs {
+		for ch := range set {
+			close(ch)
+			sseConnectionsClosed.WithLabelValues("shutdown").Inc()
+		}
+		delete(subs, orderID)
+	}
+	atomic.StoreInt64(&connections, 0)
 }
 
-func broadcast(status []byte) {
+// broadcast hands status, the decoded body of m, to every notifier with its
+// private fields stripped; see publicStatus. m's event-id header is the
+// deduplication key; messages without one are deduplicated by content. A
+// correlation id carried only in m's headers is added to the body so SSE
+// frames always show it.
+func broadcast(m kafka.Message, status []byte) error {
+	status, err := publicStatus(status)
+	if err != nil {
+		return err
+	}
 	var s OrderStatus
 	if err := json.Unmarshal(status, &s); err != nil {
-		return
+		return err
 	}
-	mu.RLock()
-	arr := subs[s.OrderID]
-	for _, ch := range arr {
-		select {
-		case ch <- status:
-		default:
+	if s.CorrelationID == "" {
+		if id := correlationOf("", m); id != "" {
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(status, &fields); err != nil {
+				return err
+			}
+			fields["correlationId"], _ = json.Marshal(id)
+			status, _ = json.Marshal(fields)
+			s.CorrelationID = id
 		}
 	}
-	mu.RUnlock()
+	eventID := headerValue(m, headerEventID)
+	// at-least-once delivery, and producer retries after a lost ack, can
+	// hand us the same status twice
+	key := s.key()
+	if eventID != "" {
+		key = "id|" + eventID
+	}
+	if !delivered.add(key) {
+		return nil
+	}
+	statusesBroadcast.Inc()
+	for _, n := range notifiers {
+		if err := n.Notify(s, status); err != nil {
+			slog.Warn("notify failed", "error", err)
+		}
+	}
+	return nil
 }
 
 func main() {
+	logging.Init("notifications-api")
 	addr := getenv("HTTP_ADDR", ":8083")
 	brokers := strings.Split(getenv("KAFKA_BROKERS", "localhost:9093"), ",")
 	topic := getenv("STATUS_TOPIC", "orders.status")
-	group := getenv("GROUP_ID", "notifications-api-cg")
+	group := groupID("notifications-api-cg")
+
+	// SHUTDOWN_TIMEOUT bounds the whole shutdown sequence once a signal arrives
+	shutdownTimeout, err := time.ParseDuration(getenv("SHUTDOWN_TIMEOUT", "5s"))
+	if err != nil {
+		logging.Fatalf("invalid SHUTDOWN_TIMEOUT: %v", err)
+	}
+	replayTimeout, err := time.ParseDuration(getenv("REPLAY_TIMEOUT", "10s"))
+	if err != nil {
+		logging.Fatalf("invalid REPLAY_TIMEOUT: %v", err)
+	}
+	// the consumer checks for fetches every quarter window, so anything
+	// shorter than a second is a typo rather than a window
+	staleness, err := time.ParseDuration(getenv("STALENESS_WINDOW", "60s"))
+	if err != nil || staleness < time.Second {
+		logging.Fatalf("invalid STALENESS_WINDOW: %q, must be at least 1s", getenv("STALENESS_WINDOW", "60s"))
+	}
+	longPollTimeout, err := time.ParseDuration(getenv("LONGPOLL_TIMEOUT", "30s"))
+	if err != nil {
+		logging.Fatalf("invalid LONGPOLL_TIMEOUT: %v", err)
+	}
+
+	if err := startupBrokerCheck(brokers); err != nil {
+		logging.Fatalf("kafka startup check failed: %v", err)
+	}
+	undeliveredTopic := getenv("UNDELIVERED_TOPIC", "notifications.undelivered")
+	undelivered = newUndeliveredBuffer(brokers, undeliveredTopic)
+	topics := []string{topic}
+	if undelivered != nil {
+		topics = append(topics, undeliveredTopic)
+	}
+	if err := ensureTopics(brokers, topics...); err != nil {
+		logging.Fatalf("ensure topics failed: %v", err)
+	}
+
+	// SCHEMA_VALIDATION=off leaves validator nil, which accepts every payload
+	var validator *schema.Validator
+	if getenv("SCHEMA_VALIDATION", "on") == "on" {
+		v, err := schema.New()
+		if err != nil {
+			logging.Fatalf("failed to load schemas: %v", err)
+		}
+		validator = v
+	}
+
+	eventCodec, err := codec.New(getenv("EVENT_FORMAT", "json"), getenv("SCHEMA_REGISTRY_URL", ""))
+	if err != nil {
+		logging.Fatalf("invalid event codec config: %v", err)
+	}
 
 	// Create context that can be cancelled
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Start Kafka consumer in goroutine
-	go func() {
+	// NOTIFIERS picks where statuses go besides (or instead of) SSE
+	notifiers, err = newNotifiers(ctx, getenv("NOTIFIERS", "sse"))
+	if err != nil {
+		logging.Fatalf("invalid NOTIFIERS: %v", err)
+	}
+
+	// Start Kafka consumer under a supervisor that restarts it if it dies;
+	// readiness follows whether a consumer is actually able to read
+	go superviseConsumer(ctx, func(ctx context.Context) error {
+		if err := topicReadable(ctx, brokers, topic); err != nil {
+			return fmt.Errorf("topic %s not readable: %w", topic, err)
+		}
 		r := newReader(brokers, topic, group)
 		defer r.Close()
-		for {
-			m, err := r.ReadMessage(ctx)
-			if err != nil {
-				if ctx.Err() != nil {
-					log.Println("context cancelled, stopping kafka consumer")
+		atomic.StoreInt64(&kafkaReady, 1)
+
+		// Stats resets its counters on every call, so any fetch since the last
+		// tick proves the reader is still polling the broker
+		atomic.StoreInt64(&lastPoll, time.Now().UnixNano())
+		monitorCtx, stopMonitor := context.WithCancel(ctx)
+		defer stopMonitor()
+		go func() {
+			t := time.NewTicker(staleness / 4)
+			defer t.Stop()
+			for {
+				select {
+				case <-monitorCtx.Done():
 					return
+				case <-t.C:
+					if r.Stats().Fetches > 0 {
+						atomic.StoreInt64(&lastPoll, time.Now().UnixNano())
+					}
 				}
-				log.Printf("read error: %v", err)
-				continue
 			}
-			broadcast(m.Value)
-		}
-	}()
+		}()
 
-	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
-	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
-		if atomic.LoadInt64(&kafkaReady) == 1 {
-			w.WriteHeader(http.StatusOK)
-		} else {
-			w.WriteHeader(http.StatusServiceUnavailable)
-		}
+		poison := newPoisonHandler(nil)
+		return consumeLoop(ctx, r, poison, func(m kafka.Message) {
+			atomic.StoreInt64(&lastMessage, time.Now().UnixNano())
+			if et := headerValue(m, headerEventType); et != "" && et != "OrderStatus" {
+				poison.handle(ctx, m, "event_type", fmt.Errorf("unexpected event type %q", et))
+			} else if body, err := eventCodec.Decode(ctx, m.Value); err != nil {
+				poison.handle(ctx, m, "decode", err)
+			} else if err := validator.Validate("OrderStatus", body); err != nil {
+				poison.handle(ctx, m, "schema", err)
+			} else if err := broadcast(m, body); err != nil {
+				poison.handle(ctx, m, "unmarshal", err)
+			}
+		})
 	})
-	http.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
-		// CORS for local dev
-		if r.Method == http.MethodOptions {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-			w.WriteHeader(http.StatusNoContent)
-			return
+
+	var health HealthChecker
+	health.Register("kafka", func(ctx context.Context) error { return checkBrokers(brokers, 2*time.Second) })
+	health.Register("consumer", func(ctx context.Context) error {
+		if ok, reason := consumerLiveness(brokers, staleness); !ok {
+			return errors.New(reason)
 		}
-		orderID := r.URL.Query().Get("orderId")
-		if orderID == "" {
-			http.Error(w, "orderId required", http.StatusBadRequest)
+		return nil
+	})
+	http.HandleFunc("/healthz", health.Handler())
+	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/admin/subscriptions", requireAdmin(handleSubscriptions))
+	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt64(&kafkaReady) != 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
 			return
 		}
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Content-Type", "text/event-stream")
-		w.Header().Set("Cache-Control", "no-cache")
-		w.Header().Set("Connection", "keep-alive")
-		flusher, ok := w.(http.Flusher)
-		if !ok {
-			http.Error(w, "stream unsupported", http.StatusInternalServerError)
+		if ok, reason := consumerLiveness(brokers, staleness); !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": reason})
 			return
 		}
-		ch := subscribe(orderID)
-		defer unsubscribe(orderID, ch)
-		bw := bufio.NewWriter(w)
-		for msg := range ch {
-			fmt.Fprintf(bw, "data: %s\n\n", string(msg))
-			bw.Flush()
-			flusher.Flush()
-		}
+		w.WriteHeader(http.StatusOK)
 	})
+	http.HandleFunc("/events", eventsHandler(brokers, topic, eventCodec, replayTimeout, longPollTimeout))
 
-	srv := &http.Server{Addr: addr}
-
-	// Mark as ready after successful initialization
-	atomic.StoreInt64(&kafkaReady, 1)
+	srv := &http.Server{Addr: addr, Handler: logging.AccessLog(http.DefaultServeMux)}
 
 	// Start server in a goroutine
 	go func() {
-		log.Printf("notifications-api listening on %s", addr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("server failed: %v", err)
+		slog.Info("notifications-api listening", "addr", addr)
+		if err := listenAndServe(srv); err != nil && err != http.ErrServerClosed {
+			logging.Fatalf("server failed: %v", err)
 		}
 	}()
 
@@ -174,18 +412,24 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("shutting down notifications-api...")
+	slog.Info("shutting down notifications-api")
 
 	// Cancel context to stop Kafka consumer
 	cancel()
 
+	// Close subscriber channels so open SSE streams end cleanly
+	closeAllSubscribers()
+	if err := undelivered.Close(); err != nil {
+		slog.Warn("error closing undelivered writer", "error", err)
+	}
+
 	// Shutdown HTTP server with timeout
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer shutdownCancel()
 
 	if err := srv.Shutdown(shutdownCtx); err != nil {
-		log.Printf("server forced to shutdown: %v", err)
+		slog.Warn("server forced to shutdown", "error", err)
 	}
 
-	log.Println("notifications-api shutdown complete")
+	slog.Info("notifications-api shutdown complete")
 }
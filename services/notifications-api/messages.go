@@ -0,0 +1,35 @@
+package main
+
+import "github.com/segmentio/kafka-go"
+
+// headerEventType names the event carried by a message; producers set it on
+// everything they write.
+const headerEventType = "event-type"
+
+// headerEventID identifies an event. orders-processor derives it from the
+// order id and status, so a status written twice carries the same id.
+const headerEventID = "event-id"
+
+// headerCorrelationID groups every event that stems from one order, from
+// its creation in orders-api onwards.
+const headerCorrelationID = "correlation-id"
+
+// headerValue returns the value of the named header, or "" when absent.
+func headerValue(m kafka.Message, key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// correlationOf returns the correlation id of an inbound event: the
+// correlationId field of its body when set, otherwise its correlation-id
+// header.
+func correlationOf(bodyID string, m kafka.Message) string {
+	if bodyID != "" {
+		return bodyID
+	}
+	return headerValue(m, headerCorrelationID)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SSE fan-out metrics, served on /metrics. Dropped statuses are the ones a
+// subscriber missed because its buffer was full; a climbing count points at
+// slow clients, and opened minus closed drifting from the subscriber gauge
+// at a leak.
+var (
+	sseConnectionsOpened = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notifications_sse_connections_opened_total",
+		Help: "Subscriptions opened on /events.",
+	})
+	sseConnectionsClosed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "notifications_sse_connections_closed_total",
+		Help: "Subscriptions closed, by reason: client, evicted or shutdown.",
+	}, []string{"reason"})
+	statusesBroadcast = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notifications_broadcast_messages_total",
+		Help: "Statuses handed to the notifiers after deduplication.",
+	})
+	sseMessagesDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notifications_sse_messages_dropped_total",
+		Help: "Statuses not delivered to a subscriber because its buffer was full.",
+	})
+	sseSubscribers = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "notifications_sse_subscribers",
+		Help: "Subscriptions currently open on /events.",
+	}, func() float64 { return float64(atomic.LoadInt64(&connections)) })
+)
+
+func init() {
+	prometheus.MustRegister(sseConnectionsOpened, sseConnectionsClosed, statusesBroadcast, sseMessagesDropped, sseSubscribers)
+}
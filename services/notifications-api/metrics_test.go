@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestSubscriberGauge opens and closes subscriptions and expects the gauge,
+// and the opened and closed counters, to follow.
+func TestSubscriberGauge(t *testing.T) {
+	base := testutil.ToFloat64(sseSubscribers)
+	opened := testutil.ToFloat64(sseConnectionsOpened)
+	closed := testutil.ToFloat64(sseConnectionsClosed.WithLabelValues("client"))
+
+	a, err := subscribe("o-gauge", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := subscribe("o-gauge", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(sseSubscribers) - base; got != 2 {
+		t.Fatalf("gauge after two subscribes moved by %v, want 2", got)
+	}
+	unsubscribe("o-gauge", a)
+	if got := testutil.ToFloat64(sseSubscribers) - base; got != 1 {
+		t.Fatalf("gauge after one unsubscribe moved by %v, want 1", got)
+	}
+	// a repeated unsubscribe must not count twice
+	unsubscribe("o-gauge", a)
+	unsubscribe("o-gauge", b)
+	if got := testutil.ToFloat64(sseSubscribers) - base; got != 0 {
+		t.Fatalf("gauge after both closed moved by %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(sseConnectionsOpened) - opened; got != 2 {
+		t.Fatalf("opened moved by %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(sseConnectionsClosed.WithLabelValues("client")) - closed; got != 2 {
+		t.Fatalf("closed{client} moved by %v, want 2", got)
+	}
+}
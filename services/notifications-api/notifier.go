@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notifier delivers one order status somewhere. broadcast calls every
+// notifier enabled in NOTIFIERS for each status that survives deduplication.
+type Notifier interface {
+	Notify(s OrderStatus, payload []byte) error
+}
+
+// newNotifiers builds the notifiers named in spec, a comma-separated list of
+// sse, webhook and log.
+func newNotifiers(ctx context.Context, spec string) ([]Notifier, error) {
+	var out []Notifier
+	for _, name := range strings.Split(spec, ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "":
+		case "sse":
+			out = append(out, sseNotifier{})
+		case "log":
+			out = append(out, logNotifier{})
+		case "webhook":
+			wn, err := newWebhookNotifier(ctx)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, wn)
+		default:
+			return nil, fmt.Errorf("unknown notifier %q", name)
+		}
+	}
+	return out, nil
+}
+
+// sseNotifier hands the status to every /events stream for its order. Slow
+// subscribers whose buffers are full miss it rather than stall the consumer.
+// With no subscriber at all the status goes to the undelivered buffer; that
+// happens under mu so a concurrent subscribe either sees it buffered or
+// receives it live.
+type sseNotifier struct{}
+
+func (sseNotifier) Notify(s OrderStatus, payload []byte) error {
+	mu.RLock()
+	defer mu.RUnlock()
+	if len(subs[s.OrderID]) == 0 {
+		undelivered.add(s.OrderID, payload)
+		return nil
+	}
+	for ch, sub := range subs[s.OrderID] {
+		if !sub.statuses.allows(s.Status) {
+			continue
+		}
+		if sub.offer(ch, payload) {
+			sub.touch()
+		} else {
+			// a subscriber that is not keeping up misses this status
+			sseMessagesDropped.Inc()
+		}
+	}
+	return nil
+}
+
+// logNotifier writes each status to the service log.
+type logNotifier struct{}
+
+func (logNotifier) Notify(s OrderStatus, _ []byte) error {
+	slog.Info("order status", "order", s.OrderID, "status", s.Status)
+	return nil
+}
+
+// webhookNotifier POSTs each status as JSON to WEBHOOK_URL. Deliveries are
+// queued (WEBHOOK_QUEUE, default 100) and sent in order by one worker, so a
+// slow endpoint never holds up the consumer; when the queue is full the
+// status is dropped with a log line. Each attempt times out after
+// WEBHOOK_TIMEOUT (default 5s) and failures, including 5xx responses, are
+// retried up to WEBHOOK_RETRIES times (default 3) with doubling backoff.
+type webhookNotifier struct {
+	url     string
+	client  *http.Client
+	retries int
+	queue   chan []byte
+}
+
+func newWebhookNotifier(ctx context.Context) (*webhookNotifier, error) {
+	url := getenv("WEBHOOK_URL", "")
+	if url == "" {
+		return nil, fmt.Errorf("NOTIFIERS includes webhook but WEBHOOK_URL is not set")
+	}
+	timeout, err := time.ParseDuration(getenv("WEBHOOK_TIMEOUT", "5s"))
+	if err != nil || timeout <= 0 {
+		return nil, fmt.Errorf("invalid WEBHOOK_TIMEOUT %q", getenv("WEBHOOK_TIMEOUT", "5s"))
+	}
+	retries, err := strconv.Atoi(getenv("WEBHOOK_RETRIES", "3"))
+	if err != nil || retries < 0 {
+		return nil, fmt.Errorf("invalid WEBHOOK_RETRIES %q", getenv("WEBHOOK_RETRIES", "3"))
+	}
+	size, err := strconv.Atoi(getenv("WEBHOOK_QUEUE", "100"))
+	if err != nil || size < 1 {
+		return nil, fmt.Errorf("invalid WEBHOOK_QUEUE %q", getenv("WEBHOOK_QUEUE", "100"))
+	}
+	n := &webhookNotifier{url: url, client: &http.Client{Timeout: timeout}, retries: retries, queue: make(chan []byte, size)}
+	go n.run(ctx)
+	return n, nil
+}
+
+func (n *webhookNotifier) Notify(s OrderStatus, payload []byte) error {
+	select {
+	case n.queue <- payload:
+		return nil
+	default:
+		return fmt.Errorf("webhook queue full, dropping %s for order %s", s.Status, s.OrderID)
+	}
+}
+
+func (n *webhookNotifier) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case payload := <-n.queue:
+			if err := n.deliver(ctx, payload); err != nil {
+				slog.Warn("webhook delivery failed", "error", err)
+			}
+		}
+	}
+}
+
+// deliver POSTs payload, retrying transport errors and 5xx responses.
+func (n *webhookNotifier) deliver(ctx context.Context, payload []byte) error {
+	delay := 200 * time.Millisecond
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = n.post(ctx, payload); err == nil {
+			return nil
+		}
+		if attempt == n.retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (n *webhookNotifier) post(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestWebhookReceivesStatusPayload fails the first delivery with a 503 and
+// expects the retry to carry the status payload to WEBHOOK_URL.
+func TestWebhookReceivesStatusPayload(t *testing.T) {
+	bodies := make(chan string, 4)
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type %q", ct)
+		}
+		b, _ := io.ReadAll(r.Body)
+		bodies <- string(b)
+	}))
+	defer srv.Close()
+	t.Setenv("WEBHOOK_URL", srv.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n, err := newWebhookNotifier(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := `{"orderId":"o-1","status":"PAID","updatedAt":"2024-01-01T00:00:00Z"}`
+	if err := n.Notify(OrderStatus{OrderID: "o-1", Status: "PAID"}, []byte(payload)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-bodies:
+		if got != payload {
+			t.Fatalf("webhook got %s, want %s", got, payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook never received the status")
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// signToken signs claims the way orders-api does.
+func signToken(t *testing.T, secret []byte, claims orderClaims) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuthorizeOrderTokens(t *testing.T) {
+	prev := orderTokenSecret
+	orderTokenSecret = []byte("secret")
+	t.Cleanup(func() { orderTokenSecret = prev })
+
+	exp := time.Now().Add(time.Hour).Unix()
+	valid := signToken(t, orderTokenSecret, orderClaims{OrderID: "o-1", UserID: "u-1", Exp: exp})
+	for name, tc := range map[string]struct {
+		token string
+		ok    bool
+	}{
+		"valid":       {valid, true},
+		"missing":     {"", false},
+		"forged":      {signToken(t, []byte("guess"), orderClaims{OrderID: "o-1", UserID: "u-1", Exp: exp}), false},
+		"other order": {signToken(t, orderTokenSecret, orderClaims{OrderID: "o-2", UserID: "u-1", Exp: exp}), false},
+		"expired":     {signToken(t, orderTokenSecret, orderClaims{OrderID: "o-1", UserID: "u-1", Exp: time.Now().Add(-time.Minute).Unix()}), false},
+		"not a token": {"o-1", false},
+	} {
+		r := httptest.NewRequest("GET", "/events?orderId=o-1&token="+tc.token, nil)
+		if err := authorizeOrder(r, "o-1"); (err == nil) != tc.ok {
+			t.Errorf("%s: err %v, want ok=%v", name, err, tc.ok)
+		}
+	}
+}
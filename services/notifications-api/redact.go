@@ -0,0 +1,30 @@
+package main
+
+import "encoding/json"
+
+// privateStatusFields are OrderStatus fields meant only for internal readers
+// of the status topic, such as the userEmail orders-processor adds when
+// enrichment is on. Subscribing needs no more than an order id unless
+// ORDER_TOKEN_SECRET is set, so every status is stripped of these before it
+// reaches SSE, long-poll or webhook subscribers.
+var privateStatusFields = []string{"userEmail"}
+
+// publicStatus returns status without privateStatusFields, or status itself
+// when it carries none.
+func publicStatus(status []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(status, &fields); err != nil {
+		return nil, err
+	}
+	stripped := false
+	for _, f := range privateStatusFields {
+		if _, ok := fields[f]; ok {
+			delete(fields, f)
+			stripped = true
+		}
+	}
+	if !stripped {
+		return status, nil
+	}
+	return json.Marshal(fields)
+}
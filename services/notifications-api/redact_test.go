@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type captureNotifier struct {
+	payloads [][]byte
+}
+
+func (c *captureNotifier) Notify(_ OrderStatus, payload []byte) error {
+	c.payloads = append(c.payloads, payload)
+	return nil
+}
+
+func TestPublicStatusStripsUserEmail(t *testing.T) {
+	got, err := publicStatus([]byte(`{"orderId":"o-1","status":"PAID","userEmail":"a@example.com","updatedAt":"t"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(got, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fields["userEmail"]; ok {
+		t.Fatalf("userEmail still present: %s", got)
+	}
+	if fields["orderId"] != "o-1" || fields["status"] != "PAID" {
+		t.Fatalf("other fields lost: %s", got)
+	}
+}
+
+func TestPublicStatusLeavesCleanStatusAlone(t *testing.T) {
+	in := []byte(`{"orderId":"o-1","status":"PAID"}`)
+	got, err := publicStatus(in)
+	if err != nil || string(got) != string(in) {
+		t.Fatalf("got %s, %v", got, err)
+	}
+	if _, err := publicStatus([]byte(`not json`)); err == nil {
+		t.Fatal("want an error for a body that is not JSON")
+	}
+}
+
+func TestBroadcastNeverHandsOutUserEmail(t *testing.T) {
+	capture := &captureNotifier{}
+	prev := notifiers
+	notifiers = []Notifier{capture}
+	t.Cleanup(func() { notifiers = prev })
+
+	m := kafka.Message{Key: []byte("o-redact"), Headers: []kafka.Header{{Key: headerEventID, Value: []byte("redact-1")}}}
+	if err := broadcast(m, []byte(`{"orderId":"o-redact","status":"PAID","userEmail":"a@example.com","updatedAt":"t"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(capture.payloads) != 1 {
+		t.Fatalf("notified %d times", len(capture.payloads))
+	}
+	var fields map[string]interface{}
+	_ = json.Unmarshal(capture.payloads[0], &fields)
+	if _, ok := fields["userEmail"]; ok {
+		t.Fatalf("subscriber got userEmail: %s", capture.payloads[0])
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+
+	"kafka-microservice/services/notifications-api/codec"
+)
+
+// replayStatuses reads topic from the beginning up to the end offsets observed
+// when the call starts and returns, in log order, every status keyed by
+// orderID, stripped like a live one. It uses throwaway partition readers with
+// no consumer group, so it never moves the live consumer's committed offsets.
+func replayStatuses(ctx context.Context, brokers []string, topic, orderID string, eventCodec codec.Codec) ([][]byte, error) {
+	conn, err := dialAny(ctx, brokers)
+	if err != nil {
+		return nil, err
+	}
+	// the leader lookups go through the broker that answered
+	bootstrap := conn.RemoteAddr().String()
+	partitions, err := conn.ReadPartitions(topic)
+	conn.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var out [][]byte
+	for _, p := range partitions {
+		leader, err := kafkaDialer.DialLeader(ctx, "tcp", bootstrap, topic, p.ID)
+		if err != nil {
+			return nil, err
+		}
+		first, last, err := leader.ReadOffsets()
+		leader.Close()
+		if err != nil {
+			return nil, err
+		}
+		if last <= first {
+			continue
+		}
+
+		r := kafka.NewReader(withReaderLogging(kafka.ReaderConfig{Brokers: brokers, Topic: topic, Partition: p.ID, MinBytes: 1, MaxBytes: 10e6}))
+		if err := r.SetOffset(first); err != nil {
+			r.Close()
+			return nil, err
+		}
+		for {
+			m, err := r.ReadMessage(ctx)
+			if err != nil {
+				r.Close()
+				return nil, fmt.Errorf("replay %s[%d]: %w", topic, p.ID, err)
+			}
+			if string(m.Key) == orderID {
+				if body, err := eventCodec.Decode(ctx, m.Value); err == nil {
+					if body, err = publicStatus(body); err == nil {
+						out = append(out, body)
+					}
+				}
+			}
+			if m.Offset+1 >= last {
+				break
+			}
+		}
+		r.Close()
+	}
+	return out, nil
+}
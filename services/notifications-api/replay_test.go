@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestReplaySubscriberHoldsLiveStatuses notifies more statuses than the
+// channel holds while a replay is running and expects every one of them, in
+// order, once the replay ends.
+func TestReplaySubscriberHoldsLiveStatuses(t *testing.T) {
+	ch, err := subscribe("o-replay", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { unsubscribe("o-replay", ch) })
+
+	const n = 20
+	for i := 0; i < n; i++ {
+		_ = sseNotifier{}.Notify(OrderStatus{OrderID: "o-replay", Status: "PAID"}, []byte(fmt.Sprint(i)))
+	}
+	queued, held := endReplay("o-replay", ch)
+	if queued != cap(ch) || queued+len(held) != n {
+		t.Fatalf("queued %d, held %d; want %d and %d", queued, len(held), cap(ch), n-cap(ch))
+	}
+	var got []string
+	for ; queued > 0; queued-- {
+		got = append(got, string(<-ch))
+	}
+	for _, msg := range held {
+		got = append(got, string(msg))
+	}
+	for i, msg := range got {
+		if msg != fmt.Sprint(i) {
+			t.Fatalf("status %d is %q; got %v", i, msg, got)
+		}
+	}
+
+	// after the replay a full channel drops again
+	for i := 0; i <= cap(ch); i++ {
+		_ = sseNotifier{}.Notify(OrderStatus{OrderID: "o-replay", Status: "PAID"}, []byte("late"))
+	}
+	if _, held := endReplay("o-replay", ch); len(held) != 0 || len(ch) != cap(ch) {
+		t.Fatalf("held %d after the replay ended", len(held))
+	}
+}
@@ -0,0 +1,23 @@
+package schema
+
+import "testing"
+
+func TestOrderStatusSchema(t *testing.T) {
+	v, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := `{"orderId":"o-1","status":"PAID","eventTime":"2026-01-02T03:04:05Z","processedAt":"2026-01-02T03:04:06Z","updatedAt":"2026-01-02T03:04:06Z"}`
+	if err := v.Validate("OrderStatus", []byte(ok)); err != nil {
+		t.Fatalf("valid status rejected: %v", err)
+	}
+	for _, bad := range []string{
+		`{"orderId":"o-1","updatedAt":"2026-01-02T03:04:06Z"}`,
+		`{"orderId":"o-1","status":"LOST","updatedAt":"2026-01-02T03:04:06Z"}`,
+		`{"orderId":"o-1","status":"PAID","updatedAt":"yesterday"}`,
+	} {
+		if err := v.Validate("OrderStatus", []byte(bad)); err == nil {
+			t.Errorf("accepted %s", bad)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"kafka-microservice/services/notifications-api/codec"
+)
+
+// eventsHandler serves /events: an SSE stream of an order's statuses, or a
+// single JSON status for a client that accepts only JSON; see longPoll.
+// replay=true first streams the order's history read back from topic.
+func eventsHandler(brokers []string, topic string, eventCodec codec.Codec, replayTimeout, longPollTimeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cors(w, r, "GET") {
+			return
+		}
+		orderID := r.URL.Query().Get("orderId")
+		if orderID == "" {
+			http.Error(w, "orderId required", http.StatusBadRequest)
+			return
+		}
+		if err := authorizeOrder(r, orderID); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		statuses := parseStatusFilter(r.URL.Query().Get("statuses"))
+		if wantsLongPoll(r) {
+			longPoll(w, r, orderID, statuses, longPollTimeout)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		if _, ok := w.(http.Flusher); !ok {
+			http.Error(w, "stream unsupported", http.StatusInternalServerError)
+			return
+		}
+		// Subscribe before replaying so nothing published during the replay is
+		// missed; anything that shows up on both paths is sent only once.
+		replay := r.URL.Query().Get("replay") == "true"
+		ch, err := subscribe(orderID, statuses, replay)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		defer unsubscribe(orderID, ch)
+		bw, rc := bufio.NewWriter(w), http.NewResponseController(w)
+		replayed := map[string]bool{}
+		// statuses that arrived while nobody was subscribed come first
+		for _, msg := range undelivered.take(orderID) {
+			if !statuses.allowsPayload(msg) {
+				continue
+			}
+			replayed[statusKey(msg)] = true
+			fmt.Fprintf(bw, "data: %s\n\n", string(msg))
+		}
+		if flushEvents(bw, rc) != nil {
+			return
+		}
+		if replay {
+			replayCtx, replayCancel := context.WithTimeout(r.Context(), replayTimeout)
+			history, err := replayStatuses(replayCtx, brokers, topic, orderID, eventCodec)
+			replayCancel()
+			if err != nil {
+				slog.Warn("replay incomplete", "order", orderID, "error", err)
+			}
+			for _, msg := range history {
+				if !statuses.allowsPayload(msg) {
+					continue
+				}
+				replayed[statusKey(msg)] = true
+				fmt.Fprintf(bw, "data: %s\n\n", string(msg))
+			}
+			// what arrived live meanwhile: first what fit the channel, then
+			// what was held back once it was full
+			queued, held := endReplay(orderID, ch)
+			live := make([][]byte, 0, queued+len(held))
+			for ; queued > 0; queued-- {
+				msg, ok := <-ch
+				if !ok {
+					return
+				}
+				live = append(live, msg)
+			}
+			for _, msg := range append(live, held...) {
+				if !replayed[statusKey(msg)] {
+					fmt.Fprintf(bw, "data: %s\n\n", string(msg))
+				}
+			}
+			if flushEvents(bw, rc) != nil {
+				return
+			}
+		}
+		for {
+			select {
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				if len(replayed) > 0 && replayed[statusKey(msg)] {
+					continue
+				}
+				fmt.Fprintf(bw, "data: %s\n\n", string(msg))
+				if err := flushEvents(bw, rc); err != nil {
+					// the client has gone; returning unsubscribes now rather
+					// than on the next shutdown or eviction
+					slog.Debug("sse write failed", "orderId", orderID, "error", err)
+					return
+				}
+			case <-r.Context().Done():
+				// a disconnect on an order with no further statuses
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitSubscribed waits for a client of orderID to subscribe.
+func waitSubscribed(t *testing.T, orderID string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for subscriptionStats().Orders[orderID] == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("no subscriber for %s", orderID)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// dropSubscribers closes every subscription of orderID, as shutdown does.
+func dropSubscribers(orderID string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for ch := range subs[orderID] {
+		removeLocked(orderID, ch, "shutdown")
+	}
+}
+
+func getEvents(url, accept string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	return http.DefaultClient.Do(req)
+}
+
+func TestEventsStreamsSSE(t *testing.T) {
+	srv := httptest.NewServer(eventsHandler(nil, "", nil, time.Second, time.Second))
+	defer srv.Close()
+
+	resp, err := getEvents(srv.URL+"?orderId=o-sse", "text/event-stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type %q", ct)
+	}
+	waitSubscribed(t, "o-sse")
+	_ = sseNotifier{}.Notify(OrderStatus{OrderID: "o-sse", Status: "PAID"}, []byte(`{"orderId":"o-sse","status":"PAID"}`))
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != "data: {\"orderId\":\"o-sse\",\"status\":\"PAID\"}\n" {
+		t.Fatalf("got %q, %v", line, err)
+	}
+	dropSubscribers("o-sse")
+}
+
+func TestEventsLongPollReturnsNextStatus(t *testing.T) {
+	srv := httptest.NewServer(eventsHandler(nil, "", nil, time.Second, 5*time.Second))
+	defer srv.Close()
+
+	done := make(chan *http.Response, 1)
+	go func() {
+		resp, err := getEvents(srv.URL+"?orderId=o-poll", "application/json")
+		if err != nil {
+			t.Error(err)
+		}
+		done <- resp
+	}()
+	waitSubscribed(t, "o-poll")
+	_ = sseNotifier{}.Notify(OrderStatus{OrderID: "o-poll", Status: "PAID"}, []byte(`{"orderId":"o-poll","status":"PAID"}`))
+
+	resp := <-done
+	if resp == nil {
+		t.FailNow()
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" || !strings.Contains(string(body), `"PAID"`) {
+		t.Fatalf("got %d %q %s", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+}
+
+func TestEventsLongPollTimesOut(t *testing.T) {
+	srv := httptest.NewServer(eventsHandler(nil, "", nil, time.Second, 20*time.Millisecond))
+	defer srv.Close()
+
+	resp, err := getEvents(srv.URL+"?orderId=o-quiet", "application/json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("got %d, want 204 once the timeout passes", resp.StatusCode)
+	}
+}
+
+// failingWriter is a client connection that has gone away: headers go
+// through, every body write fails.
+type failingWriter struct{ header http.Header }
+
+func (w *failingWriter) Header() http.Header       { return w.header }
+func (w *failingWriter) WriteHeader(int)           {}
+func (w *failingWriter) Write([]byte) (int, error) { return 0, io.ErrClosedPipe }
+func (w *failingWriter) Flush()                    {}
+
+// serveEvents runs the /events handler for orderID on w in the background
+// and returns a channel closed when it returns.
+func serveEvents(ctx context.Context, w http.ResponseWriter, orderID string) <-chan struct{} {
+	done := make(chan struct{})
+	req := httptest.NewRequest(http.MethodGet, "/events?orderId="+orderID, nil).WithContext(ctx)
+	go func() {
+		defer close(done)
+		eventsHandler(nil, "", nil, time.Second, time.Second)(w, req)
+	}()
+	return done
+}
+
+func waitReturned(t *testing.T, done <-chan struct{}, orderID string) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler did not return")
+	}
+	if n := subscriptionStats().Orders[orderID]; n != 0 {
+		t.Fatalf("%d subscriptions left on %s", n, orderID)
+	}
+}
+
+// TestEventsWriteFailureUnsubscribes expects a failed write to end the
+// stream and drop its subscription.
+func TestEventsWriteFailureUnsubscribes(t *testing.T) {
+	done := serveEvents(context.Background(), &failingWriter{header: http.Header{}}, "o-dead")
+	waitSubscribed(t, "o-dead")
+	_ = sseNotifier{}.Notify(OrderStatus{OrderID: "o-dead", Status: "PAID"}, []byte(`{"orderId":"o-dead","status":"PAID"}`))
+	waitReturned(t, done, "o-dead")
+}
+
+// TestEventsDisconnectUnsubscribes expects a client that goes away from an
+// order with no further statuses to be dropped without waiting for one.
+func TestEventsDisconnectUnsubscribes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := serveEvents(ctx, httptest.NewRecorder(), "o-gone")
+	waitSubscribed(t, "o-gone")
+	cancel()
+	waitReturned(t, done, "o-gone")
+}
+
+// TestShutdownClosesSubscribers expects closeAllSubscribers to close every
+// subscriber channel, end open streams, and turn new subscriptions away
+// with 503.
+func TestShutdownClosesSubscribers(t *testing.T) {
+	t.Cleanup(func() {
+		mu.Lock()
+		closing = false
+		mu.Unlock()
+	})
+	var chans []chan []byte
+	for _, orderID := range []string{"o-shut-1", "o-shut-1", "o-shut-2"} {
+		ch, err := subscribe(orderID, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chans = append(chans, ch)
+	}
+	done := serveEvents(context.Background(), httptest.NewRecorder(), "o-shut-3")
+	waitSubscribed(t, "o-shut-3")
+
+	closeAllSubscribers()
+	for i, ch := range chans {
+		select {
+		case _, ok := <-ch:
+			if ok {
+				t.Fatalf("subscriber %d got a message, want its channel closed", i)
+			}
+		default:
+			t.Fatalf("subscriber %d still open", i)
+		}
+	}
+	waitReturned(t, done, "o-shut-3")
+	if n := subscriptionStats().Orders; len(n) != 0 {
+		t.Fatalf("subscriptions left: %v", n)
+	}
+
+	rec := httptest.NewRecorder()
+	eventsHandler(nil, "", nil, time.Second, time.Second)(rec, httptest.NewRequest(http.MethodGet, "/events?orderId=o-late", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("subscribe after shutdown: got %d, want 503", rec.Code)
+	}
+}
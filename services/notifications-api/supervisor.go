@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	restartBackoffMin = time.Second
+	restartBackoffMax = 30 * time.Second
+)
+
+// superviseConsumer runs consume until ctx ends, restarting it with doubling
+// backoff whenever it returns or panics while ctx is still live. kafkaReady
+// is cleared as soon as a run ends; consume sets it again once it can read.
+func superviseConsumer(ctx context.Context, consume func(context.Context) error) {
+	delay := restartBackoffMin
+	for {
+		started := time.Now()
+		err := runRecovered(ctx, consume)
+		atomic.StoreInt64(&kafkaReady, 0)
+		if ctx.Err() != nil {
+			return
+		}
+		// a run that stayed up a while was healthy; start the backoff over
+		if time.Since(started) > restartBackoffMax {
+			delay = restartBackoffMin
+		}
+		slog.Error("kafka consumer exited unexpectedly, restarting", "error", err, "retryIn", delay)
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		delay = min(delay*2, restartBackoffMax)
+	}
+}
+
+func runRecovered(ctx context.Context, consume func(context.Context) error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	if err := consume(ctx); err != nil {
+		return err
+	}
+	return fmt.Errorf("consumer returned")
+}
+
+// topicReadable confirms a broker answers a metadata request for topic, the
+// point at which the consumer counts as ready even before a message arrives.
+func topicReadable(ctx context.Context, brokers []string, topic string) error {
+	dialCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	conn, err := dialAny(dialCtx, brokers)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	partitions, err := conn.ReadPartitions(topic)
+	if err != nil {
+		return err
+	}
+	if len(partitions) == 0 {
+		return fmt.Errorf("topic %s has no partitions", topic)
+	}
+	return nil
+}
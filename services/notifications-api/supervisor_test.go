@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// brokerGone fails every fetch, as a reader does once its broker is down.
+type brokerGone struct{ fetches atomic.Int32 }
+
+func (s *brokerGone) FetchMessage(context.Context) (kafka.Message, error) {
+	s.fetches.Add(1)
+	return kafka.Message{}, errors.New("dial tcp: connection refused")
+}
+
+func (s *brokerGone) CommitMessages(context.Context, ...kafka.Message) error { return nil }
+
+func withMaxFetchFailures(t *testing.T, n int) {
+	t.Helper()
+	prev := maxFetchFailures
+	maxFetchFailures = n
+	t.Cleanup(func() { maxFetchFailures = prev })
+}
+
+// TestConsumerErrorDropsReadiness lets a run become ready and then lose its
+// broker. After maxFetchFailures failed fetches consumeLoop returns an error
+// and readiness drops before the restart backoff ends.
+func TestConsumerErrorDropsReadiness(t *testing.T) {
+	withMaxFetchFailures(t, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	src := &brokerGone{}
+	ready := make(chan struct{})
+	failed := make(chan error, 1)
+	done := make(chan struct{})
+	runs := int32(0)
+	go func() {
+		defer close(done)
+		superviseConsumer(ctx, func(ctx context.Context) error {
+			if atomic.AddInt32(&runs, 1) > 1 {
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			atomic.StoreInt64(&kafkaReady, 1)
+			close(ready)
+			err := consumeLoop(ctx, src, newPoisonHandler(nil), func(kafka.Message) {})
+			failed <- err
+			return err
+		})
+	}()
+
+	<-ready
+	if err := <-failed; err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Fatalf("consumeLoop returned %v, want the fetch error", err)
+	}
+	if n := src.fetches.Load(); n != 3 {
+		t.Fatalf("%d fetches before giving up, want 3", n)
+	}
+	deadline := time.Now().Add(restartBackoffMin / 2)
+	for atomic.LoadInt64(&kafkaReady) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("still ready after the consumer failed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+}
+
+// flakySource fails every other fetch.
+type flakySource struct{ fetches atomic.Int32 }
+
+func (s *flakySource) FetchMessage(context.Context) (kafka.Message, error) {
+	if s.fetches.Add(1)%2 == 1 {
+		return kafka.Message{}, errors.New("read: connection reset")
+	}
+	return kafka.Message{}, nil
+}
+
+func (s *flakySource) CommitMessages(context.Context, ...kafka.Message) error { return nil }
+
+// TestConsumeLoopToleratesIntermittentFailures expects a successful fetch to
+// start the failure count over, so occasional errors never end the loop.
+func TestConsumeLoopToleratesIntermittentFailures(t *testing.T) {
+	withMaxFetchFailures(t, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	src := &flakySource{}
+	handled := atomic.Int32{}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- consumeLoop(ctx, src, newPoisonHandler(nil), func(kafka.Message) {
+			if handled.Add(1) == 3 {
+				cancel()
+			}
+		})
+	}()
+	if err := <-errc; err != nil {
+		t.Fatalf("consumeLoop gave up after %d fetches: %v", src.fetches.Load(), err)
+	}
+}
+
+func TestTopicReadableTriesEveryBroker(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	err := topicReadable(ctx, []string{"127.0.0.1:1", "127.0.0.1:2"}, "orders.status")
+	if err == nil || !strings.Contains(err.Error(), "127.0.0.1:1") || !strings.Contains(err.Error(), "127.0.0.1:2") {
+		t.Fatalf("got %v, want both brokers tried", err)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// dialController connects to the cluster controller, which is the broker
+// that accepts topic creation.
+func dialController(brokers []string) (*kafka.Conn, error) {
+	conn, err := kafka.Dial("tcp", brokers[0])
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	controller, err := conn.Controller()
+	if err != nil {
+		return nil, err
+	}
+	return kafka.Dial("tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)))
+}
+
+// ensureTopics creates missing topics when ENSURE_TOPICS=true, sized by
+// TOPIC_PARTITIONS (default 3) and TOPIC_REPLICATION_FACTOR (default 1).
+func ensureTopics(brokers []string, topics ...string) error {
+	if getenv("ENSURE_TOPICS", "false") != "true" {
+		return nil
+	}
+	partitions, err := strconv.Atoi(getenv("TOPIC_PARTITIONS", "3"))
+	if err != nil || partitions <= 0 {
+		return fmt.Errorf("invalid TOPIC_PARTITIONS")
+	}
+	replication, err := strconv.Atoi(getenv("TOPIC_REPLICATION_FACTOR", "1"))
+	if err != nil || replication <= 0 {
+		return fmt.Errorf("invalid TOPIC_REPLICATION_FACTOR")
+	}
+
+	cc, err := dialController(brokers)
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+	return createTopics(cc, topics, partitions, replication)
+}
+
+// topicCreator is the part of *kafka.Conn that creates topics.
+type topicCreator interface {
+	CreateTopics(topics ...kafka.TopicConfig) error
+}
+
+// createTopics creates each of topics that does not exist yet and leaves
+// the existing ones as they are.
+func createTopics(cc topicCreator, topics []string, partitions, replication int) error {
+	for _, t := range topics {
+		// one request per topic so an existing one doesn't mask the rest
+		err := cc.CreateTopics(kafka.TopicConfig{Topic: t, NumPartitions: partitions, ReplicationFactor: replication})
+		switch {
+		case err == nil:
+			slog.Info("created topic", "topic", t, "partitions", partitions, "replication", replication)
+		case errors.Is(err, kafka.TopicAlreadyExists):
+		default:
+			return fmt.Errorf("create topic %s: %w", t, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// undeliveredBuffer holds statuses that arrived while their order had no SSE
+// subscriber, so a client that reconnects still gets them. It keeps the
+// latest UNDELIVERED_PER_ORDER statuses (default 10) for at most
+// UNDELIVERED_MAX_ORDERS orders (default 10000), evicting the order buffered
+// longest ago. Each buffered status is also written to UNDELIVERED_TOPIC
+// (default notifications.undelivered) for pickup by other consumers. A nil
+// buffer, the default unless BUFFER_UNDELIVERED=true, does nothing.
+type undeliveredBuffer struct {
+	perOrder  int
+	maxOrders int
+	w         forwardWriter
+
+	mu      sync.Mutex
+	byOrder map[string][][]byte
+	fifo    []string // order ids, oldest first
+}
+
+// forwardWriter is the part of *kafka.Writer the buffer forwards through.
+type forwardWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// newUndeliveredBuffer returns nil when BUFFER_UNDELIVERED is not true.
+func newUndeliveredBuffer(brokers []string, topic string) *undeliveredBuffer {
+	if getenv("BUFFER_UNDELIVERED", "false") != "true" {
+		return nil
+	}
+	b := &undeliveredBuffer{perOrder: 10, maxOrders: 10000, byOrder: map[string][][]byte{}}
+	if n, err := strconv.Atoi(getenv("UNDELIVERED_PER_ORDER", "10")); err == nil && n > 0 {
+		b.perOrder = n
+	}
+	if n, err := strconv.Atoi(getenv("UNDELIVERED_MAX_ORDERS", "10000")); err == nil && n > 0 {
+		b.maxOrders = n
+	}
+	// async so a slow broker never holds up the consumer loop
+	b.w = withWriterLogging(&kafka.Writer{
+		Addr:     kafka.TCP(brokers...),
+		Topic:    topic,
+		Balancer: &kafka.Hash{},
+		Async:    true,
+		Completion: func(_ []kafka.Message, err error) {
+			if err != nil {
+				slog.Warn("undelivered forward failed", "error", err)
+			}
+		},
+	})
+	return b
+}
+
+// add buffers status for orderID and forwards it to the undelivered topic.
+func (b *undeliveredBuffer) add(orderID string, status []byte) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	if _, ok := b.byOrder[orderID]; !ok {
+		if len(b.fifo) >= b.maxOrders {
+			delete(b.byOrder, b.fifo[0])
+			b.fifo = b.fifo[1:]
+		}
+		b.fifo = append(b.fifo, orderID)
+	}
+	kept := append(b.byOrder[orderID], status)
+	if len(kept) > b.perOrder {
+		kept = kept[len(kept)-b.perOrder:]
+	}
+	b.byOrder[orderID] = kept
+	b.mu.Unlock()
+
+	_ = b.w.WriteMessages(context.Background(), kafka.Message{
+		Key:     []byte(orderID),
+		Value:   status,
+		Headers: []kafka.Header{{Key: headerEventType, Value: []byte("OrderStatus")}},
+	})
+}
+
+// take removes and returns the statuses buffered for orderID, oldest first.
+func (b *undeliveredBuffer) take(orderID string) [][]byte {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out, ok := b.byOrder[orderID]
+	if !ok {
+		return nil
+	}
+	delete(b.byOrder, orderID)
+	for i, id := range b.fifo {
+		if id == orderID {
+			b.fifo = append(b.fifo[:i], b.fifo[i+1:]...)
+			break
+		}
+	}
+	return out
+}
+
+// Close flushes pending forwards.
+func (b *undeliveredBuffer) Close() error {
+	if b == nil {
+		return nil
+	}
+	return b.w.Close()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// forwarded records what the buffer writes to the undelivered topic.
+type forwarded struct {
+	mu   sync.Mutex
+	msgs []kafka.Message
+}
+
+func (f *forwarded) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.msgs = append(f.msgs, msgs...)
+	return nil
+}
+
+func (f *forwarded) Close() error { return nil }
+
+func withUndelivered(t *testing.T, perOrder, maxOrders int) *forwarded {
+	t.Helper()
+	fw := &forwarded{}
+	prev := undelivered
+	undelivered = &undeliveredBuffer{perOrder: perOrder, maxOrders: maxOrders, w: fw, byOrder: map[string][][]byte{}}
+	t.Cleanup(func() { undelivered = prev })
+	return fw
+}
+
+func notifyStatus(orderID, status string) {
+	_ = sseNotifier{}.Notify(OrderStatus{OrderID: orderID, Status: status}, []byte(`{"orderId":"`+orderID+`","status":"`+status+`"}`))
+}
+
+// TestUndeliveredBuffersAndForwards notifies statuses for orders nobody is
+// subscribed to: each is forwarded to the undelivered topic, the latest
+// UNDELIVERED_PER_ORDER are kept per order, and past UNDELIVERED_MAX_ORDERS
+// the order buffered longest ago is evicted.
+func TestUndeliveredBuffersAndForwards(t *testing.T) {
+	fw := withUndelivered(t, 2, 2)
+	for _, s := range []string{"PENDING", "PAID", "SHIPPED"} {
+		notifyStatus("o-buf-1", s)
+	}
+	if len(fw.msgs) != 3 || string(fw.msgs[0].Key) != "o-buf-1" || headerValue(fw.msgs[0], headerEventType) != "OrderStatus" {
+		t.Fatalf("forwarded %d messages, first %+v", len(fw.msgs), fw.msgs)
+	}
+	notifyStatus("o-buf-2", "PENDING")
+	notifyStatus("o-buf-3", "PENDING")
+
+	if got := undelivered.take("o-buf-1"); got != nil {
+		t.Fatalf("o-buf-1 kept %q after two newer orders, want it evicted", got)
+	}
+	for _, id := range []string{"o-buf-2", "o-buf-3"} {
+		if got := undelivered.take(id); len(got) != 1 {
+			t.Fatalf("%s buffered %q, want its one status", id, got)
+		}
+	}
+
+	withUndelivered(t, 2, 10)
+	for _, s := range []string{"PENDING", "PAID", "SHIPPED"} {
+		notifyStatus("o-buf-4", s)
+	}
+	got := undelivered.take("o-buf-4")
+	if len(got) != 2 || string(got[0]) != `{"orderId":"o-buf-4","status":"PAID"}` || string(got[1]) != `{"orderId":"o-buf-4","status":"SHIPPED"}` {
+		t.Fatalf("kept %q, want the latest two in order", got)
+	}
+}
+
+// TestUndeliveredSentOnReconnect buffers a status while its client is away
+// and expects the client to get it first when it subscribes again, and the
+// buffer to be emptied.
+func TestUndeliveredSentOnReconnect(t *testing.T) {
+	withUndelivered(t, 10, 10)
+	notifyStatus("o-back", "PAID")
+
+	srv := httptest.NewServer(eventsHandler(nil, "", nil, time.Second, time.Second))
+	defer srv.Close()
+	resp, err := getEvents(srv.URL+"?orderId=o-back", "text/event-stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != "data: {\"orderId\":\"o-back\",\"status\":\"PAID\"}\n" {
+		t.Fatalf("got %q, %v", line, err)
+	}
+	if got := undelivered.take("o-back"); got != nil {
+		t.Fatalf("still buffered: %q", got)
+	}
+	dropSubscribers("o-back")
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"kafka-microservice/services/orders-api/codec"
+	"kafka-microservice/services/orders-api/schema"
+)
+
+// AmendOrderRequest is the body of PATCH /orders/{id}: the order's full new
+// item list and the total for it, in the order's currency.
+type AmendOrderRequest struct {
+	Items []OrderItem `json:"items"`
+	Total *Money      `json:"total"`
+}
+
+// OrderAmended is published to AMEND_TOPIC (default orders.amended) for an
+// order that is still PENDING. Items and Total are the new item list and
+// total; Deltas is what changed per SKU, positive for units added and
+// negative for units released. Version is the order's amendment count once
+// this one applies, so an amendment computed from a stale read of the order
+// is rejected instead of stacking its deltas on another's. orders-processor
+// accepts it only if the order is still PENDING at Version-1, and
+// stock-service applies the deltas once it has.
+type OrderAmended struct {
+	OrderID       string      `json:"orderId"`
+	Items         []OrderItem `json:"items"`
+	Deltas        []OrderItem `json:"deltas"`
+	Total         Money       `json:"total"`
+	Currency      string      `json:"currency,omitempty"`
+	Version       int         `json:"version"`
+	AmendedAt     string      `json:"amendedAt"`
+	CorrelationID string      `json:"correlationId,omitempty"`
+}
+
+// queriedOrder is the part of the orders-query projection an amendment
+// needs.
+type queriedOrder struct {
+	Items         []OrderItem `json:"items"`
+	Status        string      `json:"status"`
+	Currency      string      `json:"currency"`
+	Version       int         `json:"version"`
+	CorrelationID string      `json:"correlationId"`
+}
+
+var (
+	errOrderNotFound    = errors.New("order not found")
+	errOrderUnavailable = errors.New("orders-query unavailable")
+)
+
+// fetchOrder looks orderID up in orders-query (ORDERS_QUERY_URL).
+func fetchOrder(ctx context.Context, orderID string) (queriedOrder, error) {
+	var o queriedOrder
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, getenv("ORDERS_QUERY_URL", "http://localhost:8085")+"/orders/"+url.PathEscape(orderID), nil)
+	if err != nil {
+		return o, err
+	}
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		return o, fmt.Errorf("%w: %v", errOrderUnavailable, err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return o, errOrderNotFound
+	case resp.StatusCode != http.StatusOK:
+		return o, fmt.Errorf("%w: status %d", errOrderUnavailable, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&o); err != nil {
+		return o, fmt.Errorf("%w: %v", errOrderUnavailable, err)
+	}
+	return o, nil
+}
+
+// amendDeltas returns the per-SKU change from before to after, sorted by
+// SKU, leaving out SKUs whose quantity is unchanged.
+func amendDeltas(before, after []OrderItem) []OrderItem {
+	qty := map[string]int{}
+	for _, it := range before {
+		qty[it.SKU] -= it.Qty
+	}
+	for _, it := range after {
+		qty[it.SKU] += it.Qty
+	}
+	deltas := []OrderItem{}
+	for sku, n := range qty {
+		if n != 0 {
+			deltas = append(deltas, OrderItem{SKU: sku, Qty: n})
+		}
+	}
+	sort.Slice(deltas, func(i, j int) bool { return deltas[i].SKU < deltas[j].SKU })
+	return deltas
+}
+
+// amendHandler serves PATCH /orders/{id}. Only PENDING orders can be
+// amended, by whoever holds the order's token; anything further along
+// answers 409. The new total passes the same guard as a new order, except
+// that one needing review is refused, and units added are checked against
+// stock like a new order.
+func amendHandler(stock *stockChecker, allowlist *skuAllowlist, guard *orderGuard, validator *schema.Validator, eventCodec codec.Codec, w messageWriter, inFlight *sync.WaitGroup) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		// shutdown waits for this produce before closing w
+		inFlight.Add(1)
+		defer inFlight.Done()
+		if cors(rw, r, "PATCH") {
+			return
+		}
+		if r.Method != http.MethodPatch {
+			writeError(rw, http.StatusMethodNotAllowed, APIError{Code: CodeMethodNotAllowed, Message: "use PATCH"})
+			return
+		}
+		orderID := strings.TrimPrefix(r.URL.Path, "/orders/")
+		if orderID == "" || strings.Contains(orderID, "/") {
+			writeError(rw, http.StatusNotFound, APIError{Code: CodeOrderNotFound, Message: "order not found"})
+			return
+		}
+		if err := authorizeOrder(r, orderID); err != nil {
+			writeError(rw, http.StatusForbidden, APIError{Code: CodeForbidden, Message: err.Error()})
+			return
+		}
+		if !isJSONRequest(r) {
+			writeError(rw, http.StatusUnsupportedMediaType, APIError{Code: CodeUnsupportedMedia, Message: "Content-Type must be application/json"})
+			return
+		}
+		var req AmendOrderRequest
+		if status, err := decodeJSONBody(rw, r, &req); err != nil {
+			code := CodeInvalidJSON
+			if status == http.StatusUnprocessableEntity {
+				code = CodeValidationFailed
+			}
+			writeError(rw, status, APIError{Code: code, Message: err.Error()})
+			return
+		}
+		if req.Total == nil {
+			writeError(rw, http.StatusUnprocessableEntity, APIError{Code: CodeValidationFailed, Message: "total is required"})
+			return
+		}
+		normalizeItems(req.Items)
+		if apiErr := allowlist.checkItems(r.Context(), req.Items); apiErr != nil {
+			writeError(rw, http.StatusUnprocessableEntity, *apiErr)
+			return
+		}
+
+		order, err := fetchOrder(r.Context(), orderID)
+		switch {
+		case errors.Is(err, errOrderNotFound):
+			writeError(rw, http.StatusNotFound, APIError{Code: CodeOrderNotFound, Message: "order not found"})
+			return
+		case err != nil:
+			slog.Warn("order lookup failed", "error", err)
+			writeError(rw, http.StatusServiceUnavailable, APIError{Code: CodeOrderUnavailable, Message: "order status unavailable"})
+			return
+		case order.Status != "PENDING":
+			writeError(rw, http.StatusConflict, APIError{Code: CodeOrderNotAmendable, Message: fmt.Sprintf("order is %s; only PENDING orders can be amended", order.Status)})
+			return
+		}
+
+		total := *req.Total
+		total.Currency = order.Currency
+		checked, status, apiErr := guard.check(r.Context(), req.Items, total, order.Currency)
+		if apiErr != nil {
+			writeError(rw, status, *apiErr)
+			return
+		}
+		if checked.Review {
+			// the order is already on its way; it cannot be held back now
+			writeError(rw, http.StatusUnprocessableEntity, APIError{Code: CodeOrderValueExceeded, Message: fmt.Sprintf("amended total %s would need review; place a new order instead", total)})
+			return
+		}
+
+		deltas := amendDeltas(order.Items, req.Items)
+		var added []OrderItem
+		for _, d := range deltas {
+			if d.Qty > 0 {
+				added = append(added, d)
+			}
+		}
+		if len(added) > 0 {
+			if err := stock.check(added); err != nil {
+				slog.Info("stock validation failed", "error", err)
+				status, apiErr := stockError(err)
+				writeError(rw, status, apiErr)
+				return
+			}
+		}
+
+		correlationID := order.CorrelationID
+		if correlationID == "" {
+			correlationID = uuid.NewString()
+		}
+		evt := OrderAmended{OrderID: orderID, Items: req.Items, Deltas: deltas, Total: total, Currency: order.Currency, Version: order.Version + 1, AmendedAt: time.Now().UTC().Format(time.RFC3339), CorrelationID: correlationID}
+		payload, _ := json.Marshal(evt)
+		if err := validator.Validate("OrderAmended", payload); err != nil {
+			writeError(rw, http.StatusBadRequest, APIError{Code: CodeValidationFailed, Message: "amendment does not match the OrderAmended schema", Details: err.Error()})
+			return
+		}
+		value, err := eventCodec.Encode(r.Context(), "OrderAmended", payload)
+		if err != nil {
+			slog.Error("encode failed", "error", err)
+			writeError(rw, http.StatusInternalServerError, APIError{Code: CodeEncodeFailed, Message: "encode failed"})
+			return
+		}
+		if err := w.WriteMessages(r.Context(), withCorrelation(buildMessage(orderID, "OrderAmended", value), correlationID)); err != nil {
+			slog.Error("write failed", "error", err)
+			writeError(rw, http.StatusInternalServerError, APIError{Code: CodeProduceFailed, Message: "produce failed"})
+			return
+		}
+		// accepted, not applied: the processor has the final say, and turns
+		// the amendment down if another one reached the order first; the
+		// order in orders-query then shows it as lastRejectedAmendment
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(rw).Encode(evt)
+	}
+}
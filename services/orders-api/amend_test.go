@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+
+	"kafka-microservice/services/orders-api/codec"
+	"kafka-microservice/services/orders-api/events"
+	"kafka-microservice/services/orders-api/schema"
+)
+
+func TestAmendDeltas(t *testing.T) {
+	cases := []struct {
+		name          string
+		before, after []OrderItem
+		want          []OrderItem
+	}{
+		{"unchanged", []OrderItem{{"S1", 2}}, []OrderItem{{"S1", 2}}, []OrderItem{}},
+		{"more", []OrderItem{{"S1", 2}}, []OrderItem{{"S1", 5}}, []OrderItem{{"S1", 3}}},
+		{"fewer", []OrderItem{{"S1", 5}}, []OrderItem{{"S1", 1}}, []OrderItem{{"S1", -4}}},
+		{"sku swapped", []OrderItem{{"S1", 2}}, []OrderItem{{"S2", 1}}, []OrderItem{{"S1", -2}, {"S2", 1}}},
+		{"repeated lines summed", []OrderItem{{"S1", 1}, {"S1", 1}}, []OrderItem{{"S1", 3}}, []OrderItem{{"S1", 1}}},
+		{"sorted by sku", []OrderItem{{"S3", 1}}, []OrderItem{{"S2", 1}, {"S1", 1}, {"S3", 1}}, []OrderItem{{"S1", 1}, {"S2", 1}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := amendDeltas(tc.before, tc.after); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+type captureWriter struct {
+	mu   sync.Mutex
+	msgs []kafka.Message
+}
+
+func (c *captureWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.msgs = append(c.msgs, msgs...)
+	return nil
+}
+
+// amendFixture serves orders-query's GET /orders/{id} with order and
+// stock-service's /stock and /catalog with S1 and S2 in stock.
+func amendFixture(t *testing.T, order queriedOrder, guard *orderGuard) (http.HandlerFunc, *captureWriter) {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/orders/o-1":
+			_ = json.NewEncoder(w).Encode(order)
+		case r.URL.Path == "/stock":
+			_ = json.NewEncoder(w).Encode(map[string]int{"S1": 10, "S2": 10})
+		case r.URL.Path == "/catalog":
+			_ = json.NewEncoder(w).Encode([]map[string]interface{}{{"sku": "S1", "price": 5, "currency": "USD"}, {"sku": "S2", "price": 5, "currency": "USD"}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+	t.Setenv("ORDERS_QUERY_URL", upstream.URL)
+	t.Setenv("STOCK_SERVICE_URL", upstream.URL)
+	snapshot := stockSnapshot
+	stockSnapshot = &stockCache{}
+	t.Cleanup(func() { stockSnapshot = snapshot })
+
+	stock, err := newStockChecker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowlist, err := newSKUAllowlist()
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator, err := schema.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if guard == nil {
+		guard = testGuard(t, "", "")
+	}
+	w := &captureWriter{}
+	return amendHandler(stock, allowlist, guard, validator, codec.JSONCodec{}, w, &sync.WaitGroup{}), w
+}
+
+func patch(h http.HandlerFunc, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var e APIError
+	_ = json.Unmarshal(rec.Body.Bytes(), &e)
+	return e.Code
+}
+
+func TestAmendPendingOrder(t *testing.T) {
+	h, w := amendFixture(t, queriedOrder{Items: []OrderItem{{"S1", 2}}, Status: "PENDING", Currency: "USD", Version: 3, CorrelationID: "c-1"}, nil)
+	rec := patch(h, "/orders/o-1", `{"items":[{"sku":" s1 ","qty":1},{"sku":"S2","qty":2}],"total":15}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if len(w.msgs) != 1 {
+		t.Fatalf("produced %d messages, want 1", len(w.msgs))
+	}
+	m := w.msgs[0]
+	if string(m.Key) != "o-1" {
+		t.Fatalf("key %q", m.Key)
+	}
+	var got string
+	for _, h := range m.Headers {
+		if h.Key == headerCorrelationID {
+			got = string(h.Value)
+		}
+	}
+	if got != "c-1" {
+		t.Fatalf("correlation header %q, want the order's c-1", got)
+	}
+	_, body, err := events.Decode(m.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var evt OrderAmended
+	if err := json.Unmarshal(body, &evt); err != nil {
+		t.Fatal(err)
+	}
+	if evt.Version != 4 || evt.CorrelationID != "c-1" || evt.Total.Amount != 1500 || evt.Currency != "USD" {
+		t.Fatalf("event %+v", evt)
+	}
+	if want := []OrderItem{{"S1", -1}, {"S2", 2}}; !reflect.DeepEqual(evt.Deltas, want) {
+		t.Fatalf("deltas %v, want %v", evt.Deltas, want)
+	}
+}
+
+func TestAmendRejections(t *testing.T) {
+	pending := queriedOrder{Items: []OrderItem{{"S1", 1}}, Status: "PENDING", Currency: "USD"}
+	cases := []struct {
+		name   string
+		order  queriedOrder
+		guard  *orderGuard
+		body   string
+		status int
+		code   string
+	}{
+		{"paid", queriedOrder{Items: []OrderItem{{"S1", 1}}, Status: "PAID"}, nil, `{"items":[{"sku":"S1","qty":2}],"total":10}`, http.StatusConflict, CodeOrderNotAmendable},
+		{"total missing", pending, nil, `{"items":[{"sku":"S1","qty":2}]}`, http.StatusUnprocessableEntity, CodeValidationFailed},
+		{"negative total", pending, nil, `{"items":[{"sku":"S1","qty":2}],"total":-1}`, http.StatusUnprocessableEntity, CodeValidationFailed},
+		{"above MAX_ORDER_VALUE", pending, testGuard(t, "USD=100", ""), `{"items":[{"sku":"S1","qty":2}],"total":100.01}`, http.StatusUnprocessableEntity, CodeOrderValueExceeded},
+		{"above REVIEW_THRESHOLD", pending, testGuard(t, "", "USD=50"), `{"items":[{"sku":"S1","qty":2}],"total":60}`, http.StatusUnprocessableEntity, CodeOrderValueExceeded},
+		{"total mismatch", pending, func() *orderGuard { g := testGuard(t, "", ""); g.verifyTotal = true; return g }(), `{"items":[{"sku":"S1","qty":2}],"total":1}`, http.StatusUnprocessableEntity, CodeTotalMismatch},
+		{"out of stock", pending, nil, `{"items":[{"sku":"S1","qty":50}],"total":10}`, http.StatusConflict, CodeInsufficientStock},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h, w := amendFixture(t, tc.order, tc.guard)
+			rec := patch(h, "/orders/o-1", tc.body)
+			if rec.Code != tc.status || errorCode(t, rec) != tc.code {
+				t.Fatalf("got %d %s, want %d %s", rec.Code, rec.Body, tc.status, tc.code)
+			}
+			if len(w.msgs) != 0 {
+				t.Fatalf("produced %d messages for a rejected amendment", len(w.msgs))
+			}
+		})
+	}
+}
+
+func TestAmendRequiresOrderToken(t *testing.T) {
+	secret := orderTokenSecret
+	orderTokenSecret = []byte("test-secret")
+	t.Cleanup(func() { orderTokenSecret = secret })
+	h, _ := amendFixture(t, queriedOrder{Items: []OrderItem{{"S1", 1}}, Status: "PENDING", Currency: "USD"}, nil)
+	body := `{"items":[{"sku":"S1","qty":2}],"total":10}`
+
+	if rec := patch(h, "/orders/o-1", body); rec.Code != http.StatusForbidden || errorCode(t, rec) != CodeForbidden {
+		t.Fatalf("no token: %d %s", rec.Code, rec.Body)
+	}
+	if rec := patch(h, "/orders/o-1?token="+signOrderToken("o-2", "u-1"), body); rec.Code != http.StatusForbidden {
+		t.Fatalf("token for another order: %d %s", rec.Code, rec.Body)
+	}
+	if rec := patch(h, "/orders/o-1?token="+signOrderToken("o-1", "u-1"), body); rec.Code != http.StatusAccepted {
+		t.Fatalf("own token: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestFetchOrderEscapesID(t *testing.T) {
+	var gotPath, gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery = r.URL.Path, r.URL.RawQuery
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+	t.Setenv("ORDERS_QUERY_URL", srv.URL)
+	if _, err := fetchOrder(context.Background(), "a?b=c"); err != errOrderNotFound {
+		t.Fatalf("err = %v", err)
+	}
+	if gotPath != "/orders/a?b=c" || gotQuery != "" {
+		t.Fatalf("requested path %q query %q", gotPath, gotQuery)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// batchLinger is how long the produce batcher waits for more orders before
+// writing what it has (BATCH_LINGER, default 5ms); 0 writes each order on
+// its own. batchSize caps a batch (BATCH_SIZE, default 100).
+var (
+	batchLinger = func() time.Duration {
+		d, err := time.ParseDuration(getenv("BATCH_LINGER", "5ms"))
+		if err != nil || d < 0 {
+			slog.Warn("invalid BATCH_LINGER, using 5ms")
+			return 5 * time.Millisecond
+		}
+		return d
+	}()
+	batchSize = func() int {
+		n, err := strconv.Atoi(getenv("BATCH_SIZE", "100"))
+		if err != nil || n <= 0 {
+			return 100
+		}
+		return n
+	}()
+)
+
+// messageWriter is what placeOrder produces through: a *kafka.Writer, or a
+// produceBatcher in front of one.
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+var errBatcherClosed = errors.New("produce batcher closed")
+
+// errOutcomeUnknown means the caller stopped waiting for a message already
+// handed to the writer, which may still write it.
+var errOutcomeUnknown = errors.New("produce outcome unknown")
+
+// produceBatcher gathers messages from concurrent requests and writes them
+// with one WriteMessages call once batchSize have queued or batchLinger has
+// passed since the first, trading a few milliseconds per order for far
+// fewer produce round trips under bursty load. Each caller still gets the
+// result for its own message.
+type produceBatcher struct {
+	w      messageWriter
+	linger time.Duration
+	size   int
+
+	mu     sync.RWMutex // held for reading while enqueueing, see Close
+	closed bool
+	queue  chan queuedMessage
+	done   chan struct{}
+}
+
+type queuedMessage struct {
+	msg    kafka.Message
+	result chan error
+}
+
+// newProduceBatcher starts a batcher in front of w, or returns w itself
+// when linger is 0.
+func newProduceBatcher(w messageWriter, linger time.Duration, size int) messageWriter {
+	if linger <= 0 {
+		return w
+	}
+	b := &produceBatcher{w: w, linger: linger, size: size, queue: make(chan queuedMessage, size), done: make(chan struct{})}
+	go b.run()
+	return b
+}
+
+// WriteMessages queues msgs for the next batch and waits until it has been
+// written, returning the first failure among msgs.
+func (b *produceBatcher) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	results := make([]chan error, len(msgs))
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return errBatcherClosed
+	}
+	for i, m := range msgs {
+		results[i] = make(chan error, 1)
+		select {
+		case b.queue <- queuedMessage{msg: m, result: results[i]}:
+		case <-ctx.Done():
+			b.mu.RUnlock()
+			if i > 0 {
+				return fmt.Errorf("%w: %w", errOutcomeUnknown, ctx.Err())
+			}
+			return ctx.Err()
+		}
+	}
+	b.mu.RUnlock()
+
+	var first error
+	for _, res := range results {
+		select {
+		case err := <-res:
+			if first == nil {
+				first = err
+			}
+		case <-ctx.Done():
+			// the message may still be written with its batch
+			return fmt.Errorf("%w: %w", errOutcomeUnknown, ctx.Err())
+		}
+	}
+	return first
+}
+
+func (b *produceBatcher) run() {
+	defer close(b.done)
+	for first := range b.queue {
+		batch := []queuedMessage{first}
+		timer := time.NewTimer(b.linger)
+	collect:
+		for len(batch) < b.size {
+			select {
+			case q, ok := <-b.queue:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, q)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+		b.flush(batch)
+	}
+}
+
+// flush writes batch and hands each caller its message's result. A
+// kafka.WriteErrors carries one error per message; any other error failed
+// the whole batch.
+func (b *produceBatcher) flush(batch []queuedMessage) {
+	msgs := make([]kafka.Message, len(batch))
+	for i, q := range batch {
+		msgs[i] = q.msg
+	}
+	err := b.w.WriteMessages(context.Background(), msgs...)
+	var perMessage kafka.WriteErrors
+	split := errors.As(err, &perMessage) && len(perMessage) == len(batch)
+	for i, q := range batch {
+		if split {
+			q.result <- perMessage[i]
+		} else {
+			q.result <- err
+		}
+	}
+}
+
+// produceError maps a failed write of orderID's OrderCreated onto a
+// response. mayBeWritten reports that the write was abandoned rather than
+// refused, because the request's context ended: the order may yet reach
+// Kafka, so its id must stay reserved and a retry be told it is a
+// duplicate rather than placed twice.
+func produceError(orderID string, err error) (status int, apiErr *APIError, mayBeWritten bool) {
+	switch {
+	case errors.Is(err, errOutcomeUnknown), errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		slog.Warn("order write abandoned", "order", orderID, "error", err)
+		return http.StatusGatewayTimeout, &APIError{Code: CodeOutcomeUnknown, Message: fmt.Sprintf("order %s may still be placed; check its status before placing it again", orderID), Details: map[string]string{"orderId": orderID}}, true
+	case errors.Is(err, kafka.MessageSizeTooLarge):
+		// the broker's limit is lower than MAX_MESSAGE_BYTES
+		slog.Error("write failed", "error", err)
+		return http.StatusRequestEntityTooLarge, &APIError{Code: CodePayloadTooLarge, Message: "order is larger than the broker accepts; split it into smaller orders"}, false
+	default:
+		slog.Error("write failed", "error", err)
+		return http.StatusInternalServerError, &APIError{Code: CodeProduceFailed, Message: "produce failed"}, false
+	}
+}
+
+// Close writes whatever is queued and stops the batcher; later writes fail
+// with errBatcherClosed. It must run before the underlying writer closes.
+func (b *produceBatcher) Close() error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.queue)
+	}
+	b.mu.Unlock()
+	<-b.done
+	return nil
+}
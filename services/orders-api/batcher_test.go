@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// heldWriter blocks every write until release is closed.
+type heldWriter struct{ release chan struct{} }
+
+func (w heldWriter) WriteMessages(ctx context.Context, _ ...kafka.Message) error {
+	<-w.release
+	return nil
+}
+
+// TestBatcherCancelledWaitIsOutcomeUnknown gives up on a message already
+// queued and expects errOutcomeUnknown, which keeps the order id reserved.
+func TestBatcherCancelledWaitIsOutcomeUnknown(t *testing.T) {
+	w := heldWriter{release: make(chan struct{})}
+	b := newProduceBatcher(w, time.Millisecond, 10).(*produceBatcher)
+	defer b.Close()
+	defer close(w.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := b.WriteMessages(ctx, kafka.Message{Key: []byte("o-1")})
+	if !errors.Is(err, errOutcomeUnknown) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want errOutcomeUnknown wrapping the deadline", err)
+	}
+	status, apiErr, mayBeWritten := produceError("o-1", err)
+	if status != http.StatusGatewayTimeout || apiErr.Code != CodeOutcomeUnknown || !mayBeWritten {
+		t.Fatalf("produceError = %d %+v %v", status, apiErr, mayBeWritten)
+	}
+}
+
+func TestProduceErrorFreesRefusedWrites(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{kafka.MessageSizeTooLarge, http.StatusRequestEntityTooLarge, CodePayloadTooLarge},
+		{errors.New("leader not available"), http.StatusInternalServerError, CodeProduceFailed},
+		{errBatcherClosed, http.StatusInternalServerError, CodeProduceFailed},
+	} {
+		status, apiErr, mayBeWritten := produceError("o-1", tc.err)
+		if status != tc.status || apiErr.Code != tc.code || mayBeWritten {
+			t.Errorf("%v: got %d %s %v, want %d %s and the id freed", tc.err, status, apiErr.Code, mayBeWritten, tc.status, tc.code)
+		}
+	}
+}
+
+// roundTripWriter takes rtt per WriteMessages call, one call at a time, like
+// a producer with a single request in flight.
+type roundTripWriter struct {
+	mu  sync.Mutex
+	rtt time.Duration
+}
+
+func (w *roundTripWriter) WriteMessages(context.Context, ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	time.Sleep(w.rtt)
+	return nil
+}
+
+// BenchmarkProduce compares writing each order on its own against the
+// batcher, with 64 concurrent requests per CPU. The simulated writer has one
+// request in flight; with KAFKA_BROKERS set the same runs go through a
+// *kafka.Writer as newWriter builds it, which batches concurrent writes
+// itself, e.g.
+//
+//	KAFKA_BROKERS=localhost:9093 go test -run '^$' -bench Produce
+func BenchmarkProduce(b *testing.B) {
+	writers := map[string]func(b *testing.B) messageWriter{
+		"simulated": func(*testing.B) messageWriter { return &roundTripWriter{rtt: 500 * time.Microsecond} },
+	}
+	if addrs := getenv("KAFKA_BROKERS", ""); addrs != "" {
+		writers["kafka"] = func(b *testing.B) messageWriter {
+			brokers := strings.Split(addrs, ",")
+			topic := fmt.Sprintf("bench-produce-%d", time.Now().UnixNano())
+			if err := ensureTopics(brokers, topic); err != nil {
+				b.Fatal(err)
+			}
+			w := newWriter(brokers, topic)
+			b.Cleanup(func() { w.Close() })
+			return w
+		}
+	}
+	for name, newOut := range writers {
+		for _, linger := range []time.Duration{0, batchLinger} {
+			mode := "per-request"
+			if linger > 0 {
+				mode = "batched"
+			}
+			b.Run(name+"/"+mode, func(b *testing.B) {
+				out := newProduceBatcher(newOut(b), linger, batchSize)
+				if pb, ok := out.(*produceBatcher); ok {
+					defer pb.Close()
+				}
+				msg := kafka.Message{Key: []byte("o-bench"), Value: []byte(`{"orderId":"o-bench"}`)}
+				b.SetParallelism(64)
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						if err := out.WriteMessages(context.Background(), msg); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				})
+			})
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// maxBodyBytes caps JSON request bodies (MAX_BODY_BYTES, default 1MB).
+var maxBodyBytes = func() int64 {
+	n, err := strconv.ParseInt(getenv("MAX_BODY_BYTES", "1048576"), 10, 64)
+	if err != nil || n <= 0 {
+		return 1 << 20
+	}
+	return n
+}()
+
+// maxMessageBytes caps the size of a produced OrderCreated, key and headers
+// included (MAX_MESSAGE_BYTES, default 1000000 to match the broker's
+// message.max.bytes). Raise it together with the broker setting. An order
+// over the limit is refused rather than split: every consumer treats one
+// OrderCreated as the whole order.
+var maxMessageBytes = func() int {
+	n, err := strconv.Atoi(getenv("MAX_MESSAGE_BYTES", "1000000"))
+	if err != nil || n <= 0 {
+		return 1000000
+	}
+	return n
+}()
+
+// messageSize approximates m's size on the wire, ignoring record framing.
+func messageSize(m kafka.Message) int {
+	n := len(m.Key) + len(m.Value)
+	for _, h := range m.Headers {
+		n += len(h.Key) + len(h.Value)
+	}
+	return n
+}
+
+// checkMessageSize refuses msg with CodePayloadTooLarge when it is over
+// maxMessageBytes; the caller answers 413.
+func checkMessageSize(msg kafka.Message) *APIError {
+	if size := messageSize(msg); size > maxMessageBytes {
+		return &APIError{Code: CodePayloadTooLarge, Message: fmt.Sprintf("order encodes to %d bytes, more than the %d a message may hold; split it into smaller orders", size, maxMessageBytes)}
+	}
+	return nil
+}
+
+// isJSONRequest reports whether r declares a JSON body. Parameters such as
+// charset are allowed; a missing Content-Type is not.
+func isJSONRequest(r *http.Request) bool {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mt == "application/json"
+}
+
+// decodeJSONBody decodes r's body into dst, streaming through a size-limited
+// reader and rejecting fields dst does not declare. On failure it returns the
+// HTTP status to answer with: 413 for an oversized body, 422 for a
+// well-formed body with an invalid amount, 400 otherwise.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) (int, error) {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return http.StatusRequestEntityTooLarge, errors.New("request body too large")
+		}
+		if errors.Is(err, errInvalidAmount) {
+			return http.StatusUnprocessableEntity, err
+		}
+		return http.StatusBadRequest, err
+	}
+	return 0, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestOrdersContentType(t *testing.T) {
+	atomic.StoreInt64(&kafkaReady, 1)
+	t.Cleanup(func() { atomic.StoreInt64(&kafkaReady, 0) })
+	for _, tc := range []struct {
+		contentType string
+		want        int
+	}{
+		{"", http.StatusUnsupportedMediaType},
+		{"application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"text/plain; charset=utf-8", http.StatusUnsupportedMediaType},
+		{"application/json", http.StatusCreated},
+		{"application/json; charset=utf-8", http.StatusCreated},
+	} {
+		h := ordersHandler(func(context.Context, CreateOrderRequest) (string, int, *APIError) {
+			return "o-1", http.StatusCreated, nil
+		}, newInflight())
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"userId":"u1","items":[{"sku":"S1","qty":1}],"total":1}`))
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("Content-Type %q: got %d %s, want %d", tc.contentType, rec.Code, rec.Body, tc.want)
+		}
+		if tc.want == http.StatusUnsupportedMediaType && !strings.Contains(rec.Body.String(), CodeUnsupportedMedia) {
+			t.Errorf("Content-Type %q: body %s, want %s", tc.contentType, rec.Body, CodeUnsupportedMedia)
+		}
+	}
+}
+
+// TestOversizedOrderIs413 builds the OrderCreated of an order with thousands
+// of items, as placeOrder does, and expects it refused with 413.
+func TestOversizedOrderIs413(t *testing.T) {
+	atomic.StoreInt64(&kafkaReady, 1)
+	t.Cleanup(func() { atomic.StoreInt64(&kafkaReady, 0) })
+	prev := maxMessageBytes
+	maxMessageBytes = 64 << 10
+	t.Cleanup(func() { maxMessageBytes = prev })
+
+	h := ordersHandler(func(_ context.Context, req CreateOrderRequest) (string, int, *APIError) {
+		payload, _ := json.Marshal(OrderCreated{OrderID: "o-big", UserID: req.UserID, Items: req.Items, Total: req.Total})
+		if apiErr := checkMessageSize(buildMessage("o-big", "OrderCreated", payload)); apiErr != nil {
+			return "", http.StatusRequestEntityTooLarge, apiErr
+		}
+		return "o-big", http.StatusCreated, nil
+	}, newInflight())
+	for n, want := range map[int]int{1: http.StatusCreated, 5000: http.StatusRequestEntityTooLarge} {
+		items := make([]string, n)
+		for i := range items {
+			items[i] = fmt.Sprintf(`{"sku":"SKU-%d","qty":1}`, i)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"userId":"u1","items":[`+strings.Join(items, ",")+`],"total":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != want {
+			t.Fatalf("%d items: got %d %.200s, want %d", n, rec.Code, rec.Body, want)
+		}
+		if want == http.StatusRequestEntityTooLarge && !strings.Contains(rec.Body.String(), CodePayloadTooLarge) {
+			t.Fatalf("%d items: body %.200s, want %s", n, rec.Body, CodePayloadTooLarge)
+		}
+	}
+}
+
+// TestOrderBodyLimits covers the request hardening of POST /orders: a body
+// over MAX_BODY_BYTES is 413, an undeclared field is 400.
+func TestOrderBodyLimits(t *testing.T) {
+	atomic.StoreInt64(&kafkaReady, 1)
+	t.Cleanup(func() { atomic.StoreInt64(&kafkaReady, 0) })
+	prev := maxBodyBytes
+	maxBodyBytes = 256
+	t.Cleanup(func() { maxBodyBytes = prev })
+
+	for _, tc := range []struct {
+		name, body string
+		want       int
+		code       string
+	}{
+		{"valid", `{"userId":"u1","items":[{"sku":"S1","qty":1}],"total":1}`, http.StatusCreated, ""},
+		{"unknown field", `{"userId":"u1","items":[{"sku":"S1","qty":1}],"total":1,"coupon":"FREE"}`, http.StatusBadRequest, CodeInvalidJSON},
+		{"unknown item field", `{"userId":"u1","items":[{"sku":"S1","qty":1,"gift":true}],"total":1}`, http.StatusBadRequest, CodeInvalidJSON},
+		{"oversized", `{"userId":"` + strings.Repeat("u", 300) + `","items":[{"sku":"S1","qty":1}],"total":1}`, http.StatusRequestEntityTooLarge, CodePayloadTooLarge},
+	} {
+		h := ordersHandler(func(context.Context, CreateOrderRequest) (string, int, *APIError) {
+			return "o-1", http.StatusCreated, nil
+		}, newInflight())
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: got %d %s, want %d", tc.name, rec.Code, rec.Body, tc.want)
+		}
+		if tc.code != "" && !strings.Contains(rec.Body.String(), tc.code) {
+			t.Errorf("%s: body %s, want %s", tc.name, rec.Body, tc.code)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/sony/gobreaker"
+)
+
+// stockChecker wraps checkStockAvailability in a circuit breaker. After
+// STOCK_BREAKER_THRESHOLD consecutive failures to reach stock-service
+// (default 5) the breaker opens and checks fail fast for
+// STOCK_BREAKER_TIMEOUT (default 30s), after which a single probe decides
+// whether it closes again. Insufficient stock and unknown SKUs are answers,
+// not failures, and never trip it.
+//
+// With STOCK_CHECK_MODE=best_effort an open breaker lets orders through
+// unchecked instead of rejecting them.
+type stockChecker struct {
+	cb         *gobreaker.CircuitBreaker
+	bestEffort bool
+}
+
+func newStockChecker() (*stockChecker, error) {
+	threshold, err := strconv.ParseUint(getenv("STOCK_BREAKER_THRESHOLD", "5"), 10, 32)
+	if err != nil || threshold == 0 {
+		return nil, fmt.Errorf("invalid STOCK_BREAKER_THRESHOLD")
+	}
+	timeout, err := time.ParseDuration(getenv("STOCK_BREAKER_TIMEOUT", "30s"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid STOCK_BREAKER_TIMEOUT: %w", err)
+	}
+	var bestEffort bool
+	switch v := getenv("STOCK_CHECK_MODE", "strict"); v {
+	case "strict":
+	case "best_effort":
+		bestEffort = true
+	default:
+		return nil, fmt.Errorf("unknown STOCK_CHECK_MODE %q", v)
+	}
+
+	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		Name:        "stock-service",
+		MaxRequests: 1,
+		Timeout:     timeout,
+		ReadyToTrip: func(c gobreaker.Counts) bool {
+			return c.ConsecutiveFailures >= uint32(threshold)
+		},
+		IsSuccessful: func(err error) bool {
+			return err == nil || !errors.Is(err, errStockUnavailable)
+		},
+		OnStateChange: func(name string, from, to gobreaker.State) {
+			slog.Warn("breaker state changed", "breaker", name, "from", from.String(), "to", to.String())
+		},
+	})
+	return &stockChecker{cb: cb, bestEffort: bestEffort}, nil
+}
+
+func (c *stockChecker) check(items []OrderItem) error {
+	_, err := c.cb.Execute(func() (interface{}, error) {
+		return nil, checkStockAvailability(items)
+	})
+	if errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests) {
+		if c.bestEffort {
+			slog.Warn("stock breaker open, accepting order without stock check", "state", c.cb.State().String())
+			return nil
+		}
+		return fmt.Errorf("%w: circuit %s", errStockUnavailable, c.cb.State())
+	}
+	return err
+}
+
+// stats reports the breaker state and counts for /stats.
+func (c *stockChecker) stats() map[string]interface{} {
+	counts := c.cb.Counts()
+	return map[string]interface{}{
+		"state":                c.cb.State().String(),
+		"requests":             counts.Requests,
+		"consecutiveFailures":  counts.ConsecutiveFailures,
+		"consecutiveSuccesses": counts.ConsecutiveSuccesses,
+		"bestEffort":           c.bestEffort,
+	}
+}
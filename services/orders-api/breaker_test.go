@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sony/gobreaker"
+)
+
+// fakeStockService answers /stock?view=available with S1=10 while healthy
+// and hangs past the client timeout otherwise.
+func fakeStockService(t *testing.T, healthy *int32) *httptest.Server {
+	t.Helper()
+	hang := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(healthy) == 0 {
+			select {
+			case <-hang:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]int{"S1": 10})
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(hang) })
+	return srv
+}
+
+func newTestStockChecker(t *testing.T, mode string, healthy *int32) *stockChecker {
+	t.Helper()
+	t.Setenv("STOCK_SERVICE_URL", fakeStockService(t, healthy).URL)
+	t.Setenv("STOCK_BREAKER_THRESHOLD", "2")
+	t.Setenv("STOCK_BREAKER_TIMEOUT", "100ms")
+	t.Setenv("STOCK_CHECK_MODE", mode)
+	client, snapshot := upstreamClient, stockSnapshot
+	upstreamClient, stockSnapshot = &http.Client{Timeout: 50 * time.Millisecond}, &stockCache{}
+	t.Cleanup(func() { upstreamClient, stockSnapshot = client, snapshot })
+	c, err := newStockChecker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestStockBreakerOpensOnHungStockServiceAndRecovers(t *testing.T) {
+	var healthy int32
+	c := newTestStockChecker(t, "strict", &healthy)
+	items := []OrderItem{{SKU: "S1", Qty: 1}}
+
+	// a hung stock-service times out and counts as a failure
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		if err := c.check(items); !errors.Is(err, errStockUnavailable) {
+			t.Fatalf("check %d: err = %v, want errStockUnavailable", i, err)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Fatalf("check %d took %s; the client timeout did not apply", i, d)
+		}
+	}
+	if s := c.cb.State(); s != gobreaker.StateOpen {
+		t.Fatalf("breaker %s after 2 failures, want open", s)
+	}
+	// open: fail fast without calling stock-service
+	start := time.Now()
+	if err := c.check(items); !errors.Is(err, errStockUnavailable) {
+		t.Fatalf("open breaker: err = %v", err)
+	}
+	if d := time.Since(start); d > 20*time.Millisecond {
+		t.Fatalf("open breaker took %s, want a fast failure", d)
+	}
+
+	// after the timeout one probe is let through and closes it
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(120 * time.Millisecond)
+	if err := c.check(items); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if s := c.cb.State(); s != gobreaker.StateClosed {
+		t.Fatalf("breaker %s after a good probe, want closed", s)
+	}
+}
+
+func TestStockBreakerIgnoresBusinessErrors(t *testing.T) {
+	healthy := int32(1)
+	c := newTestStockChecker(t, "strict", &healthy)
+	for i := 0; i < 5; i++ {
+		if err := c.check([]OrderItem{{SKU: "S1", Qty: 99}}); !errors.Is(err, errInsufficientStock) {
+			t.Fatalf("err = %v, want errInsufficientStock", err)
+		}
+		if err := c.check([]OrderItem{{SKU: "NOPE", Qty: 1}}); !errors.Is(err, errUnknownSKU) {
+			t.Fatalf("err = %v, want errUnknownSKU", err)
+		}
+	}
+	if s := c.cb.State(); s != gobreaker.StateClosed {
+		t.Fatalf("breaker %s, want closed", s)
+	}
+}
+
+func TestStockBreakerBestEffortAcceptsWhileOpen(t *testing.T) {
+	var healthy int32
+	c := newTestStockChecker(t, "best_effort", &healthy)
+	items := []OrderItem{{SKU: "S1", Qty: 1}}
+	for i := 0; i < 2; i++ {
+		_ = c.check(items)
+	}
+	if err := c.check(items); err != nil {
+		t.Fatalf("best_effort with open breaker: err = %v, want nil", err)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// TestStartupBrokerCheck expects an unreachable or malformed KAFKA_BROKERS to
+// fail the check within STARTUP_BROKER_TIMEOUT, a live broker to pass, and
+// the check to be skipped unless STARTUP_BROKER_CHECK=true.
+func TestStartupBrokerCheck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := ln.Addr().String()
+	t.Cleanup(func() { ln.Close() })
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := closed.Addr().String()
+	closed.Close()
+
+	t.Setenv("STARTUP_BROKER_TIMEOUT", "200ms")
+	for _, tc := range []struct {
+		name    string
+		brokers []string
+		ok      bool
+	}{
+		{"empty", []string{""}, false},
+		{"invalid address", []string{"kafka:not-a-port"}, false},
+		{"refused", []string{refused}, false},
+		{"unroutable", []string{"192.0.2.1:9092"}, false},
+		{"one live broker", []string{refused, live}, true},
+	} {
+		t.Setenv("STARTUP_BROKER_CHECK", "true")
+		start := time.Now()
+		err := startupBrokerCheck(tc.brokers)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: err = %v, want ok=%v", tc.name, err, tc.ok)
+		}
+		if took := time.Since(start); took > 2*time.Second {
+			t.Errorf("%s: took %s, want a failure within the timeout", tc.name, took)
+		}
+
+		t.Setenv("STARTUP_BROKER_CHECK", "false")
+		if err := startupBrokerCheck(tc.brokers); err != nil {
+			t.Errorf("%s: check disabled but got %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// catalogEntry mirrors stock-service's /catalog response.
+type catalogEntry struct {
+	SKU      string `json:"sku"`
+	Price    Money  `json:"price"`
+	Currency string `json:"currency"`
+	Quantity int    `json:"quantity"`
+}
+
+func fetchCatalog(ctx context.Context) ([]catalogEntry, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, getenv("STOCK_SERVICE_URL", "http://localhost:8084")+"/catalog", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("catalog returned %d", resp.StatusCode)
+	}
+	var entries []catalogEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// maxItems caps line items per order (MAX_ITEMS, default 50).
+var maxItems = func() int {
+	n, err := strconv.Atoi(getenv("MAX_ITEMS", "50"))
+	if err != nil || n <= 0 {
+		return 50
+	}
+	return n
+}()
+
+// skuAllowlist decides which SKUs an order may reference: those matching
+// SKU_PATTERN, when set, or present in stock-service's catalog. The catalog
+// set is cached for SKU_CACHE_TTL (default 30s).
+type skuAllowlist struct {
+	pattern *regexp.Regexp
+	ttl     time.Duration
+	fetch   func(context.Context) ([]catalogEntry, error)
+
+	mu       sync.Mutex
+	known    map[string]bool
+	fetched  time.Time
+	failed   time.Time // last failed refresh; see catalogRetryBackoff
+	inflight chan struct{}
+}
+
+// catalogRetryBackoff is how long a failed catalog refresh is remembered
+// before the next request tries again, so an unreachable stock-service costs
+// one fetch every few seconds rather than one per order.
+const catalogRetryBackoff = 5 * time.Second
+
+func newSKUAllowlist() (*skuAllowlist, error) {
+	a := &skuAllowlist{fetch: fetchCatalog}
+	if p := getenv("SKU_PATTERN", ""); p != "" {
+		re, err := regexp.Compile("^(?:" + p + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid SKU_PATTERN: %w", err)
+		}
+		a.pattern = re
+	}
+	ttl, err := time.ParseDuration(getenv("SKU_CACHE_TTL", "30s"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SKU_CACHE_TTL: %w", err)
+	}
+	a.ttl = ttl
+	return a, nil
+}
+
+// catalogSKUs returns the cached catalog set, refreshing it once the TTL has
+// passed. Like stockCache.get, the refresh runs outside the lock and
+// concurrent misses wait for the same one. If a refresh fails the previous
+// set is kept and no refresh is tried for catalogRetryBackoff; nil means no
+// set has been fetched yet.
+func (a *skuAllowlist) catalogSKUs(ctx context.Context) map[string]bool {
+	a.mu.Lock()
+	if (a.known != nil && time.Since(a.fetched) < a.ttl) || time.Since(a.failed) < catalogRetryBackoff {
+		known := a.known
+		a.mu.Unlock()
+		return known
+	}
+	if done := a.inflight; done != nil {
+		a.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		return a.known
+	}
+	done := make(chan struct{})
+	a.inflight = done
+	a.mu.Unlock()
+
+	// waiters share this fetch, so the first caller going away must not
+	// cancel it; upstreamClient's timeout still bounds it
+	entries, err := a.fetch(context.WithoutCancel(ctx))
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.inflight = nil
+	close(done)
+	if err != nil {
+		slog.Warn("sku allowlist refresh failed", "error", err)
+		a.failed = time.Now()
+		return a.known
+	}
+	known := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		known[e.SKU] = true
+	}
+	a.known, a.fetched, a.failed = known, time.Now(), time.Time{}
+	return known
+}
+
+// disallowed returns the SKUs in items that are not allowed, in order and
+// without duplicates. When the catalog is unreachable and no pattern is set
+// every SKU passes here and the stock check has the final say.
+func (a *skuAllowlist) disallowed(ctx context.Context, items []OrderItem) []string {
+	known := a.catalogSKUs(ctx)
+	if known == nil && a.pattern == nil {
+		return nil
+	}
+	var bad []string
+	seen := make(map[string]bool)
+	for _, it := range items {
+		if seen[it.SKU] || known[it.SKU] || (a.pattern != nil && a.pattern.MatchString(it.SKU)) {
+			continue
+		}
+		seen[it.SKU] = true
+		bad = append(bad, it.SKU)
+	}
+	return bad
+}
+
+// checkItems applies the MAX_ITEMS limit and the allowlist to an order's
+// items, returning the 422 to answer with if either rejects them.
+func (a *skuAllowlist) checkItems(ctx context.Context, items []OrderItem) *APIError {
+	if len(items) > maxItems {
+		return &APIError{Code: CodeTooManyItems, Message: fmt.Sprintf("order has %d items, at most %d allowed", len(items), maxItems)}
+	}
+	if bad := a.disallowed(ctx, items); len(bad) > 0 {
+		return &APIError{Code: CodeSKUNotAllowed, Message: "order references SKUs that are not allowed", Details: bad}
+	}
+	return nil
+}
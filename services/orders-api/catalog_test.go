@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func testAllowlist(t *testing.T, fetch func(context.Context) ([]catalogEntry, error)) *skuAllowlist {
+	t.Helper()
+	a, err := newSKUAllowlist()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.fetch = fetch
+	return a
+}
+
+func TestCheckItemsRejectsTooManyItems(t *testing.T) {
+	a := testAllowlist(t, func(context.Context) ([]catalogEntry, error) { return nil, nil })
+	items := make([]OrderItem, maxItems+1)
+	for i := range items {
+		items[i] = OrderItem{SKU: fmt.Sprintf("S%d", i), Qty: 1}
+	}
+	if apiErr := a.checkItems(context.Background(), items); apiErr == nil || apiErr.Code != CodeTooManyItems {
+		t.Fatalf("got %+v, want %s", apiErr, CodeTooManyItems)
+	}
+}
+
+func TestCheckItemsListsUnknownSKUs(t *testing.T) {
+	a := testAllowlist(t, func(context.Context) ([]catalogEntry, error) {
+		return []catalogEntry{{SKU: "S1"}, {SKU: "S2"}}, nil
+	})
+	items := []OrderItem{{SKU: "S1", Qty: 1}, {SKU: "NOPE", Qty: 1}, {SKU: "S2", Qty: 1}, {SKU: "NOPE", Qty: 2}, {SKU: "GONE", Qty: 1}}
+	apiErr := a.checkItems(context.Background(), items)
+	if apiErr == nil || apiErr.Code != CodeSKUNotAllowed {
+		t.Fatalf("got %+v, want %s", apiErr, CodeSKUNotAllowed)
+	}
+	if want := []string{"NOPE", "GONE"}; !reflect.DeepEqual(apiErr.Details, want) {
+		t.Fatalf("details %v, want %v", apiErr.Details, want)
+	}
+}
+
+func TestCatalogFailureIsNotRetriedPerRequest(t *testing.T) {
+	calls := 0
+	a := testAllowlist(t, func(context.Context) ([]catalogEntry, error) {
+		calls++
+		return nil, errors.New("stock-service down")
+	})
+	for i := 0; i < 3; i++ {
+		if known := a.catalogSKUs(context.Background()); known != nil {
+			t.Fatalf("got %v before any successful fetch", known)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("fetched %d times, want 1 within the retry backoff", calls)
+	}
+}
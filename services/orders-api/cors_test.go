@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	for _, tc := range []struct {
+		name, allowed, origin, method string
+		wantOrigin                    string
+		handled                       bool
+	}{
+		{"allowed origin", "http://localhost:3000,https://shop.example", "https://shop.example", http.MethodPost, "https://shop.example", false},
+		{"disallowed origin", "http://localhost:3000", "https://evil.example", http.MethodPost, "", false},
+		{"wildcard", "*", "https://anyone.example", http.MethodPost, "*", false},
+		{"preflight", "http://localhost:3000", "http://localhost:3000", http.MethodOptions, "http://localhost:3000", true},
+		{"disallowed preflight", "http://localhost:3000", "https://evil.example", http.MethodOptions, "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prev := corsOrigins
+			corsOrigins = parseOrigins(tc.allowed)
+			t.Cleanup(func() { corsOrigins = prev })
+
+			req := httptest.NewRequest(tc.method, "/orders", nil)
+			req.Header.Set("Origin", tc.origin)
+			rec := httptest.NewRecorder()
+			handled := cors(rec, req, "POST")
+			if handled != tc.handled {
+				t.Fatalf("handled = %v, want %v", handled, tc.handled)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tc.wantOrigin {
+				t.Fatalf("Access-Control-Allow-Origin %q, want %q", got, tc.wantOrigin)
+			}
+			if tc.handled {
+				if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Methods") != "POST, OPTIONS" {
+					t.Fatalf("preflight: %d, methods %q", rec.Code, rec.Header().Get("Access-Control-Allow-Methods"))
+				}
+			}
+		})
+	}
+}
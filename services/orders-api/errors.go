@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Stable, machine-readable error codes returned in APIError.Code. Clients
+// should branch on these rather than on Message, which is for humans.
+const (
+	CodeInvalidJSON         = "INVALID_JSON"
+	CodePayloadTooLarge     = "PAYLOAD_TOO_LARGE"
+	CodeUnsupportedMedia    = "UNSUPPORTED_MEDIA_TYPE"
+	CodeMethodNotAllowed    = "METHOD_NOT_ALLOWED"
+	CodeValidationFailed    = "VALIDATION_FAILED"
+	CodeUnknownSKU          = "UNKNOWN_SKU"
+	CodeInsufficientStock   = "INSUFFICIENT_STOCK"
+	CodeStockUnavailable    = "STOCK_UNAVAILABLE"
+	CodeEncodeFailed        = "ENCODE_FAILED"
+	CodeProduceFailed       = "PRODUCE_FAILED"
+	CodeOutcomeUnknown      = "OUTCOME_UNKNOWN"
+	CodeOverloaded          = "OVERLOADED"
+	CodeNotReady            = "NOT_READY"
+	CodeTooManyItems        = "TOO_MANY_ITEMS"
+	CodeSKUNotAllowed       = "SKU_NOT_ALLOWED"
+	CodeUnsupportedCurrency = "UNSUPPORTED_CURRENCY"
+	CodeTotalMismatch       = "TOTAL_MISMATCH"
+	CodeOrderNotFound       = "ORDER_NOT_FOUND"
+	CodeOrderUnavailable    = "ORDER_UNAVAILABLE"
+	CodeOrderNotAmendable   = "ORDER_NOT_AMENDABLE"
+	CodeDuplicateOrder      = "DUPLICATE_ORDER"
+	CodeOrderValueExceeded  = "ORDER_VALUE_EXCEEDED"
+	CodeForbidden           = "FORBIDDEN"
+)
+
+// APIError is the body of every error response from orders-api.
+type APIError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+func (e APIError) Error() string { return e.Code + ": " + e.Message }
+
+func writeError(w http.ResponseWriter, status int, apiErr APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(apiErr)
+}
+
+// Sentinel errors wrapped by checkStockAvailability so the handler can map
+// them to a status and code.
+var (
+	errStockUnavailable  = errors.New("stock service unavailable")
+	errUnknownSKU        = errors.New("unknown sku")
+	errInsufficientStock = errors.New("insufficient stock")
+)
+
+// stockError maps a checkStockAvailability failure onto a response.
+func stockError(err error) (int, APIError) {
+	switch {
+	case errors.Is(err, errStockUnavailable):
+		return http.StatusServiceUnavailable, APIError{Code: CodeStockUnavailable, Message: err.Error()}
+	case errors.Is(err, errUnknownSKU):
+		return http.StatusConflict, APIError{Code: CodeUnknownSKU, Message: err.Error()}
+	default:
+		return http.StatusConflict, APIError{Code: CodeInsufficientStock, Message: err.Error()}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// TestErrorResponseShape runs each mapped failure of POST /orders through
+// the handler and checks the body is an APIError: code and message always,
+// details only when set, and nothing else.
+func TestErrorResponseShape(t *testing.T) {
+	atomic.StoreInt64(&kafkaReady, 1)
+	t.Cleanup(func() { atomic.StoreInt64(&kafkaReady, 0) })
+
+	fromStock := func(err error) func() (int, *APIError) {
+		return func() (int, *APIError) {
+			status, apiErr := stockError(err)
+			return status, &apiErr
+		}
+	}
+	fromProduce := func(err error) func() (int, *APIError) {
+		return func() (int, *APIError) {
+			status, apiErr, _ := produceError("o-1", err)
+			return status, apiErr
+		}
+	}
+	const valid = `{"userId":"u1","items":[{"sku":"S1","qty":1}],"total":1}`
+	for _, tc := range []struct {
+		code   string
+		body   string
+		fail   func() (int, *APIError)
+		status int
+		keys   string
+	}{
+		{CodeValidationFailed, `{"userId":"u1","items":[{"sku":"S1","qty":1}],"total":"0.305"}`, nil, http.StatusUnprocessableEntity, "code,message"},
+		{CodeInvalidJSON, `{"userId":`, nil, http.StatusBadRequest, "code,message"},
+		{CodeInsufficientStock, valid, fromStock(fmt.Errorf("%w: S1 has 0", errInsufficientStock)), http.StatusConflict, "code,message"},
+		{CodeUnknownSKU, valid, fromStock(fmt.Errorf("%w: S9", errUnknownSKU)), http.StatusConflict, "code,message"},
+		{CodeStockUnavailable, valid, fromStock(errStockUnavailable), http.StatusServiceUnavailable, "code,message"},
+		{CodeProduceFailed, valid, fromProduce(errors.New("broker down")), http.StatusInternalServerError, "code,message"},
+		{CodeOutcomeUnknown, valid, fromProduce(context.DeadlineExceeded), http.StatusGatewayTimeout, "code,details,message"},
+	} {
+		h := ordersHandler(func(context.Context, CreateOrderRequest) (string, int, *APIError) {
+			if tc.fail == nil {
+				return "o-1", http.StatusCreated, nil
+			}
+			status, apiErr := tc.fail()
+			return "", status, apiErr
+		}, newInflight())
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h(rec, req)
+
+		if rec.Code != tc.status || rec.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%s: got %d %q, want %d application/json", tc.code, rec.Code, rec.Header().Get("Content-Type"), tc.status)
+		}
+		var got map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: body %s: %v", tc.code, rec.Body, err)
+		}
+		keys := make([]string, 0, len(got))
+		for k := range got {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if strings.Join(keys, ",") != tc.keys {
+			t.Errorf("%s: keys %v, want %s", tc.code, keys, tc.keys)
+		}
+		if got["code"] != tc.code || got["message"] == "" {
+			t.Errorf("%s: body %s", tc.code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package events
+
+import "testing"
+
+func TestDecodeBareAndEnveloped(t *testing.T) {
+	bare := []byte(`{"orderId":"o-1"}`)
+	wire, err := Encode("OrderCreated", bare)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, tc := range map[string]struct {
+		body     []byte
+		wantType string
+	}{
+		"bare v1":  {bare, ""},
+		"envelope": {wire, "OrderCreated"},
+	} {
+		typ, data, err := Decode(tc.body)
+		if err != nil || typ != tc.wantType || string(data) != string(bare) {
+			t.Errorf("%s: got %q, %s, %v", name, typ, data, err)
+		}
+	}
+}
+
+func TestDecodeRejectsNewerVersions(t *testing.T) {
+	if _, _, err := Decode([]byte(`{"schemaVersion":2,"type":"OrderCreated","data":{}}`)); err == nil {
+		t.Fatal("decoded a schemaVersion this build does not know")
+	}
+}
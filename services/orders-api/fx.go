@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var errUnsupportedCurrency = errors.New("unsupported currency")
+
+// CurrencyConverter converts amounts between currencies. Convert returns the
+// converted amount and the rate applied (units of to per unit of m.Currency).
+type CurrencyConverter interface {
+	Convert(m Money, to string) (Money, float64, error)
+	Supports(currency string) bool
+}
+
+// staticRates converts using fixed rates against a base currency. Rates come
+// from FX_RATES as "EUR=0.92,JPY=151.3", each the price of one unit of
+// BASE_CURRENCY (default USD) in that currency.
+type staticRates struct {
+	base  string
+	rates map[string]float64
+}
+
+func newStaticRates(base, spec string) (*staticRates, error) {
+	s := &staticRates{base: strings.ToUpper(base), rates: map[string]float64{strings.ToUpper(base): 1}}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		cur, val, ok := strings.Cut(pair, "=")
+		rate, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if !ok || err != nil || rate <= 0 || math.IsInf(rate, 0) {
+			return nil, fmt.Errorf("invalid FX_RATES entry %q", pair)
+		}
+		s.rates[strings.ToUpper(strings.TrimSpace(cur))] = rate
+	}
+	return s, nil
+}
+
+func (s *staticRates) Supports(currency string) bool {
+	_, ok := s.rates[strings.ToUpper(currency)]
+	return ok
+}
+
+// Convert rounds the result half away from zero to the nearest minor unit.
+// An empty currency on either side means the base currency.
+func (s *staticRates) Convert(m Money, to string) (Money, float64, error) {
+	from := m.Currency
+	if from == "" {
+		from = s.base
+	}
+	if to == "" {
+		to = s.base
+	}
+	fromRate, ok := s.rates[strings.ToUpper(from)]
+	if !ok {
+		return Money{}, 0, fmt.Errorf("%w: %s", errUnsupportedCurrency, from)
+	}
+	toRate, ok := s.rates[strings.ToUpper(to)]
+	if !ok {
+		return Money{}, 0, fmt.Errorf("%w: %s", errUnsupportedCurrency, to)
+	}
+	rate := toRate / fromRate
+	return Money{Amount: int64(math.Round(float64(m.Amount) * rate)), Currency: to}, rate, nil
+}
+
+// expectedTotal prices items from the catalog in the given currency. Each
+// catalog currency is converted as one subtotal so rounding happens once per
+// currency rather than once per line. SKUs missing from the catalog are
+// skipped and left to the stock check.
+func expectedTotal(conv CurrencyConverter, entries []catalogEntry, items []OrderItem, currency string) (Money, error) {
+	prices := make(map[string]Money, len(entries))
+	for _, e := range entries {
+		p := e.Price
+		p.Currency = e.Currency
+		prices[e.SKU] = p
+	}
+	subtotals := map[string]Money{}
+	for _, it := range items {
+		p, ok := prices[it.SKU]
+		if !ok {
+			continue
+		}
+		line, err := p.Mul(it.Qty)
+		if err != nil {
+			return Money{}, err
+		}
+		if subtotals[p.Currency], err = subtotals[p.Currency].Add(line); err != nil {
+			return Money{}, err
+		}
+	}
+	total := Money{Currency: currency}
+	for _, sub := range subtotals {
+		converted, _, err := conv.Convert(sub, currency)
+		if err != nil {
+			return Money{}, err
+		}
+		if total, err = total.Add(converted); err != nil {
+			return Money{}, err
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func testCatalog() []catalogEntry {
+	return []catalogEntry{
+		{SKU: "S1", Price: Money{Amount: 1999}, Currency: "USD"},
+		{SKU: "S2", Price: Money{Amount: 500}, Currency: "USD"},
+	}
+}
+
+func TestExpectedTotalSameCurrency(t *testing.T) {
+	conv, err := newStaticRates("USD", "EUR=0.92")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := expectedTotal(conv, testCatalog(), []OrderItem{{SKU: "S1", Qty: 2}, {SKU: "S2", Qty: 1}, {SKU: "NOPE", Qty: 9}}, "USD")
+	if err != nil || got.Amount != 4498 || got.Currency != "USD" {
+		t.Fatalf("got %v, %v; want 44.98 USD with the unknown SKU skipped", got, err)
+	}
+}
+
+// TestExpectedTotalConvertedCurrency prices a USD catalog in EUR: the
+// subtotal of 44.98 USD converts once, to 41.3816 EUR, rounded to cents.
+func TestExpectedTotalConvertedCurrency(t *testing.T) {
+	conv, err := newStaticRates("USD", "EUR=0.92,JPY=151.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := expectedTotal(conv, testCatalog(), []OrderItem{{SKU: "S1", Qty: 2}, {SKU: "S2", Qty: 1}}, "EUR")
+	if err != nil || got.Amount != 4138 || got.Currency != "EUR" {
+		t.Fatalf("got %v, %v; want 41.38 EUR", got, err)
+	}
+	_, rate, err := conv.Convert(Money{Amount: 100, Currency: "EUR"}, "JPY")
+	if err != nil || rate < 164.45 || rate > 164.47 {
+		t.Fatalf("EUR->JPY rate %v, %v; want 151.3/0.92", rate, err)
+	}
+	if _, err := expectedTotal(conv, testCatalog(), []OrderItem{{SKU: "S1", Qty: 1}}, "GBP"); !errors.Is(err, errUnsupportedCurrency) {
+		t.Fatalf("GBP: %v, want errUnsupportedCurrency", err)
+	}
+}
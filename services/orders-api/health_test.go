@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// TestDeepHealthReportsEachCheck mixes passing and failing checks: the deep
+// health check is 503 "degraded" with every check's own result, while the
+// shallow one stays 200 without running them.
+func TestDeepHealthReportsEachCheck(t *testing.T) {
+	var h HealthChecker
+	var ran atomic.Int32
+	h.Register("kafka", func(context.Context) error { ran.Add(1); return nil })
+	h.Register("stock-service", func(context.Context) error { ran.Add(1); return errors.New("connection refused") })
+
+	rec := httptest.NewRecorder()
+	h.Handler()(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK || ran.Load() != 0 {
+		t.Fatalf("shallow: got %d with %d checks run, want 200 and none", rec.Code, ran.Load())
+	}
+
+	rec = httptest.NewRecorder()
+	h.Handler()(rec, httptest.NewRequest(http.MethodGet, "/healthz?deep=true", nil))
+	var body struct {
+		Status string                 `json:"status"`
+		Checks map[string]CheckResult `json:"checks"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusServiceUnavailable || body.Status != "degraded" {
+		t.Fatalf("deep: got %d %q, want 503 degraded", rec.Code, body.Status)
+	}
+	want := map[string]CheckResult{
+		"kafka":         {Status: "ok"},
+		"stock-service": {Status: "error", Error: "connection refused"},
+	}
+	if len(body.Checks) != len(want) {
+		t.Fatalf("checks %v, want %v", body.Checks, want)
+	}
+	for name, w := range want {
+		if body.Checks[name] != w {
+			t.Errorf("%s: %+v, want %+v", name, body.Checks[name], w)
+		}
+	}
+
+	h.Register("stock-service", func(context.Context) error { return nil })
+	rec = httptest.NewRecorder()
+	h.Handler()(rec, httptest.NewRequest(http.MethodGet, "/healthz?deep=true", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("all healthy: got %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+)
+
+// inflight bounds concurrent /orders requests (MAX_INFLIGHT, default 100).
+// Requests beyond the limit are rejected instead of queued so a burst cannot
+// pile up writes against the broker.
+type inflight chan struct{}
+
+func newInflight() inflight {
+	n, err := strconv.Atoi(getenv("MAX_INFLIGHT", "100"))
+	if err != nil || n <= 0 {
+		slog.Warn("invalid MAX_INFLIGHT, using 100")
+		n = 100
+	}
+	return make(inflight, n)
+}
+
+// tryAcquire takes a slot without blocking and reports whether it got one.
+func (s inflight) tryAcquire() bool {
+	select {
+	case s <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// acquire waits for a slot until ctx ends.
+func (s inflight) acquire(ctx context.Context) error {
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s inflight) release() { <-s }
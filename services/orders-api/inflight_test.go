@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestInflightLimitRejectsOverflow fills MAX_INFLIGHT with orders blocked in
+// produce and expects the next one to get 503 and Retry-After at once,
+// and orders to be accepted again once a slot frees up.
+func TestInflightLimitRejectsOverflow(t *testing.T) {
+	atomic.StoreInt64(&kafkaReady, 1)
+	t.Cleanup(func() { atomic.StoreInt64(&kafkaReady, 0) })
+	t.Setenv("MAX_INFLIGHT", "2")
+
+	entered, release := make(chan struct{}), make(chan struct{})
+	var blocking atomic.Bool
+	blocking.Store(true)
+	h := ordersHandler(func(context.Context, CreateOrderRequest) (string, int, *APIError) {
+		if blocking.Load() {
+			entered <- struct{}{}
+			<-release
+		}
+		return "o-1", http.StatusCreated, nil
+	}, newInflight())
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"userId":"u1","items":[{"sku":"S1","qty":1}],"total":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec
+	}
+
+	var held sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		held.Add(1)
+		go func() {
+			defer held.Done()
+			if rec := post(); rec.Code != http.StatusCreated {
+				t.Errorf("held order: got %d", rec.Code)
+			}
+		}()
+		<-entered
+	}
+
+	overflow := make(chan *httptest.ResponseRecorder, 1)
+	go func() { overflow <- post() }()
+	select {
+	case rec := <-overflow:
+		if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" || !strings.Contains(rec.Body.String(), CodeOverloaded) {
+			t.Fatalf("overflow: got %d Retry-After %q %s", rec.Code, rec.Header().Get("Retry-After"), rec.Body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("overflow request blocked instead of being rejected")
+	}
+
+	blocking.Store(false)
+	close(release)
+	held.Wait()
+	if rec := post(); rec.Code != http.StatusCreated {
+		t.Fatalf("after release: got %d %s", rec.Code, rec.Body)
+	}
+}
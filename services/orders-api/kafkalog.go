@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaDebugLog (KAFKA_DEBUG_LOG=true) routes kafka-go's own logging into
+// the service log; off by default since readers log every fetch.
+var kafkaDebugLog = getenv("KAFKA_DEBUG_LOG", "false") == "true"
+
+// kafkaLoggers returns a kafka-go client's loggers, nil unless kafkaDebugLog.
+func kafkaLoggers(client string) (kafka.Logger, kafka.Logger) {
+	if !kafkaDebugLog {
+		return nil, nil
+	}
+	info := kafka.LoggerFunc(func(msg string, args ...interface{}) {
+		slog.Info(fmt.Sprintf(msg, args...), "component", "kafka-go", "client", client)
+	})
+	errs := kafka.LoggerFunc(func(msg string, args ...interface{}) {
+		slog.Warn(fmt.Sprintf(msg, args...), "component", "kafka-go", "client", client)
+	})
+	return info, errs
+}
+
+// withWriterLogging attaches kafkaLoggers to w.
+func withWriterLogging(w *kafka.Writer) *kafka.Writer {
+	w.Logger, w.ErrorLogger = kafkaLoggers("writer " + w.Topic)
+	return w
+}
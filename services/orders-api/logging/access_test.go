@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestAccessLogRecordsRequest serves one request through AccessLog and
+// expects a single record carrying its status, a non-zero duration and the
+// request id echoed on the response.
+func TestAccessLogRecordsRequest(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	h := AccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(RequestIDHeader); got != "req-1" {
+		t.Fatalf("response %s %q", RequestIDHeader, got)
+	}
+	var entry struct {
+		Msg       string `json:"msg"`
+		Method    string `json:"method"`
+		Path      string `json:"path"`
+		Status    int    `json:"status"`
+		Duration  int64  `json:"duration"`
+		RequestID string `json:"requestId"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("%v: %s", err, buf.String())
+	}
+	if entry.Msg != "http request" || entry.Method != http.MethodPost || entry.Path != "/orders" ||
+		entry.Status != http.StatusTeapot || entry.RequestID != "req-1" {
+		t.Fatalf("entry %+v", entry)
+	}
+	if entry.Duration <= 0 {
+		t.Fatalf("duration %d, want > 0", entry.Duration)
+	}
+}
+
+// TestAccessLogProbesAtDebug expects health probes to stay out of an info
+// log.
+func TestAccessLogProbesAtDebug(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	AccessLog(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if buf.Len() != 0 {
+		t.Fatalf("probe logged at info: %s", buf.String())
+	}
+}
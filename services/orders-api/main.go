@@ -3,17 +3,24 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/segmentio/kafka-go"
+
+	"kafka-microservice/services/orders-api/codec"
+	"kafka-microservice/services/orders-api/logging"
+	"kafka-microservice/services/orders-api/schema"
 )
 
 type OrderItem struct {
@@ -22,19 +29,31 @@ type OrderItem struct {
 }
 
 type CreateOrderRequest struct {
+	// OrderID is optional; a client that sets it can retry without placing
+	// the order twice, see reserveOrderID
+	OrderID  string      `json:"orderId,omitempty"`
 	UserID   string      `json:"userId"`
 	Items    []OrderItem `json:"items"`
-	Total    float64     `json:"total"`
+	Total    Money       `json:"total"`
 	Currency string      `json:"currency"`
+	Priority string      `json:"priority,omitempty"`
 }
 
 type OrderCreated struct {
 	OrderID   string      `json:"orderId"`
 	UserID    string      `json:"userId"`
 	Items     []OrderItem `json:"items"`
-	Total     float64     `json:"total"`
+	Total     Money       `json:"total"`
 	Currency  string      `json:"currency"`
 	CreatedAt string      `json:"createdAt"`
+	// CorrelationID ties together every event downstream of this order
+	CorrelationID string `json:"correlationId,omitempty"`
+	// FXRate is the rate used to convert catalog prices from the base
+	// currency into Currency, set only when the two differ
+	FXRate float64 `json:"fxRate,omitempty"`
+	// Priority is low, normal (the default when empty) or high; high
+	// orders go to the priority topic
+	Priority string `json:"priority,omitempty"`
 }
 
 func getenv(key, def string) string {
@@ -44,108 +63,409 @@ func getenv(key, def string) string {
 	return def
 }
 
+// newWriter flushes partial batches after BATCH_LINGER rather than
+// kafka-go's default of a second, so a batch handed over by produceBatcher
+// goes out straight away.
 func newWriter(brokers []string, topic string) *kafka.Writer {
-	return &kafka.Writer{Addr: kafka.TCP(brokers...), Topic: topic, Balancer: &kafka.Hash{}}
+	return withWriterLogging(&kafka.Writer{Addr: kafka.TCP(brokers...), Topic: topic, Balancer: &kafka.Hash{}, Compression: compression(), RequiredAcks: requiredAcks(), BatchBytes: int64(max(maxMessageBytes, 1048576)), BatchSize: batchSize, BatchTimeout: batchLinger})
 }
 
-func checkStockAvailability(items []OrderItem) error {
+// compression maps COMPRESSION onto the writer codec. Compressing trades CPU on
+// both producer and consumer for smaller batches on the wire and on the broker:
+// snappy and lz4 are cheap and suit small JSON events, gzip and zstd shrink
+// further at noticeably higher CPU cost. Readers decompress transparently.
+func compression() kafka.Compression {
+	switch v := getenv("COMPRESSION", "snappy"); v {
+	case "none":
+		return 0
+	case "gzip":
+		return kafka.Gzip
+	case "snappy":
+		return kafka.Snappy
+	case "lz4":
+		return kafka.Lz4
+	case "zstd":
+		return kafka.Zstd
+	default:
+		slog.Warn("unknown COMPRESSION, using snappy", "value", v)
+		return kafka.Snappy
+	}
+}
+
+// requiredAcks maps PRODUCE_ACKS onto how many replicas must confirm a write
+// before it returns. all (the default) waits for every in-sync replica, so an
+// acknowledged event survives losing the leader, at the cost of a replication
+// round trip on every write; one returns once the leader has it, trading that
+// latency for losing writes the leader had not yet replicated; none does not
+// wait at all and surfaces no broker-side errors.
+func requiredAcks() kafka.RequiredAcks {
+	switch v := getenv("PRODUCE_ACKS", "all"); v {
+	case "none":
+		return kafka.RequireNone
+	case "one":
+		return kafka.RequireOne
+	case "all":
+		return kafka.RequireAll
+	default:
+		slog.Warn("unknown PRODUCE_ACKS, using all", "value", v)
+		return kafka.RequireAll
+	}
+}
+
+func fetchStock() (map[string]int, error) {
 	stockServiceURL := getenv("STOCK_SERVICE_URL", "http://localhost:8084")
-	
-	// Get current stock levels
-	resp, err := http.Get(stockServiceURL + "/stock")
+
+	// Get current sellable stock, i.e. net of each SKU's safety stock
+	resp, err := upstreamClient.Get(stockServiceURL + "/stock?view=available")
 	if err != nil {
-		return fmt.Errorf("failed to check stock: %v", err)
+		return nil, fmt.Errorf("%w: %v", errStockUnavailable, err)
 	}
 	defer resp.Body.Close()
-	
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: stock-service returned %d", errStockUnavailable, resp.StatusCode)
+	}
+
 	var stock map[string]int
 	if err := json.NewDecoder(resp.Body).Decode(&stock); err != nil {
-		return fmt.Errorf("failed to parse stock response: %v", err)
+		return nil, fmt.Errorf("%w: failed to parse stock response: %v", errStockUnavailable, err)
+	}
+	return stock, nil
+}
+
+// checkStockAvailability checks items against stock levels that may be up
+// to STOCK_CACHE_TTL old; see stockCache.
+func checkStockAvailability(items []OrderItem) error {
+	stock, err := stockSnapshot.get(fetchStock)
+	if err != nil {
+		return err
 	}
-	
+
 	// Check if we have enough stock for each item
 	for _, item := range items {
 		available, exists := stock[item.SKU]
 		if !exists {
-			return fmt.Errorf("product %s does not exist", item.SKU)
+			return fmt.Errorf("%w: product %s does not exist", errUnknownSKU, item.SKU)
 		}
 		if available < item.Qty {
-			return fmt.Errorf("insufficient stock for %s: requested %d, available %d", 
+			return fmt.Errorf("%w for %s: requested %d, available %d", errInsufficientStock,
 				item.SKU, item.Qty, available)
 		}
 	}
-	
+
 	return nil
 }
 
+// kafkaReady flips to 1 once a broker has answered; until then /readyz and
+// /orders return 503.
+var kafkaReady int64
+
+// ordersHandler serves POST /orders: it answers 503 until kafkaReady and
+// while slots are exhausted, then hands the decoded order to place.
+func ordersHandler(place orderPlacer, slots inflight) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cors(w, r, "POST") {
+			return
+		}
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, APIError{Code: CodeMethodNotAllowed, Message: "use POST"})
+			return
+		}
+		if atomic.LoadInt64(&kafkaReady) != 1 {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusServiceUnavailable, APIError{Code: CodeNotReady, Message: "waiting for kafka"})
+			return
+		}
+		if !slots.tryAcquire() {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusServiceUnavailable, APIError{Code: CodeOverloaded, Message: "too many orders in flight, retry shortly"})
+			return
+		}
+		defer slots.release()
+		if !isJSONRequest(r) {
+			writeError(w, http.StatusUnsupportedMediaType, APIError{Code: CodeUnsupportedMedia, Message: "Content-Type must be application/json"})
+			return
+		}
+		var req CreateOrderRequest
+		if status, err := decodeJSONBody(w, r, &req); err != nil {
+			code := CodeInvalidJSON
+			switch status {
+			case http.StatusRequestEntityTooLarge:
+				code = CodePayloadTooLarge
+			case http.StatusUnprocessableEntity:
+				code = CodeValidationFailed
+			}
+			writeError(w, status, APIError{Code: code, Message: err.Error()})
+			return
+		}
+
+		req.Total.Currency = req.Currency
+		ctx, timing := withServerTiming(context.Background())
+		orderID, status, apiErr := place(ctx, req)
+		timing.write(w)
+		if apiErr != nil {
+			writeError(w, status, *apiErr)
+			return
+		}
+		w.WriteHeader(status)
+		resp := map[string]string{"orderId": orderID}
+		if status == http.StatusAccepted {
+			resp["status"] = "PENDING_REVIEW"
+		}
+		// the token lets this client, and only it, follow the order's status
+		if token := signOrderToken(orderID, req.UserID); token != "" {
+			resp["orderToken"] = token
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// drainAndClose shuts srv down, waits for the orders still tracked by
+// inFlight, and only then calls closeWriters. Shutdown returns at ctx's
+// deadline even if handlers are still running, so those get whatever budget
+// is left before the writers go.
+func drainAndClose(ctx context.Context, srv *http.Server, inFlight *sync.WaitGroup, closeWriters func()) {
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("server forced to shutdown", "error", err)
+	}
+	placing := make(chan struct{})
+	go func() {
+		inFlight.Wait()
+		close(placing)
+	}()
+	select {
+	case <-placing:
+	case <-ctx.Done():
+		slog.Warn("closing kafka writer with orders still in flight")
+	}
+	closeWriters()
+}
+
 func main() {
+	logging.Init("orders-api")
 	addr := getenv("HTTP_ADDR", ":8081")
 	brokers := strings.Split(getenv("KAFKA_BROKERS", "localhost:9093"), ",")
 	ordersTopic := getenv("ORDERS_TOPIC", "orders.created")
+	priorityTopic := getenv("PRIORITY_TOPIC", "orders.created.priority")
+	amendTopic := getenv("AMEND_TOPIC", "orders.amended")
+	reviewTopic := getenv("REVIEW_TOPIC", "orders.review")
+
+	// SHUTDOWN_TIMEOUT bounds the whole shutdown sequence once a signal arrives
+	shutdownTimeout, err := time.ParseDuration(getenv("SHUTDOWN_TIMEOUT", "5s"))
+	if err != nil {
+		logging.Fatalf("invalid SHUTDOWN_TIMEOUT: %v", err)
+	}
+
+	if err := startupBrokerCheck(brokers); err != nil {
+		logging.Fatalf("kafka startup check failed: %v", err)
+	}
+	if err := ensureTopics(brokers, ordersTopic, priorityTopic, amendTopic, reviewTopic); err != nil {
+		logging.Fatalf("ensure topics failed: %v", err)
+	}
 
 	writer := newWriter(brokers, ordersTopic)
 	defer writer.Close()
+	// high-priority orders skip the queue on their own topic
+	priorityWriter := newWriter(brokers, priorityTopic)
+	defer priorityWriter.Close()
+	// orders are produced in batches; see produceBatcher
+	orderOut := newProduceBatcher(writer, batchLinger, batchSize)
+	priorityOut := newProduceBatcher(priorityWriter, batchLinger, batchSize)
+	amendWriter := newWriter(brokers, amendTopic)
+	defer amendWriter.Close()
+	// orders above REVIEW_THRESHOLD wait on their own topic for a reviewer
+	reviewWriter := newWriter(brokers, reviewTopic)
+	defer reviewWriter.Close()
+	outputs := orderOutputs{
+		normal:   orderOut,
+		priority: priorityOut,
+		review:   newProduceBatcher(reviewWriter, batchLinger, batchSize),
+	}
+
+	// SCHEMA_VALIDATION=off leaves validator nil, which accepts every payload
+	var validator *schema.Validator
+	if getenv("SCHEMA_VALIDATION", "on") == "on" {
+		v, err := schema.New()
+		if err != nil {
+			logging.Fatalf("failed to load schemas: %v", err)
+		}
+		validator = v
+	}
 
-	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	eventCodec, err := codec.New(getenv("EVENT_FORMAT", "json"), getenv("SCHEMA_REGISTRY_URL", ""))
+	if err != nil {
+		logging.Fatalf("invalid event codec config: %v", err)
+	}
+
+	var health HealthChecker
+	health.Register("kafka", func(ctx context.Context) error { return checkBrokers(brokers, 2*time.Second) })
+	health.Register("stock-service", func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, getenv("STOCK_SERVICE_URL", "http://localhost:8084")+"/healthz", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := upstreamClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("stock-service /healthz returned %d", resp.StatusCode)
+		}
+		return nil
+	})
+	http.HandleFunc("/healthz", health.Handler())
 	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
-		// Check if Kafka writer is available by attempting a connection test
-		// Note: kafka-go doesn't expose connection status directly, so we assume ready if writer was created
-		if writer != nil {
+		if atomic.LoadInt64(&kafkaReady) == 1 {
 			w.WriteHeader(http.StatusOK)
 		} else {
 			w.WriteHeader(http.StatusServiceUnavailable)
 		}
 	})
 
-	http.HandleFunc("/orders", func(w http.ResponseWriter, r *http.Request) {
-		// CORS for local dev
-		if r.Method == http.MethodOptions {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-			w.WriteHeader(http.StatusNoContent)
-			return
+	allowlist, err := newSKUAllowlist()
+	if err != nil {
+		logging.Fatalf("%v", err)
+	}
+	stock, err := newStockChecker()
+	if err != nil {
+		logging.Fatalf("%v", err)
+	}
+	baseCurrency := strings.ToUpper(getenv("BASE_CURRENCY", "USD"))
+	fx, err := newStaticRates(baseCurrency, getenv("FX_RATES", ""))
+	if err != nil {
+		logging.Fatalf("%v", err)
+	}
+	guard := &orderGuard{
+		baseCurrency: baseCurrency,
+		converter:    fx,
+		// VERIFY_TOTAL rejects orders whose total differs from the catalog
+		// price of their items, converted into the order's currency
+		verifyTotal: getenv("VERIFY_TOTAL", "false") == "true",
+	}
+	// MAX_ORDER_VALUE rejects orders above it; REVIEW_THRESHOLD sends orders
+	// above it to REVIEW_TOPIC instead of ORDERS_TOPIC. Both are per currency,
+	// e.g. "USD=10000,EUR=9000".
+	if guard.maxValue, err = parseOrderLimits("MAX_ORDER_VALUE", getenv("MAX_ORDER_VALUE", "")); err != nil {
+		logging.Fatalf("%v", err)
+	}
+	if guard.review, err = parseOrderLimits("REVIEW_THRESHOLD", getenv("REVIEW_THRESHOLD", "")); err != nil {
+		logging.Fatalf("%v", err)
+	}
+	http.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"stockBreaker": stock.stats()})
+	})
+
+	// inFlightOrders tracks placeOrder calls and amendments so shutdown can
+	// wait for their produce before closing the writers
+	var inFlightOrders sync.WaitGroup
+
+	// placeOrder runs the item limit, SKU allowlist and stock checks, schema
+	// validation, encoding and produce for one order. It returns the status
+	// to answer with: 201, or 202 for an order held for review, or the
+	// failure along with its error.
+	var placeOrder orderPlacer = func(ctx context.Context, req CreateOrderRequest) (string, int, *APIError) {
+		inFlightOrders.Add(1)
+		defer inFlightOrders.Done()
+		normalizeItems(req.Items)
+		switch req.Priority {
+		case "", "low", "normal", "high":
+		default:
+			return "", http.StatusBadRequest, &APIError{Code: CodeValidationFailed, Message: fmt.Sprintf("priority must be low, normal or high, got %q", req.Priority)}
 		}
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			return
+		orderID, err := reserveOrderID(req.OrderID)
+		if errors.Is(err, errDuplicateOrderID) {
+			return "", http.StatusConflict, &APIError{Code: CodeDuplicateOrder, Message: fmt.Sprintf("order %s was already placed", req.OrderID)}
 		}
-		var req CreateOrderRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid json"})
-			return
+		if err != nil {
+			return "", http.StatusBadRequest, &APIError{Code: CodeValidationFailed, Message: err.Error()}
+		}
+		// an order that fails below was never placed, so its id may be
+		// reused, unless its write was abandoned; see produceError
+		placed := false
+		defer func() {
+			if !placed {
+				recentOrderIDs.remove(orderID)
+			}
+		}()
+		if apiErr := allowlist.checkItems(ctx, req.Items); apiErr != nil {
+			return "", http.StatusUnprocessableEntity, apiErr
+		}
+		checked, status, apiErr := guard.check(ctx, req.Items, req.Total, req.Currency)
+		if apiErr != nil {
+			return "", status, apiErr
 		}
-		
 		// Check stock availability before accepting the order
-		if err := checkStockAvailability(req.Items); err != nil {
-			log.Printf("stock validation failed: %v", err)
-			w.WriteHeader(http.StatusConflict)
-			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-			return
+		stopStock := startTiming(ctx, "stock")
+		err = stock.check(req.Items)
+		stopStock()
+		if err != nil {
+			slog.Info("stock validation failed", "error", err)
+			status, apiErr := stockError(err)
+			return "", status, &apiErr
 		}
-		
-		orderID := uuid.NewString()
-		evt := OrderCreated{OrderID: orderID, UserID: req.UserID, Items: req.Items, Total: req.Total, Currency: req.Currency, CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+
+		evt := OrderCreated{OrderID: orderID, UserID: req.UserID, Items: req.Items, Total: req.Total, Currency: req.Currency, CreatedAt: time.Now().UTC().Format(time.RFC3339), CorrelationID: uuid.NewString(), FXRate: checked.FXRate, Priority: req.Priority}
 		payload, _ := json.Marshal(evt)
-		if err := writer.WriteMessages(context.Background(), kafka.Message{Key: []byte(orderID), Value: payload}); err != nil {
-			log.Printf("write error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			_ = json.NewEncoder(w).Encode(map[string]string{"error": "produce failed"})
-			return
+		if err := validator.Validate("OrderCreated", payload); err != nil {
+			slog.Warn("schema validation failed", "error", err)
+			return "", http.StatusBadRequest, &APIError{Code: CodeValidationFailed, Message: "order does not match the OrderCreated schema", Details: err.Error()}
 		}
-		w.WriteHeader(http.StatusCreated)
-		_ = json.NewEncoder(w).Encode(map[string]string{"orderId": orderID})
-	})
+		value, err := eventCodec.Encode(ctx, "OrderCreated", payload)
+		if err != nil {
+			slog.Error("encode failed", "error", err)
+			return "", http.StatusInternalServerError, &APIError{Code: CodeEncodeFailed, Message: "encode failed"}
+		}
+		msg := withCorrelation(buildMessage(orderID, "OrderCreated", value), evt.CorrelationID)
+		if apiErr := checkMessageSize(msg); apiErr != nil {
+			return "", http.StatusRequestEntityTooLarge, apiErr
+		}
+		out := outputs.forOrder(req.Priority, checked.Review)
+		stopProduce := startTiming(ctx, "produce")
+		err = out.WriteMessages(ctx, msg)
+		stopProduce()
+		if err != nil {
+			status, apiErr, mayBeWritten := produceError(orderID, err)
+			placed = mayBeWritten
+			return "", status, apiErr
+		}
+		placed = true
+		if checked.Review {
+			slog.Info("order held for review", "order", orderID, "total", req.Total.String())
+			return orderID, http.StatusAccepted, nil
+		}
+		return orderID, http.StatusCreated, nil
+	}
+
+	orderSlots := newInflight()
+
+	http.HandleFunc("/orders", ordersHandler(placeOrder, orderSlots))
+
+	http.HandleFunc("/orders/", amendHandler(stock, allowlist, guard, validator, eventCodec, amendWriter, &inFlightOrders))
+
+	// POST /simulate generates synthetic orders; dev only
+	if getenv("ENV", "") == "dev" {
+		http.HandleFunc("/simulate", simulateHandler(placeOrder, orderSlots))
+		slog.Warn("/simulate enabled")
+	}
 
-	srv := &http.Server{Addr: addr}
+	srv := &http.Server{Addr: addr, Handler: logging.AccessLog(http.DefaultServeMux)}
 
 	// Start server in a goroutine
 	go func() {
-		log.Printf("orders-api listening on %s", addr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("server failed: %v", err)
+		slog.Info("orders-api listening", "addr", addr)
+		if err := listenAndServe(srv); err != nil && err != http.ErrServerClosed {
+			logging.Fatalf("server failed: %v", err)
+		}
+	}()
+
+	// Probe the brokers in the background so health checks answer meanwhile
+	probeCtx, probeCancel := context.WithCancel(context.Background())
+	defer probeCancel()
+	go func() {
+		if err := waitForBrokers(probeCtx, brokers, 2*time.Second); err == nil {
+			atomic.StoreInt64(&kafkaReady, 1)
+			slog.Info("orders-api ready")
 		}
 	}()
 
@@ -154,20 +474,35 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("shutting down orders-api...")
+	slog.Info("shutting down orders-api")
+	probeCancel()
 
-	// Close Kafka writer
-	if err := writer.Close(); err != nil {
-		log.Printf("error closing kafka writer: %v", err)
-	}
-
-	// Shutdown HTTP server with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// Drain the HTTP server first: stop accepting connections and let
+	// in-flight requests finish their produce. Every step below shares the
+	// SHUTDOWN_TIMEOUT budget.
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancel()
 
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Printf("server forced to shutdown: %v", err)
-	}
+	drainAndClose(ctx, srv, &inFlightOrders, func() {
+		// flush any batch still queued before the writers go
+		for _, out := range []messageWriter{outputs.normal, outputs.priority, outputs.review} {
+			if b, ok := out.(*produceBatcher); ok {
+				b.Close()
+			}
+		}
+		if err := writer.Close(); err != nil {
+			slog.Warn("error closing kafka writer", "error", err)
+		}
+		if err := priorityWriter.Close(); err != nil {
+			slog.Warn("error closing priority writer", "error", err)
+		}
+		if err := reviewWriter.Close(); err != nil {
+			slog.Warn("error closing review writer", "error", err)
+		}
+		if err := amendWriter.Close(); err != nil {
+			slog.Warn("error closing amend writer", "error", err)
+		}
+	})
 
-	log.Println("orders-api shutdown complete")
+	slog.Info("orders-api shutdown complete")
 }
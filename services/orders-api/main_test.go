@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// TestCompressionRoundTrip compresses a batch-sized payload with the codec
+// each COMPRESSION value selects and decompresses it the way a reader does.
+func TestCompressionRoundTrip(t *testing.T) {
+	payload := bytes.Repeat([]byte(`{"orderId":"o-1","userId":"u-1","items":[{"sku":"S1","qty":2}],"total":19.99}`), 100)
+	for _, name := range []string{"gzip", "snappy", "lz4", "zstd"} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("COMPRESSION", name)
+			codec := compression().Codec()
+			if codec == nil || codec.Name() != name {
+				t.Fatalf("COMPRESSION=%s selected %v", name, codec)
+			}
+			var wire bytes.Buffer
+			w := codec.NewWriter(&wire)
+			if _, err := w.Write(payload); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if wire.Len() >= len(payload) {
+				t.Errorf("compressed %d bytes to %d", len(payload), wire.Len())
+			}
+			r := codec.NewReader(&wire)
+			defer r.Close()
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, payload) {
+				t.Fatal("payload changed in the round trip")
+			}
+		})
+	}
+	t.Setenv("COMPRESSION", "none")
+	if c := compression(); c != 0 {
+		t.Fatalf("COMPRESSION=none selected %v", c)
+	}
+}
+
+func TestOrdersUnavailableBeforeReady(t *testing.T) {
+	atomic.StoreInt64(&kafkaReady, 0)
+	placed := false
+	h := ordersHandler(func(context.Context, CreateOrderRequest) (string, int, *APIError) {
+		placed = true
+		return "o-1", http.StatusCreated, nil
+	}, newInflight())
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"userId":"u1","items":[{"sku":"S1","qty":1}],"total":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), CodeNotReady) || placed {
+		t.Fatalf("got %d %s, placed=%v; want 503 %s before kafka is ready", rec.Code, rec.Body, placed, CodeNotReady)
+	}
+}
+
+func TestRequiredAcksFromEnv(t *testing.T) {
+	for v, want := range map[string]kafka.RequiredAcks{
+		"none":   kafka.RequireNone,
+		"one":    kafka.RequireOne,
+		"all":    kafka.RequireAll,
+		"":       kafka.RequireAll,
+		"quorum": kafka.RequireAll,
+	} {
+		t.Setenv("PRODUCE_ACKS", v)
+		if got := requiredAcks(); got != want {
+			t.Errorf("PRODUCE_ACKS=%q: got %v, want %v", v, got, want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+
+	"kafka-microservice/services/orders-api/codec"
+)
+
+// serviceName is stamped on every produced message as the producer header.
+const serviceName = "orders-api"
+
+// Standard headers carried by every event this service produces.
+const (
+	headerContentType   = "content-type"
+	headerEventType     = "event-type"
+	headerProducer      = "producer"
+	headerEventID       = "event-id"
+	headerCorrelationID = "correlation-id"
+)
+
+// buildMessage wraps an encoded event with the standard headers. The
+// content type follows the wire format the codec produced.
+func buildMessage(key, eventType string, payload []byte) kafka.Message {
+	contentType := "application/json"
+	if codec.IsAvro(payload) {
+		contentType = "application/vnd.confluent.avro"
+	}
+	return kafka.Message{
+		Key:   []byte(key),
+		Value: payload,
+		Time:  time.Now(),
+		Headers: []kafka.Header{
+			{Key: headerContentType, Value: []byte(contentType)},
+			{Key: headerEventType, Value: []byte(eventType)},
+			{Key: headerProducer, Value: []byte(serviceName)},
+			{Key: headerEventID, Value: []byte(uuid.NewString())},
+		},
+	}
+}
+
+// withCorrelation returns m carrying id in its correlation-id header. An
+// empty id leaves m unchanged.
+func withCorrelation(m kafka.Message, id string) kafka.Message {
+	if id != "" {
+		m.Headers = append(m.Headers, kafka.Header{Key: headerCorrelationID, Value: []byte(id)})
+	}
+	return m
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+)
+
+func headerMap(m kafka.Message) map[string]string {
+	h := make(map[string]string, len(m.Headers))
+	for _, kv := range m.Headers {
+		h[kv.Key] = string(kv.Value)
+	}
+	return h
+}
+
+// TestBuildMessageHeaders checks the standard headers of a produced event:
+// content type from the wire format, event type, producer, a fresh event
+// id, and the correlation id once withCorrelation adds it.
+func TestBuildMessageHeaders(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		payload     []byte
+		contentType string
+	}{
+		{"json", []byte(`{"orderId":"o-1"}`), "application/json"},
+		{"avro", []byte{0, 0, 0, 0, 1, 2, 'o'}, "application/vnd.confluent.avro"},
+	} {
+		m := buildMessage("o-1", "OrderCreated", tc.payload)
+		h := headerMap(m)
+		if string(m.Key) != "o-1" || h[headerContentType] != tc.contentType || h[headerEventType] != "OrderCreated" || h[headerProducer] != serviceName {
+			t.Errorf("%s: key %q headers %v", tc.name, m.Key, h)
+		}
+		if _, err := uuid.Parse(h[headerEventID]); err != nil {
+			t.Errorf("%s: event-id %q: %v", tc.name, h[headerEventID], err)
+		}
+		if _, ok := h[headerCorrelationID]; ok {
+			t.Errorf("%s: correlation-id set before withCorrelation", tc.name)
+		}
+	}
+
+	a, b := buildMessage("o-1", "OrderCreated", nil), buildMessage("o-1", "OrderCreated", nil)
+	if headerMap(a)[headerEventID] == headerMap(b)[headerEventID] {
+		t.Fatal("two messages share an event-id")
+	}
+	if got := headerMap(withCorrelation(a, "c-1"))[headerCorrelationID]; got != "c-1" {
+		t.Fatalf("correlation-id %q, want c-1", got)
+	}
+	if got := withCorrelation(b, ""); len(got.Headers) != len(b.Headers) {
+		t.Fatal("empty correlation id added a header")
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in integer minor units (cents), so totals add up
+// exactly. All supported currencies use two decimal places.
+//
+// On the wire an amount is a plain JSON number such as 19.99, matching the
+// OrderCreated schema; the currency travels in its own field. Decoding also
+// accepts a decimal string ("19.99"). Either way the literal digits are read
+// exactly rather than going through float64, and negative amounts are
+// rejected.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+var errInvalidAmount = errors.New("invalid amount")
+
+// maxAmount bounds amounts to 15 whole digits, well inside int64 cents.
+const maxAmount = 1e17 - 1
+
+// ParseAmount converts a decimal number into minor units. Any JSON number
+// form is accepted ("19.99", "19.990", "1.999e1") as long as it is an exact
+// number of cents; the digits are read as an exact rational, never through
+// float64, so "0.30" is 30 cents while "0.305" is rejected rather than
+// rounded.
+func ParseAmount(s string) (int64, error) {
+	if s == "" || len(s) > 32 || strings.Trim(s, "0123456789.eE+-") != "" {
+		return 0, fmt.Errorf("%w: %q", errInvalidAmount, s)
+	}
+	if _, exp, ok := strings.Cut(strings.ToLower(s), "e"); ok {
+		// big.Rat would expand a huge exponent in full
+		if e, err := strconv.Atoi(exp); err != nil || e < -32 || e > 32 {
+			return 0, fmt.Errorf("%w: %q", errInvalidAmount, s)
+		}
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", errInvalidAmount, s)
+	}
+	r.Mul(r, big.NewRat(100, 1))
+	if !r.IsInt() {
+		return 0, fmt.Errorf("%w: %q is not a whole number of cents", errInvalidAmount, s)
+	}
+	if !r.Num().IsInt64() || r.Num().Int64() > maxAmount || r.Num().Int64() < -maxAmount {
+		return 0, fmt.Errorf("%w: %q out of range", errInvalidAmount, s)
+	}
+	return r.Num().Int64(), nil
+}
+
+// String formats the amount as a decimal, e.g. 1999 -> "19.99".
+func (m Money) String() string {
+	sign, n := "", m.Amount
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, n/100, n%100)
+}
+
+// Add returns m+o. Adding amounts in different currencies is an error;
+// an empty currency takes the other operand's.
+func (m Money) Add(o Money) (Money, error) {
+	cur := m.Currency
+	if cur == "" {
+		cur = o.Currency
+	} else if o.Currency != "" && o.Currency != cur {
+		return Money{}, fmt.Errorf("cannot add %s to %s", o.Currency, cur)
+	}
+	sum := m.Amount + o.Amount
+	if sum > maxAmount || sum < -maxAmount {
+		return Money{}, fmt.Errorf("%w: %s + %s out of range", errInvalidAmount, m, o)
+	}
+	return Money{Amount: sum, Currency: cur}, nil
+}
+
+// Mul returns m multiplied by a quantity, as for a line item. A product
+// beyond maxAmount is an error rather than a wrapped int64.
+func (m Money) Mul(qty int) (Money, error) {
+	a, q := m.Amount, int64(qty)
+	if a < 0 {
+		a = -a
+	}
+	if q < 0 {
+		q = -q
+	}
+	if a != 0 && q > maxAmount/a {
+		return Money{}, fmt.Errorf("%w: %s x %d out of range", errInvalidAmount, m, qty)
+	}
+	return Money{Amount: m.Amount * int64(qty), Currency: m.Currency}, nil
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	s := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		var err error
+		if s, err = strconv.Unquote(s); err != nil {
+			return fmt.Errorf("%w: %s", errInvalidAmount, data)
+		}
+	}
+	n, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return fmt.Errorf("%w: %q is negative", errInvalidAmount, s)
+	}
+	m.Amount = n
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestMoneyUnmarshal(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want int64
+		ok   bool
+	}{
+		{`"19.99"`, 1999, true},
+		{`19.99`, 1999, true},
+		{`0.1`, 10, true},
+		{`"abc"`, 0, false},
+		{`19.999`, 0, false},
+		{`-5.00`, 0, false},
+		{`"-0.01"`, 0, false},
+		{`true`, 0, false},
+	} {
+		var m Money
+		err := json.Unmarshal([]byte(tc.in), &m)
+		if tc.ok && (err != nil || m.Amount != tc.want) {
+			t.Errorf("%s: got %d, %v; want %d", tc.in, m.Amount, err, tc.want)
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("%s: accepted as %d, want an error", tc.in, m.Amount)
+		}
+	}
+}
+
+func TestMoneyMulRejectsOverflow(t *testing.T) {
+	if got, err := (Money{Amount: 1999}).Mul(3); err != nil || got.Amount != 5997 {
+		t.Fatalf("19.99 x 3 = %v, %v; want 59.97", got, err)
+	}
+	if _, err := (Money{Amount: maxAmount}).Mul(1 << 40); !errors.Is(err, errInvalidAmount) {
+		t.Fatalf("err = %v, want errInvalidAmount", err)
+	}
+}
+
+// TestParseAmountExactCents checks amounts are read as exact cents where
+// float64 arithmetic would drift: 0.1 + 0.2 is 30 cents, not
+// 0.30000000000000004.
+func TestParseAmountExactCents(t *testing.T) {
+	a, errA := ParseAmount("0.1")
+	b, errB := ParseAmount("0.2")
+	if errA != nil || errB != nil || a+b != 30 {
+		t.Fatalf("0.1 + 0.2 = %d cents (%v, %v), want 30", a+b, errA, errB)
+	}
+	sum, err := (Money{Amount: a}).Add(Money{Amount: b})
+	if err != nil || sum.String() != "0.30" {
+		t.Fatalf("Money 0.1 + 0.2 = %s, %v; want 0.30", sum, err)
+	}
+	for _, tc := range []struct {
+		in   string
+		want int64
+		ok   bool
+	}{
+		{"0.30", 30, true},
+		{"1.999e1", 1999, true},
+		{"90071992547409.93", 9007199254740993, true}, // not representable as float64
+		{"0.30000000000000004", 0, false},
+		{"0.305", 0, false},
+		{"1e400", 0, false},
+	} {
+		got, err := ParseAmount(tc.in)
+		if tc.ok && (err != nil || got != tc.want) {
+			t.Errorf("%s: got %d, %v; want %d", tc.in, got, err, tc.want)
+		}
+		if !tc.ok && !errors.Is(err, errInvalidAmount) {
+			t.Errorf("%s: got %d, %v; want errInvalidAmount", tc.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// recentSet is a fixed-capacity set of keys that evicts the oldest entry once
+// full. It remembers the order ids handed out recently so none is used
+// twice.
+type recentSet struct {
+	mu   sync.Mutex
+	seen map[string]struct{}
+	ring []string
+	next int
+}
+
+func newRecentSet(capacity int) *recentSet {
+	return &recentSet{seen: make(map[string]struct{}, capacity), ring: make([]string, capacity)}
+}
+
+// add records key and reports whether it was new.
+func (s *recentSet) add(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.seen[key]; ok {
+		return false
+	}
+	if old := s.ring[s.next]; old != "" {
+		delete(s.seen, old)
+	}
+	s.ring[s.next] = key
+	s.next = (s.next + 1) % len(s.ring)
+	s.seen[key] = struct{}{}
+	return true
+}
+
+// remove forgets key, as when the order it was reserved for failed. It
+// scans the ring, which is fine for the rare failure path.
+func (s *recentSet) remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.seen[key]; !ok {
+		return
+	}
+	delete(s.seen, key)
+	for i, k := range s.ring {
+		if k == key {
+			s.ring[i] = ""
+			return
+		}
+	}
+}
+
+// recentOrderIDs holds the last ORDER_ID_WINDOW (default 10000) order ids
+// placed through this instance.
+var recentOrderIDs = newRecentSet(func() int {
+	n, err := strconv.Atoi(getenv("ORDER_ID_WINDOW", "10000"))
+	if err != nil || n < 1 {
+		return 10000
+	}
+	return n
+}())
+
+// errDuplicateOrderID is returned by reserveOrderID for a client-supplied id
+// already used within the window.
+var errDuplicateOrderID = fmt.Errorf("orderId already used")
+
+// reserveOrderID returns the id for a new order and records it as used.
+// A client-supplied id must be a UUID in canonical form and not used within
+// the window; otherwise a fresh one is generated, regenerating on the
+// (astronomically unlikely) collision.
+func reserveOrderID(requested string) (string, error) {
+	if requested != "" {
+		if id, err := uuid.Parse(requested); err != nil || id.String() != requested {
+			return "", fmt.Errorf("orderId must be a lowercase UUID like %s", uuid.Nil)
+		}
+		if !recentOrderIDs.add(requested) {
+			return "", errDuplicateOrderID
+		}
+		return requested, nil
+	}
+	for {
+		id := uuid.NewString()
+		if recentOrderIDs.add(id) {
+			return id, nil
+		}
+		slog.Warn("generated orderId collided with a recent one, regenerating", "orderId", id)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func withRecentOrderIDs(t *testing.T, capacity int) {
+	t.Helper()
+	prev := recentOrderIDs
+	recentOrderIDs = newRecentSet(capacity)
+	t.Cleanup(func() { recentOrderIDs = prev })
+}
+
+// TestReserveClientOrderID covers a client-supplied orderId that is valid,
+// malformed, or already used within the window.
+func TestReserveClientOrderID(t *testing.T) {
+	withRecentOrderIDs(t, 16)
+	valid := "3f2b8c1e-6a4d-4e5f-9b7a-1c2d3e4f5a6b"
+	for _, tc := range []struct {
+		name, id string
+		dup, bad bool
+	}{
+		{name: "valid", id: valid},
+		{name: "duplicate", id: valid, dup: true},
+		{name: "not a uuid", id: "order-1", bad: true},
+		{name: "upper case", id: "3F2B8C1E-6A4D-4E5F-9B7A-1C2D3E4F5A6B", bad: true},
+		{name: "braced", id: "{" + valid + "}", bad: true},
+	} {
+		got, err := reserveOrderID(tc.id)
+		switch {
+		case tc.dup:
+			if !errors.Is(err, errDuplicateOrderID) {
+				t.Errorf("%s: got %q, %v; want errDuplicateOrderID", tc.name, got, err)
+			}
+		case tc.bad:
+			if err == nil || errors.Is(err, errDuplicateOrderID) {
+				t.Errorf("%s: got %q, %v; want a validation error", tc.name, got, err)
+			}
+		default:
+			if err != nil || got != tc.id {
+				t.Errorf("%s: got %q, %v; want %q", tc.name, got, err, tc.id)
+			}
+		}
+	}
+
+	// an order that failed frees its id for a retry
+	recentOrderIDs.remove(valid)
+	if _, err := reserveOrderID(valid); err != nil {
+		t.Fatalf("reuse after remove: %v", err)
+	}
+}
+
+func TestReserveGeneratedOrderID(t *testing.T) {
+	withRecentOrderIDs(t, 16)
+	a, errA := reserveOrderID("")
+	b, errB := reserveOrderID("")
+	if errA != nil || errB != nil || a == b {
+		t.Fatalf("generated %q, %q (%v, %v)", a, b, errA, errB)
+	}
+	if _, err := uuid.Parse(a); err != nil {
+		t.Fatalf("generated %q: %v", a, err)
+	}
+	// a client cannot claim an id the server just handed out
+	if _, err := reserveOrderID(a); !errors.Is(err, errDuplicateOrderID) {
+		t.Fatalf("reusing a generated id: %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestOrderRejectedBelowSafetyFloor checks orders against stock-service's
+// available view: with 5 on hand and a floor of 3 only 2 are sellable, so an
+// order for 3 is refused as insufficient stock.
+func TestOrderRejectedBelowSafetyFloor(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("view") == "available" {
+			_ = json.NewEncoder(w).Encode(map[string]int{"S1": 2})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]int{"S1": 5})
+	}))
+	defer srv.Close()
+	t.Setenv("STOCK_SERVICE_URL", srv.URL)
+	prev := stockSnapshot
+	stockSnapshot = &stockCache{}
+	t.Cleanup(func() { stockSnapshot = prev })
+
+	if err := checkStockAvailability([]OrderItem{{SKU: "S1", Qty: 3}}); !errors.Is(err, errInsufficientStock) {
+		t.Fatalf("order for 3: err = %v, want errInsufficientStock", err)
+	}
+	if err := checkStockAvailability([]OrderItem{{SKU: "S1", Qty: 2}}); err != nil {
+		t.Fatalf("order for 2: %v", err)
+	}
+}
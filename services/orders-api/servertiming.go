@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serverTimingEnabled turns on the Server-Timing header on /orders
+// responses (SERVER_TIMING=true), reporting how long the stock check and the
+// Kafka produce took, e.g. "stock;dur=12.4, produce;dur=5.1".
+var serverTimingEnabled = getenv("SERVER_TIMING", "false") == "true"
+
+// serverTiming collects named durations for one request, in the order they
+// were recorded.
+type serverTiming struct {
+	mu      sync.Mutex
+	metrics []string
+}
+
+type serverTimingKey struct{}
+
+// withServerTiming attaches a fresh collector to ctx when Server-Timing is
+// enabled; otherwise ctx is returned unchanged and timing is a no-op.
+func withServerTiming(ctx context.Context) (context.Context, *serverTiming) {
+	if !serverTimingEnabled {
+		return ctx, nil
+	}
+	st := &serverTiming{}
+	return context.WithValue(ctx, serverTimingKey{}, st), st
+}
+
+// startTiming begins timing name for the request in ctx and returns the
+// function that records it.
+func startTiming(ctx context.Context, name string) func() {
+	st, _ := ctx.Value(serverTimingKey{}).(*serverTiming)
+	if st == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		ms := float64(time.Since(start).Microseconds()) / 1000
+		st.mu.Lock()
+		st.metrics = append(st.metrics, fmt.Sprintf("%s;dur=%.1f", name, ms))
+		st.mu.Unlock()
+	}
+}
+
+// write sets the Server-Timing header; it must run before WriteHeader.
+func (st *serverTiming) write(w http.ResponseWriter) {
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if len(st.metrics) > 0 {
+		w.Header().Set("Server-Timing", strings.Join(st.metrics, ", "))
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestServerTimingHeaderFormat places an order through ordersHandler with a
+// placer that times a stock check and a produce the way placeOrder does.
+func TestServerTimingHeaderFormat(t *testing.T) {
+	prev := serverTimingEnabled
+	serverTimingEnabled = true
+	t.Cleanup(func() { serverTimingEnabled = prev })
+	atomic.StoreInt64(&kafkaReady, 1)
+	t.Cleanup(func() { atomic.StoreInt64(&kafkaReady, 0) })
+
+	h := ordersHandler(func(ctx context.Context, _ CreateOrderRequest) (string, int, *APIError) {
+		stopStock := startTiming(ctx, "stock")
+		time.Sleep(2 * time.Millisecond)
+		stopStock()
+		stopProduce := startTiming(ctx, "produce")
+		stopProduce()
+		return "o-1", http.StatusCreated, nil
+	}, newInflight())
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"userId":"u1","items":[{"sku":"S1","qty":1}],"total":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got %d %s", rec.Code, rec.Body)
+	}
+	header := rec.Header().Get("Server-Timing")
+	if !regexp.MustCompile(`^stock;dur=\d+\.\d, produce;dur=\d+\.\d$`).MatchString(header) {
+		t.Fatalf("Server-Timing %q, want \"stock;dur=N.N, produce;dur=N.N\"", header)
+	}
+	if strings.HasPrefix(header, "stock;dur=0.") || strings.HasPrefix(header, "stock;dur=1.") {
+		t.Fatalf("Server-Timing %q: stock check took at least 2ms", header)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestShutdownClosesWritersAfterInFlightOrders starts a slow order, begins
+// shutdown while it is still producing and expects the produce to finish,
+// and the client to get its answer, before the writers close.
+func TestShutdownClosesWritersAfterInFlightOrders(t *testing.T) {
+	var (
+		inFlight sync.WaitGroup
+		mu       sync.Mutex
+		events   []string
+	)
+	record := func(e string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	}
+	started := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight.Add(1)
+		defer inFlight.Done()
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		record("produced")
+		w.WriteHeader(http.StatusCreated)
+	})}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve(l) }()
+
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Post("http://"+l.Addr().String()+"/orders", "application/json", nil)
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	drainAndClose(ctx, srv, &inFlight, func() { record("closed") })
+
+	if got := <-status; got != http.StatusCreated {
+		t.Fatalf("in-flight order got status %d, want 201", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 || events[0] != "produced" || events[1] != "closed" {
+		t.Fatalf("events %v, want the produce before the writers close", events)
+	}
+}
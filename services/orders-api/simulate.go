@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// orderPlacer is the normal /orders path: stock check, validation, produce.
+type orderPlacer func(ctx context.Context, req CreateOrderRequest) (string, int, *APIError)
+
+// SimulateRequest configures a synthetic order run. Zero values fall back to
+// 10 orders at 5 per second for user "loadgen".
+type SimulateRequest struct {
+	Count      int     `json:"count"`
+	RatePerSec float64 `json:"ratePerSec"`
+	UserID     string  `json:"userId"`
+}
+
+// SimulateResult summarises a run. Orders rejected by the stock check or
+// validation count as failed, the same as they would for a real client.
+type SimulateResult struct {
+	Produced int    `json:"produced"`
+	Failed   int    `json:"failed"`
+	Duration string `json:"duration"`
+}
+
+const (
+	maxSimulateCount = 10000
+	maxSimulateRate  = 1000
+)
+
+// randomOrder draws up to three in-stock SKUs with quantities the current
+// stock can cover. It returns false when nothing is in stock.
+func randomOrder(rng *rand.Rand, userID string, entries []catalogEntry) (CreateOrderRequest, bool) {
+	var inStock []catalogEntry
+	for _, e := range entries {
+		if e.Quantity > 0 {
+			inStock = append(inStock, e)
+		}
+	}
+	if len(inStock) == 0 {
+		return CreateOrderRequest{}, false
+	}
+	rng.Shuffle(len(inStock), func(i, j int) { inStock[i], inStock[j] = inStock[j], inStock[i] })
+	currency := inStock[0].Currency
+	if currency == "" {
+		currency = "USD"
+	}
+	req := CreateOrderRequest{UserID: userID, Currency: currency, Total: Money{Currency: currency}}
+	for _, e := range inStock[:1+rng.Intn(min(3, len(inStock)))] {
+		qty := 1 + rng.Intn(min(3, e.Quantity))
+		e.Price.Currency = e.Currency
+		line, err := e.Price.Mul(qty)
+		if err != nil {
+			continue
+		}
+		total, err := req.Total.Add(line)
+		if err != nil {
+			continue // priced in another currency
+		}
+		req.Items = append(req.Items, OrderItem{SKU: e.SKU, Qty: qty})
+		req.Total = total
+	}
+	return req, true
+}
+
+// simulateHandler serves POST /simulate, producing orders at the requested
+// rate through place until the count is reached, stock runs out or the
+// request context is cancelled. Each order holds one of slots while it is
+// placed, so a run counts against MAX_INFLIGHT like real traffic.
+func simulateHandler(place orderPlacer, slots inflight) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, APIError{Code: CodeMethodNotAllowed, Message: "use POST"})
+			return
+		}
+		var sim SimulateRequest
+		if r.ContentLength != 0 {
+			if status, err := decodeJSONBody(w, r, &sim); err != nil {
+				writeError(w, status, APIError{Code: CodeInvalidJSON, Message: err.Error()})
+				return
+			}
+		}
+		if sim.Count <= 0 {
+			sim.Count = 10
+		}
+		if sim.Count > maxSimulateCount {
+			writeError(w, http.StatusBadRequest, APIError{Code: CodeValidationFailed, Message: fmt.Sprintf("count must be at most %d", maxSimulateCount)})
+			return
+		}
+		if sim.RatePerSec <= 0 {
+			sim.RatePerSec = 5
+		}
+		if sim.RatePerSec > maxSimulateRate {
+			writeError(w, http.StatusBadRequest, APIError{Code: CodeValidationFailed, Message: fmt.Sprintf("ratePerSec must be at most %d", maxSimulateRate)})
+			return
+		}
+		if sim.UserID == "" {
+			sim.UserID = "loadgen"
+		}
+
+		ctx := r.Context()
+		rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / sim.RatePerSec))
+		defer ticker.Stop()
+
+		var res SimulateResult
+		start := time.Now()
+	loop:
+		for i := 0; i < sim.Count; i++ {
+			if i > 0 {
+				select {
+				case <-ctx.Done():
+					break loop
+				case <-ticker.C:
+				}
+			}
+			// re-read the catalog each time so orders track current stock
+			entries, err := fetchCatalog(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				slog.Warn("simulate: catalog fetch failed", "error", err)
+				res.Failed++
+				continue
+			}
+			req, ok := randomOrder(rng, sim.UserID, entries)
+			if !ok {
+				slog.Info("simulate: no stock left, stopping", "orders", i)
+				break
+			}
+			if slots.acquire(ctx) != nil {
+				break
+			}
+			_, _, apiErr := place(ctx, req)
+			slots.release()
+			if apiErr != nil {
+				res.Failed++
+				continue
+			}
+			res.Produced++
+		}
+		res.Duration = time.Since(start).String()
+		slog.Info("simulate finished", "produced", res.Produced, "failed", res.Failed, "duration", res.Duration)
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(res)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSimulateRejectsExcessiveRate(t *testing.T) {
+	h := simulateHandler(func(context.Context, CreateOrderRequest) (string, int, *APIError) {
+		t.Fatal("placed an order")
+		return "", 0, nil
+	}, make(inflight, 1))
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/simulate", strings.NewReader(`{"count":1,"ratePerSec":2e9}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", w.Code)
+	}
+}
+
+func TestSimulateHoldsAnInflightSlotPerOrder(t *testing.T) {
+	catalog := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]catalogEntry{{SKU: "S1", Price: Money{Amount: 100}, Currency: "USD", Quantity: 50}})
+	}))
+	defer catalog.Close()
+	t.Setenv("STOCK_SERVICE_URL", catalog.URL)
+
+	slots := make(inflight, 1)
+	placed := 0
+	h := simulateHandler(func(context.Context, CreateOrderRequest) (string, int, *APIError) {
+		if len(slots) != 1 {
+			t.Errorf("order placed without a slot")
+		}
+		placed++
+		return "o", http.StatusCreated, nil
+	}, slots)
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/simulate", strings.NewReader(`{"count":3,"ratePerSec":1000}`)))
+	var res SimulateResult
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil || res.Produced != 3 || placed != 3 {
+		t.Fatalf("result %+v (%v), placed %d", res, err, placed)
+	}
+	if len(slots) != 0 {
+		t.Fatal("slot not released")
+	}
+}
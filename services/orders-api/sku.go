@@ -0,0 +1,22 @@
+package main
+
+import "strings"
+
+// normalizeSKUs is SKU_NORMALIZE (default true). stock-service reads the same
+// variable and applies the same rule, so both sides agree on what " s1 " is.
+var normalizeSKUs = getenv("SKU_NORMALIZE", "true") == "true"
+
+// normalizeSKU trims and upper-cases sku unless SKU_NORMALIZE is false.
+func normalizeSKU(sku string) string {
+	if !normalizeSKUs {
+		return sku
+	}
+	return strings.ToUpper(strings.TrimSpace(sku))
+}
+
+// normalizeItems normalizes every item's SKU in place.
+func normalizeItems(items []OrderItem) {
+	for i := range items {
+		items[i].SKU = normalizeSKU(items[i].SKU)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNormalizeSKU(t *testing.T) {
+	for in, want := range map[string]string{" s1 ": "S1", "S1": "S1", "\ts-2\n": "S-2", "": ""} {
+		if got := normalizeSKU(in); got != want {
+			t.Errorf("normalizeSKU(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// TestOrderSKUNormalizedBeforeStockCheck orders " s1 " against a stock-service
+// that knows only S1, as placeOrder does: normalize, then check.
+func TestOrderSKUNormalizedBeforeStockCheck(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]int{"S1": 5})
+	}))
+	defer srv.Close()
+	t.Setenv("STOCK_SERVICE_URL", srv.URL)
+	prev := stockSnapshot
+	stockSnapshot = &stockCache{}
+	t.Cleanup(func() { stockSnapshot = prev })
+
+	items := []OrderItem{{SKU: " s1 ", Qty: 2}, {SKU: "S1", Qty: 1}}
+	normalizeItems(items)
+	if items[0].SKU != "S1" || items[1].SKU != "S1" {
+		t.Fatalf("normalized %+v", items)
+	}
+	if err := checkStockAvailability(items); err != nil {
+		t.Fatalf("stock check: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// stockCache holds the last /stock response for STOCK_CACHE_TTL (default
+// 1s; 0 disables it) so a burst of orders costs one fetch rather than one
+// each. This makes the availability check best-effort: within the TTL an
+// order can pass against quantities another order has already consumed.
+// That was already possible between check and produce; stock-service remains
+// the authority and compensates when it applies the order.
+type stockCache struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	stock    map[string]int
+	fetched  time.Time
+	inflight *stockFetch
+}
+
+// stockFetch is one fetch in progress, shared by every caller that missed
+// the cache while it runs.
+type stockFetch struct {
+	done  chan struct{}
+	stock map[string]int
+	err   error
+}
+
+var stockSnapshot = func() *stockCache {
+	ttl, err := time.ParseDuration(getenv("STOCK_CACHE_TTL", "1s"))
+	if err != nil || ttl < 0 {
+		ttl = time.Second
+	}
+	return &stockCache{ttl: ttl}
+}()
+
+// get returns the cached stock map, fetching it with fetch once it is older
+// than the TTL. The fetch runs outside the lock and concurrent misses wait
+// for the same one, so a slow stock-service never blocks a caller for longer
+// than one fetch. A failed fetch is returned to every waiter and nothing is
+// cached, so the breaker still sees it.
+func (c *stockCache) get(fetch func() (map[string]int, error)) (map[string]int, error) {
+	c.mu.Lock()
+	if c.stock != nil && time.Since(c.fetched) < c.ttl {
+		stock := c.stock
+		c.mu.Unlock()
+		return stock, nil
+	}
+	if f := c.inflight; f != nil {
+		c.mu.Unlock()
+		<-f.done
+		return f.stock, f.err
+	}
+	f := &stockFetch{done: make(chan struct{})}
+	c.inflight = f
+	c.mu.Unlock()
+
+	f.stock, f.err = fetch()
+
+	c.mu.Lock()
+	c.inflight = nil
+	if f.err == nil {
+		c.stock, c.fetched = f.stock, time.Now()
+	}
+	c.mu.Unlock()
+	close(f.done)
+	return f.stock, f.err
+}
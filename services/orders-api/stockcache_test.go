@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStockCacheServesWithinTTL(t *testing.T) {
+	c := &stockCache{ttl: time.Hour}
+	var calls int32
+	fetch := func() (map[string]int, error) {
+		atomic.AddInt32(&calls, 1)
+		return map[string]int{"S1": 5}, nil
+	}
+	for i := 0; i < 3; i++ {
+		stock, err := c.get(fetch)
+		if err != nil || stock["S1"] != 5 {
+			t.Fatalf("get = %v, %v", stock, err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("fetched %d times within the TTL, want 1", calls)
+	}
+}
+
+func TestStockCacheRefreshesAfterExpiry(t *testing.T) {
+	c := &stockCache{ttl: 20 * time.Millisecond}
+	n := 0
+	fetch := func() (map[string]int, error) {
+		n++
+		return map[string]int{"S1": n}, nil
+	}
+	first, _ := c.get(fetch)
+	time.Sleep(30 * time.Millisecond)
+	second, _ := c.get(fetch)
+	if first["S1"] != 1 || second["S1"] != 2 {
+		t.Fatalf("got %v then %v, want a refetch after the TTL", first, second)
+	}
+}
+
+func TestStockCacheDoesNotCacheFailures(t *testing.T) {
+	c := &stockCache{ttl: time.Hour}
+	boom := errors.New("boom")
+	if _, err := c.get(func() (map[string]int, error) { return nil, boom }); !errors.Is(err, boom) {
+		t.Fatalf("err = %v, want boom", err)
+	}
+	stock, err := c.get(func() (map[string]int, error) { return map[string]int{"S1": 1}, nil })
+	if err != nil || stock["S1"] != 1 {
+		t.Fatalf("get after failure = %v, %v", stock, err)
+	}
+}
+
+// TestStockCacheSharesConcurrentFetch checks that concurrent misses wait on
+// one fetch instead of queueing a fetch each behind a lock.
+func TestStockCacheSharesConcurrentFetch(t *testing.T) {
+	c := &stockCache{ttl: time.Hour}
+	var calls int32
+	release := make(chan struct{})
+	fetch := func() (map[string]int, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return map[string]int{"S1": 1}, nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.get(fetch); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls != 1 {
+		t.Fatalf("fetched %d times, want 1", calls)
+	}
+}
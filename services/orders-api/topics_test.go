@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeCluster answers CreateTopics like a broker holding topics.
+type fakeCluster struct {
+	topics  map[string]kafka.TopicConfig
+	failing string
+}
+
+func (c *fakeCluster) CreateTopics(configs ...kafka.TopicConfig) error {
+	for _, tc := range configs {
+		if tc.Topic == c.failing {
+			return kafka.InvalidReplicationFactor
+		}
+		if _, ok := c.topics[tc.Topic]; ok {
+			return kafka.TopicAlreadyExists
+		}
+		c.topics[tc.Topic] = tc
+	}
+	return nil
+}
+
+// TestCreateTopicsLeavesExistingOnes creates the missing topics with the
+// configured sizing, keeps an existing topic's, and stops at a real failure.
+func TestCreateTopicsLeavesExistingOnes(t *testing.T) {
+	existing := kafka.TopicConfig{Topic: "orders.created", NumPartitions: 12, ReplicationFactor: 3}
+	c := &fakeCluster{topics: map[string]kafka.TopicConfig{existing.Topic: existing}}
+	if err := createTopics(c, []string{"orders.created", "orders.amended", "orders.dlq"}, 3, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.topics["orders.created"]; got.NumPartitions != 12 || got.ReplicationFactor != 3 {
+		t.Fatalf("existing topic became %+v", got)
+	}
+	for _, topic := range []string{"orders.amended", "orders.dlq"} {
+		if got := c.topics[topic]; got.NumPartitions != 3 || got.ReplicationFactor != 1 {
+			t.Fatalf("%s created as %+v, want 3 partitions and replication 1", topic, got)
+		}
+	}
+
+	c.failing = "orders.broken"
+	err := createTopics(c, []string{"orders.broken", "orders.after"}, 3, 1)
+	if !errors.Is(err, kafka.InvalidReplicationFactor) {
+		t.Fatalf("err = %v", err)
+	}
+	if _, ok := c.topics["orders.after"]; ok {
+		t.Fatal("kept creating topics after a failure")
+	}
+}
+
+// TestEnsureTopicsDisabledOrMisconfigured expects no broker contact unless
+// ENSURE_TOPICS=true, and invalid sizing to be refused before dialing.
+func TestEnsureTopicsDisabledOrMisconfigured(t *testing.T) {
+	t.Setenv("ENSURE_TOPICS", "false")
+	if err := ensureTopics(nil, "orders.created"); err != nil {
+		t.Fatalf("disabled: %v", err)
+	}
+	t.Setenv("ENSURE_TOPICS", "true")
+	t.Setenv("TOPIC_PARTITIONS", "0")
+	if err := ensureTopics(nil, "orders.created"); err == nil {
+		t.Fatal("TOPIC_PARTITIONS=0 accepted")
+	}
+	t.Setenv("TOPIC_PARTITIONS", "3")
+	t.Setenv("TOPIC_REPLICATION_FACTOR", "none")
+	if err := ensureTopics(nil, "orders.created"); err == nil {
+		t.Fatal("TOPIC_REPLICATION_FACTOR=none accepted")
+	}
+}
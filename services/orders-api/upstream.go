@@ -0,0 +1,20 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// upstreamClient makes every call orders-api sends to stock-service and
+// orders-query. UPSTREAM_TIMEOUT (default 2s) bounds each call, so a hung
+// upstream fails the request, and counts against the stock breaker, instead
+// of holding it forever.
+var upstreamClient = &http.Client{Timeout: func() time.Duration {
+	d, err := time.ParseDuration(getenv("UPSTREAM_TIMEOUT", "2s"))
+	if err != nil || d <= 0 {
+		slog.Warn("invalid UPSTREAM_TIMEOUT, using 2s")
+		return 2 * time.Second
+	}
+	return d
+}()}
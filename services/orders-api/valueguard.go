@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// orderLimits maps a currency to an order value limit in minor units. It is
+// read from a spec like "USD=10000,EUR=9000"; a currency without an entry is
+// not limited.
+type orderLimits map[string]int64
+
+func parseOrderLimits(name, spec string) (orderLimits, error) {
+	l := orderLimits{}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		cur, val, ok := strings.Cut(pair, "=")
+		amount, err := ParseAmount(strings.TrimSpace(val))
+		if !ok || err != nil || amount <= 0 {
+			return nil, fmt.Errorf("invalid %s entry %q", name, pair)
+		}
+		l[strings.ToUpper(strings.TrimSpace(cur))] = amount
+	}
+	return l, nil
+}
+
+// exceeded returns the limit for total's currency and whether total is above
+// it.
+func (l orderLimits) exceeded(total Money) (Money, bool) {
+	limit, ok := l[strings.ToUpper(total.Currency)]
+	if !ok {
+		return Money{}, false
+	}
+	return Money{Amount: limit, Currency: total.Currency}, total.Amount > limit
+}
+
+// orderGuard runs the checks on an order's total that POST /orders and
+// PATCH /orders/{id} share, so an amendment cannot take an order anywhere a
+// new order could not go.
+type orderGuard struct {
+	baseCurrency string
+	converter    CurrencyConverter
+	verifyTotal  bool        // VERIFY_TOTAL: total must match the catalog price of the items
+	maxValue     orderLimits // MAX_ORDER_VALUE: reject above
+	review       orderLimits // REVIEW_THRESHOLD: hold for review above
+}
+
+// totalCheck is what a passed orderGuard.check found.
+type totalCheck struct {
+	FXRate float64 // price of one base currency unit in the order's, when they differ
+	Review bool    // above REVIEW_THRESHOLD
+}
+
+// check validates total, in currency ("" for the base currency), for items.
+// On failure it returns the status and error to answer with.
+func (g *orderGuard) check(ctx context.Context, items []OrderItem, total Money, currency string) (totalCheck, int, *APIError) {
+	var res totalCheck
+	if currency != "" && !strings.EqualFold(currency, g.baseCurrency) {
+		if !g.converter.Supports(currency) {
+			return res, http.StatusUnprocessableEntity, &APIError{Code: CodeUnsupportedCurrency, Message: fmt.Sprintf("currency %s is not supported", currency)}
+		}
+		_, res.FXRate, _ = g.converter.Convert(Money{Currency: g.baseCurrency}, currency)
+	}
+	if total.Amount < 0 {
+		return res, http.StatusUnprocessableEntity, &APIError{Code: CodeValidationFailed, Message: fmt.Sprintf("total %s must not be negative", total)}
+	}
+	total.Currency = currency
+	if total.Currency == "" {
+		total.Currency = g.baseCurrency
+	}
+	if limit, over := g.maxValue.exceeded(total); over {
+		return res, http.StatusUnprocessableEntity, &APIError{Code: CodeOrderValueExceeded, Message: fmt.Sprintf("total %s is above the %s limit of %s", total, total.Currency, limit), Details: map[string]interface{}{"limit": limit}}
+	}
+	if g.verifyTotal {
+		entries, err := fetchCatalog(ctx)
+		if err != nil {
+			slog.Warn("catalog fetch failed", "error", err)
+			return res, http.StatusServiceUnavailable, &APIError{Code: CodeStockUnavailable, Message: "catalog unavailable"}
+		}
+		expected, err := expectedTotal(g.converter, entries, items, currency)
+		if errors.Is(err, errInvalidAmount) {
+			return res, http.StatusUnprocessableEntity, &APIError{Code: CodeValidationFailed, Message: err.Error()}
+		}
+		if err != nil {
+			return res, http.StatusUnprocessableEntity, &APIError{Code: CodeUnsupportedCurrency, Message: err.Error()}
+		}
+		if expected.Amount != total.Amount {
+			return res, http.StatusUnprocessableEntity, &APIError{Code: CodeTotalMismatch, Message: fmt.Sprintf("total %s does not match expected %s", total, expected), Details: map[string]interface{}{"expected": expected, "fxRate": res.FXRate}}
+		}
+	}
+	_, res.Review = g.review.exceeded(total)
+	return res, 0, nil
+}
+
+// orderOutputs are the routes an order can be produced to.
+type orderOutputs struct {
+	normal, priority, review messageWriter
+}
+
+// forOrder picks the route: review for orders held for review, whatever
+// their priority, then the priority lane for high-priority orders.
+func (o orderOutputs) forOrder(priority string, review bool) messageWriter {
+	switch {
+	case review:
+		return o.review
+	case priority == "high":
+		return o.priority
+	}
+	return o.normal
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func testGuard(t *testing.T, max, review string) *orderGuard {
+	t.Helper()
+	fx, err := newStaticRates("USD", "EUR=0.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &orderGuard{baseCurrency: "USD", converter: fx}
+	if g.maxValue, err = parseOrderLimits("MAX_ORDER_VALUE", max); err != nil {
+		t.Fatal(err)
+	}
+	if g.review, err = parseOrderLimits("REVIEW_THRESHOLD", review); err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestParseOrderLimits(t *testing.T) {
+	l, err := parseOrderLimits("MAX_ORDER_VALUE", " usd=10000, EUR=99.50 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l["USD"] != 1000000 || l["EUR"] != 9950 {
+		t.Fatalf("limits = %v", l)
+	}
+	for _, bad := range []string{"USD", "USD=abc", "USD=-1", "USD=0", "USD=1.001"} {
+		if _, err := parseOrderLimits("MAX_ORDER_VALUE", bad); err == nil {
+			t.Errorf("%q: want an error", bad)
+		}
+	}
+}
+
+func TestOrderGuard(t *testing.T) {
+	g := testGuard(t, "USD=1000,EUR=400", "USD=500")
+	items := []OrderItem{{SKU: "S1", Qty: 1}}
+	cases := []struct {
+		name     string
+		total    int64
+		currency string
+		status   int
+		code     string
+		review   bool
+	}{
+		{name: "accepted", total: 10000},
+		{name: "at the limit, held for review", total: 100000, currency: "USD", review: true},
+		{name: "held for review", total: 60000, review: true},
+		{name: "rejected above the limit", total: 100001, status: http.StatusUnprocessableEntity, code: CodeOrderValueExceeded},
+		{name: "limit per currency", total: 50000, currency: "EUR", status: http.StatusUnprocessableEntity, code: CodeOrderValueExceeded},
+		{name: "no review threshold for EUR", total: 39999, currency: "EUR"},
+		{name: "negative total", total: -1, status: http.StatusUnprocessableEntity, code: CodeValidationFailed},
+		{name: "unsupported currency", total: 100, currency: "JPY", status: http.StatusUnprocessableEntity, code: CodeUnsupportedCurrency},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, status, apiErr := g.check(context.Background(), items, Money{Amount: tc.total}, tc.currency)
+			if tc.code != "" {
+				if apiErr == nil || apiErr.Code != tc.code || status != tc.status {
+					t.Fatalf("got %d %+v, want %d %s", status, apiErr, tc.status, tc.code)
+				}
+				return
+			}
+			if apiErr != nil {
+				t.Fatalf("rejected: %d %+v", status, apiErr)
+			}
+			if res.Review != tc.review {
+				t.Fatalf("review = %v, want %v", res.Review, tc.review)
+			}
+		})
+	}
+}
+
+func TestOrderGuardFXRate(t *testing.T) {
+	res, _, apiErr := testGuard(t, "", "").check(context.Background(), nil, Money{Amount: 100}, "EUR")
+	if apiErr != nil || res.FXRate != 0.5 {
+		t.Fatalf("fxRate = %v, err %+v", res.FXRate, apiErr)
+	}
+}
+
+type namedWriter string
+
+func (namedWriter) WriteMessages(context.Context, ...kafka.Message) error { return nil }
+
+func TestOrderOutputsRouting(t *testing.T) {
+	o := orderOutputs{normal: namedWriter("normal"), priority: namedWriter("priority"), review: namedWriter("review")}
+	cases := []struct {
+		priority string
+		review   bool
+		want     namedWriter
+	}{
+		{"", false, "normal"},
+		{"low", false, "normal"},
+		{"high", false, "priority"},
+		{"", true, "review"},
+		{"high", true, "review"},
+	}
+	for _, tc := range cases {
+		if got := o.forOrder(tc.priority, tc.review); got != tc.want {
+			t.Errorf("forOrder(%q, %v) = %v, want %v", tc.priority, tc.review, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"kafka-microservice/services/orders-processor/codec"
+	"kafka-microservice/services/orders-processor/schema"
+)
+
+// OrderAmended is a quantity change requested through orders-api's
+// PATCH /orders/{id}; Deltas is the per-SKU change, positive for units
+// added. Version is the order's amendment count once this one applies.
+type OrderAmended struct {
+	OrderID       string      `json:"orderId"`
+	Items         []OrderItem `json:"items"`
+	Deltas        []OrderItem `json:"deltas"`
+	Version       int         `json:"version"`
+	AmendedAt     string      `json:"amendedAt"`
+	CorrelationID string      `json:"correlationId,omitempty"`
+}
+
+// AmendmentRejected is published on AMEND_REJECTED_TOPIC for an amendment
+// the processor turned down after orders-api had answered 202, so the
+// client can learn of it through orders-query. Version and AmendedAt
+// identify the amendment as orders-api returned it.
+type AmendmentRejected struct {
+	OrderID       string `json:"orderId"`
+	Version       int    `json:"version"`
+	AmendedAt     string `json:"amendedAt,omitempty"`
+	Reason        string `json:"reason"`
+	RejectedAt    string `json:"rejectedAt"`
+	CorrelationID string `json:"correlationId,omitempty"`
+}
+
+// rejectAmendment publishes an AmendmentRejected for oa to w.
+func rejectAmendment(ctx context.Context, w messageWriter, validator *schema.Validator, eventCodec codec.Codec, oa OrderAmended, reason string) error {
+	evt := AmendmentRejected{OrderID: oa.OrderID, Version: oa.Version, AmendedAt: oa.AmendedAt, Reason: reason, RejectedAt: time.Now().UTC().Format(time.RFC3339), CorrelationID: oa.CorrelationID}
+	payload, _ := json.Marshal(evt)
+	if err := validator.Validate("AmendmentRejected", payload); err != nil {
+		return err
+	}
+	value, err := eventCodec.Encode(ctx, "AmendmentRejected", payload)
+	if err != nil {
+		return err
+	}
+	return writeWithRetry(ctx, w, withCorrelation(buildMessage(oa.OrderID, "AmendmentRejected", value), oa.CorrelationID), 4)
+}
+
+// orderIndex is the latest status and amendment version of every open order,
+// built from the status and accepted-amendment feeds so it covers orders
+// processed by any replica. Orders are dropped once they reach final or
+// EXPIRED.
+//
+// The version check is only as fresh as this replica's copy of the accepted
+// feed. Amendments are keyed by order, so one replica handles all of an
+// order's amendments while partition ownership holds; right after a
+// rebalance the new owner may not yet have read an accept the previous one
+// published, and can let a second amendment on the same version through.
+type orderIndex struct {
+	final string
+
+	mu       sync.Mutex
+	status   map[string]string
+	versions map[string]int
+}
+
+func newOrderIndex(final string) *orderIndex {
+	return &orderIndex{final: final, status: map[string]string{}, versions: map[string]int{}}
+}
+
+func (x *orderIndex) observe(s OrderStatus) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	switch s.Status {
+	case x.final, StatusExpired:
+		delete(x.status, s.OrderID)
+		delete(x.versions, s.OrderID)
+	default:
+		x.status[s.OrderID] = s.Status
+	}
+}
+
+// observeAmendment records an accepted amendment from the feed. Versions only
+// move forward, so this replica's own accepts seen again are no-ops.
+func (x *orderIndex) observeAmendment(orderID string, version int) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if version > x.versions[orderID] {
+		x.versions[orderID] = version
+	}
+}
+
+// accept claims version for orderID if the order is still PENDING and the
+// amendment was computed from its current version, returning why not
+// otherwise. An amendment built on a stale read of the order loses here, so
+// two amendments from the same base never both apply. A claim whose forward
+// then fails is handed back with release.
+func (x *orderIndex) accept(orderID string, version int) (bool, string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	status, ok := x.status[orderID]
+	switch {
+	case !ok:
+		return false, "order is not open"
+	case status != StatusPending:
+		return false, "order is " + status
+	case version != x.versions[orderID]+1:
+		return false, fmt.Sprintf("amendment is for version %d but the order is at %d", version-1, x.versions[orderID])
+	}
+	x.versions[orderID] = version
+	return true, ""
+}
+
+// release undoes accept's claim on version.
+func (x *orderIndex) release(orderID string, version int) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.versions[orderID] == version {
+		x.versions[orderID] = version - 1
+	}
+}
+
+// consumeAmendments reads topic as group and hands each message to handle,
+// committing it afterwards, until ctx ends.
+func consumeAmendments(ctx context.Context, brokers []string, topic, group string, handle func(kafka.Message)) {
+	r := newReader(brokers, topic, group)
+	defer r.Close()
+	var backoff readBackoff
+	for {
+		m, err := fetchBounded(ctx, r.FetchMessage)
+		if errors.Is(err, errReadIdle) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil || backoff.failed(ctx, err) != nil {
+				return
+			}
+			continue
+		}
+		backoff.reset()
+		handle(m)
+		if err := r.CommitMessages(ctx, m); err != nil {
+			slog.Warn("commit failed", "error", err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"kafka-microservice/services/orders-processor/codec"
+	"kafka-microservice/services/orders-processor/schema"
+)
+
+func TestOrderIndexAcceptsOnlyCurrentVersion(t *testing.T) {
+	x := newOrderIndex(StatusShipped)
+	x.observe(OrderStatus{OrderID: "o-1", Status: StatusPending})
+
+	if ok, _ := x.accept("o-1", 1); !ok {
+		t.Fatal("first amendment rejected")
+	}
+	// a second amendment computed from the same read of the order
+	if ok, reason := x.accept("o-1", 1); ok {
+		t.Fatal("stale amendment accepted")
+	} else if reason == "" {
+		t.Fatal("no reason given")
+	}
+	if ok, _ := x.accept("o-1", 2); !ok {
+		t.Fatal("amendment on the current version rejected")
+	}
+	if ok, _ := x.accept("o-1", 4); ok {
+		t.Fatal("amendment from the future accepted")
+	}
+}
+
+func TestOrderIndexRejectsUnlessPending(t *testing.T) {
+	x := newOrderIndex(StatusShipped)
+	if ok, _ := x.accept("o-1", 1); ok {
+		t.Fatal("unknown order accepted")
+	}
+	x.observe(OrderStatus{OrderID: "o-1", Status: StatusPending})
+	x.observe(OrderStatus{OrderID: "o-1", Status: StatusPaid})
+	if ok, _ := x.accept("o-1", 1); ok {
+		t.Fatal("paid order accepted")
+	}
+	x.observe(OrderStatus{OrderID: "o-1", Status: StatusShipped})
+	if _, open := x.status["o-1"]; open {
+		t.Fatal("final order still indexed")
+	}
+}
+
+func TestOrderIndexFeedAndRelease(t *testing.T) {
+	x := newOrderIndex(StatusShipped)
+	x.observe(OrderStatus{OrderID: "o-1", Status: StatusPending})
+	// another replica accepted version 1
+	x.observeAmendment("o-1", 1)
+	if ok, _ := x.accept("o-1", 1); ok {
+		t.Fatal("version taken by another replica accepted")
+	}
+	if ok, _ := x.accept("o-1", 2); !ok {
+		t.Fatal("next version rejected")
+	}
+	// our own accept seen again on the feed is a no-op
+	x.observeAmendment("o-1", 2)
+	x.observeAmendment("o-1", 1)
+	if x.versions["o-1"] != 2 {
+		t.Fatalf("version %d, want 2", x.versions["o-1"])
+	}
+	// a failed forward hands the version back
+	if ok, _ := x.accept("o-1", 3); !ok {
+		t.Fatal("version 3 rejected")
+	}
+	x.release("o-1", 3)
+	if ok, _ := x.accept("o-1", 3); !ok {
+		t.Fatal("released version not reusable")
+	}
+}
+
+// TestRejectedAmendmentIsPublished turns down a stale amendment and expects
+// an AmendmentRejected, valid against its schema, that names the amendment
+// and why.
+func TestRejectedAmendmentIsPublished(t *testing.T) {
+	ctx := context.Background()
+	validator, err := schema.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := newOrderIndex(StatusShipped)
+	x.observe(OrderStatus{OrderID: "o-1", Status: StatusPending})
+	x.observeAmendment("o-1", 1)
+	oa := OrderAmended{OrderID: "o-1", Version: 1, AmendedAt: "2026-01-01T00:00:00Z", CorrelationID: "corr-1"}
+	ok, reason := x.accept(oa.OrderID, oa.Version)
+	if ok {
+		t.Fatal("stale amendment accepted")
+	}
+
+	w := &recordWriter{}
+	if err := rejectAmendment(ctx, w, validator, codec.JSONCodec{}, oa, reason); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.written) != 1 {
+		t.Fatalf("wrote %d messages, want 1", len(w.written))
+	}
+	m := w.written[0]
+	if string(m.Key) != "o-1" || headerValue(m, headerEventType) != "AmendmentRejected" || headerValue(m, headerCorrelationID) != "corr-1" {
+		t.Fatalf("key %q, headers %v", m.Key, m.Headers)
+	}
+	body, err := codec.JSONCodec{}.Decode(ctx, m.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got AmendmentRejected
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.OrderID != "o-1" || got.Version != 1 || got.AmendedAt != oa.AmendedAt || got.Reason != reason || got.RejectedAt == "" {
+		t.Fatalf("event %+v, reason %q", got, reason)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// readBackoff spaces out retries after failed reads so an unreachable broker
+// doesn't turn the consumer loop into a busy spin. The delay doubles from
+// 100ms up to 10s and resets on the next successful read; error logs are
+// limited to one every 10s with a count of the ones suppressed in between.
+type readBackoff struct {
+	delay      time.Duration
+	lastLog    time.Time
+	suppressed int
+
+	// now and sleep default to the real clock; tests replace them
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+const (
+	readBackoffMin     = 100 * time.Millisecond
+	readBackoffMax     = 10 * time.Second
+	readErrorLogPeriod = 10 * time.Second
+)
+
+// failed records a read error and waits out the current delay. It returns
+// ctx.Err() if the context ends while waiting.
+func (b *readBackoff) failed(ctx context.Context, err error) error {
+	if b.delay == 0 {
+		b.delay = readBackoffMin
+	}
+	if now := b.clock(); now.Sub(b.lastLog) >= readErrorLogPeriod {
+		if b.suppressed > 0 {
+			slog.Warn("read error", "error", err, "retryIn", b.delay, "suppressed", b.suppressed)
+		} else {
+			slog.Warn("read error", "error", err, "retryIn", b.delay)
+		}
+		b.lastLog = now
+		b.suppressed = 0
+	} else {
+		// every read error is still visible with LOG_LEVEL=debug
+		slog.Debug("read error", "error", err, "retryIn", b.delay)
+		b.suppressed++
+	}
+
+	d := b.delay
+	b.delay = min(b.delay*2, readBackoffMax)
+	if b.sleep != nil {
+		return b.sleep(ctx, d)
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func (b *readBackoff) clock() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+	return time.Now()
+}
+
+// reset clears the delay after a successful read.
+func (b *readBackoff) reset() {
+	if b.delay > readBackoffMin {
+		slog.Info("reads recovered")
+	}
+	b.delay = 0
+	b.suppressed = 0
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestReadBackoff drives readBackoff with a reader that always fails, one
+// second apart: the delay doubles from 100ms to the 10s cap, only one
+// error per 10s is logged along with how many were suppressed, and a
+// successful read starts over from 100ms.
+func TestReadBackoff(t *testing.T) {
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var slept []time.Duration
+	b := readBackoff{
+		now: func() time.Time { return clock },
+		sleep: func(_ context.Context, d time.Duration) error {
+			slept = append(slept, d)
+			return nil
+		},
+	}
+	fetch := func() error { return errors.New("connection refused") }
+	for i := 0; i < 12; i++ {
+		if err := b.failed(context.Background(), fetch()); err != nil {
+			t.Fatal(err)
+		}
+		clock = clock.Add(time.Second)
+	}
+
+	ms := time.Millisecond
+	want := []time.Duration{100 * ms, 200 * ms, 400 * ms, 800 * ms, 1600 * ms, 3200 * ms, 6400 * ms, 10 * time.Second, 10 * time.Second, 10 * time.Second, 10 * time.Second, 10 * time.Second}
+	if len(slept) != len(want) {
+		t.Fatalf("slept %v, want %v", slept, want)
+	}
+	for i := range want {
+		if slept[i] != want[i] {
+			t.Fatalf("slept %v, want %v", slept, want)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 2 || strings.Contains(lines[0], "suppressed") || !strings.Contains(lines[1], "suppressed=9") {
+		t.Fatalf("logged %q, want the first error and one after 10s with 9 suppressed", lines)
+	}
+
+	logs.Reset()
+	b.reset()
+	if !strings.Contains(logs.String(), "reads recovered") {
+		t.Fatalf("reset logged %q", logs.String())
+	}
+	_ = b.failed(context.Background(), fetch())
+	if last := slept[len(slept)-1]; last != 100*ms {
+		t.Fatalf("delay after reset %v, want 100ms", last)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b.sleep = nil
+	if err := b.failed(ctx, fetch()); !errors.Is(err, context.Canceled) {
+		t.Fatalf("failed with cancelled context = %v", err)
+	}
+}
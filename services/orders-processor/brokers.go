@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaDialer is shared by the connections made outside the readers and
+// writers: the leader election's lock topic and the expiry feeds.
+var kafkaDialer = &kafka.Dialer{Timeout: 5 * time.Second, DualStack: true}
+
+// dialAny connects to the first of brokers that accepts, so one broker down
+// does not fail the caller.
+func dialAny(ctx context.Context, brokers []string) (*kafka.Conn, error) {
+	var errs []error
+	for _, b := range brokers {
+		b = strings.TrimSpace(b)
+		if b == "" {
+			continue
+		}
+		conn, err := kafkaDialer.DialContext(ctx, "tcp", b)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("KAFKA_BROKERS is empty")
+	}
+	return nil, fmt.Errorf("no broker reachable: %w", errors.Join(errs...))
+}
+
+// dialLeaderAny connects to the leader of one partition, looked up through
+// whichever broker dialAny reaches.
+func dialLeaderAny(ctx context.Context, brokers []string, topic string, partition int) (*kafka.Conn, error) {
+	conn, err := dialAny(ctx, brokers)
+	if err != nil {
+		return nil, err
+	}
+	bootstrap := conn.RemoteAddr().String()
+	conn.Close()
+	return kafkaDialer.DialLeader(ctx, "tcp", bootstrap, topic, partition)
+}
+
+// checkBrokers dials each broker in turn and succeeds as soon as one accepts
+// a connection within timeout. It turns a misconfigured KAFKA_BROKERS into an
+// immediate startup failure instead of an opaque error on first produce/read.
+func checkBrokers(brokers []string, timeout time.Duration) error {
+	var errs []error
+	for _, b := range brokers {
+		b = strings.TrimSpace(b)
+		if b == "" {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", b)
+		cancel()
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return errors.New("KAFKA_BROKERS is empty")
+	}
+	return fmt.Errorf("no broker reachable: %w", errors.Join(errs...))
+}
+
+// startupBrokerCheck runs checkBrokers when STARTUP_BROKER_CHECK=true;
+// otherwise connections stay lazy as before.
+func startupBrokerCheck(brokers []string) error {
+	if getenv("STARTUP_BROKER_CHECK", "false") != "true" {
+		return nil
+	}
+	timeout, err := time.ParseDuration(getenv("STARTUP_BROKER_TIMEOUT", "5s"))
+	if err != nil {
+		return fmt.Errorf("invalid STARTUP_BROKER_TIMEOUT: %w", err)
+	}
+	return checkBrokers(brokers, timeout)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type partitionCheckpoint struct {
+	offset    int64
+	highWater int64
+}
+
+// checkpointLogger records the last committed offset per partition and logs
+// them, together with each partition's high-watermark, at most once per
+// interval. record is on the consumer hot path: updating an existing map key
+// and checking the deadline do not allocate, only the periodic log line does.
+type checkpointLogger struct {
+	interval time.Duration
+	level    slog.Level
+
+	mu    sync.Mutex
+	next  time.Time
+	parts map[int]partitionCheckpoint
+}
+
+// newCheckpointLogger returns nil when level is "off"; a nil logger ignores
+// every record call.
+func newCheckpointLogger(level string, interval time.Duration) *checkpointLogger {
+	if level == "off" || interval <= 0 {
+		return nil
+	}
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		lvl = slog.LevelInfo
+	}
+	return &checkpointLogger{
+		interval: interval,
+		level:    lvl,
+		next:     time.Now().Add(interval),
+		parts:    map[int]partitionCheckpoint{},
+	}
+}
+
+// record notes that m has been committed and logs a checkpoint when due.
+func (c *checkpointLogger) record(m kafka.Message) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.parts[m.Partition] = partitionCheckpoint{offset: m.Offset, highWater: m.HighWaterMark}
+	now := time.Now()
+	if now.Before(c.next) {
+		return
+	}
+	c.next = now.Add(c.interval)
+	ids := make([]int, 0, len(c.parts))
+	for id := range c.parts {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		p := c.parts[id]
+		slog.Log(context.Background(), c.level, "checkpoint", "topic", m.Topic, "partition", id, "offset", p.offset, "highWatermark", p.highWater, "lag", p.highWater-p.offset-1)
+	}
+}
@@ -0,0 +1,191 @@
+package codec
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+
+	"kafka-microservice/services/orders-processor/events"
+)
+
+const magicByte = 0
+
+//go:embed avro/*.avsc
+var avroFiles embed.FS
+
+// avroSchema is one embedded .avsc together with the names of its top-level
+// fields, used to drop JSON keys the schema does not know about.
+type avroSchema struct {
+	subject string
+	text    string
+	fields  map[string]bool
+}
+
+// AvroCodec encodes events as Avro using schemas registered with a Confluent
+// Schema Registry. Subjects follow the record-name strategy, so the same
+// subject is shared by every topic carrying a given event type.
+type AvroCodec struct {
+	registryURL string
+	client      *http.Client
+
+	mu      sync.Mutex
+	schemas map[string]avroSchema // event type -> embedded schema
+	ids     map[string]int        // event type -> registered schema id
+	codecs  map[int]*goavro.Codec // schema id -> codec
+}
+
+// NewAvroCodec returns a codec that talks to the registry at registryURL.
+// Schemas are registered lazily on first encode.
+func NewAvroCodec(registryURL string) *AvroCodec {
+	c := &AvroCodec{
+		registryURL: strings.TrimRight(registryURL, "/"),
+		client:      &http.Client{Timeout: 5 * time.Second},
+		schemas:     map[string]avroSchema{},
+		ids:         map[string]int{},
+		codecs:      map[int]*goavro.Codec{},
+	}
+	entries, _ := avroFiles.ReadDir("avro")
+	for _, e := range entries {
+		raw, err := avroFiles.ReadFile("avro/" + e.Name())
+		if err != nil {
+			continue
+		}
+		var doc struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+			Fields    []struct {
+				Name string `json:"name"`
+			} `json:"fields"`
+		}
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			continue
+		}
+		fields := map[string]bool{}
+		for _, f := range doc.Fields {
+			fields[f.Name] = true
+		}
+		c.schemas[doc.Name] = avroSchema{subject: doc.Namespace + "." + doc.Name, text: string(raw), fields: fields}
+	}
+	return c
+}
+
+// Encode registers (or looks up) the schema for eventType and returns payload
+// as Avro binary framed with the magic byte and schema id. Keys in payload
+// that are not part of the schema are dropped.
+func (c *AvroCodec) Encode(ctx context.Context, eventType string, payload []byte) ([]byte, error) {
+	id, codec, err := c.schemaFor(ctx, eventType)
+	if err != nil {
+		return nil, err
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return nil, err
+	}
+	fields := c.schemas[eventType].fields
+	for k := range body {
+		if !fields[k] {
+			delete(body, k)
+		}
+	}
+	textual, _ := json.Marshal(body)
+	native, _, err := codec.NativeFromTextual(textual)
+	if err != nil {
+		return nil, fmt.Errorf("avro encode %s: %w", eventType, err)
+	}
+	out := make([]byte, 5, 5+len(payload))
+	out[0] = magicByte
+	binary.BigEndian.PutUint32(out[1:5], uint32(id))
+	return codec.BinaryFromNative(out, native)
+}
+
+// Decode returns the JSON form of an Avro-framed message. Plain JSON, as
+// written by JSONCodec during a migration, is unwrapped from its events
+// envelope the same way JSONCodec would.
+func (c *AvroCodec) Decode(ctx context.Context, data []byte) ([]byte, error) {
+	if !IsAvro(data) {
+		_, body, err := events.Decode(data)
+		return body, err
+	}
+	id := int(binary.BigEndian.Uint32(data[1:5]))
+	codec, err := c.codecByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	native, _, err := codec.NativeFromBinary(data[5:])
+	if err != nil {
+		return nil, fmt.Errorf("avro decode schema %d: %w", id, err)
+	}
+	return codec.TextualFromNative(nil, native)
+}
+
+func (c *AvroCodec) schemaFor(ctx context.Context, eventType string) (int, *goavro.Codec, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if id, ok := c.ids[eventType]; ok {
+		return id, c.codecs[id], nil
+	}
+	s, ok := c.schemas[eventType]
+	if !ok {
+		return 0, nil, fmt.Errorf("no avro schema for event type %q", eventType)
+	}
+	codec, err := goavro.NewCodec(s.text)
+	if err != nil {
+		return 0, nil, err
+	}
+	var resp struct {
+		ID int `json:"id"`
+	}
+	req, _ := json.Marshal(map[string]string{"schema": s.text})
+	if err := c.call(ctx, http.MethodPost, "/subjects/"+s.subject+"/versions", req, &resp); err != nil {
+		return 0, nil, fmt.Errorf("register %s: %w", s.subject, err)
+	}
+	c.ids[eventType] = resp.ID
+	c.codecs[resp.ID] = codec
+	return resp.ID, codec, nil
+}
+
+func (c *AvroCodec) codecByID(ctx context.Context, id int) (*goavro.Codec, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if codec, ok := c.codecs[id]; ok {
+		return codec, nil
+	}
+	var resp struct {
+		Schema string `json:"schema"`
+	}
+	if err := c.call(ctx, http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &resp); err != nil {
+		return nil, fmt.Errorf("fetch schema %d: %w", id, err)
+	}
+	codec, err := goavro.NewCodec(resp.Schema)
+	if err != nil {
+		return nil, err
+	}
+	c.codecs[id] = codec
+	return codec, nil
+}
+
+func (c *AvroCodec) call(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.registryURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("schema registry returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
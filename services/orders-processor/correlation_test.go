@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"kafka-microservice/services/orders-processor/codec"
+)
+
+// recordWriter keeps every message it is handed.
+type recordWriter struct {
+	written []kafka.Message
+}
+
+func (w *recordWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	w.written = append(w.written, msgs...)
+	return nil
+}
+
+// TestCorrelationIDFlowsFromOrderToStatus reads the correlationId off an
+// OrderCreated as orders-api writes it, or off its header alone, and checks
+// that the emitted status carries it in both its body and its header.
+func TestCorrelationIDFlowsFromOrderToStatus(t *testing.T) {
+	cases := map[string]struct {
+		body string
+	}{
+		"body and header": {`{"orderId":"o-corr","userId":"u-1","correlationId":"corr-1"}`},
+		"header only":     {`{"orderId":"o-corr","userId":"u-1"}`},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			value, err := codec.JSONCodec{}.Encode(ctx, "OrderCreated", []byte(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			in := withCorrelation(buildMessage("o-corr", "OrderCreated", value), "corr-1")
+			body, err := codec.JSONCodec{}.Decode(ctx, in.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var oc OrderCreated
+			if err := json.Unmarshal(body, &oc); err != nil {
+				t.Fatal(err)
+			}
+			w := &recordWriter{}
+			e := &statusEmitter{states: newOrderStates(StatusPaid), emitted: newRecentSet(16), codec: codec.JSONCodec{}, w: w}
+			e.emit(ctx, trackedOrder{ID: oc.OrderID, ReadAt: time.Now(), CorrelationID: correlationOf(oc.CorrelationID, in)}, StatusPending)
+
+			if len(w.written) != 1 {
+				t.Fatalf("wrote %d messages, want 1", len(w.written))
+			}
+			out := w.written[0]
+			body, err = codec.JSONCodec{}.Decode(ctx, out.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var status OrderStatus
+			if err := json.Unmarshal(body, &status); err != nil {
+				t.Fatal(err)
+			}
+			if status.CorrelationID != "corr-1" || headerValue(out, headerCorrelationID) != "corr-1" {
+				t.Fatalf("status correlationId %q, header %q; want corr-1 in both", status.CorrelationID, headerValue(out, headerCorrelationID))
+			}
+		})
+	}
+}
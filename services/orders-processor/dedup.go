@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+)
+
+// recentSet is a fixed-capacity set of keys that evicts the oldest entry once
+// full. It remembers which status events have been published so a
+// redelivered order does not publish them again.
+type recentSet struct {
+	mu   sync.Mutex
+	seen map[string]struct{}
+	ring []string
+	next int
+}
+
+func newRecentSet(capacity int) *recentSet {
+	return &recentSet{seen: make(map[string]struct{}, capacity), ring: make([]string, capacity)}
+}
+
+// has reports whether key is in the set.
+func (s *recentSet) has(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.seen[key]
+	return ok
+}
+
+// add records key and reports whether it was new.
+func (s *recentSet) add(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.seen[key]; ok {
+		return false
+	}
+	if old := s.ring[s.next]; old != "" {
+		delete(s.seen, old)
+	}
+	s.ring[s.next] = key
+	s.next = (s.next + 1) % len(s.ring)
+	s.seen[key] = struct{}{}
+	return true
+}
+
+func dedupCapacity() int {
+	n, err := strconv.Atoi(getenv("DEDUP_CAPACITY", "10000"))
+	if err != nil || n < 1 {
+		return 10000
+	}
+	return n
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"kafka-microservice/services/orders-processor/codec"
+)
+
+// ackLostWriter keeps every message it is handed but reports the first
+// write as failed, as when the broker appends a batch and the ack is lost.
+type ackLostWriter struct {
+	written []kafka.Message
+}
+
+func (w *ackLostWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	w.written = append(w.written, msgs...)
+	if len(w.written) == 1 {
+		return errors.New("i/o timeout")
+	}
+	return nil
+}
+
+// TestAckLostRetryCarriesOneEventID checks that both copies of a status
+// written twice carry the same event id, and that re-emitting it for a
+// redelivered order writes nothing.
+func TestAckLostRetryCarriesOneEventID(t *testing.T) {
+	w := &ackLostWriter{}
+	e := &statusEmitter{states: newOrderStates(StatusPaid), emitted: newRecentSet(16), codec: codec.JSONCodec{}, w: w}
+	order := trackedOrder{ID: "o-acklost", ReadAt: time.Now()}
+	e.emit(context.Background(), order, StatusPending)
+	e.emit(context.Background(), order, StatusPending)
+
+	if len(w.written) != 2 {
+		t.Fatalf("wrote %d messages, want the original and one retry", len(w.written))
+	}
+	want := statusEventID("o-acklost", StatusPending)
+	for i, m := range w.written {
+		if got := headerValue(m, headerEventID); got != want {
+			t.Fatalf("message %d: event-id %q, want %q", i, got, want)
+		}
+	}
+}
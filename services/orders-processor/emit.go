@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"kafka-microservice/services/orders-processor/codec"
+	"kafka-microservice/services/orders-processor/schema"
+)
+
+// statusEmitter publishes status transitions, at most once each per
+// emitted, and records each attempt in processingSeconds.
+type statusEmitter struct {
+	states    *orderStates
+	emitted   *recentSet
+	validator *schema.Validator
+	codec     codec.Codec
+	w         messageWriter
+}
+
+// emit validates and publishes one status transition for order.
+func (e *statusEmitter) emit(ctx context.Context, order trackedOrder, status string) {
+	orderID, readAt := order.ID, order.ReadAt
+	eventID := statusEventID(orderID, status)
+	if e.emitted.has(eventID) {
+		// already published, e.g. the OrderCreated was redelivered
+		slog.Debug("skipping duplicate status", "order", orderID, "status", status)
+		observeProcessing(status, "duplicate", readAt)
+		return
+	}
+	if status == StatusExpired {
+		// the leader expires orders other replicas processed, so it
+		// may hold no state for them; the status feed tells the owner
+		e.states.forget(orderID)
+	} else if err := e.states.advance(orderID, status); err != nil {
+		slog.Warn("rejected status", "error", err)
+		observeProcessing(status, "rejected", readAt)
+		return
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	evt := OrderStatus{OrderID: orderID, Status: status, UserEmail: order.UserEmail, EventTime: order.EventTime, ProcessedAt: now, CorrelationID: order.CorrelationID, UpdatedAt: now}
+	payload, _ := json.Marshal(evt)
+	if err := e.validator.Validate("OrderStatus", payload); err != nil {
+		slog.Error("status fails its schema, not publishing", "order", orderID, "status", status, "error", err)
+		observeProcessing(status, "schema_error", readAt)
+		return
+	}
+	value, err := e.codec.Encode(ctx, "OrderStatus", payload)
+	if err != nil {
+		slog.Error("encode failed", "error", err)
+		observeProcessing(status, "encode_error", readAt)
+		return
+	}
+
+	// Use retry logic with exponential backoff
+	msg := withCorrelation(buildMessageWithID(orderID, "OrderStatus", eventID, value), order.CorrelationID)
+	if err := writeWithRetry(ctx, e.w, msg, 4); err != nil {
+		slog.Error("failed to write status after retries", "error", err)
+		observeProcessing(status, "write_error", readAt)
+		// Continue processing other messages even if one fails
+		return
+	}
+	e.emitted.add(eventID)
+	observeProcessing(status, "ok", readAt)
+}
+
+// pay emits PENDING for order, waits out the simulated payment delay and
+// emits PAID. With no delay both go out back to back.
+func pay(ctx context.Context, emit func(context.Context, trackedOrder, string), order trackedOrder, delay time.Duration) {
+	emit(ctx, order, StatusPending)
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	emit(ctx, order, StatusPaid)
+}
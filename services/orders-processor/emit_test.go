@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+
+	"kafka-microservice/services/orders-processor/codec"
+)
+
+// flakyWriter fails its first fails writes.
+type flakyWriter struct {
+	fails, calls int
+}
+
+func (w *flakyWriter) WriteMessages(context.Context, ...kafka.Message) error {
+	w.calls++
+	if w.calls <= w.fails {
+		return errors.New("leader not available")
+	}
+	return nil
+}
+
+// latencySamples returns the sample count and sum of one processingSeconds
+// series.
+func latencySamples(t *testing.T, status, outcome string) (uint64, float64) {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != "orders_processor_status_latency_seconds" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["status"] == status && labels["outcome"] == outcome {
+				return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+			}
+		}
+	}
+	return 0, 0
+}
+
+// TestEmitObservesLatencyIncludingRetries publishes one status through a
+// writer that fails once, so the sample must cover writeWithRetry's backoff.
+func TestEmitObservesLatencyIncludingRetries(t *testing.T) {
+	before, sumBefore := latencySamples(t, StatusPending, "ok")
+	w := &flakyWriter{fails: 1}
+	e := &statusEmitter{states: newOrderStates(StatusPaid), emitted: newRecentSet(16), codec: codec.JSONCodec{}, w: w}
+	e.emit(context.Background(), trackedOrder{ID: "o-latency", ReadAt: time.Now()}, StatusPending)
+
+	after, sumAfter := latencySamples(t, StatusPending, "ok")
+	if w.calls != 2 || after != before+1 {
+		t.Fatalf("writes %d, samples %d -> %d; want 2 writes and one sample", w.calls, before, after)
+	}
+	if got := sumAfter - sumBefore; got < 0.1 {
+		t.Fatalf("observed %.3fs, want the 100ms retry backoff included", got)
+	}
+}
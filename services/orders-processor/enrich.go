@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UserProfile is the subset of the user service's profile used to enrich
+// status events.
+type UserProfile struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+type cachedProfile struct {
+	profile UserProfile
+	expires time.Time
+}
+
+// profileLookup fetches profiles from USER_SERVICE_URL/users/{id}, caching
+// successful lookups for ttl so a burst of orders from one user costs a
+// single request. The cache holds at most maxCached users. A nil
+// *profileLookup means enrichment is disabled.
+type profileLookup struct {
+	baseURL   string
+	ttl       time.Duration
+	maxCached int
+	client    *http.Client
+
+	mu    sync.Mutex
+	cache map[string]cachedProfile
+}
+
+// newProfileLookup reads ENRICHMENT_ENABLED, USER_SERVICE_URL,
+// PROFILE_CACHE_TTL (default 1m) and PROFILE_CACHE_SIZE (default 10000). It
+// returns nil when enrichment is off.
+func newProfileLookup() (*profileLookup, error) {
+	if getenv("ENRICHMENT_ENABLED", "false") != "true" {
+		return nil, nil
+	}
+	base := getenv("USER_SERVICE_URL", "")
+	if base == "" {
+		return nil, fmt.Errorf("ENRICHMENT_ENABLED requires USER_SERVICE_URL")
+	}
+	ttl, err := time.ParseDuration(getenv("PROFILE_CACHE_TTL", "1m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PROFILE_CACHE_TTL: %w", err)
+	}
+	size, err := strconv.Atoi(getenv("PROFILE_CACHE_SIZE", "10000"))
+	if err != nil || size < 1 {
+		return nil, fmt.Errorf("invalid PROFILE_CACHE_SIZE %q", getenv("PROFILE_CACHE_SIZE", "10000"))
+	}
+	return &profileLookup{
+		baseURL:   strings.TrimRight(base, "/"),
+		ttl:       ttl,
+		maxCached: size,
+		client:    &http.Client{Timeout: 2 * time.Second},
+		cache:     make(map[string]cachedProfile),
+	}, nil
+}
+
+func (p *profileLookup) get(ctx context.Context, userID string) (UserProfile, error) {
+	if p == nil {
+		return UserProfile{}, nil
+	}
+	p.mu.Lock()
+	c, ok := p.cache[userID]
+	p.mu.Unlock()
+	if ok && time.Now().Before(c.expires) {
+		return c.profile, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/users/"+url.PathEscape(userID), nil)
+	if err != nil {
+		return UserProfile{}, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return UserProfile{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return UserProfile{}, fmt.Errorf("user service returned %d for %s", resp.StatusCode, userID)
+	}
+	var profile UserProfile
+	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+		return UserProfile{}, fmt.Errorf("decode profile for %s: %w", userID, err)
+	}
+
+	p.mu.Lock()
+	p.store(userID, cachedProfile{profile: profile, expires: time.Now().Add(p.ttl)})
+	p.mu.Unlock()
+	return profile, nil
+}
+
+// store caches c for userID. A full cache first drops its expired entries
+// and, if that frees nothing, the entry closest to expiring. Callers hold mu.
+func (p *profileLookup) store(userID string, c cachedProfile) {
+	if _, ok := p.cache[userID]; !ok && len(p.cache) >= p.maxCached {
+		now := time.Now()
+		victim, soonest := "", time.Time{}
+		for id, e := range p.cache {
+			if now.After(e.expires) {
+				delete(p.cache, id)
+			} else if victim == "" || e.expires.Before(soonest) {
+				victim, soonest = id, e.expires
+			}
+		}
+		if len(p.cache) >= p.maxCached {
+			delete(p.cache, victim)
+		}
+	}
+	p.cache[userID] = c
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestLookup(t *testing.T, ttl time.Duration, size int) (*profileLookup, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		id := strings.TrimPrefix(r.URL.Path, "/users/")
+		_ = json.NewEncoder(w).Encode(UserProfile{Email: id + "@example.com"})
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("ENRICHMENT_ENABLED", "true")
+	t.Setenv("USER_SERVICE_URL", srv.URL)
+	t.Setenv("PROFILE_CACHE_TTL", ttl.String())
+	t.Setenv("PROFILE_CACHE_SIZE", strconv.Itoa(size))
+	p, err := newProfileLookup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, &calls
+}
+
+func TestProfileLookupCachesWithinTTL(t *testing.T) {
+	p, calls := newTestLookup(t, time.Hour, 10)
+	for i := 0; i < 3; i++ {
+		got, err := p.get(context.Background(), "u-1")
+		if err != nil || got.Email != "u-1@example.com" {
+			t.Fatalf("get = %+v, %v", got, err)
+		}
+	}
+	if *calls != 1 {
+		t.Fatalf("user service called %d times, want 1", *calls)
+	}
+}
+
+func TestProfileCacheStaysBounded(t *testing.T) {
+	p, _ := newTestLookup(t, time.Hour, 3)
+	for _, id := range []string{"u-1", "u-2", "u-3", "u-4", "u-5"} {
+		if _, err := p.get(context.Background(), id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(p.cache) != 3 {
+		t.Fatalf("cache holds %d users, want 3", len(p.cache))
+	}
+	if _, ok := p.cache["u-5"]; !ok {
+		t.Fatal("latest lookup not cached")
+	}
+	if _, ok := p.cache["u-1"]; ok {
+		t.Fatal("entry closest to expiring was kept")
+	}
+}
+
+func TestProfileCacheDropsExpiredEntriesFirst(t *testing.T) {
+	p, _ := newTestLookup(t, time.Hour, 2)
+	p.cache["stale-1"] = cachedProfile{expires: time.Now().Add(-time.Second)}
+	p.cache["stale-2"] = cachedProfile{expires: time.Now().Add(-time.Second)}
+	if _, err := p.get(context.Background(), "u-1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.cache) != 1 {
+		t.Fatalf("cache holds %d users after a sweep, want 1", len(p.cache))
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"kafka-microservice/services/orders-processor/codec"
+	"kafka-microservice/services/orders-processor/schema"
+)
+
+// TestStatusCarriesEventTimeAndStampsProcessedAt emits a status for an
+// order read off a message, as the consumer does. eventTime is the order's
+// createdAt, or the message time when it has none, unchanged; processedAt
+// is when the status was emitted.
+func TestStatusCarriesEventTimeAndStampsProcessedAt(t *testing.T) {
+	validator, err := schema.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	for _, tc := range []struct {
+		name, createdAt, want string
+	}{
+		{"createdAt", "2024-03-01T10:00:00Z", "2024-03-01T10:00:00Z"},
+		{"message time", "", "2024-03-01T11:00:00Z"},
+	} {
+		ctx := context.Background()
+		order := trackedOrder{ID: "o-time", EventTime: eventTime(tc.createdAt, kafka.Message{Time: msgTime}), ReadAt: time.Now()}
+		w := &recordWriter{}
+		e := &statusEmitter{states: newOrderStates(StatusPaid), emitted: newRecentSet(16), validator: validator, codec: codec.JSONCodec{}, w: w}
+		before := time.Now().UTC().Truncate(time.Second)
+		e.emit(ctx, order, StatusPending)
+		after := time.Now().UTC()
+
+		if len(w.written) != 1 {
+			t.Fatalf("%s: wrote %d messages, want 1", tc.name, len(w.written))
+		}
+		body, err := codec.JSONCodec{}.Decode(ctx, w.written[0].Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s OrderStatus
+		if err := json.Unmarshal(body, &s); err != nil {
+			t.Fatal(err)
+		}
+		if s.EventTime != tc.want {
+			t.Errorf("%s: eventTime %q, want %q", tc.name, s.EventTime, tc.want)
+		}
+		processed, err := time.Parse(time.RFC3339, s.ProcessedAt)
+		if err != nil || processed.Before(before) || processed.After(after) {
+			t.Errorf("%s: processedAt %q, want between %s and %s", tc.name, s.ProcessedAt, before, after)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"kafka-microservice/services/orders-processor/codec"
+)
+
+// expiryWatcher tracks orders that have not reached their final status and
+// expires those still open ORDER_TIMEOUT after they went PENDING, so clients
+// waiting on a crashed or stuck order are told to stop. A nil watcher, the
+// default when ORDER_TIMEOUT is unset, tracks nothing.
+//
+// Every replica follows the status topic (see followStatuses), so each
+// watcher sees all orders whichever replica processes them, but only the
+// elected leader runs the scan; otherwise each replica would emit its own
+// EXPIRED for the same order.
+type expiryWatcher struct {
+	timeout time.Duration
+	final   string
+
+	mu   sync.Mutex
+	open map[string]trackedOrder
+}
+
+func newExpiryWatcher(timeout time.Duration, final string) *expiryWatcher {
+	if timeout <= 0 {
+		return nil
+	}
+	return &expiryWatcher{timeout: timeout, final: final, open: map[string]trackedOrder{}}
+}
+
+// observe updates the open orders from one status read off the status
+// topic at time at.
+func (e *expiryWatcher) observe(s OrderStatus, at time.Time) {
+	if e == nil {
+		return
+	}
+	switch s.Status {
+	case StatusPending:
+		e.track(trackedOrder{ID: s.OrderID, UserEmail: s.UserEmail, EventTime: s.EventTime, ReadAt: at, CorrelationID: s.CorrelationID})
+	case e.final, StatusExpired:
+		e.done(s.OrderID)
+	}
+}
+
+// track starts the clock for order; a repeated PENDING keeps its first
+// ReadAt.
+func (e *expiryWatcher) track(order trackedOrder) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.open[order.ID]; !ok {
+		e.open[order.ID] = order
+	}
+}
+
+// done stops tracking orderID once it reached a final status.
+func (e *expiryWatcher) done(orderID string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.open, orderID)
+}
+
+// due removes and returns the orders open longer than the timeout.
+func (e *expiryWatcher) due(now time.Time) []trackedOrder {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var out []trackedOrder
+	for id, order := range e.open {
+		if now.Sub(order.ReadAt) >= e.timeout {
+			out = append(out, order)
+			delete(e.open, id)
+		}
+	}
+	return out
+}
+
+// run scans for overdue orders every tenth of the timeout, at least once a
+// second, and hands each to expire until ctx ends.
+func (e *expiryWatcher) run(ctx context.Context, expire func(trackedOrder)) {
+	if e == nil {
+		return
+	}
+	t := time.NewTicker(max(e.timeout/10, time.Second))
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			for _, order := range e.due(now) {
+				expire(order)
+			}
+		}
+	}
+}
+
+// followStatuses reads every partition of topic from since onwards, passing
+// each decoded status and its message time to handle until ctx ends. It
+// reads without a group, so every replica sees every status.
+func followStatuses(ctx context.Context, brokers []string, topic string, since time.Time, eventCodec codec.Codec, handle func(OrderStatus, time.Time)) error {
+	return followTopic(ctx, brokers, topic, since, eventCodec, func(body []byte, at time.Time) error {
+		var s OrderStatus
+		if err := json.Unmarshal(body, &s); err != nil {
+			return err
+		}
+		handle(s, at)
+		return nil
+	})
+}
+
+// followTopic reads every partition of topic from since onwards without a
+// group, passing each decoded body and its message time to handle until ctx
+// ends. Bodies that fail to decode or handle are skipped.
+func followTopic(ctx context.Context, brokers []string, topic string, since time.Time, eventCodec codec.Codec, handle func(body []byte, at time.Time) error) error {
+	conn, err := dialAny(ctx, brokers)
+	if err != nil {
+		return err
+	}
+	partitions, err := conn.ReadPartitions(topic)
+	conn.Close()
+	if err != nil {
+		return err
+	}
+	for _, p := range partitions {
+		r := kafka.NewReader(withFetchTuning(withReaderLogging(kafka.ReaderConfig{Brokers: brokers, Topic: topic, Partition: p.ID})))
+		if err := r.SetOffsetAt(ctx, since); err != nil {
+			r.Close()
+			return err
+		}
+		go func(r *kafka.Reader) {
+			defer r.Close()
+			var backoff readBackoff
+			for {
+				m, err := r.ReadMessage(ctx)
+				if err != nil {
+					if ctx.Err() != nil || backoff.failed(ctx, err) != nil {
+						return
+					}
+					continue
+				}
+				backoff.reset()
+				body, err := eventCodec.Decode(ctx, m.Value)
+				if err == nil {
+					err = handle(body, m.Time)
+				}
+				if err != nil {
+					slog.Debug("feed decode error", "topic", topic, "partition", m.Partition, "offset", m.Offset, "error", err)
+				}
+			}
+		}(r)
+	}
+	return nil
+}
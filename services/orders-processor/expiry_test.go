@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"kafka-microservice/services/orders-processor/codec"
+)
+
+// TestUnpaidOrderExpires leaves one order PENDING past ORDER_TIMEOUT while
+// another is paid; only the first is marked EXPIRED.
+func TestUnpaidOrderExpires(t *testing.T) {
+	x := newExpiryWatcher(time.Minute, StatusPaid)
+	start := time.Now()
+	x.observe(OrderStatus{OrderID: "o-unpaid", Status: StatusPending}, start)
+	x.observe(OrderStatus{OrderID: "o-paid", Status: StatusPending}, start)
+	x.observe(OrderStatus{OrderID: "o-paid", Status: StatusPaid}, start.Add(time.Second))
+
+	if due := x.due(start.Add(59 * time.Second)); len(due) != 0 {
+		t.Fatalf("expired %v before the timeout", due)
+	}
+	due := x.due(start.Add(time.Minute))
+	if len(due) != 1 || due[0].ID != "o-unpaid" {
+		t.Fatalf("due %v, want only o-unpaid", due)
+	}
+
+	w := &recordWriter{}
+	e := &statusEmitter{states: newOrderStates(StatusPaid), emitted: newRecentSet(16), codec: codec.JSONCodec{}, w: w}
+	e.emit(context.Background(), due[0], StatusExpired)
+	if len(w.written) != 1 {
+		t.Fatalf("wrote %d statuses, want 1", len(w.written))
+	}
+	body, err := codec.JSONCodec{}.Decode(context.Background(), w.written[0].Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s OrderStatus
+	if err := json.Unmarshal(body, &s); err != nil || s.OrderID != "o-unpaid" || s.Status != StatusExpired {
+		t.Fatalf("emitted %s, %v", body, err)
+	}
+	if again := x.due(start.Add(time.Hour)); len(again) != 0 {
+		t.Fatalf("expired again: %v", again)
+	}
+}
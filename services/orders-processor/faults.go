@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var errInjectedFault = errors.New("injected fault")
+
+// faultInjector fails selected operations at random, at per-kind
+// probabilities, so retry and DLQ paths can be exercised in integration tests.
+// A nil *faultInjector never fails anything.
+type faultInjector struct {
+	mu     sync.Mutex
+	rnd    *rand.Rand
+	rates  map[string]float64
+	counts map[string]*int64
+}
+
+// newFaultInjector parses spec ("write=0.2,decode=0.1"). Fault injection is
+// only honoured when env is "dev"; anywhere else it stays off regardless of
+// spec, so a stray FAULT_INJECTION can never reach production.
+func newFaultInjector(spec, env string, seed int64) (*faultInjector, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	if env != "dev" {
+		return nil, fmt.Errorf("FAULT_INJECTION requires ENV=dev (ENV=%q)", env)
+	}
+	f := &faultInjector{rnd: rand.New(rand.NewSource(seed)), rates: map[string]float64{}, counts: map[string]*int64{}}
+	for _, part := range strings.Split(spec, ",") {
+		kind, rate, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid FAULT_INJECTION entry %q", part)
+		}
+		p, err := strconv.ParseFloat(rate, 64)
+		if err != nil || p < 0 || p > 1 {
+			return nil, fmt.Errorf("invalid probability for %s: %q", kind, rate)
+		}
+		switch kind {
+		case "write", "decode":
+		default:
+			return nil, fmt.Errorf("unknown fault kind %q", kind)
+		}
+		f.rates[kind] = p
+		f.counts[kind] = new(int64)
+	}
+	return f, nil
+}
+
+// inject reports whether the operation of the given kind should fail now.
+func (f *faultInjector) inject(kind string) bool {
+	if f == nil {
+		return false
+	}
+	p, ok := f.rates[kind]
+	if !ok {
+		return false
+	}
+	f.mu.Lock()
+	hit := f.rnd.Float64() < p
+	f.mu.Unlock()
+	if hit {
+		atomic.AddInt64(f.counts[kind], 1)
+	}
+	return hit
+}
+
+// stats returns how many faults of each kind have been injected.
+func (f *faultInjector) stats() map[string]int64 {
+	out := map[string]int64{}
+	if f == nil {
+		return out
+	}
+	for kind, n := range f.counts {
+		out[kind] = atomic.LoadInt64(n)
+	}
+	return out
+}
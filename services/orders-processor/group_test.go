@@ -0,0 +1,102 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestGroupIDSuffix(t *testing.T) {
+	for _, tc := range []struct {
+		group, suffix, want string
+	}{
+		{"", "", "orders-processor"},
+		{"", "2", "orders-processor-2"},
+		{"orders-canary", "", "orders-canary"},
+		{"orders-canary", "web-0", "orders-canary-web-0"},
+	} {
+		t.Setenv("GROUP_ID", tc.group)
+		t.Setenv("GROUP_ID_SUFFIX", tc.suffix)
+		if got := groupID("orders-processor"); got != tc.want {
+			t.Errorf("GROUP_ID=%q GROUP_ID_SUFFIX=%q: got %q, want %q", tc.group, tc.suffix, got, tc.want)
+		}
+	}
+}
+
+// TestGroupTimeoutsFromEnv maps SESSION_TIMEOUT, HEARTBEAT_INTERVAL and
+// REBALANCE_TIMEOUT onto the config of a consumer built by newReader.
+func TestGroupTimeoutsFromEnv(t *testing.T) {
+	for _, tc := range []struct {
+		name                      string
+		session, heartbeat, rebal string
+		wantS, wantH, wantR       time.Duration
+	}{
+		{"defaults", "", "", "", 30 * time.Second, 3 * time.Second, 30 * time.Second},
+		{"set", "45s", "5s", "1m", 45 * time.Second, 5 * time.Second, time.Minute},
+		{"invalid falls back", "soon", "-1s", "0", 30 * time.Second, 3 * time.Second, 30 * time.Second},
+		{"heartbeat not under session", "5s", "10s", "", 30 * time.Second, 3 * time.Second, 30 * time.Second},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("SESSION_TIMEOUT", tc.session)
+			t.Setenv("HEARTBEAT_INTERVAL", tc.heartbeat)
+			t.Setenv("REBALANCE_TIMEOUT", tc.rebal)
+			r := newReader([]string{"localhost:9093"}, "orders.created", "g")
+			defer r.Close()
+			cfg := r.Config()
+			if cfg.SessionTimeout != tc.wantS || cfg.HeartbeatInterval != tc.wantH || cfg.RebalanceTimeout != tc.wantR {
+				t.Fatalf("session %v, heartbeat %v, rebalance %v; want %v, %v, %v",
+					cfg.SessionTimeout, cfg.HeartbeatInterval, cfg.RebalanceTimeout, tc.wantS, tc.wantH, tc.wantR)
+			}
+		})
+	}
+}
+
+// TestGroupBalancerFromEnv maps GROUP_BALANCER onto the balancers of a
+// consumer built by newReader. Unset and unknown values keep kafka-go's
+// default of range, then round-robin.
+func TestGroupBalancerFromEnv(t *testing.T) {
+	kafkaDefault := []kafka.GroupBalancer{kafka.RangeGroupBalancer{}, kafka.RoundRobinGroupBalancer{}}
+	for _, tc := range []struct {
+		balancer, rack string
+		want           []kafka.GroupBalancer
+	}{
+		{"", "", kafkaDefault},
+		{"range", "", []kafka.GroupBalancer{kafka.RangeGroupBalancer{}}},
+		{"roundrobin", "", []kafka.GroupBalancer{kafka.RoundRobinGroupBalancer{}}},
+		{"rackaware", "eu-west-1a", []kafka.GroupBalancer{kafka.RackAffinityGroupBalancer{Rack: "eu-west-1a"}}},
+		{"sticky", "", kafkaDefault},
+	} {
+		t.Setenv("GROUP_BALANCER", tc.balancer)
+		t.Setenv("RACK_ID", tc.rack)
+		r := newReader([]string{"localhost:9093"}, "orders.created", "g")
+		got := r.Config().GroupBalancers
+		r.Close()
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("GROUP_BALANCER=%q: got %#v, want %#v", tc.balancer, got, tc.want)
+		}
+	}
+}
+
+// TestStartOffsetFromEnv maps START_OFFSET onto where a new consumer group
+// built by newReader begins; unset and invalid values mean last.
+func TestStartOffsetFromEnv(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  int64
+	}{
+		{"", kafka.LastOffset},
+		{"first", kafka.FirstOffset},
+		{"last", kafka.LastOffset},
+		{"earliest", kafka.LastOffset},
+	} {
+		t.Setenv("START_OFFSET", tc.value)
+		r := newReader([]string{"localhost:9093"}, "orders.created", "g")
+		got := r.Config().StartOffset
+		r.Close()
+		if got != tc.want {
+			t.Errorf("START_OFFSET=%q: got %d, want %d", tc.value, got, tc.want)
+		}
+	}
+}
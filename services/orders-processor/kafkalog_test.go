@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// TestKafkaDebugLog expects KAFKA_DEBUG_LOG to attach kafka-go loggers to
+// readers and writers, writing into the service log tagged with the client,
+// and to leave them nil when off.
+func TestKafkaDebugLog(t *testing.T) {
+	var logs bytes.Buffer
+	prevLog, prevDebug := slog.Default(), kafkaDebugLog
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() {
+		slog.SetDefault(prevLog)
+		kafkaDebugLog = prevDebug
+	})
+
+	for _, on := range []bool{false, true} {
+		kafkaDebugLog = on
+		cfg := withReaderLogging(kafka.ReaderConfig{Topic: "orders.created"})
+		w := newWriter([]string{"127.0.0.1:1"}, "orders.status")
+		loggers := map[string]kafka.Logger{
+			"reader Logger": cfg.Logger, "reader ErrorLogger": cfg.ErrorLogger,
+			"writer Logger": w.Logger, "writer ErrorLogger": w.ErrorLogger,
+		}
+		for name, l := range loggers {
+			if (l != nil) != on {
+				t.Errorf("KAFKA_DEBUG_LOG=%v: %s = %v", on, name, l)
+			}
+		}
+		_ = w.Close()
+	}
+
+	logs.Reset()
+	cfg := withReaderLogging(kafka.ReaderConfig{Topic: "orders.created"})
+	cfg.ErrorLogger.Printf("fetch failed: %s", "EOF")
+	if got := logs.String(); !strings.Contains(got, "level=WARN") || !strings.Contains(got, `msg="fetch failed: EOF"`) || !strings.Contains(got, `client="reader orders.created"`) {
+		t.Fatalf("error logger wrote %q", got)
+	}
+}
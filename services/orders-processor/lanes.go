@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fetched is one message together with the reader it must be committed on
+// and the checkpoint logger of its lane.
+type fetched struct {
+	m           kafka.Message
+	r           *kafka.Reader
+	checkpoints *checkpointLogger
+}
+
+// fetchLane reads topic as group and hands each message to out until ctx
+// ends, then closes out. The send blocks, so a lane holds at most one
+// message ahead of the consumer loop. A committed offset that has fallen out
+// of range is reset per resetPolicy and the reader recreated.
+//
+// kafka-go only reports an out-of-range offset when a reader starts on it,
+// i.e. after a restart or rebalance. If retention deletes the segment a
+// running reader is on, kafka-go itself skips to the first retained offset
+// and logs that through the reader's error logger; ON_OFFSET_RESET does not
+// apply there.
+func fetchLane(ctx context.Context, brokers []string, topic, group, resetPolicy string, checkpoints *checkpointLogger, out chan<- fetched) {
+	defer close(out)
+	r := newReader(brokers, topic, group)
+	defer func() { r.Close() }()
+	var backoff readBackoff
+	for {
+		m, err := fetchBounded(ctx, r.FetchMessage)
+		if errors.Is(err, errReadIdle) {
+			continue
+		}
+		if errors.Is(err, kafka.OffsetOutOfRange) {
+			// the reader stops on this error; leave the group, move the
+			// stale offsets and rejoin
+			slog.Warn("committed offset out of range, applying ON_OFFSET_RESET", "topic", topic, "policy", resetPolicy)
+			r.Close()
+			err := resetOutOfRangeOffsets(ctx, brokers, topic, group, resetPolicy)
+			r = newReader(brokers, topic, group)
+			if err != nil && backoff.failed(ctx, fmt.Errorf("offset reset: %w", err)) != nil {
+				return
+			}
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil || backoff.failed(ctx, err) != nil {
+				return
+			}
+			continue
+		}
+		backoff.reset()
+		select {
+		case out <- fetched{m: m, r: r, checkpoints: checkpoints}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// priorityWeight is how many priority orders in a row the consumer takes
+// before letting one waiting normal order through (PRIORITY_WEIGHT, default
+// 4), so a steady stream of priority orders cannot starve the rest.
+func priorityWeight() int {
+	if n, err := strconv.Atoi(getenv("PRIORITY_WEIGHT", "4")); err == nil && n > 0 {
+		return n
+	}
+	return 4
+}
+
+// laneSelector picks the next message from the priority and normal lanes.
+type laneSelector struct {
+	priority, normal <-chan fetched
+	weight           int
+	streak           int // priority messages taken since the last normal one
+}
+
+// next prefers a waiting priority message unless weight of them have just
+// been taken and a normal one is waiting; with nothing waiting it blocks for
+// whichever comes first. ok is false once ctx ends or a lane has closed,
+// which only happens on shutdown.
+func (s *laneSelector) next(ctx context.Context) (f fetched, ok bool) {
+	if s.streak < s.weight {
+		select {
+		case f, ok = <-s.priority:
+			s.streak++
+			return f, ok
+		default:
+		}
+	}
+	select {
+	case f, ok = <-s.normal:
+		s.streak = 0
+		return f, ok
+	default:
+	}
+	select {
+	case f, ok = <-s.priority:
+		s.streak++
+	case f, ok = <-s.normal:
+		s.streak = 0
+	case <-ctx.Done():
+	}
+	return f, ok
+}
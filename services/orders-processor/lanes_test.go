@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func lane(prefix string, n int) chan fetched {
+	ch := make(chan fetched, n)
+	for i := 0; i < n; i++ {
+		ch <- fetched{m: kafka.Message{Key: []byte(fmt.Sprintf("%s%d", prefix, i))}}
+	}
+	return ch
+}
+
+func takeKeys(t *testing.T, s *laneSelector, n int) string {
+	t.Helper()
+	var keys []string
+	for i := 0; i < n; i++ {
+		f, ok := s.next(context.Background())
+		if !ok {
+			t.Fatalf("lane closed after %v", keys)
+		}
+		keys = append(keys, string(f.m.Key))
+	}
+	return strings.Join(keys, " ")
+}
+
+// TestPriorityServedAheadOfBacklog queues a high-priority order behind a
+// backlog of normal ones; it must come out first.
+func TestPriorityServedAheadOfBacklog(t *testing.T) {
+	s := &laneSelector{priority: lane("p", 1), normal: lane("n", 10), weight: 4}
+	if got := takeKeys(t, s, 3); got != "p0 n0 n1" {
+		t.Fatalf("got %s, want the priority order first", got)
+	}
+}
+
+func TestNormalLaneNotStarved(t *testing.T) {
+	s := &laneSelector{priority: lane("p", 10), normal: lane("n", 10), weight: 2}
+	if got := takeKeys(t, s, 7); got != "p0 p1 n0 p2 p3 n1 p4" {
+		t.Fatalf("got %s, want a normal order after every 2 priority ones", got)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// generation is one round of the election: leads reports whether this
+// replica holds partition 0 of the lock topic, and start runs fn with a
+// context that ends when the round does.
+type generation struct {
+	id    int32
+	leads bool
+	start func(fn func(term context.Context))
+}
+
+// coordinator hands out election rounds. The next round is only returned
+// once every fn started for the previous one has returned, so terms never
+// overlap on a replica.
+type coordinator interface {
+	next(ctx context.Context) (generation, error)
+	close() error
+}
+
+// groupCoordinator runs the election as a consumer group on the lock topic.
+type groupCoordinator struct {
+	cg    *kafka.ConsumerGroup
+	topic string
+}
+
+func newGroupCoordinator(brokers []string, topic, group string) (*groupCoordinator, error) {
+	logger, errLogger := kafkaLoggers("leader " + topic)
+	session, heartbeat, rebalance := groupTimeouts()
+	cg, err := kafka.NewConsumerGroup(kafka.ConsumerGroupConfig{
+		ID:          group,
+		Brokers:     brokers,
+		Topics:      []string{topic},
+		Dialer:      kafkaDialer,
+		Logger:      logger,
+		ErrorLogger: errLogger,
+
+		SessionTimeout:    session,
+		HeartbeatInterval: heartbeat,
+		RebalanceTimeout:  rebalance,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &groupCoordinator{cg: cg, topic: topic}, nil
+}
+
+func (c *groupCoordinator) next(ctx context.Context) (generation, error) {
+	gen, err := c.cg.Next(ctx)
+	if err != nil {
+		return generation{}, err
+	}
+	leads := false
+	for _, p := range gen.Assignments[c.topic] {
+		leads = leads || p.ID == 0
+	}
+	return generation{id: gen.ID, leads: leads, start: gen.Start}, nil
+}
+
+func (c *groupCoordinator) close() error { return c.cg.Close() }
+
+// leaderElector picks one replica to run singleton jobs such as the expiry
+// scan. Every replica joins a consumer group on the lock topic
+// (LEADER_TOPIC); whichever member Kafka assigns partition 0 leads until the
+// next rebalance, so a crashed leader is replaced once its session times
+// out. A nil elector never leads.
+type leaderElector struct {
+	brokers []string
+	topic   string
+	group   string
+	replica string
+	coord   coordinator // a group on topic unless set before run
+
+	mu      sync.Mutex
+	term    context.Context // non-nil while this replica leads
+	since   time.Time
+	changed chan struct{} // closed and replaced on every change of term
+
+	// the last announced leader read back for /stats, so requests do not
+	// each dial the lock topic
+	leader   string
+	leaderAt time.Time
+}
+
+// announcedTTL is how long /stats reuses the announced leader it read.
+const announcedTTL = 10 * time.Second
+
+func newLeaderElector(brokers []string, topic, group string) *leaderElector {
+	replica := getenv("REPLICA_ID", "")
+	if replica == "" {
+		replica, _ = os.Hostname()
+	}
+	return &leaderElector{brokers: brokers, topic: topic, group: group, replica: replica, changed: make(chan struct{})}
+}
+
+func (e *leaderElector) setTerm(term context.Context) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.term = term
+	if term != nil {
+		e.since = time.Now()
+		e.leader, e.leaderAt = e.replica, e.since
+	} else {
+		// someone else leads now; read who on the next /stats
+		e.leaderAt = time.Time{}
+	}
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+func (e *leaderElector) current() (context.Context, <-chan struct{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.term, e.changed
+}
+
+// run takes part in the election until ctx ends.
+func (e *leaderElector) run(ctx context.Context) {
+	if e == nil {
+		return
+	}
+	coord := e.coord
+	if coord == nil {
+		var err error
+		if coord, err = newGroupCoordinator(e.brokers, e.topic, e.group); err != nil {
+			slog.Warn("leader election disabled", "error", err)
+			return
+		}
+	}
+	defer coord.close()
+
+	var backoff readBackoff
+	for {
+		gen, err := coord.next(ctx)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, kafka.ErrGroupClosed) || backoff.failed(ctx, err) != nil {
+				return
+			}
+			continue
+		}
+		backoff.reset()
+		gen.start(func(term context.Context) {
+			if !gen.leads {
+				return
+			}
+			slog.Info("replica is now leader", "replica", e.replica, "generation", gen.id)
+			e.announce(term)
+			e.setTerm(term)
+			<-term.Done()
+			e.setTerm(nil)
+			slog.Info("replica is no longer leader", "replica", e.replica)
+		})
+	}
+}
+
+// announce records this replica as leader on partition 0 of the lock topic,
+// where any replica's /stats can read it back.
+func (e *leaderElector) announce(ctx context.Context) {
+	conn, err := dialLeaderAny(ctx, e.brokers, e.topic, 0)
+	if err != nil {
+		slog.Warn("leader announce failed", "error", err)
+		return
+	}
+	defer conn.Close()
+	_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.WriteMessages(kafka.Message{Key: []byte("leader"), Value: []byte(e.replica)}); err != nil {
+		slog.Warn("leader announce failed", "error", err)
+	}
+}
+
+// announced returns the replica that most recently took the lead, reading
+// the lock topic at most once per announcedTTL.
+func (e *leaderElector) announced(ctx context.Context) string {
+	e.mu.Lock()
+	if time.Since(e.leaderAt) < announcedTTL {
+		defer e.mu.Unlock()
+		return e.leader
+	}
+	e.mu.Unlock()
+	leader, err := e.readAnnounced(ctx)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil {
+		// keep what was known; a broker outage is retried after the TTL too
+		leader = e.leader
+	}
+	e.leader, e.leaderAt = leader, time.Now()
+	return leader
+}
+
+func (e *leaderElector) readAnnounced(ctx context.Context) (string, error) {
+	conn, err := dialLeaderAny(ctx, e.brokers, e.topic, 0)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	last, err := conn.ReadLastOffset()
+	if err != nil || last == 0 {
+		return "", err
+	}
+	if _, err := conn.Seek(last-1, kafka.SeekAbsolute); err != nil {
+		return "", err
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	m, err := conn.ReadMessage(1 << 10)
+	if err != nil {
+		return "", err
+	}
+	return string(m.Value), nil
+}
+
+// whileLeader runs job for each term this replica leads, cancelling the
+// job's context when the term ends, until ctx ends. This is how singleton
+// background work is kept to one replica.
+func (e *leaderElector) whileLeader(ctx context.Context, job func(context.Context)) {
+	if e == nil {
+		return
+	}
+	for {
+		term, changed := e.current()
+		if term != nil && term.Err() == nil {
+			job(term)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		}
+	}
+}
+
+// LeaderStats is the election state reported on /stats.
+type LeaderStats struct {
+	Replica  string `json:"replica"`
+	IsLeader bool   `json:"isLeader"`
+	Leader   string `json:"leader,omitempty"` // last replica to announce itself
+	Since    string `json:"since,omitempty"`
+}
+
+func (e *leaderElector) stats(ctx context.Context) *LeaderStats {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	s := LeaderStats{Replica: e.replica, IsLeader: e.term != nil}
+	if s.IsLeader {
+		s.Since = e.since.UTC().Format(time.RFC3339)
+	}
+	e.mu.Unlock()
+	s.Leader = e.announced(ctx)
+	return &s
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeCoordinator hands the elector the rounds a test sends it.
+type fakeCoordinator struct{ gens chan generation }
+
+func (c *fakeCoordinator) next(ctx context.Context) (generation, error) {
+	select {
+	case gen := <-c.gens:
+		return gen, nil
+	case <-ctx.Done():
+		return generation{}, ctx.Err()
+	}
+}
+
+func (c *fakeCoordinator) close() error { return nil }
+
+// round returns a generation whose term lasts until the returned cancel.
+func round(id int32, leads bool) (generation, context.CancelFunc) {
+	term, cancel := context.WithCancel(context.Background())
+	return generation{id: id, leads: leads, start: func(fn func(context.Context)) { go fn(term) }}, cancel
+}
+
+// TestLeaderAcquireRelease runs the elector against a fake coordinator and
+// expects the singleton job to start when the replica is handed partition 0,
+// stop when that round ends, and not start for a round it does not lead.
+func TestLeaderAcquireRelease(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	coord := &fakeCoordinator{gens: make(chan generation)}
+	e := newLeaderElector(nil, "lock", "g.leader")
+	e.replica, e.coord = "replica-a", coord
+	go e.run(ctx)
+
+	started, stopped := make(chan struct{}, 1), make(chan struct{}, 1)
+	go e.whileLeader(ctx, func(term context.Context) {
+		started <- struct{}{}
+		<-term.Done()
+		stopped <- struct{}{}
+	})
+	wait := func(ch chan struct{}, what string) {
+		t.Helper()
+		select {
+		case <-ch:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("job never %s", what)
+		}
+	}
+
+	gen, release := round(1, true)
+	coord.gens <- gen
+	wait(started, "started")
+	if s := e.stats(ctx); !s.IsLeader || s.Leader != "replica-a" || s.Since == "" {
+		t.Fatalf("while leading: %+v", s)
+	}
+
+	release()
+	wait(stopped, "stopped")
+	gen, release = round(2, false)
+	defer release()
+	coord.gens <- gen
+	select {
+	case <-started:
+		t.Fatal("job started for a round this replica does not lead")
+	case <-time.After(50 * time.Millisecond):
+	}
+	for deadline := time.Now().Add(2 * time.Second); e.stats(ctx).IsLeader; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("still leading after release: %+v", e.stats(ctx))
+		}
+	}
+}
+
+func TestNilElectorNeverLeads(t *testing.T) {
+	var e *leaderElector
+	e.run(context.Background())
+	e.whileLeader(context.Background(), func(context.Context) { t.Fatal("nil elector ran a job") })
+	if e.stats(context.Background()) != nil {
+		t.Fatal("nil elector reported stats")
+	}
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"math"
 	"net/http"
 	"os"
@@ -13,7 +15,12 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/segmentio/kafka-go"
+
+	"kafka-microservice/services/orders-processor/codec"
+	"kafka-microservice/services/orders-processor/logging"
+	"kafka-microservice/services/orders-processor/schema"
 )
 
 type OrderItem struct {
@@ -21,16 +28,39 @@ type OrderItem struct {
 	Qty int    `json:"qty"`
 }
 type OrderCreated struct {
-	OrderID string      `json:"orderId"`
-	UserID  string      `json:"userId"`
-	Items   []OrderItem `json:"items"`
-	Total   float64     `json:"total"`
+	OrderID   string      `json:"orderId"`
+	UserID    string      `json:"userId"`
+	Items     []OrderItem `json:"items"`
+	Total     float64     `json:"total"`
+	CreatedAt string      `json:"createdAt"`
+
+	CorrelationID string `json:"correlationId,omitempty"`
+	Priority      string `json:"priority,omitempty"`
 }
+
+// OrderStatus carries two clocks: EventTime is when the order was created,
+// propagated unchanged, and ProcessedAt (like UpdatedAt) is when this status
+// was produced. Their difference is the end-to-end latency including lag.
 type OrderStatus struct {
-	OrderID   string `json:"orderId"`
-	Status    string `json:"status"`
-	Reason    string `json:"reason,omitempty"`
-	UpdatedAt string `json:"updatedAt"`
+	OrderID     string `json:"orderId"`
+	Status      string `json:"status"`
+	Reason      string `json:"reason,omitempty"`
+	UserEmail   string `json:"userEmail,omitempty"`
+	EventTime   string `json:"eventTime,omitempty"`
+	ProcessedAt string `json:"processedAt,omitempty"`
+	// CorrelationID is copied from the order, see correlationOf
+	CorrelationID string `json:"correlationId,omitempty"`
+	UpdatedAt     string `json:"updatedAt"`
+}
+
+// trackedOrder is what every status emitted for one order shares.
+type trackedOrder struct {
+	ID        string
+	UserEmail string    // empty when enrichment is off or the lookup failed
+	EventTime string    // the order's creation time, see eventTime
+	ReadAt    time.Time // when the order was read, for the latency histogram
+
+	CorrelationID string
 }
 
 func getenv(key, def string) string {
@@ -41,23 +71,116 @@ func getenv(key, def string) string {
 }
 
 func newReader(brokers []string, topic, group string) *kafka.Reader {
-	return kafka.NewReader(kafka.ReaderConfig{
+	return kafka.NewReader(withGroupTuning(withFetchTuning(withReaderLogging(kafka.ReaderConfig{
 		Brokers:     brokers,
 		GroupID:     group,
 		Topic:       topic,
-		MinBytes:    1,
-		MaxBytes:    10e6,
-		StartOffset: kafka.LastOffset,
-	})
+		StartOffset: startOffset(),
+
+		CommitInterval: commitInterval(),
+
+		GroupBalancers: groupBalancers(),
+
+		// surface out-of-range offsets instead of retrying forever, so the
+		// loop can apply ON_OFFSET_RESET
+		OffsetOutOfRangeError: true,
+	}))))
+}
+
+// startOffset maps START_OFFSET (first|last, default last) onto where a new
+// consumer group begins reading. Groups with committed offsets resume from
+// those regardless of this setting.
+func startOffset() int64 {
+	switch v := getenv("START_OFFSET", "last"); v {
+	case "first":
+		slog.Info("new consumer groups start from the first offset")
+		return kafka.FirstOffset
+	case "last":
+		slog.Info("new consumer groups start from the last offset")
+		return kafka.LastOffset
+	default:
+		slog.Warn("unknown START_OFFSET, using last", "value", v)
+		return kafka.LastOffset
+	}
+}
+
+// groupBalancers maps GROUP_BALANCER onto the partition assignment strategy.
+// Unset keeps kafka-go's default (range, then round-robin); rackaware prefers
+// partitions whose leader shares this consumer's RACK_ID.
+func groupBalancers() []kafka.GroupBalancer {
+	switch v := getenv("GROUP_BALANCER", ""); v {
+	case "":
+		return nil
+	case "range":
+		return []kafka.GroupBalancer{kafka.RangeGroupBalancer{}}
+	case "roundrobin":
+		return []kafka.GroupBalancer{kafka.RoundRobinGroupBalancer{}}
+	case "rackaware":
+		return []kafka.GroupBalancer{kafka.RackAffinityGroupBalancer{Rack: getenv("RACK_ID", "")}}
+	default:
+		slog.Warn("unknown GROUP_BALANCER, using default", "value", v)
+		return nil
+	}
 }
 func newWriter(brokers []string, topic string) *kafka.Writer {
-	return &kafka.Writer{Addr: kafka.TCP(brokers...), Topic: topic, Balancer: &kafka.Hash{}}
+	return withWriterLogging(&kafka.Writer{Addr: kafka.TCP(brokers...), Topic: topic, Balancer: &kafka.Hash{}, Compression: compression(), RequiredAcks: requiredAcks()})
+}
+
+// compression maps COMPRESSION onto the writer codec. Compressing trades CPU on
+// both producer and consumer for smaller batches on the wire and on the broker:
+// snappy and lz4 are cheap and suit small JSON events, gzip and zstd shrink
+// further at noticeably higher CPU cost. Readers decompress transparently.
+func compression() kafka.Compression {
+	switch v := getenv("COMPRESSION", "snappy"); v {
+	case "none":
+		return 0
+	case "gzip":
+		return kafka.Gzip
+	case "snappy":
+		return kafka.Snappy
+	case "lz4":
+		return kafka.Lz4
+	case "zstd":
+		return kafka.Zstd
+	default:
+		slog.Warn("unknown COMPRESSION, using snappy", "value", v)
+		return kafka.Snappy
+	}
 }
 
-func writeWithRetry(ctx context.Context, w *kafka.Writer, msg kafka.Message, maxRetries int) error {
+// requiredAcks maps PRODUCE_ACKS onto how many replicas must confirm a write
+// before it returns. all (the default) waits for every in-sync replica, so an
+// acknowledged event survives losing the leader, at the cost of a replication
+// round trip on every write; one returns once the leader has it, trading that
+// latency for losing writes the leader had not yet replicated; none does not
+// wait at all and surfaces no broker-side errors.
+func requiredAcks() kafka.RequiredAcks {
+	switch v := getenv("PRODUCE_ACKS", "all"); v {
+	case "none":
+		return kafka.RequireNone
+	case "one":
+		return kafka.RequireOne
+	case "all":
+		return kafka.RequireAll
+	default:
+		slog.Warn("unknown PRODUCE_ACKS, using all", "value", v)
+		return kafka.RequireAll
+	}
+}
+
+// messageWriter is the part of *kafka.Writer writeWithRetry uses.
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+func writeWithRetry(ctx context.Context, w messageWriter, msg kafka.Message, maxRetries int) error {
 	var err error
 	for attempt := 0; attempt <= maxRetries; attempt++ {
-		err = w.WriteMessages(ctx, msg)
+		if faults.inject("write") {
+			err = errInjectedFault
+		} else {
+			err = w.WriteMessages(ctx, msg)
+		}
 		if err == nil {
 			return nil
 		}
@@ -65,7 +188,7 @@ func writeWithRetry(ctx context.Context, w *kafka.Writer, msg kafka.Message, max
 		if attempt < maxRetries {
 			// Exponential backoff: 100ms, 200ms, 400ms, 800ms, 1.6s
 			backoff := time.Duration(100*math.Pow(2, float64(attempt))) * time.Millisecond
-			log.Printf("write error (attempt %d/%d): %v, retrying in %v", attempt+1, maxRetries+1, err, backoff)
+			slog.Warn("write failed, retrying", "attempt", attempt+1, "of", maxRetries+1, "error", err, "backoff", backoff)
 
 			select {
 			case <-ctx.Done():
@@ -76,28 +199,175 @@ func writeWithRetry(ctx context.Context, w *kafka.Writer, msg kafka.Message, max
 		}
 	}
 
-	log.Printf("write failed after %d attempts: %v", maxRetries+1, err)
+	slog.Error("write failed after retries", "attempts", maxRetries+1, "error", err)
 	return err
 }
 
+// sendToDLQ forwards a message that could not be processed to the dead-letter
+// topic, keeping its key and recording why it was rejected in headers.
+func sendToDLQ(ctx context.Context, w *kafka.Writer, m kafka.Message, reason error) {
+	headers := append(m.Headers,
+		kafka.Header{Key: "x-error", Value: []byte(reason.Error())},
+		kafka.Header{Key: "x-original-topic", Value: []byte(m.Topic)},
+	)
+	if err := w.WriteMessages(ctx, kafka.Message{Key: m.Key, Value: m.Value, Headers: headers}); err != nil {
+		slog.Error("dlq write failed", "error", err)
+	}
+}
+
 var (
 	kafkaReady int64 // 0 = not ready, 1 = ready
+	faults     *faultInjector
 )
 
+// shutdown stops the consumer and the health server under one budget: it
+// cancels the consumer, shuts the server down and waits for the consumer
+// loop to return. Once ctx ends it forces the server's connections closed
+// and stops waiting for the consumer.
+func shutdown(ctx context.Context, srv *http.Server, stopConsumer func(), consumerDone <-chan struct{}) {
+	stopConsumer()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("health server forced to shutdown", "error", err)
+		_ = srv.Close()
+	}
+	select {
+	case <-consumerDone:
+	case <-ctx.Done():
+		slog.Warn("shutdown timeout, consumer still running")
+	}
+}
+
 func main() {
+	logging.Init("orders-processor")
 	brokers := strings.Split(getenv("KAFKA_BROKERS", "localhost:9093"), ",")
 	inTopic := getenv("ORDERS_TOPIC", "orders.created")
+	priorityTopic := getenv("PRIORITY_TOPIC", "orders.created.priority")
 	outTopic := getenv("STATUS_TOPIC", "orders.status")
-	group := getenv("GROUP_ID", "orders-processor-cg")
+	// amendment requests come in on AMEND_TOPIC; the ones accepted go on to
+	// stock-service on AMEND_ACCEPTED_TOPIC, the rest to orders-query on
+	// AMEND_REJECTED_TOPIC
+	amendTopic := getenv("AMEND_TOPIC", "orders.amended")
+	acceptedTopic := getenv("AMEND_ACCEPTED_TOPIC", "orders.amended.accepted")
+	rejectedTopic := getenv("AMEND_REJECTED_TOPIC", "orders.amended.rejected")
+	group := groupID("orders-processor-cg")
 	httpAddr := getenv("HTTP_ADDR", ":8082")
+	dlqTopic := getenv("DLQ_TOPIC", inTopic+".dlq")
+
+	// SHUTDOWN_TIMEOUT bounds the whole shutdown sequence once a signal arrives
+	shutdownTimeout, err := time.ParseDuration(getenv("SHUTDOWN_TIMEOUT", "5s"))
+	if err != nil {
+		logging.Fatalf("invalid SHUTDOWN_TIMEOUT: %v", err)
+	}
+
+	if err := startupBrokerCheck(brokers); err != nil {
+		logging.Fatalf("kafka startup check failed: %v", err)
+	}
+	if err := ensureTopics(brokers, inTopic, priorityTopic, outTopic, dlqTopic, amendTopic, acceptedTopic, rejectedTopic); err != nil {
+		logging.Fatalf("ensure topics failed: %v", err)
+	}
 
-	r := newReader(brokers, inTopic, group)
-	defer r.Close()
+	if f, err := newFaultInjector(getenv("FAULT_INJECTION", ""), getenv("ENV", ""), time.Now().UnixNano()); err != nil {
+		slog.Warn("fault injection disabled", "error", err)
+	} else if f != nil {
+		slog.Warn("fault injection enabled", "spec", getenv("FAULT_INJECTION", ""))
+		faults = f
+	}
+
+	// PAYMENT_DELAY is the simulated payment time between PENDING and PAID
+	// (default 300ms); 0 runs the processor at full speed, e.g. under test
+	paymentDelay, err := time.ParseDuration(getenv("PAYMENT_DELAY", "300ms"))
+	if err != nil || paymentDelay < 0 {
+		logging.Fatalf("invalid PAYMENT_DELAY: %q", getenv("PAYMENT_DELAY", "300ms"))
+	}
+
+	// FULFILLMENT_DELAY enables the SHIPPED step; when unset orders end at PAID
+	var fulfillmentDelay time.Duration
+	if v := getenv("FULFILLMENT_DELAY", ""); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			logging.Fatalf("invalid FULFILLMENT_DELAY: %v", err)
+		}
+		fulfillmentDelay = d
+	}
+	final := StatusPaid
+	if fulfillmentDelay > 0 {
+		final = StatusShipped
+	}
+	states := newOrderStates(final)
+
+	// ORDER_TIMEOUT, when set, expires orders that have not reached the
+	// final status that long after they were read; it must leave room for
+	// FULFILLMENT_DELAY
+	var orderTimeout time.Duration
+	if v := getenv("ORDER_TIMEOUT", ""); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= fulfillmentDelay {
+			logging.Fatalf("invalid ORDER_TIMEOUT %q: must be a duration longer than FULFILLMENT_DELAY", v)
+		}
+		orderTimeout = d
+	}
+	expiry := newExpiryWatcher(orderTimeout, final)
+	// only the replica leading on LEADER_TOPIC scans for expired orders
+	var elector *leaderElector
+	if expiry != nil {
+		leaderTopic := getenv("LEADER_TOPIC", "orders-processor.leader")
+		if err := ensureTopics(brokers, leaderTopic); err != nil {
+			logging.Fatalf("ensure topics failed: %v", err)
+		}
+		elector = newLeaderElector(brokers, leaderTopic, group+".leader")
+	}
+	// event ids of statuses already published, to skip re-emitting them
+	emitted := newRecentSet(dedupCapacity())
+
+	checkpointInterval, err := time.ParseDuration(getenv("CHECKPOINT_LOG_INTERVAL", "30s"))
+	if err != nil {
+		logging.Fatalf("invalid CHECKPOINT_LOG_INTERVAL: %v", err)
+	}
+	checkpointLevel := getenv("CHECKPOINT_LOG_LEVEL", "info")
+
+	// SCHEMA_VALIDATION=off leaves validator nil, which accepts every payload
+	var validator *schema.Validator
+	if getenv("SCHEMA_VALIDATION", "on") == "on" {
+		v, err := schema.New()
+		if err != nil {
+			logging.Fatalf("failed to load schemas: %v", err)
+		}
+		validator = v
+	}
+
+	eventCodec, err := codec.New(getenv("EVENT_FORMAT", "json"), getenv("SCHEMA_REGISTRY_URL", ""))
+	if err != nil {
+		logging.Fatalf("invalid event codec config: %v", err)
+	}
+
+	profiles, err := newProfileLookup()
+	if err != nil {
+		logging.Fatalf("invalid enrichment config: %v", err)
+	}
+
+	resetPolicy := offsetResetPolicy()
 	w := newWriter(brokers, outTopic)
 	defer w.Close()
+	dlq := newWriter(brokers, dlqTopic)
+	defer dlq.Close()
+	acceptedWriter := newWriter(brokers, acceptedTopic)
+	defer acceptedWriter.Close()
+	rejectedWriter := newWriter(brokers, rejectedTopic)
+	defer rejectedWriter.Close()
+	poison := newPoisonHandler(func(ctx context.Context, m kafka.Message, reason error) {
+		sendToDLQ(ctx, dlq, m, reason)
+	})
 
 	// Health and readiness endpoints
-	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	var health HealthChecker
+	health.Register("kafka", func(ctx context.Context) error { return checkBrokers(brokers, 2*time.Second) })
+	health.Register("consumer", func(ctx context.Context) error {
+		if atomic.LoadInt64(&kafkaReady) != 1 {
+			return errors.New("consumer loop not running")
+		}
+		return nil
+	})
+	http.HandleFunc("/healthz", health.Handler())
 	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
 		if atomic.LoadInt64(&kafkaReady) == 1 {
 			w.WriteHeader(http.StatusOK)
@@ -105,13 +375,22 @@ func main() {
 			w.WriteHeader(http.StatusServiceUnavailable)
 		}
 	})
+	http.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"faults": faults.stats(), "poison": poison.stats(), "leader": elector.stats(r.Context())})
+	})
+	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/statemachine", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"transitions": transitions, "final": final})
+	})
 
 	// Start HTTP server for health checks
-	srv := &http.Server{Addr: httpAddr}
+	srv := &http.Server{Addr: httpAddr, Handler: logging.AccessLog(http.DefaultServeMux)}
 	go func() {
-		log.Printf("orders-processor health server listening on %s", httpAddr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("health server failed: %v", err)
+		slog.Info("orders-processor health server listening", "addr", httpAddr)
+		if err := listenAndServe(srv); err != nil && err != http.ErrServerClosed {
+			slog.Error("health server failed", "error", err)
 		}
 	}()
 
@@ -123,50 +402,167 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
-	go func() {
-		<-quit
-		log.Println("shutting down orders-processor...")
-		cancel()
+	// emit validates and publishes one status transition for order
+	emit := (&statusEmitter{states: states, emitted: emitted, validator: validator, codec: eventCodec, w: w}).emit
+	// every replica follows the status topic to know which orders are still
+	// open, whoever processed them; it starts far enough back to pick up
+	// every order that can still expire or be amended
+	index := newOrderIndex(final)
+	err = followStatuses(ctx, brokers, outTopic, time.Now().Add(-max(orderTimeout, time.Hour)), eventCodec, func(s OrderStatus, at time.Time) {
+		index.observe(s)
+		expiry.observe(s, at)
+		if s.Status == StatusExpired {
+			states.forget(s.OrderID)
+		}
+	})
+	if err != nil {
+		logging.Fatalf("status feed failed: %v", err)
+	}
+	err = followTopic(ctx, brokers, acceptedTopic, time.Now().Add(-max(orderTimeout, time.Hour)), eventCodec, func(body []byte, _ time.Time) error {
+		var oa OrderAmended
+		if err := json.Unmarshal(body, &oa); err != nil {
+			return err
+		}
+		index.observeAmendment(oa.OrderID, oa.Version)
+		return nil
+	})
+	if err != nil {
+		logging.Fatalf("amendment feed failed: %v", err)
+	}
+	if expiry != nil {
+		go elector.run(ctx)
+		go elector.whileLeader(ctx, func(term context.Context) {
+			expiry.run(term, func(order trackedOrder) {
+				slog.Info("order reached no final status in time, expiring", "order", order.ID, "timeout", orderTimeout)
+				emit(ctx, order, StatusExpired)
+			})
+		})
+	}
 
-		// Shutdown HTTP server
-		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer shutdownCancel()
-		if err := srv.Shutdown(shutdownCtx); err != nil {
-			log.Printf("health server forced to shutdown: %v", err)
+	// handleAmendment forwards an amendment to stock-service if its order is
+	// still PENDING and no other amendment has reached it since orders-api
+	// read it. The index trails the status topic, so a PAID published
+	// moments before can still let one through.
+	handleAmendment := func(m kafka.Message) {
+		if et := headerValue(m, headerEventType); et != "" && et != "OrderAmended" {
+			poison.handle(ctx, m, "event_type", fmt.Errorf("unexpected event type %q", et))
+			return
 		}
-	}()
+		body, err := eventCodec.Decode(ctx, m.Value)
+		if err != nil {
+			poison.handle(ctx, m, "decode", err)
+			return
+		}
+		if err := validator.Validate("OrderAmended", body); err != nil {
+			poison.handle(ctx, m, "schema", err)
+			return
+		}
+		var oa OrderAmended
+		if err := json.Unmarshal(body, &oa); err != nil {
+			poison.handle(ctx, m, "unmarshal", err)
+			return
+		}
+		if ok, reason := index.accept(oa.OrderID, oa.Version); !ok {
+			slog.Info("rejecting amendment", "order", oa.OrderID, "reason", reason)
+			// orders-api already answered 202; tell the client through
+			// orders-query
+			if err := rejectAmendment(ctx, rejectedWriter, validator, eventCodec, oa, reason); err != nil {
+				slog.Error("failed to publish amendment rejection", "order", oa.OrderID, "error", err)
+			}
+			return
+		}
+		if err := writeWithRetry(ctx, acceptedWriter, kafka.Message{Key: m.Key, Value: m.Value, Headers: m.Headers}, 4); err != nil {
+			index.release(oa.OrderID, oa.Version)
+			slog.Error("failed to forward amendment", "order", oa.OrderID, "error", err)
+			return
+		}
+		slog.Info("accepted amendment", "order", oa.OrderID, "skus", len(oa.Deltas))
+	}
+	go consumeAmendments(ctx, brokers, amendTopic, group, handleAmendment)
 
-	log.Printf("orders-processor consuming %s, producing %s", inTopic, outTopic)
+	slog.Info("orders-processor consuming", "topic", inTopic, "priorityTopic", priorityTopic, "amendTopic", amendTopic, "producing", outTopic)
 
 	// Mark as ready after successful initialization
 	atomic.StoreInt64(&kafkaReady, 1)
 
-	for {
-		m, err := r.ReadMessage(ctx)
+	// process handles one OrderCreated; bad messages go to the poison handler
+	process := func(m kafka.Message, readAt time.Time) {
+		if et := headerValue(m, headerEventType); et != "" && et != "OrderCreated" {
+			poison.handle(ctx, m, "event_type", fmt.Errorf("unexpected event type %q", et))
+			return
+		}
+		body, err := eventCodec.Decode(ctx, m.Value)
+		if err == nil && faults.inject("decode") {
+			err = errInjectedFault
+		}
 		if err != nil {
-			if ctx.Err() != nil {
-				log.Println("context cancelled, stopping consumer")
-				break
-			}
-			log.Printf("read error: %v", err)
-			continue
+			poison.handle(ctx, m, "decode", err)
+			return
+		}
+		if err := validator.Validate("OrderCreated", body); err != nil {
+			poison.handle(ctx, m, "schema", err)
+			return
 		}
 		var oc OrderCreated
-		if err := json.Unmarshal(m.Value, &oc); err != nil {
-			log.Printf("json error: %v", err)
-			continue
+		if err := json.Unmarshal(body, &oc); err != nil {
+			poison.handle(ctx, m, "unmarshal", err)
+			return
 		}
-		time.Sleep(300 * time.Millisecond)
-		status := OrderStatus{OrderID: oc.OrderID, Status: "PAID", UpdatedAt: time.Now().UTC().Format(time.RFC3339)}
-		payload, _ := json.Marshal(status)
-
-		// Use retry logic with exponential backoff
-		msg := kafka.Message{Key: []byte(oc.OrderID), Value: payload}
-		if err := writeWithRetry(ctx, w, msg, 4); err != nil {
-			log.Printf("failed to write status after retries: %v", err)
-			// Continue processing other messages even if one fails
+		// enrichment is best-effort: a failed lookup still emits the status
+		profile, err := profiles.get(ctx, oc.UserID)
+		if err != nil {
+			slog.Warn("profile lookup failed", "user", oc.UserID, "error", err)
+		}
+		order := trackedOrder{ID: oc.OrderID, UserEmail: profile.Email, EventTime: eventTime(oc.CreatedAt, m), ReadAt: readAt, CorrelationID: correlationOf(oc.CorrelationID, m)}
+		pay(ctx, emit, order, paymentDelay)
+		if fulfillmentDelay > 0 {
+			// fulfillment runs off the consumer loop so it doesn't hold up the next order
+			go func(order trackedOrder) {
+				select {
+				case <-ctx.Done():
+				case <-time.After(fulfillmentDelay):
+					emit(ctx, order, StatusShipped)
+				}
+			}(order)
 		}
 	}
 
-	log.Println("orders-processor shutdown complete")
+	// each topic is fetched on its own goroutine; the loop below takes from
+	// the priority lane first, see laneSelector
+	priorityLane, normalLane := make(chan fetched), make(chan fetched)
+	go fetchLane(ctx, brokers, priorityTopic, group, resetPolicy, newCheckpointLogger(checkpointLevel, checkpointInterval), priorityLane)
+	go fetchLane(ctx, brokers, inTopic, group, resetPolicy, newCheckpointLogger(checkpointLevel, checkpointInterval), normalLane)
+	lanes := &laneSelector{priority: priorityLane, normal: normalLane, weight: priorityWeight()}
+	consumerDone := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
+		for {
+			if poison.wait(ctx) != nil {
+				slog.Info("context cancelled, stopping consumer")
+				return
+			}
+			f, ok := lanes.next(ctx)
+			if !ok {
+				slog.Info("context cancelled, stopping consumer")
+				return
+			}
+			readAt := time.Now()
+			process(f.m, readAt)
+			// commit only once the message is handled, or parked in the DLQ, so a
+			// crash replays it instead of losing it; see commitInterval
+			if err := f.r.CommitMessages(ctx, f.m); err != nil {
+				slog.Warn("commit failed", "error", err)
+				continue
+			}
+			f.checkpoints.record(f.m)
+		}
+	}()
+
+	<-quit
+	slog.Info("shutting down orders-processor")
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer shutdownCancel()
+	shutdown(shutdownCtx, srv, cancel, consumerDone)
+
+	slog.Info("orders-processor shutdown complete")
 }
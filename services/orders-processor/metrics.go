@@ -0,0 +1,26 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// processingSeconds measures how long each status takes to reach the topic,
+// from reading the OrderCreated to writeWithRetry returning, retries
+// included. SHIPPED therefore includes FULFILLMENT_DELAY.
+var processingSeconds = func() *prometheus.HistogramVec {
+	h := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "orders_processor_status_latency_seconds",
+		Help:    "Time from reading an order to producing a status for it.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"status", "outcome"})
+	prometheus.MustRegister(h)
+	return h
+}()
+
+// observeProcessing records one status attempt that started at readAt.
+// outcome is ok, rejected, encode_error or write_error.
+func observeProcessing(status, outcome string, readAt time.Time) {
+	processingSeconds.WithLabelValues(status, outcome).Observe(time.Since(readAt).Seconds())
+}
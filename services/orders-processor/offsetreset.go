@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// offsetResetPolicy reads ON_OFFSET_RESET (first|last, default first): where
+// the group resumes when its committed offset has fallen outside the log,
+// typically after downtime longer than the topic's retention. first replays
+// whatever is still retained; last skips straight to new messages.
+func offsetResetPolicy() string {
+	switch v := getenv("ON_OFFSET_RESET", "first"); v {
+	case "first", "last":
+		return v
+	default:
+		slog.Warn("unknown ON_OFFSET_RESET, using first", "value", v)
+		return "first"
+	}
+}
+
+// resetOutOfRangeOffsets moves every committed offset of group on topic that
+// lies outside [first, last] to the policy's end of the log. It must run while
+// the group has no members (the reader closed), since the commit is made
+// without a generation.
+func resetOutOfRangeOffsets(ctx context.Context, brokers []string, topic, group, policy string) error {
+	conn, err := kafka.DialContext(ctx, "tcp", brokers[0])
+	if err != nil {
+		return err
+	}
+	partitions, err := conn.ReadPartitions(topic)
+	conn.Close()
+	if err != nil {
+		return err
+	}
+
+	client := &kafka.Client{Addr: kafka.TCP(brokers...)}
+	ids := make([]int, 0, len(partitions))
+	reqs := make([]kafka.OffsetRequest, 0, 2*len(partitions))
+	for _, p := range partitions {
+		ids = append(ids, p.ID)
+		reqs = append(reqs, kafka.FirstOffsetOf(p.ID), kafka.LastOffsetOf(p.ID))
+	}
+	bounds, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{topic: reqs}})
+	if err != nil {
+		return fmt.Errorf("list offsets: %w", err)
+	}
+	committed, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{GroupID: group, Topics: map[string][]int{topic: ids}})
+	if err != nil {
+		return fmt.Errorf("fetch committed offsets: %w", err)
+	}
+	current := make(map[int]int64)
+	for _, p := range committed.Topics[topic] {
+		current[p.Partition] = p.CommittedOffset
+	}
+
+	commits, err := resetTargets(topic, bounds.Topics[topic], current, policy)
+	if err != nil {
+		return err
+	}
+	if len(commits) == 0 {
+		return nil
+	}
+	resp, err := client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      group,
+		GenerationID: -1,
+		Topics:       map[string][]kafka.OffsetCommit{topic: commits},
+	})
+	if err != nil {
+		return fmt.Errorf("commit reset offsets: %w", err)
+	}
+	for _, p := range resp.Topics[topic] {
+		if p.Error != nil {
+			return fmt.Errorf("commit reset offset for partition %d: %w", p.Partition, p.Error)
+		}
+	}
+	return nil
+}
+
+// resetTargets picks, for every partition whose committed offset in current
+// lies outside its bounds, the offset policy moves it to. Partitions with
+// nothing committed are left to StartOffset.
+func resetTargets(topic string, bounds []kafka.PartitionOffsets, current map[int]int64, policy string) ([]kafka.OffsetCommit, error) {
+	var commits []kafka.OffsetCommit
+	for _, b := range bounds {
+		if b.Error != nil {
+			return nil, fmt.Errorf("partition %d offsets: %w", b.Partition, b.Error)
+		}
+		off, ok := current[b.Partition]
+		if !ok || off < 0 || (off >= b.FirstOffset && off <= b.LastOffset) {
+			continue
+		}
+		target := b.FirstOffset
+		if policy == "last" {
+			target = b.LastOffset
+		}
+		slog.Warn("committed offset out of range, resetting; messages may have been skipped",
+			"topic", topic, "partition", b.Partition, "offset", off, "first", b.FirstOffset, "last", b.LastOffset, "target", target, "policy", policy)
+		commits = append(commits, kafka.OffsetCommit{Partition: b.Partition, Offset: target})
+	}
+	return commits, nil
+}
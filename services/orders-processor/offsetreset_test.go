@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// TestResetTargetsFollowPolicy simulates a topic truncated by retention:
+// partition 0's committed offset now lies before the log start, partition 1
+// is still in range and partition 2 has nothing committed.
+func TestResetTargetsFollowPolicy(t *testing.T) {
+	bounds := []kafka.PartitionOffsets{
+		{Partition: 0, FirstOffset: 100, LastOffset: 250},
+		{Partition: 1, FirstOffset: 0, LastOffset: 40},
+		{Partition: 2, FirstOffset: 10, LastOffset: 20},
+	}
+	current := map[int]int64{0: 30, 1: 12, 2: -1}
+	for policy, want := range map[string]int64{"first": 100, "last": 250} {
+		commits, err := resetTargets("orders", bounds, current, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(commits) != 1 || commits[0].Partition != 0 || commits[0].Offset != want {
+			t.Errorf("%s: commits %+v, want partition 0 moved to %d", policy, commits, want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"kafka-microservice/services/orders-processor/codec"
+)
+
+func TestPayWithoutDelayEmitsImmediately(t *testing.T) {
+	w := &recordWriter{}
+	e := &statusEmitter{states: newOrderStates(StatusPaid), emitted: newRecentSet(16), codec: codec.JSONCodec{}, w: w}
+	start := time.Now()
+	pay(context.Background(), e.emit, trackedOrder{ID: "o-fast", ReadAt: start}, 0)
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("took %v with PAYMENT_DELAY=0", elapsed)
+	}
+	if len(w.written) != 2 {
+		t.Fatalf("wrote %d statuses, want PENDING and PAID", len(w.written))
+	}
+	for i, want := range []string{StatusPending, StatusPaid} {
+		if got := headerValue(w.written[i], headerEventID); got != statusEventID("o-fast", want) {
+			t.Fatalf("status %d is not %s", i, want)
+		}
+	}
+}
+
+func TestPayWaitsOutDelay(t *testing.T) {
+	w := &recordWriter{}
+	e := &statusEmitter{states: newOrderStates(StatusPaid), emitted: newRecentSet(16), codec: codec.JSONCodec{}, w: w}
+	start := time.Now()
+	pay(context.Background(), e.emit, trackedOrder{ID: "o-slow", ReadAt: start}, 30*time.Millisecond)
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond || len(w.written) != 2 {
+		t.Fatalf("took %v and wrote %d statuses", elapsed, len(w.written))
+	}
+}
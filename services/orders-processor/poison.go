@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// poisonHandler is where the consumer loop sends every message it cannot
+// use. It counts them by class, forwards them to the DLQ when one is
+// configured and logs at most once a second. When POISON_THRESHOLD bad
+// messages (default 20, 0 disables) arrive within POISON_WINDOW (default
+// 10s) the stream most likely no longer matches what this build expects, so
+// consumption pauses for POISON_PAUSE (default 30s) instead of burning
+// through the topic.
+type poisonHandler struct {
+	threshold int
+	window    time.Duration
+	pauseFor  time.Duration
+	forward   func(ctx context.Context, m kafka.Message, reason error)
+
+	mu          sync.Mutex
+	recent      []time.Time
+	counts      map[string]int64
+	pausedUntil time.Time
+	lastLog     time.Time
+	suppressed  int
+}
+
+// newPoisonHandler reads the POISON_* settings. forward may be nil when
+// the service has no DLQ.
+func newPoisonHandler(forward func(ctx context.Context, m kafka.Message, reason error)) *poisonHandler {
+	p := &poisonHandler{threshold: 20, window: 10 * time.Second, pauseFor: 30 * time.Second, forward: forward, counts: map[string]int64{}}
+	if n, err := strconv.Atoi(getenv("POISON_THRESHOLD", "20")); err == nil && n >= 0 {
+		p.threshold = n
+	}
+	if d, err := time.ParseDuration(getenv("POISON_WINDOW", "10s")); err == nil && d > 0 {
+		p.window = d
+	}
+	if d, err := time.ParseDuration(getenv("POISON_PAUSE", "30s")); err == nil && d > 0 {
+		p.pauseFor = d
+	}
+	return p
+}
+
+// classify names the kind of failure for counting: JSON syntax or type
+// errors get their own class, anything else is counted under stage.
+func classify(stage string, err error) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return stage + ":syntax"
+	case errors.As(err, &typeErr):
+		return stage + ":type_mismatch"
+	default:
+		return stage
+	}
+}
+
+// handle records one bad message that failed at stage (event_type, decode,
+// schema or unmarshal) and forwards it.
+func (p *poisonHandler) handle(ctx context.Context, m kafka.Message, stage string, err error) {
+	class := classify(stage, err)
+	now := time.Now()
+
+	p.mu.Lock()
+	p.counts[class]++
+	cutoff := now.Add(-p.window)
+	kept := p.recent[:0]
+	for _, t := range p.recent {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	p.recent = append(kept, now)
+	tripped := p.threshold > 0 && len(p.recent) >= p.threshold && now.After(p.pausedUntil)
+	if tripped {
+		p.pausedUntil = now.Add(p.pauseFor)
+		p.recent = p.recent[:0]
+	}
+	logNow := now.Sub(p.lastLog) >= time.Second
+	suppressed := p.suppressed
+	if logNow {
+		p.lastLog, p.suppressed = now, 0
+	} else {
+		p.suppressed++
+	}
+	p.mu.Unlock()
+
+	if logNow {
+		slog.Warn("bad message", "topic", m.Topic, "partition", m.Partition, "offset", m.Offset, "class", class, "error", err, "suppressed", suppressed)
+	}
+	if tripped {
+		slog.Warn("too many bad messages, pausing consumption (schema mismatch?)", "threshold", p.threshold, "window", p.window, "pause", p.pauseFor)
+	}
+	if p.forward != nil {
+		p.forward(ctx, m, err)
+	}
+}
+
+// wait blocks while a rate-triggered pause is in effect.
+func (p *poisonHandler) wait(ctx context.Context) error {
+	p.mu.Lock()
+	d := time.Until(p.pausedUntil)
+	p.mu.Unlock()
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		slog.Info("resuming consumption after poison pause")
+		return nil
+	}
+}
+
+// stats returns the per-class counts and whether a pause is in effect.
+func (p *poisonHandler) stats() map[string]interface{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	counts := make(map[string]int64, len(p.counts))
+	for k, v := range p.counts {
+		counts[k] = v
+	}
+	return map[string]interface{}{"counts": counts, "paused": time.Now().Before(p.pausedUntil)}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestPoisonRatePausesConsumption(t *testing.T) {
+	forwarded := 0
+	p := newPoisonHandler(func(context.Context, kafka.Message, error) { forwarded++ })
+	p.threshold, p.window, p.pauseFor = 3, time.Minute, 100*time.Millisecond
+	ctx := context.Background()
+	syntaxErr := json.Unmarshal([]byte("{"), &struct{}{})
+
+	p.handle(ctx, kafka.Message{}, "unmarshal", syntaxErr)
+	p.handle(ctx, kafka.Message{}, "schema", errors.New("missing orderId"))
+	if p.stats()["paused"] != false {
+		t.Fatal("paused below the threshold")
+	}
+	p.handle(ctx, kafka.Message{}, "schema", errors.New("missing orderId"))
+	stats := p.stats()
+	if stats["paused"] != true {
+		t.Fatal("not paused at the threshold")
+	}
+	if counts := stats["counts"].(map[string]int64); counts["unmarshal:syntax"] != 1 || counts["schema"] != 2 {
+		t.Fatalf("counts %v", counts)
+	}
+	if forwarded != 3 {
+		t.Fatalf("forwarded %d, want every bad message", forwarded)
+	}
+
+	start := time.Now()
+	if err := p.wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Fatalf("wait returned after %s, want the pause honoured", waited)
+	}
+	if p.stats()["paused"] != false {
+		t.Fatal("still paused after POISON_PAUSE")
+	}
+}
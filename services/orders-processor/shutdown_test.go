@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestShutdownTimeoutForcesClose runs shutdown against a handler slower
+// than the budget and a consumer that has or has not stopped. It waits up
+// to the timeout, then closes the slow connection and returns, with or
+// without the consumer.
+func TestShutdownTimeoutForcesClose(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		consumerDone bool
+	}{
+		{"consumer stopped", true},
+		{"consumer stuck", false},
+	} {
+		started, release := make(chan struct{}), make(chan struct{})
+		srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+		})}
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() { _ = srv.Serve(l) }()
+
+		reqErr := make(chan error, 1)
+		go func() {
+			resp, err := http.Get("http://" + l.Addr().String() + "/healthz")
+			if err == nil {
+				resp.Body.Close()
+			}
+			reqErr <- err
+		}()
+		<-started
+
+		done := make(chan struct{})
+		if tc.consumerDone {
+			close(done)
+		}
+		stopped := false
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		start := time.Now()
+		shutdown(ctx, srv, func() { stopped = true }, done)
+		elapsed := time.Since(start)
+		cancel()
+		close(release)
+
+		if !stopped {
+			t.Errorf("%s: consumer not cancelled", tc.name)
+		}
+		if elapsed < 100*time.Millisecond || elapsed > time.Second {
+			t.Errorf("%s: shutdown took %v, want about the 100ms timeout", tc.name, elapsed)
+		}
+		if err := <-reqErr; err == nil {
+			t.Errorf("%s: slow request completed, want its connection closed", tc.name)
+		}
+	}
+}
+
+// TestShutdownReturnsOnceIdle expects shutdown to return as soon as the
+// server is idle and the consumer has stopped, well inside the timeout.
+func TestShutdownReturnsOnceIdle(t *testing.T) {
+	srv := &http.Server{}
+	done := make(chan struct{})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	shutdown(ctx, srv, func() { close(done) }, done)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("shutdown took %v with nothing in flight", elapsed)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+const (
+	StatusPending = "PENDING"
+	StatusPaid    = "PAID"
+	StatusShipped = "SHIPPED"
+	StatusExpired = "EXPIRED"
+)
+
+// transitions is the order lifecycle: for each status, the statuses an order
+// may move to next. The empty status is an order the processor has not seen.
+// EXPIRED ends an order that missed ORDER_TIMEOUT; see expiryWatcher.
+var transitions = map[string][]string{
+	"":            {StatusPending},
+	StatusPending: {StatusPaid, StatusExpired},
+	StatusPaid:    {StatusShipped, StatusExpired},
+}
+
+func validTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// orderStates remembers the last status emitted per order so that an
+// out-of-order transition is caught before it is published.
+type orderStates struct {
+	mu    sync.Mutex
+	state map[string]string
+	final string // status after which an order is forgotten
+}
+
+func newOrderStates(final string) *orderStates {
+	return &orderStates{state: map[string]string{}, final: final}
+}
+
+// forget drops orderID, as when another replica expired it, so any later
+// transition for it is rejected.
+func (s *orderStates) forget(orderID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.state, orderID)
+}
+
+// advance moves orderID to status, or returns an error if the lifecycle does
+// not allow it from the order's current status.
+func (s *orderStates) advance(orderID, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	from := s.state[orderID]
+	if !validTransition(from, status) {
+		return fmt.Errorf("invalid transition %q -> %q for order %s", from, status, orderID)
+	}
+	if status == s.final || status == StatusExpired {
+		delete(s.state, orderID)
+	} else {
+		s.state[orderID] = status
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestValidTransition(t *testing.T) {
+	all := []string{"", StatusPending, StatusPaid, StatusShipped, StatusExpired}
+	legal := map[[2]string]bool{
+		{"", StatusPending}:            true,
+		{StatusPending, StatusPaid}:    true,
+		{StatusPending, StatusExpired}: true,
+		{StatusPaid, StatusShipped}:    true,
+		{StatusPaid, StatusExpired}:    true,
+	}
+	for _, from := range all {
+		for _, to := range all {
+			if got, want := validTransition(from, to), legal[[2]string{from, to}]; got != want {
+				t.Errorf("%q -> %q: got %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+// TestOrderStatesAdvance walks an order through its lifecycle and expects
+// out-of-order steps rejected and a finished order forgotten.
+func TestOrderStatesAdvance(t *testing.T) {
+	s := newOrderStates(StatusShipped)
+	steps := []struct {
+		status string
+		ok     bool
+	}{
+		{StatusPaid, false}, // not yet PENDING
+		{StatusPending, true},
+		{StatusPending, false}, // no self-transition
+		{StatusShipped, false}, // skips PAID
+		{StatusPaid, true},
+		{StatusShipped, true},
+		{StatusPaid, false}, // forgotten after the final status
+	}
+	for i, st := range steps {
+		if err := s.advance("o-1", st.status); (err == nil) != st.ok {
+			t.Fatalf("step %d -> %s: err = %v, want ok=%v", i, st.status, err, st.ok)
+		}
+	}
+	if _, ok := s.state["o-1"]; ok {
+		t.Fatal("final order still tracked")
+	}
+}
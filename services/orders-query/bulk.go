@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// maxQueryIDs caps the order ids one POST /orders/statuses may ask for
+// (MAX_QUERY_IDS, default 100).
+var maxQueryIDs = func() int {
+	n, err := strconv.Atoi(getenv("MAX_QUERY_IDS", "100"))
+	if err != nil || n <= 0 {
+		return 100
+	}
+	return n
+}()
+
+// BulkStatusRequest is the body of POST /orders/statuses.
+type BulkStatusRequest struct {
+	OrderIDs []string `json:"orderIds"`
+}
+
+// StatusView is the latest status of one order as the bulk query reports it.
+type StatusView struct {
+	Status    string `json:"status"`
+	Reason    string `json:"reason,omitempty"`
+	UpdatedAt string `json:"updatedAt,omitempty"`
+}
+
+// handleBulkStatuses serves POST /orders/statuses: the latest status of every
+// requested order in one response, keyed by order id, with null for orders
+// the projection has not seen.
+func handleBulkStatuses(w http.ResponseWriter, r *http.Request) {
+	if cors(w, r, "POST") {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req BulkStatusRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid JSON body"})
+		return
+	}
+	if len(req.OrderIDs) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "orderIds required"})
+		return
+	}
+	if len(req.OrderIDs) > maxQueryIDs {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("at most %d orderIds per request", maxQueryIDs)})
+		return
+	}
+
+	out := make(map[string]*StatusView, len(req.OrderIDs))
+	mu.RLock()
+	for _, id := range req.OrderIDs {
+		if v, ok := orders[id]; ok {
+			out[id] = &StatusView{Status: v.Status, Reason: v.Reason, UpdatedAt: v.UpdatedAt}
+		} else {
+			out[id] = nil
+		}
+	}
+	mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
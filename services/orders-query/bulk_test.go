@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestBulkStatusesMixesKnownAndUnknown asks for two projected orders and one
+// the projection has never seen, which must come back as null.
+func TestBulkStatusesMixesKnownAndUnknown(t *testing.T) {
+	resetOrders(t)
+	applyStatus(OrderStatus{OrderID: "o-1", Status: "PAID", UpdatedAt: "2026-01-01T00:00:00Z"})
+	applyStatus(OrderStatus{OrderID: "o-2", Status: "FAILED", Reason: "out of stock", UpdatedAt: "2026-01-01T00:00:01Z"})
+
+	rec := httptest.NewRecorder()
+	handleBulkStatuses(rec, httptest.NewRequest(http.MethodPost, "/orders/statuses", strings.NewReader(`{"orderIds":["o-1","o-2","o-missing"]}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var got map[string]*StatusView
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d entries, want 3: %s", len(got), rec.Body)
+	}
+	if v := got["o-1"]; v == nil || v.Status != "PAID" {
+		t.Fatalf("o-1: %+v", v)
+	}
+	if v := got["o-2"]; v == nil || v.Status != "FAILED" || v.Reason != "out of stock" {
+		t.Fatalf("o-2: %+v", v)
+	}
+	if v, ok := got["o-missing"]; !ok || v != nil {
+		t.Fatalf("o-missing: %+v present=%v, want null", v, ok)
+	}
+}
+
+func TestBulkStatusesCapsIDs(t *testing.T) {
+	prev := maxQueryIDs
+	maxQueryIDs = 2
+	t.Cleanup(func() { maxQueryIDs = prev })
+
+	rec := httptest.NewRecorder()
+	handleBulkStatuses(rec, httptest.NewRequest(http.MethodPost, "/orders/statuses", strings.NewReader(`{"orderIds":["a","b","c"]}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,68 @@
+// Package codec converts event bodies between their JSON form, which is what
+// the services build and consume internally, and the wire format selected by
+// EVENT_FORMAT. Decoding always detects the format from the payload itself so
+// a topic carrying both JSON and Avro messages during a migration still works.
+//
+// JSON bodies travel inside the versioned envelope from package events; Avro
+// bodies are versioned by their registry schema id instead.
+package codec
+
+import (
+	"context"
+	"fmt"
+
+	"kafka-microservice/services/orders-query/events"
+)
+
+// Codec encodes JSON event bodies for the wire and decodes them back to JSON.
+type Codec interface {
+	Encode(ctx context.Context, eventType string, payload []byte) ([]byte, error)
+	Decode(ctx context.Context, data []byte) ([]byte, error)
+}
+
+// New returns the codec for format ("json" or "avro"). registryURL is required
+// for avro and optional for json, where it lets the reader decode Avro
+// messages still present on a topic that is migrating back to JSON.
+func New(format, registryURL string) (Codec, error) {
+	var avro *AvroCodec
+	if registryURL != "" {
+		avro = NewAvroCodec(registryURL)
+	}
+	switch format {
+	case "", "json":
+		return JSONCodec{avro: avro}, nil
+	case "avro":
+		if avro == nil {
+			return nil, fmt.Errorf("EVENT_FORMAT=avro requires SCHEMA_REGISTRY_URL")
+		}
+		return avro, nil
+	default:
+		return nil, fmt.Errorf("unknown event format %q", format)
+	}
+}
+
+// IsAvro reports whether data carries the Confluent wire-format header: a zero
+// magic byte followed by a 4-byte schema id. JSON bodies never start with 0x00.
+func IsAvro(data []byte) bool {
+	return len(data) > 5 && data[0] == magicByte
+}
+
+// JSONCodec writes payloads as JSON inside an events envelope.
+type JSONCodec struct {
+	avro *AvroCodec
+}
+
+func (JSONCodec) Encode(_ context.Context, eventType string, payload []byte) ([]byte, error) {
+	return events.Encode(eventType, payload)
+}
+
+func (c JSONCodec) Decode(ctx context.Context, data []byte) ([]byte, error) {
+	if !IsAvro(data) {
+		_, body, err := events.Decode(data)
+		return body, err
+	}
+	if c.avro == nil {
+		return nil, fmt.Errorf("avro message received but SCHEMA_REGISTRY_URL is not set")
+	}
+	return c.avro.Decode(ctx, data)
+}
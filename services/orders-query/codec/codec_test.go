@@ -0,0 +1,131 @@
+package codec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"kafka-microservice/services/orders-query/events"
+)
+
+const orderCreated = `{"orderId":"o-1","userId":"u-1","items":[{"sku":"S1","qty":2}],"total":19.99,"currency":"USD","createdAt":"2024-01-01T00:00:00Z","correlationId":"c-1","fxRate":0,"priority":""}`
+
+// fakeRegistry serves the two Schema Registry calls AvroCodec makes.
+func fakeRegistry(t *testing.T) *httptest.Server {
+	t.Helper()
+	var mu sync.Mutex
+	var schemas []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/subjects/"):
+			var req struct {
+				Schema string `json:"schema"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			schemas = append(schemas, req.Schema)
+			_ = json.NewEncoder(w).Encode(map[string]int{"id": len(schemas)})
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/schemas/ids/"):
+			var id int
+			if _, err := fmt.Sscanf(r.URL.Path, "/schemas/ids/%d", &id); err != nil || id < 1 || id > len(schemas) {
+				http.NotFound(w, r)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"schema": schemas[id-1]})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func decodeOrder(t *testing.T, body []byte) (id string, items []map[string]interface{}) {
+	t.Helper()
+	var o struct {
+		OrderID string                   `json:"orderId"`
+		Items   []map[string]interface{} `json:"items"`
+	}
+	if err := json.Unmarshal(body, &o); err != nil {
+		t.Fatalf("decoded body is not JSON: %v: %s", err, body)
+	}
+	return o.OrderID, o.Items
+}
+
+// TestAvroCodecDecodesJSONEnvelope covers a topic migrating to Avro: JSON
+// messages written by JSONCodec must reach consumers unwrapped.
+func TestAvroCodecDecodesJSONEnvelope(t *testing.T) {
+	ctx := context.Background()
+	wire, err := JSONCodec{}.Encode(ctx, "OrderCreated", []byte(orderCreated))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewAvroCodec(fakeRegistry(t).URL).Decode(ctx, wire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, items := decodeOrder(t, got)
+	if id != "o-1" || len(items) != 1 || items[0]["sku"] != "S1" {
+		t.Fatalf("envelope not unwrapped: %s", got)
+	}
+}
+
+func TestAvroCodecDecodesBareJSON(t *testing.T) {
+	got, err := NewAvroCodec("http://unused").Decode(context.Background(), []byte(orderCreated))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := decodeOrder(t, got); id != "o-1" {
+		t.Fatalf("bare body changed: %s", got)
+	}
+}
+
+// TestMixedFormatRoundTrip decodes Avro and JSON messages from the same topic
+// with either codec, as during a rollout in either direction.
+func TestMixedFormatRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	avro := NewAvroCodec(fakeRegistry(t).URL)
+	avroWire, err := avro.Encode(ctx, "OrderCreated", []byte(orderCreated))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsAvro(avroWire) {
+		t.Fatalf("Avro encoding lacks the wire-format header")
+	}
+	jsonWire, err := JSONCodec{}.Encode(ctx, "OrderCreated", []byte(orderCreated))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, c := range map[string]Codec{"avro": avro, "json": JSONCodec{avro: avro}} {
+		for format, wire := range map[string][]byte{"avro": avroWire, "json": jsonWire} {
+			got, err := c.Decode(ctx, wire)
+			if err != nil {
+				t.Fatalf("%s codec, %s message: %v", name, format, err)
+			}
+			id, items := decodeOrder(t, got)
+			if id != "o-1" || len(items) != 1 || items[0]["sku"] != "S1" {
+				t.Fatalf("%s codec, %s message: got %s", name, format, got)
+			}
+		}
+	}
+}
+
+func TestJSONCodecEnvelope(t *testing.T) {
+	wire, err := JSONCodec{}.Encode(context.Background(), "OrderCreated", []byte(orderCreated))
+	if err != nil {
+		t.Fatal(err)
+	}
+	typ, data, err := events.Decode(wire)
+	if err != nil || typ != "OrderCreated" {
+		t.Fatalf("type %q, err %v", typ, err)
+	}
+	if id, _ := decodeOrder(t, data); id != "o-1" {
+		t.Fatalf("data %s", data)
+	}
+}
@@ -0,0 +1,78 @@
+// Package events wraps event bodies in a versioned envelope:
+//
+//	{"schemaVersion": 1, "type": "OrderCreated", "data": {...}}
+//
+// Decode also accepts a bare body, written before envelopes existed, and
+// treats it as version 1. When an event's shape changes, bump
+// CurrentVersion and register a migration from the old version so
+// consumers keep reading messages already on the topic.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// CurrentVersion is the schemaVersion this build writes and the shape
+// Decode returns.
+const CurrentVersion = 1
+
+// Envelope is the wire form of a versioned event.
+type Envelope struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Type          string          `json:"type"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// Migration rewrites data of one schema version into the next version up.
+type Migration func(eventType string, data []byte) ([]byte, error)
+
+var (
+	mu         sync.RWMutex
+	migrations = map[int]Migration{}
+)
+
+// RegisterMigration installs the step that upgrades version from to from+1.
+func RegisterMigration(from int, m Migration) {
+	mu.Lock()
+	defer mu.Unlock()
+	migrations[from] = m
+}
+
+// Encode wraps data in an envelope at CurrentVersion.
+func Encode(eventType string, data []byte) ([]byte, error) {
+	return json.Marshal(Envelope{SchemaVersion: CurrentVersion, Type: eventType, Data: data})
+}
+
+// Decode unwraps body and migrates its data up to CurrentVersion. A body
+// without an envelope is returned as version 1 data with an empty type.
+func Decode(body []byte) (eventType string, data []byte, err error) {
+	var probe struct {
+		SchemaVersion *int            `json:"schemaVersion"`
+		Type          string          `json:"type"`
+		Data          json.RawMessage `json:"data"`
+	}
+	if json.Unmarshal(body, &probe) != nil || probe.SchemaVersion == nil || probe.Data == nil {
+		probe.Type, probe.Data = "", body
+		v := 1
+		probe.SchemaVersion = &v
+	}
+
+	version, data := *probe.SchemaVersion, []byte(probe.Data)
+	if version < 1 || version > CurrentVersion {
+		return "", nil, fmt.Errorf("unsupported schemaVersion %d (this build reads up to %d)", version, CurrentVersion)
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	for ; version < CurrentVersion; version++ {
+		m, ok := migrations[version]
+		if !ok {
+			return "", nil, fmt.Errorf("no migration from schemaVersion %d", version)
+		}
+		if data, err = m(probe.Type, data); err != nil {
+			return "", nil, fmt.Errorf("migrate schemaVersion %d: %w", version, err)
+		}
+	}
+	return probe.Type, data, nil
+}
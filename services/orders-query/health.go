@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CheckResult is the outcome of one dependency check.
+type CheckResult struct {
+	Status string `json:"status"` // ok or error
+	Error  string `json:"error,omitempty"`
+}
+
+// HealthChecker runs named dependency checks for /healthz?deep=true.
+type HealthChecker struct {
+	mu     sync.Mutex
+	checks map[string]func(ctx context.Context) error
+}
+
+// Register adds a check; a nil error means the dependency is healthy.
+func (h *HealthChecker) Register(name string, check func(ctx context.Context) error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.checks == nil {
+		h.checks = map[string]func(ctx context.Context) error{}
+	}
+	h.checks[name] = check
+}
+
+// Run executes every check concurrently and reports whether all passed.
+func (h *HealthChecker) Run(ctx context.Context) (bool, map[string]CheckResult) {
+	h.mu.Lock()
+	checks := make(map[string]func(ctx context.Context) error, len(h.checks))
+	for name, c := range h.checks {
+		checks[name] = c
+	}
+	h.mu.Unlock()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		healthy = true
+		results = make(map[string]CheckResult, len(checks))
+	)
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(ctx context.Context) error) {
+			defer wg.Done()
+			res := CheckResult{Status: "ok"}
+			if err := check(ctx); err != nil {
+				res = CheckResult{Status: "error", Error: err.Error()}
+			}
+			mu.Lock()
+			results[name] = res
+			if res.Status != "ok" {
+				healthy = false
+			}
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+	return healthy, results
+}
+
+// Handler serves /healthz; deep=true runs the checks (3s bound) and reports
+// each one.
+func (h *HealthChecker) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("deep") != "true" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+		healthy, results := h.Run(ctx)
+		status, code := "ok", http.StatusOK
+		if !healthy {
+			status, code = "degraded", http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"status": status, "checks": results})
+	}
+}
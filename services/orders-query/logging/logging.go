@@ -0,0 +1,58 @@
+// Package logging configures the process-wide slog logger from LOG_LEVEL
+// (debug, info, warn or error; default info) and LOG_FORMAT (text or json;
+// default text). Plain log.Printf output keeps working and is logged at
+// info level through the same handler.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// New returns a logger writing to w at the given level and format.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	switch strings.ToLower(level) {
+	case "debug":
+		lvl = slog.LevelDebug
+	case "", "info":
+		lvl = slog.LevelInfo
+	case "warn", "warning":
+		lvl = slog.LevelWarn
+	case "error":
+		lvl = slog.LevelError
+	default:
+		return nil, fmt.Errorf("unknown LOG_LEVEL %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown LOG_FORMAT %q", format)
+	}
+}
+
+// Init installs the logger described by LOG_LEVEL and LOG_FORMAT as the
+// default, tagging every record with service. Invalid settings fall back to
+// info/text with a warning rather than stopping the service.
+func Init(service string) {
+	logger, err := New(os.Stderr, os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT"))
+	if err != nil {
+		logger, _ = New(os.Stderr, "info", "text")
+		defer slog.Warn("invalid logging config, using info/text", "error", err)
+	}
+	slog.SetDefault(logger.With("service", service))
+}
+
+// Fatalf logs at error level and exits. It replaces log.Fatalf, whose
+// info-level record would be dropped when LOG_LEVEL is warn or error.
+func Fatalf(format string, args ...any) {
+	slog.Error(fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
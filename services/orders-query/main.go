@@ -0,0 +1,491 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"kafka-microservice/services/orders-query/codec"
+	"kafka-microservice/services/orders-query/logging"
+)
+
+type OrderItem struct {
+	SKU string `json:"sku"`
+	Qty int    `json:"qty"`
+}
+type OrderCreated struct {
+	OrderID string      `json:"orderId"`
+	UserID  string      `json:"userId"`
+	Items   []OrderItem `json:"items"`
+	// Total keeps the amount's literal digits so the projection serves back
+	// exactly what orders-api published instead of a float64 rendering
+	Total     json.Number `json:"total"`
+	Currency  string      `json:"currency"`
+	CreatedAt string      `json:"createdAt"`
+	Priority  string      `json:"priority,omitempty"`
+
+	CorrelationID string `json:"correlationId,omitempty"`
+}
+
+// OrderAmended replaces an order's items and total; only amendments
+// orders-processor accepted are projected. Version is the order's amendment
+// count once it applies.
+type OrderAmended struct {
+	OrderID string      `json:"orderId"`
+	Items   []OrderItem `json:"items"`
+	Total   json.Number `json:"total"`
+	Version int         `json:"version"`
+}
+
+// AmendmentRejected reports an amendment orders-processor turned down after
+// orders-api had accepted it with 202.
+type AmendmentRejected struct {
+	OrderID    string `json:"orderId"`
+	Version    int    `json:"version"`
+	AmendedAt  string `json:"amendedAt,omitempty"`
+	Reason     string `json:"reason"`
+	RejectedAt string `json:"rejectedAt"`
+}
+
+type OrderStatus struct {
+	OrderID   string `json:"orderId"`
+	Status    string `json:"status"`
+	Reason    string `json:"reason,omitempty"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+// OrderView is the projection of one order: what was ordered plus the latest
+// status seen for it.
+type OrderView struct {
+	OrderID   string      `json:"orderId"`
+	UserID    string      `json:"userId"`
+	Items     []OrderItem `json:"items"`
+	Total     json.Number `json:"total"`
+	Currency  string      `json:"currency"`
+	CreatedAt string      `json:"createdAt"`
+	Priority  string      `json:"priority,omitempty"`
+	Status    string      `json:"status"`
+	Reason    string      `json:"reason,omitempty"`
+	UpdatedAt string      `json:"updatedAt,omitempty"`
+
+	// Version counts accepted amendments; orders-api sends it back with an
+	// amendment so one computed from a stale read is rejected
+	Version       int    `json:"version"`
+	CorrelationID string `json:"correlationId,omitempty"`
+	// LastRejectedAmendment is the latest amendment orders-processor turned
+	// down, so a client told 202 can find out it did not apply
+	LastRejectedAmendment *AmendmentRejected `json:"lastRejectedAmendment,omitempty"`
+}
+
+func getenv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func newPartitionReader(brokers []string, topic string, partition int) *kafka.Reader {
+	return kafka.NewReader(withFetchTuning(withReaderLogging(kafka.ReaderConfig{
+		Brokers:   brokers,
+		Topic:     topic,
+		Partition: partition,
+	})))
+}
+
+var (
+	mu         sync.RWMutex
+	orders     = map[string]*OrderView{}
+	pending    int64 // partitions not yet caught up to their end offset at startup
+	kafkaReady int64 // 0 = not ready, 1 = ready
+)
+
+// view returns the projection entry for orderID, creating it if needed.
+// Callers must hold mu for writing.
+func view(orderID string) *OrderView {
+	v, ok := orders[orderID]
+	if !ok {
+		v = &OrderView{OrderID: orderID, Status: "PENDING"}
+		orders[orderID] = v
+	}
+	return v
+}
+
+func applyCreated(oc OrderCreated) {
+	mu.Lock()
+	defer mu.Unlock()
+	v := view(oc.OrderID)
+	v.UserID = oc.UserID
+	// the topics are consumed independently; an amendment already applied
+	// carries the newer items and total
+	if v.Version == 0 {
+		v.Items = oc.Items
+		v.Total = oc.Total
+	}
+	v.Currency = oc.Currency
+	v.CreatedAt = oc.CreatedAt
+	v.Priority = oc.Priority
+	v.CorrelationID = oc.CorrelationID
+}
+
+// applyAmended applies an accepted amendment unless a later one already has.
+// Amendments from before versions existed carry 0 and always apply.
+func applyAmended(oa OrderAmended) {
+	mu.Lock()
+	defer mu.Unlock()
+	v := view(oa.OrderID)
+	if oa.Version != 0 && oa.Version <= v.Version {
+		return
+	}
+	v.Items = oa.Items
+	if oa.Total != "" {
+		v.Total = oa.Total
+	}
+	v.Version = max(v.Version, oa.Version)
+}
+
+// applyAmendmentRejected records r unless a later rejection already has.
+func applyAmendmentRejected(r AmendmentRejected) {
+	mu.Lock()
+	defer mu.Unlock()
+	v := view(r.OrderID)
+	if last := v.LastRejectedAmendment; last != nil && r.RejectedAt < last.RejectedAt {
+		return
+	}
+	v.LastRejectedAmendment = &r
+}
+
+func applyStatus(s OrderStatus) {
+	mu.Lock()
+	defer mu.Unlock()
+	v := view(s.OrderID)
+	// the two topics are consumed independently, so ignore a status that is
+	// older than the one already applied
+	if v.UpdatedAt != "" && s.UpdatedAt < v.UpdatedAt {
+		return
+	}
+	v.Status = s.Status
+	v.Reason = s.Reason
+	v.UpdatedAt = s.UpdatedAt
+}
+
+// consumeTopic replays every partition of topic from the beginning, passing
+// each decoded message to handle. The projection lives in memory, so it is
+// rebuilt on every start rather than resumed from committed offsets.
+func consumeTopic(ctx context.Context, brokers []string, topic string, eventCodec codec.Codec, handle func([]byte)) {
+	var partitions []kafka.Partition
+	for {
+		conn, err := kafka.DialContext(ctx, "tcp", brokers[0])
+		if err == nil {
+			partitions, err = conn.ReadPartitions(topic)
+			conn.Close()
+		}
+		if err == nil && len(partitions) > 0 {
+			break
+		}
+		slog.Warn("waiting for topic", "topic", topic, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(2 * time.Second):
+		}
+	}
+
+	for _, p := range partitions {
+		// a partition stays pending until its end offset is known, so a
+		// failed lookup keeps /readyz down instead of passing as caught up
+		atomic.AddInt64(&pending, 1)
+
+		go func(partition int) {
+			end, caughtUp, ok := partitionEnd(ctx, brokers, topic, partition)
+			if !ok {
+				return
+			}
+			if caughtUp && atomic.AddInt64(&pending, -1) == 0 {
+				slog.Info("projection caught up")
+			}
+			r := newPartitionReader(brokers, topic, partition)
+			defer r.Close()
+			for {
+				m, err := fetchBounded(ctx, r.ReadMessage)
+				if errors.Is(err, errReadIdle) {
+					continue
+				}
+				if err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					slog.Debug("read error", "topic", topic, "partition", partition, "error", err)
+					continue
+				}
+				body, err := eventCodec.Decode(ctx, m.Value)
+				if err != nil {
+					slog.Warn("decode error", "topic", topic, "partition", partition, "offset", m.Offset, "error", err)
+				} else {
+					handle(body)
+				}
+				if !caughtUp && m.Offset+1 >= end {
+					caughtUp = true
+					if atomic.AddInt64(&pending, -1) == 0 {
+						slog.Info("projection caught up")
+					}
+				}
+			}
+		}(p.ID)
+	}
+}
+
+// partitionEnd looks up the end offset of one partition of topic, retrying
+// until it succeeds or ctx ends; ok is false only in the latter case.
+// caughtUp reports a partition with nothing to replay.
+func partitionEnd(ctx context.Context, brokers []string, topic string, partition int) (end int64, caughtUp, ok bool) {
+	for {
+		conn, err := kafka.DialLeader(ctx, "tcp", brokers[0], topic, partition)
+		if err == nil {
+			var first int64
+			first, end, err = conn.ReadOffsets()
+			conn.Close()
+			if err == nil {
+				return end, end <= first, true
+			}
+		}
+		slog.Warn("reading end offset failed", "topic", topic, "partition", partition, "error", err)
+		select {
+		case <-ctx.Done():
+			return 0, false, false
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// listOrders returns one page of the orders matching userID and status
+// (either may be empty), newest first, along with the number of matches.
+func listOrders(userID, status string, limit, offset int) ([]OrderView, int) {
+	mu.RLock()
+	matched := make([]OrderView, 0)
+	for _, v := range orders {
+		if (userID == "" || v.UserID == userID) && (status == "" || v.Status == status) {
+			matched = append(matched, *v)
+		}
+	}
+	mu.RUnlock()
+
+	// newest first, with orderId as a tiebreaker so pages are stable
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].CreatedAt != matched[j].CreatedAt {
+			return matched[i].CreatedAt > matched[j].CreatedAt
+		}
+		return matched[i].OrderID < matched[j].OrderID
+	})
+	total := len(matched)
+	// offset may be anything up to MaxInt; add limit to what is left
+	start := min(offset, total)
+	return matched[start : start+min(limit, total-start)], total
+}
+
+func main() {
+	logging.Init("orders-query")
+	addr := getenv("HTTP_ADDR", ":8085")
+	brokers := strings.Split(getenv("KAFKA_BROKERS", "localhost:9093"), ",")
+	ordersTopic := getenv("ORDERS_TOPIC", "orders.created")
+	priorityTopic := getenv("PRIORITY_TOPIC", "orders.created.priority")
+	statusTopic := getenv("STATUS_TOPIC", "orders.status")
+	amendTopic := getenv("AMEND_ACCEPTED_TOPIC", "orders.amended.accepted")
+	rejectedTopic := getenv("AMEND_REJECTED_TOPIC", "orders.amended.rejected")
+
+	// SHUTDOWN_TIMEOUT bounds the whole shutdown sequence once a signal arrives
+	shutdownTimeout, err := time.ParseDuration(getenv("SHUTDOWN_TIMEOUT", "5s"))
+	if err != nil {
+		logging.Fatalf("invalid SHUTDOWN_TIMEOUT: %v", err)
+	}
+
+	if err := startupBrokerCheck(brokers); err != nil {
+		logging.Fatalf("kafka startup check failed: %v", err)
+	}
+	if err := ensureTopics(brokers, ordersTopic, priorityTopic, statusTopic, amendTopic, rejectedTopic); err != nil {
+		logging.Fatalf("ensure topics failed: %v", err)
+	}
+
+	eventCodec, err := codec.New(getenv("EVENT_FORMAT", "json"), getenv("SCHEMA_REGISTRY_URL", ""))
+	if err != nil {
+		logging.Fatalf("invalid event codec config: %v", err)
+	}
+
+	// Create context that can be cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Start Kafka consumers in goroutines; partitions are registered before
+	// the ready flag is considered so /readyz cannot flip early
+	handleCreated := func(b []byte) {
+		var oc OrderCreated
+		if err := json.Unmarshal(b, &oc); err != nil || oc.OrderID == "" {
+			slog.Warn("json error", "error", err)
+			return
+		}
+		applyCreated(oc)
+	}
+	var started sync.WaitGroup
+	started.Add(5)
+	for _, t := range []string{ordersTopic, priorityTopic} {
+		go func(topic string) {
+			defer started.Done()
+			consumeTopic(ctx, brokers, topic, eventCodec, handleCreated)
+		}(t)
+	}
+	go func() {
+		defer started.Done()
+		consumeTopic(ctx, brokers, statusTopic, eventCodec, func(b []byte) {
+			var s OrderStatus
+			if err := json.Unmarshal(b, &s); err != nil || s.OrderID == "" {
+				slog.Warn("json error", "error", err)
+				return
+			}
+			applyStatus(s)
+		})
+	}()
+	go func() {
+		defer started.Done()
+		consumeTopic(ctx, brokers, amendTopic, eventCodec, func(b []byte) {
+			var oa OrderAmended
+			if err := json.Unmarshal(b, &oa); err != nil || oa.OrderID == "" {
+				slog.Warn("json error", "error", err)
+				return
+			}
+			applyAmended(oa)
+		})
+	}()
+	go func() {
+		defer started.Done()
+		consumeTopic(ctx, brokers, rejectedTopic, eventCodec, func(b []byte) {
+			var r AmendmentRejected
+			if err := json.Unmarshal(b, &r); err != nil || r.OrderID == "" {
+				slog.Warn("json error", "error", err)
+				return
+			}
+			applyAmendmentRejected(r)
+		})
+	}()
+	go func() {
+		started.Wait()
+		if ctx.Err() == nil {
+			atomic.StoreInt64(&kafkaReady, 1)
+		}
+	}()
+
+	var health HealthChecker
+	health.Register("kafka", func(ctx context.Context) error { return checkBrokers(brokers, 2*time.Second) })
+	http.HandleFunc("/healthz", health.Handler())
+	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt64(&kafkaReady) == 1 && atomic.LoadInt64(&pending) == 0 {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+	http.HandleFunc("/orders/statuses", handleBulkStatuses)
+	http.HandleFunc("/orders/", func(w http.ResponseWriter, r *http.Request) {
+		if cors(w, r, "GET") {
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/orders/")
+		mu.RLock()
+		v, ok := orders[id]
+		var out OrderView
+		if ok {
+			out = *v
+		}
+		mu.RUnlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "order not found"})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	})
+	http.HandleFunc("/orders", func(w http.ResponseWriter, r *http.Request) {
+		if cors(w, r, "GET") {
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		limit, err := strconv.Atoi(getQuery(q, "limit", "50"))
+		if err != nil || limit < 1 || limit > 500 {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "limit must be between 1 and 500"})
+			return
+		}
+		offset, err := strconv.Atoi(getQuery(q, "offset", "0"))
+		if err != nil || offset < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "offset must be a non-negative integer"})
+			return
+		}
+		items, total := listOrders(q.Get("userId"), q.Get("status"), limit, offset)
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"items":  items,
+			"total":  total,
+			"limit":  limit,
+			"offset": offset,
+		})
+	})
+
+	srv := &http.Server{Addr: addr, Handler: logging.AccessLog(http.DefaultServeMux)}
+
+	// Start server in a goroutine
+	go func() {
+		slog.Info("orders-query listening", "addr", addr, "topics", []string{ordersTopic, priorityTopic, statusTopic, amendTopic})
+		if err := listenAndServe(srv); err != nil && err != http.ErrServerClosed {
+			logging.Fatalf("server failed: %v", err)
+		}
+	}()
+
+	// Wait for interrupt signal to gracefully shutdown
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	slog.Info("shutting down orders-query")
+
+	// Cancel context to stop Kafka consumers
+	cancel()
+
+	// Shutdown HTTP server with timeout
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer shutdownCancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("server forced to shutdown", "error", err)
+	}
+
+	slog.Info("orders-query shutdown complete")
+}
+
+func getQuery(q map[string][]string, key, def string) string {
+	if v := q[key]; len(v) > 0 && v[0] != "" {
+		return v[0]
+	}
+	return def
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func resetOrders(t *testing.T) {
+	t.Helper()
+	mu.Lock()
+	orders = map[string]*OrderView{}
+	mu.Unlock()
+}
+
+func TestApplyAmendedReplacesItemsAndTotal(t *testing.T) {
+	resetOrders(t)
+	applyCreated(OrderCreated{OrderID: "o-1", Items: []OrderItem{{SKU: "S1", Qty: 2}}, Total: "10.00", CorrelationID: "c-1"})
+	applyAmended(OrderAmended{OrderID: "o-1", Items: []OrderItem{{SKU: "S1", Qty: 3}}, Total: "15.00", Version: 1})
+
+	v := orders["o-1"]
+	if !reflect.DeepEqual(v.Items, []OrderItem{{SKU: "S1", Qty: 3}}) || v.Total != "15.00" || v.Version != 1 || v.CorrelationID != "c-1" {
+		t.Fatalf("view %+v", v)
+	}
+}
+
+func TestApplyAmendedIgnoresOlderVersions(t *testing.T) {
+	resetOrders(t)
+	applyAmended(OrderAmended{OrderID: "o-1", Items: []OrderItem{{SKU: "S1", Qty: 3}}, Total: "15.00", Version: 2})
+	applyAmended(OrderAmended{OrderID: "o-1", Items: []OrderItem{{SKU: "S1", Qty: 9}}, Total: "45.00", Version: 1})
+	// the amendment feed ran ahead of the created feed
+	applyCreated(OrderCreated{OrderID: "o-1", Items: []OrderItem{{SKU: "S1", Qty: 1}}, Total: "5.00"})
+
+	v := orders["o-1"]
+	if v.Items[0].Qty != 3 || v.Total != "15.00" || v.Version != 2 {
+		t.Fatalf("view %+v", v)
+	}
+}
+
+func TestListOrdersPagesPastTheEnd(t *testing.T) {
+	resetOrders(t)
+	applyCreated(OrderCreated{OrderID: "o-1", UserID: "u-1", CreatedAt: "2026-01-01T00:00:00Z"})
+	applyCreated(OrderCreated{OrderID: "o-2", UserID: "u-1", CreatedAt: "2026-01-02T00:00:00Z"})
+
+	items, total := listOrders("u-1", "", 1, 0)
+	if total != 2 || len(items) != 1 || items[0].OrderID != "o-2" {
+		t.Fatalf("first page %v of %d", items, total)
+	}
+	items, total = listOrders("", "", 500, math.MaxInt)
+	if total != 2 || len(items) != 0 {
+		t.Fatalf("page at MaxInt %v of %d", items, total)
+	}
+}
+
+// TestCreatedTotalKeepsDigits decodes a total float64 cannot represent and
+// expects the projection to serve back the published digits.
+func TestCreatedTotalKeepsDigits(t *testing.T) {
+	resetOrders(t)
+	var oc OrderCreated
+	if err := json.Unmarshal([]byte(`{"orderId":"o-1","total":90071992547409.93}`), &oc); err != nil {
+		t.Fatal(err)
+	}
+	applyCreated(oc)
+	if got := orders["o-1"].Total; got != "90071992547409.93" {
+		t.Fatalf("total %q", got)
+	}
+}
+
+func TestApplyAmendmentRejectedKeepsLatest(t *testing.T) {
+	resetOrders(t)
+	applyCreated(OrderCreated{OrderID: "o-1", Items: []OrderItem{{SKU: "S1", Qty: 2}}, Total: "10.00"})
+	applyAmendmentRejected(AmendmentRejected{OrderID: "o-1", Version: 2, Reason: "order is PAID", RejectedAt: "2026-01-01T00:00:02Z"})
+	applyAmendmentRejected(AmendmentRejected{OrderID: "o-1", Version: 1, Reason: "stale", RejectedAt: "2026-01-01T00:00:01Z"})
+
+	v := orders["o-1"]
+	if r := v.LastRejectedAmendment; r == nil || r.Version != 2 || r.Reason != "order is PAID" {
+		t.Fatalf("last rejection %+v", r)
+	}
+	if v.Items[0].Qty != 2 || v.Total != "10.00" {
+		t.Fatalf("a rejection changed the order: %+v", v)
+	}
+}
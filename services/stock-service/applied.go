@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strconv"
+)
+
+// appliedSet holds the keys of the orders and amendments most recently
+// taken off inventory, so one redelivered after a crash or rebalance is not
+// applied twice. Once full it forgets the oldest key. It is guarded by mu
+// and saved with the inventory snapshot, so a restart keeps both in step.
+type appliedSet struct {
+	seen map[string]struct{}
+	ring []string
+	next int
+}
+
+// newAppliedSet returns a set holding up to capacity keys, seeded with keys
+// oldest first as returned by appliedSet.keys.
+func newAppliedSet(capacity int, keys []string) *appliedSet {
+	s := &appliedSet{seen: make(map[string]struct{}, capacity), ring: make([]string, capacity)}
+	for _, k := range keys {
+		s.add(k)
+	}
+	return s
+}
+
+// add records key and reports whether it was new.
+func (s *appliedSet) add(key string) bool {
+	if _, ok := s.seen[key]; ok {
+		return false
+	}
+	if old := s.ring[s.next]; old != "" {
+		delete(s.seen, old)
+	}
+	s.ring[s.next] = key
+	s.next = (s.next + 1) % len(s.ring)
+	s.seen[key] = struct{}{}
+	return true
+}
+
+// keys returns the set's keys, oldest first.
+func (s *appliedSet) keys() []string {
+	out := make([]string, 0, len(s.seen))
+	for i := range s.ring {
+		if k := s.ring[(s.next+i)%len(s.ring)]; k != "" {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// applied is the process-wide appliedSet; see decrementOnce.
+var applied = newAppliedSet(dedupCapacity(), nil)
+
+// amendmentKey identifies an amendment in applied. orders-processor numbers
+// every amendment it accepts; one without a version falls back to its time.
+func amendmentKey(oa OrderAmended) string {
+	if oa.Version > 0 {
+		return oa.OrderID + "@v" + strconv.Itoa(oa.Version)
+	}
+	return oa.OrderID + "@" + oa.AmendedAt
+}
+
+// dedupCapacity is how many applied keys are remembered (DEDUP_CAPACITY,
+// default 10000).
+func dedupCapacity() int {
+	n, err := strconv.Atoi(getenv("DEDUP_CAPACITY", "10000"))
+	if err != nil || n < 1 {
+		return 10000
+	}
+	return n
+}
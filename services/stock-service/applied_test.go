@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func countingFulfiller(published *int) *fulfiller {
+	return &fulfiller{
+		publishUpdate:  func(context.Context, InventoryUpdated) error { *published++; return nil },
+		publishPartial: func(context.Context, OrderPartial) {},
+		publishUnknown: func(context.Context, UnknownSKU) {},
+	}
+}
+
+// TestRedeliveredOrderAppliedOnce hands the same order and amendment to the
+// fulfiller twice, as a replay after a crash would.
+func TestRedeliveredOrderAppliedOnce(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 10})
+	published := 0
+	f := countingFulfiller(&published)
+	ctx := context.Background()
+	amend := OrderAmended{OrderID: "o-1", Deltas: []OrderItem{{SKU: "S1", Qty: 1}}, Version: 1}
+	for i := 0; i < 2; i++ {
+		f.apply(ctx, "o-1", "o-1", []OrderItem{{SKU: "S1", Qty: 2}}, "", "")
+		f.apply(ctx, amendmentKey(amend), "o-1", amend.Deltas, "", "")
+	}
+	// the next amendment is new
+	amend.Version = 2
+	f.apply(ctx, amendmentKey(amend), "o-1", amend.Deltas, "", "")
+
+	mu.RLock()
+	defer mu.RUnlock()
+	if inventory["S1"] != 6 || published != 3 {
+		t.Fatalf("S1 = %d after %d updates, want 6 after 3", inventory["S1"], published)
+	}
+}
+
+// TestAppliedKeysSurviveSnapshot restores a snapshot and expects an order
+// applied before it was taken to be skipped when redelivered.
+func TestAppliedKeysSurviveSnapshot(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 10})
+	published := 0
+	f := countingFulfiller(&published)
+	f.apply(context.Background(), "o-1", "o-1", []OrderItem{{SKU: "S1", Qty: 2}}, "", "")
+
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	if err := saveInventoryFile(path, snapshotState()); err != nil {
+		t.Fatal(err)
+	}
+	snap, ok, err := loadInventoryFile(path)
+	if err != nil || !ok {
+		t.Fatalf("load: ok=%v, %v", ok, err)
+	}
+	mu.Lock()
+	inventory, applied = snap.Inventory, newAppliedSet(16, snap.Applied)
+	mu.Unlock()
+
+	f.apply(context.Background(), "o-1", "o-1", []OrderItem{{SKU: "S1", Qty: 2}}, "", "")
+	mu.RLock()
+	defer mu.RUnlock()
+	if inventory["S1"] != 8 || published != 1 {
+		t.Fatalf("S1 = %d after %d updates, want 8 after 1", inventory["S1"], published)
+	}
+}
+
+func TestLoadsSnapshotWithoutAppliedKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	if err := os.WriteFile(path, []byte(`{"S1":4,"S2":0}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	snap, ok, err := loadInventoryFile(path)
+	if err != nil || !ok || snap.Inventory["S1"] != 4 || len(snap.Inventory) != 2 || len(snap.Applied) != 0 {
+		t.Fatalf("got %+v, ok=%v, %v", snap, ok, err)
+	}
+}
+
+func TestAppliedSetForgetsOldestKey(t *testing.T) {
+	s := newAppliedSet(2, []string{"a", "b"})
+	if s.add("b") || !s.add("c") || !s.add("a") {
+		t.Fatal("want b remembered and a forgotten once c was added")
+	}
+	if got := s.keys(); len(got) != 2 || got[0] != "c" || got[1] != "a" {
+		t.Fatalf("keys %v, want [c a]", got)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Sources of an inventory change, in AuditEntry.Source.
+const (
+	auditSourceOrder     = "order"
+	auditSourceSeed      = "seed"
+	auditSourceRestock   = "restock"
+	auditSourceReconcile = "reconcile"
+)
+
+// AuditEntry records one change to one SKU's quantity.
+type AuditEntry struct {
+	SKU         string `json:"sku"`
+	Delta       int    `json:"delta"`
+	NewQuantity int    `json:"newQuantity"`
+	Source      string `json:"source"`
+	OrderID     string `json:"orderId,omitempty"`
+	At          string `json:"at"`
+}
+
+// auditLog is the append-only record of inventory changes. The latest
+// AUDIT_RETAIN entries (default 10000) are kept in memory for GET
+// /stock/audit; with AUDIT_LOG_PATH set every entry is also appended to that
+// file as NDJSON, which is the durable copy. Entries are recorded by the
+// functions that mutate inventory, under mu, so no change goes unrecorded.
+type auditLog struct {
+	mu      sync.Mutex
+	retain  int
+	entries []AuditEntry
+	f       *os.File
+}
+
+var audit = &auditLog{retain: func() int {
+	if n, err := strconv.Atoi(getenv("AUDIT_RETAIN", "10000")); err == nil && n > 0 {
+		return n
+	}
+	return 10000
+}()}
+
+// open starts appending entries to path.
+func (a *auditLog) open(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.f = f
+	a.mu.Unlock()
+	return nil
+}
+
+// record appends one entry, skipping changes that left the quantity as it
+// was. A failed file write is logged; the in-memory entry is kept.
+func (a *auditLog) record(sku string, delta, newQty int, source, orderID string) {
+	if delta == 0 {
+		return
+	}
+	now := time.Now().UTC()
+	history.record(sku, delta, now)
+	e := AuditEntry{SKU: sku, Delta: delta, NewQuantity: newQty, Source: source, OrderID: orderID, At: now.Format(time.RFC3339Nano)}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries = append(a.entries, e)
+	if len(a.entries) > a.retain {
+		a.entries = a.entries[len(a.entries)-a.retain:]
+	}
+	if a.f != nil {
+		line, _ := json.Marshal(e)
+		if _, err := a.f.Write(append(line, '\n')); err != nil {
+			slog.Warn("audit log write failed", "error", err)
+		}
+	}
+}
+
+// query returns retained entries for sku (any when empty) at or after since,
+// oldest first, keeping the newest limit.
+func (a *auditLog) query(sku string, since time.Time, limit int) []AuditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make([]AuditEntry, 0)
+	for _, e := range a.entries {
+		if sku != "" && e.SKU != sku {
+			continue
+		}
+		if at, err := time.Parse(time.RFC3339Nano, e.At); err == nil && at.Before(since) {
+			continue
+		}
+		out = append(out, e)
+	}
+	if len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return out
+}
+
+// Close closes the audit file, if any.
+func (a *auditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return nil
+	}
+	return a.f.Close()
+}
+
+// handleAudit serves GET /stock/audit?sku=&since=&limit=. since is RFC 3339;
+// limit defaults to 100 and is at most 1000.
+func handleAudit(w http.ResponseWriter, r *http.Request) {
+	if cors(w, r, "GET") {
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	var since time.Time
+	if s := q.Get("since"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "since must be an RFC 3339 time"})
+			return
+		}
+		since = t
+	}
+	limit := 100
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 1000 {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "limit must be between 1 and 1000"})
+			return
+		}
+		limit = n
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"entries": audit.query(q.Get("sku"), since, limit)})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestAuditRecordsEveryMutation makes one change of each source and expects
+// an entry for each, both retained and appended to AUDIT_LOG_PATH.
+func TestAuditRecordsEveryMutation(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 10, "S2": 10})
+	prev := audit
+	audit = &auditLog{retain: 100}
+	t.Cleanup(func() { audit = prev })
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+	if err := audit.open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer audit.Close()
+
+	decrementBatch("o-1", []OrderItem{{SKU: "S1", Qty: 2}})
+	seedInventory(map[string]int{"S2": 4}, false)
+	setQuantity("S3", 7)
+	since := time.Now().Add(2 * time.Second).UTC().Format(time.RFC3339)
+	if code := reconcile(t, time.Now(), `{"baseline":{"S1":9,"S2":4,"S3":7},"since":"`+since+`","correct":true}`); code != 200 {
+		t.Fatalf("reconcile: status %d", code)
+	}
+	// a seed that changes nothing is not an entry
+	seedInventory(map[string]int{"S2": 4}, false)
+
+	want := []AuditEntry{
+		{SKU: "S1", Delta: -2, NewQuantity: 8, Source: auditSourceOrder, OrderID: "o-1"},
+		{SKU: "S2", Delta: -6, NewQuantity: 4, Source: auditSourceSeed},
+		{SKU: "S3", Delta: 7, NewQuantity: 7, Source: auditSourceRestock},
+		{SKU: "S1", Delta: 1, NewQuantity: 9, Source: auditSourceReconcile},
+	}
+	check := func(where string, got []AuditEntry) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("%s: %d entries %+v, want %d", where, len(got), got, len(want))
+		}
+		for i, e := range got {
+			if e.At == "" {
+				t.Fatalf("%s: entry %d has no time", where, i)
+			}
+			e.At = ""
+			if e != want[i] {
+				t.Fatalf("%s: entry %d is %+v, want %+v", where, i, e, want[i])
+			}
+		}
+	}
+	check("retained", audit.query("", time.Time{}, 100))
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var logged []AuditEntry
+	for sc := bufio.NewScanner(f); sc.Scan(); {
+		var e AuditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		logged = append(logged, e)
+	}
+	check("file", logged)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// maxBodyBytes caps JSON request bodies (MAX_BODY_BYTES, default 1MB).
+var maxBodyBytes = func() int64 {
+	n, err := strconv.ParseInt(getenv("MAX_BODY_BYTES", "1048576"), 10, 64)
+	if err != nil || n <= 0 {
+		return 1 << 20
+	}
+	return n
+}()
+
+// isJSONRequest reports whether r declares a JSON body. Parameters such as
+// charset are allowed; a missing Content-Type is not.
+func isJSONRequest(r *http.Request) bool {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mt == "application/json"
+}
+
+// decodeJSONBody decodes r's body into dst, streaming through a size-limited
+// reader and rejecting fields dst does not declare. On failure it returns the
+// HTTP status to answer with: 413 for an oversized body, 400 otherwise.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) (int, error) {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return http.StatusRequestEntityTooLarge, errors.New("request body too large")
+		}
+		return http.StatusBadRequest, err
+	}
+	return 0, nil
+}
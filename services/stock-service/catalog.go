@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Product is the descriptive metadata for a SKU. Quantities stay in the
+// inventory map; the catalog only knows what a SKU is and what it costs.
+type Product struct {
+	SKU      string  `json:"sku"`
+	Name     string  `json:"name"`
+	Price    float64 `json:"price"`
+	Currency string  `json:"currency"`
+}
+
+// CatalogEntry is a product joined with its current quantity.
+type CatalogEntry struct {
+	Product
+	Quantity int `json:"quantity"`
+}
+
+var (
+	catalogMu sync.RWMutex
+	catalog   = map[string]Product{
+		"S1": {SKU: "S1", Name: "Product S1", Price: 12.50, Currency: "USD"},
+		"S2": {SKU: "S2", Name: "Product S2", Price: 8.99, Currency: "USD"},
+		"S3": {SKU: "S3", Name: "Product S3", Price: 15.25, Currency: "USD"},
+		"S4": {SKU: "S4", Name: "Product S4", Price: 22.00, Currency: "USD"},
+	}
+)
+
+// upsertProducts validates every product before replacing any catalog entry.
+func upsertProducts(products []Product) error {
+	for i := range products {
+		products[i].SKU = normalizeSKU(products[i].SKU)
+	}
+	for _, p := range products {
+		if p.SKU == "" {
+			return fmt.Errorf("product with empty sku")
+		}
+		if p.Price < 0 {
+			return fmt.Errorf("product %s has negative price", p.SKU)
+		}
+	}
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	for _, p := range products {
+		if p.Currency == "" {
+			p.Currency = "USD"
+		}
+		catalog[p.SKU] = p
+	}
+	return nil
+}
+
+// loadCatalogEnv merges the JSON array in CATALOG into the default catalog.
+func loadCatalogEnv() error {
+	raw := getenv("CATALOG", "")
+	if raw == "" {
+		return nil
+	}
+	var products []Product
+	if err := json.Unmarshal([]byte(raw), &products); err != nil {
+		return fmt.Errorf("invalid CATALOG: %w", err)
+	}
+	return upsertProducts(products)
+}
+
+// listCatalog joins catalog metadata with inventory, sorted by SKU. SKUs that
+// only exist on one side are included with the fields that are known.
+func listCatalog() []CatalogEntry {
+	stock := snapshotInventory()
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+	entries := make([]CatalogEntry, 0, len(catalog))
+	for sku, p := range catalog {
+		entries = append(entries, CatalogEntry{Product: p, Quantity: stock[sku]})
+	}
+	for sku, qty := range stock {
+		if _, ok := catalog[sku]; !ok {
+			entries = append(entries, CatalogEntry{Product: Product{SKU: sku}, Quantity: qty})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].SKU < entries[j].SKU })
+	return entries
+}
+
+// catalogHandler serves GET /catalog to anyone and POST /catalog to admins
+// only: orders-api verifies order totals against these prices.
+func catalogHandler() http.HandlerFunc {
+	update := requireAdmin(updateCatalog)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cors(w, r, "GET, POST") {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(listCatalog())
+		case http.MethodPost:
+			update(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// updateCatalog upserts the products in the request body.
+func updateCatalog(w http.ResponseWriter, r *http.Request) {
+	var products []Product
+	if status, err := decodeJSONBody(w, r, &products); err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid json: " + err.Error()})
+		return
+	}
+	if err := upsertProducts(products); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCatalogUpdatesNeedTheAdminToken(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+	h := catalogHandler()
+	catalogMu.RLock()
+	prev := catalog["S1"]
+	catalogMu.RUnlock()
+	t.Cleanup(func() {
+		catalogMu.Lock()
+		catalog["S1"] = prev
+		catalogMu.Unlock()
+	})
+
+	post := func(auth string) int {
+		r := httptest.NewRequest(http.MethodPost, "/catalog", strings.NewReader(`[{"sku":"S1","name":"cheap","price":0.01}]`))
+		r.Header.Set("Content-Type", "application/json")
+		if auth != "" {
+			r.Header.Set("Authorization", "Bearer "+auth)
+		}
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w.Code
+	}
+	if code := post(""); code != http.StatusUnauthorized {
+		t.Fatalf("POST without a token = %d", code)
+	}
+	catalogMu.RLock()
+	price := catalog["S1"].Price
+	catalogMu.RUnlock()
+	if price != prev.Price {
+		t.Fatal("unauthorized POST changed the price")
+	}
+	if code := post("secret"); code != http.StatusNoContent {
+		t.Fatalf("POST with the token = %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/catalog", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"price":0.01`) {
+		t.Fatalf("GET = %d %s", w.Code, w.Body)
+	}
+}
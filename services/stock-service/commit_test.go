@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// BenchmarkCommit compares consuming with a synchronous commit per message
+// against COMMIT_INTERVAL batching. It needs a broker, so it only runs with
+// KAFKA_BROKERS set, e.g.
+//
+//	KAFKA_BROKERS=localhost:9093 go test -run '^$' -bench Commit
+func BenchmarkCommit(b *testing.B) {
+	addrs := getenv("KAFKA_BROKERS", "")
+	if addrs == "" {
+		b.Skip("KAFKA_BROKERS not set")
+	}
+	brokers := strings.Split(addrs, ",")
+	for _, interval := range []string{"0", "1s"} {
+		b.Run("COMMIT_INTERVAL="+interval, func(b *testing.B) {
+			b.Setenv("COMMIT_INTERVAL", interval)
+			b.Setenv("START_OFFSET", "first")
+			topic := fmt.Sprintf("bench-commit-%d", time.Now().UnixNano())
+			cc, err := dialController(brokers)
+			if err != nil {
+				b.Fatal(err)
+			}
+			err = cc.CreateTopics(kafka.TopicConfig{Topic: topic, NumPartitions: 1, ReplicationFactor: 1})
+			cc.Close()
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			ctx := context.Background()
+			w := &kafka.Writer{Addr: kafka.TCP(brokers...), Topic: topic, BatchSize: 1000, BatchTimeout: 10 * time.Millisecond}
+			msgs := make([]kafka.Message, b.N)
+			for i := range msgs {
+				msgs[i] = kafka.Message{Key: []byte(fmt.Sprintf("o-%d", i)), Value: []byte(`{}`)}
+			}
+			if err := w.WriteMessages(ctx, msgs...); err != nil {
+				b.Fatal(err)
+			}
+			w.Close()
+
+			r := newReader(brokers, topic, topic)
+			defer r.Close()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				m, err := r.FetchMessage(ctx)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := r.CommitMessages(ctx, m); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+		})
+	}
+}
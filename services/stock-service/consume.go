@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// messageSource is the part of *kafka.Reader the consumer loop uses.
+type messageSource interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// consumeLoop hands each message of src to process and commits it, until
+// ctx ends. Nothing is fetched while the admin pause or a poison pause is in
+// effect. Commits use drainCtx so the order in hand at shutdown is still
+// committed once processed.
+func consumeLoop(ctx, drainCtx context.Context, src messageSource, poison *poisonHandler, process func(kafka.Message)) {
+	var backoff readBackoff
+	for {
+		if consumer.wait(ctx) != nil || poison.wait(ctx) != nil {
+			slog.Info("context cancelled, stopping kafka consumer")
+			return
+		}
+		m, err := fetchBounded(ctx, src.FetchMessage)
+		if errors.Is(err, errReadIdle) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil || backoff.failed(ctx, err) != nil {
+				slog.Info("context cancelled, stopping kafka consumer")
+				return
+			}
+			continue
+		}
+		backoff.reset()
+		// a pause that arrived while FetchMessage was blocked still holds
+		// back this message until resume; it stays uncommitted meanwhile
+		if consumer.wait(ctx) != nil {
+			slog.Info("context cancelled, stopping kafka consumer")
+			return
+		}
+		// a reconcile in progress holds this back; see replaying
+		replaying.RLock()
+		process(m)
+		consumed.record(m)
+		replaying.RUnlock()
+		// commit only once the order is applied, or parked in the DLQ, so
+		// a crash replays it instead of losing it; see commitInterval
+		if err := src.CommitMessages(drainCtx, m); err != nil {
+			slog.Warn("commit failed", "error", err)
+		}
+	}
+}
+
+// awaitDrain waits for the consumers, whose context was just cancelled, to
+// finish the order in hand. Past drainTimeout or the end of ctx it calls
+// abort to cancel their in-flight writes, then still waits for them to
+// return so nothing writes after the writers close.
+func awaitDrain(ctx context.Context, done <-chan struct{}, drainTimeout time.Duration, abort func()) {
+	t := time.NewTimer(drainTimeout)
+	defer t.Stop()
+	select {
+	case <-done:
+		return
+	case <-t.C:
+		slog.Warn("drain timeout, aborting in-flight writes", "timeout", drainTimeout)
+	case <-ctx.Done():
+		slog.Warn("shutdown timeout, aborting in-flight writes")
+	}
+	abort()
+	<-done
+}
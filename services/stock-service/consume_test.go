@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// chanSource serves FetchMessage from msgs, counting fetches and recording
+// commits.
+type chanSource struct {
+	msgs      chan kafka.Message
+	fetches   atomic.Int64
+	mu        sync.Mutex
+	committed []int64
+}
+
+func newChanSource() *chanSource { return &chanSource{msgs: make(chan kafka.Message)} }
+
+func (s *chanSource) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	s.fetches.Add(1)
+	select {
+	case m := <-s.msgs:
+		return m, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (s *chanSource) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range msgs {
+		s.committed = append(s.committed, m.Offset)
+	}
+	return nil
+}
+
+func (s *chanSource) commits() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.committed)
+}
+
+// runConsumeLoop runs consumeLoop over src until the test ends. Each
+// message is applied by process, or taken as an order for one S1 when
+// process is nil.
+func runConsumeLoop(t *testing.T, src *chanSource, process func(kafka.Message)) {
+	t.Helper()
+	if process == nil {
+		process = func(m kafka.Message) {
+			decrementBatch(string(m.Key), []OrderItem{{SKU: "S1", Qty: 1}})
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		consumeLoop(ctx, context.Background(), src, newPoisonHandler(nil), process)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func withPause(t *testing.T) {
+	t.Helper()
+	consumer.pause()
+	t.Cleanup(consumer.resume)
+}
+
+func stockOf(sku string) int {
+	mu.RLock()
+	defer mu.RUnlock()
+	return inventory[sku]
+}
+
+func waitStock(t *testing.T, sku string, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for stockOf(sku) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s = %d, want %d", sku, stockOf(sku), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestPauseStopsFetching pauses before the loop starts: nothing is fetched
+// or decremented until resume, after which the queued order is applied and
+// committed.
+func TestPauseStopsFetching(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 10})
+	withPause(t)
+	src := newChanSource()
+	runConsumeLoop(t, src, nil)
+
+	time.Sleep(50 * time.Millisecond)
+	if n := src.fetches.Load(); n != 0 {
+		t.Fatalf("%d fetches while paused", n)
+	}
+	consumer.resume()
+	src.msgs <- kafka.Message{Key: []byte("o-1"), Offset: 1}
+	waitStock(t, "S1", 9)
+	if src.commits() != 1 {
+		t.Fatalf("commits = %d, want 1", src.commits())
+	}
+}
+
+// TestPauseHoldsMessageInFlight pauses while FetchMessage is blocked: the
+// message it then returns is neither applied nor committed until resume.
+func TestPauseHoldsMessageInFlight(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 10})
+	src := newChanSource()
+	runConsumeLoop(t, src, nil)
+	for src.fetches.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	withPause(t)
+	src.msgs <- kafka.Message{Key: []byte("o-1"), Offset: 1}
+	time.Sleep(50 * time.Millisecond)
+	if stockOf("S1") != 10 || src.commits() != 0 {
+		t.Fatalf("while paused: S1 = %d, %d commits; want 10 and none", stockOf("S1"), src.commits())
+	}
+	consumer.resume()
+	waitStock(t, "S1", 9)
+}
+
+// TestShutdownDrainsOrderInHand cancels the consumer while the first of an
+// order's three updates is being published. The order finishes and is
+// committed before awaitDrain returns, unless DRAIN_TIMEOUT expires first,
+// in which case the remaining writes see a cancelled context.
+func TestShutdownDrainsOrderInHand(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		release bool
+	}{
+		{"drained", true},
+		{"drain timeout", false},
+	} {
+		setInventory(t, map[string]int{"S1": 10, "S2": 10, "S3": 10})
+		started, release := make(chan struct{}), make(chan struct{})
+		var pubMu sync.Mutex
+		var attempted []string
+		var aborted int
+		ful := &fulfiller{
+			publishUpdate: func(ctx context.Context, upd InventoryUpdated) error {
+				pubMu.Lock()
+				first := len(attempted) == 0
+				attempted = append(attempted, upd.SKU)
+				pubMu.Unlock()
+				if first {
+					close(started)
+					select {
+					case <-release:
+					case <-ctx.Done():
+					}
+				}
+				if ctx.Err() != nil {
+					pubMu.Lock()
+					aborted++
+					pubMu.Unlock()
+				}
+				return ctx.Err()
+			},
+			publishPartial: func(context.Context, OrderPartial) {},
+			publishUnknown: func(context.Context, UnknownSKU) {},
+		}
+
+		src := newChanSource()
+		ctx, cancel := context.WithCancel(context.Background())
+		drainCtx, drainCancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			consumeLoop(ctx, drainCtx, src, newPoisonHandler(nil), func(m kafka.Message) {
+				ful.apply(drainCtx, "o-1", "o-1", []OrderItem{{SKU: "S1", Qty: 1}, {SKU: "S2", Qty: 1}, {SKU: "S3", Qty: 1}}, "", "")
+			})
+		}()
+		src.msgs <- kafka.Message{Key: []byte("o-1"), Offset: 1}
+		<-started
+
+		cancel()
+		if tc.release {
+			time.AfterFunc(20*time.Millisecond, func() { close(release) })
+		}
+		awaitDrain(context.Background(), done, 200*time.Millisecond, drainCancel)
+		drainCancel()
+
+		pubMu.Lock()
+		if len(attempted) != 3 {
+			t.Errorf("%s: updates attempted for %v, want all three items", tc.name, attempted)
+		}
+		wantAborted := 0
+		if !tc.release {
+			wantAborted = 3
+		}
+		if aborted != wantAborted {
+			t.Errorf("%s: %d writes aborted, want %d", tc.name, aborted, wantAborted)
+		}
+		pubMu.Unlock()
+		if src.commits() != 1 {
+			t.Errorf("%s: commits = %d, want the order committed", tc.name, src.commits())
+		}
+	}
+}
+
+// TestIdleReadRechecksPause sets a short READ_TIMEOUT so fetches keep coming
+// back idle. They are retried at once rather than backed off, a pause set
+// between them stops the next fetch, and cancelling ctx ends the loop.
+func TestIdleReadRechecksPause(t *testing.T) {
+	prev := readTimeout
+	readTimeout = 10 * time.Millisecond
+	t.Cleanup(func() { readTimeout = prev })
+	setInventory(t, map[string]int{"S1": 10})
+
+	src := newChanSource()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		consumeLoop(ctx, context.Background(), src, newPoisonHandler(nil), func(m kafka.Message) {
+			decrementBatch(string(m.Key), []OrderItem{{SKU: "S1", Qty: 1}})
+		})
+	}()
+
+	// readBackoff would start at 100ms; idle reads don't wait at all
+	time.Sleep(100 * time.Millisecond)
+	if n := src.fetches.Load(); n < 5 {
+		t.Fatalf("%d fetches in 100ms of idle reads, want them retried without backoff", n)
+	}
+
+	withPause(t)
+	time.Sleep(2 * readTimeout)
+	paused := src.fetches.Load()
+	time.Sleep(5 * readTimeout)
+	if n := src.fetches.Load(); n != paused {
+		t.Fatalf("%d fetches after pausing, want none", n-paused)
+	}
+	consumer.resume()
+	src.msgs <- kafka.Message{Key: []byte("o-idle"), Offset: 1}
+	waitStock(t, "S1", 9)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("loop still running after ctx was cancelled")
+	}
+}
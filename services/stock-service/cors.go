@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// corsOrigins is the parsed CORS_ALLOWED_ORIGINS allowlist. A literal "*"
+// allows any origin; anything else must match the request Origin exactly.
+var corsOrigins = parseOrigins(getenv("CORS_ALLOWED_ORIGINS", "http://localhost:3000"))
+
+func parseOrigins(v string) map[string]bool {
+	out := map[string]bool{}
+	for _, o := range strings.Split(v, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			out[o] = true
+		}
+	}
+	return out
+}
+
+// cors sets the CORS response headers for r and answers preflight requests.
+// It reports true when the request was a preflight and has been fully handled.
+// Origins outside the allowlist get no CORS headers, so browsers block them.
+func cors(w http.ResponseWriter, r *http.Request, methods string) bool {
+	origin := r.Header.Get("Origin")
+	switch {
+	case corsOrigins["*"]:
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	case origin != "" && corsOrigins[origin]:
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+	}
+	if r.Method != http.MethodOptions {
+		return false
+	}
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Methods", methods+", OPTIONS")
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/csv"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// negotiateStockFormat picks the /stock representation from an Accept header:
+// "json" (the default, also for an empty header or wildcards) or "csv". It
+// returns "" when none of the listed media types can be served.
+func negotiateStockFormat(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return "json"
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || params["q"] == "0" {
+			continue
+		}
+		switch mt {
+		case "application/json", "application/*", "*/*":
+			return "json"
+		case "text/csv", "text/*":
+			return "csv"
+		}
+	}
+	return ""
+}
+
+// writeStockCSV writes items as sku,quantity rows under a header row.
+func writeStockCSV(w http.ResponseWriter, items []StockItem) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="stock.csv"`)
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"sku", "quantity"})
+	for _, it := range items {
+		_ = cw.Write([]string{it.SKU, strconv.Itoa(it.Quantity)})
+	}
+	cw.Flush()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func getStock(accept, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/stock"+query, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	handleStock(rec, req)
+	return rec
+}
+
+// TestStockContentNegotiation expects JSON by default and for JSON or
+// wildcard Accept values, sorted sku,quantity CSV for text/csv, and 406 for
+// anything else.
+func TestStockContentNegotiation(t *testing.T) {
+	setInventory(t, map[string]int{"S2": 3, "S1": 5})
+	for _, tc := range []struct {
+		accept string
+		status int
+		ctype  string
+	}{
+		{"", http.StatusOK, "application/json"},
+		{"application/json", http.StatusOK, "application/json"},
+		{"*/*", http.StatusOK, "application/json"},
+		{"text/csv", http.StatusOK, "text/csv; charset=utf-8"},
+		{"application/xml;q=1, text/csv;q=0.5", http.StatusOK, "text/csv; charset=utf-8"},
+		{"text/csv;q=0, application/xml", http.StatusNotAcceptable, ""},
+		{"application/xml", http.StatusNotAcceptable, ""},
+	} {
+		rec := getStock(tc.accept, "")
+		if rec.Code != tc.status {
+			t.Errorf("Accept %q: got %d, want %d", tc.accept, rec.Code, tc.status)
+			continue
+		}
+		if tc.ctype != "" && rec.Header().Get("Content-Type") != tc.ctype {
+			t.Errorf("Accept %q: Content-Type %q, want %q", tc.accept, rec.Header().Get("Content-Type"), tc.ctype)
+		}
+	}
+
+	rec := getStock("text/csv", "")
+	if got, want := rec.Body.String(), "sku,quantity\nS1,5\nS2,3\n"; got != want {
+		t.Fatalf("csv body %q, want %q", got, want)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, `filename="stock.csv"`) {
+		t.Fatalf("Content-Disposition %q", cd)
+	}
+
+	var got map[string]int
+	if err := json.NewDecoder(getStock("application/json", "").Body).Decode(&got); err != nil || got["S1"] != 5 || got["S2"] != 3 || len(got) != 2 {
+		t.Fatalf("json body %v, %v", got, err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// ExportRecord is one line of GET /stock/export.
+type ExportRecord struct {
+	SKU      string `json:"sku"`
+	Quantity int    `json:"quantity"`
+	At       string `json:"at"`
+}
+
+// exportBatch is how many SKUs are read under one lock and flushed together.
+const exportBatch = 500
+
+// handleStockExport streams inventory as NDJSON, one ExportRecord per SKU in
+// SKU order. Quantities are read and flushed a batch at a time, so neither
+// the lock nor the response is held for the whole inventory; At records when
+// each batch was read. A SKU removed mid-export is skipped.
+func handleStockExport(w http.ResponseWriter, r *http.Request) {
+	if cors(w, r, "GET") {
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	mu.RLock()
+	skus := make([]string, 0, len(inventory))
+	for sku := range inventory {
+		skus = append(skus, sku)
+	}
+	mu.RUnlock()
+	sort.Strings(skus)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	for len(skus) > 0 {
+		batch := skus[:min(exportBatch, len(skus))]
+		skus = skus[len(batch):]
+		at := time.Now().UTC().Format(time.RFC3339)
+		records := make([]ExportRecord, 0, len(batch))
+		mu.RLock()
+		for _, sku := range batch {
+			if qty, ok := inventory[sku]; ok {
+				records = append(records, ExportRecord{SKU: sku, Quantity: qty, At: at})
+			}
+		}
+		mu.RUnlock()
+		for _, rec := range records {
+			if err := enc.Encode(rec); err != nil {
+				return // client went away
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
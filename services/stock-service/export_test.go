@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestStockExportNDJSON expects one ExportRecord per line, in SKU order and
+// across batches, served as application/x-ndjson.
+func TestStockExportNDJSON(t *testing.T) {
+	inv := map[string]int{}
+	for i := 0; i < exportBatch+2; i++ {
+		inv[fmt.Sprintf("S%04d", i)] = i
+	}
+	setInventory(t, inv)
+
+	rec := httptest.NewRecorder()
+	handleStockExport(rec, httptest.NewRequest(http.MethodGet, "/stock/export", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("Content-Type %q, want application/x-ndjson", ct)
+	}
+	sc := bufio.NewScanner(bytes.NewReader(rec.Body.Bytes()))
+	n := 0
+	for ; sc.Scan(); n++ {
+		var got ExportRecord
+		dec := json.NewDecoder(bytes.NewReader(sc.Bytes()))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("line %d %q: %v", n+1, sc.Text(), err)
+		}
+		if want := fmt.Sprintf("S%04d", n); got.SKU != want || got.Quantity != n {
+			t.Fatalf("line %d = %+v, want %s with %d", n+1, got, want, n)
+		}
+		if _, err := time.Parse(time.RFC3339, got.At); err != nil {
+			t.Fatalf("line %d at %q: %v", n+1, got.At, err)
+		}
+	}
+	if n != len(inv) {
+		t.Fatalf("%d lines, want %d", n, len(inv))
+	}
+	if !bytes.HasSuffix(rec.Body.Bytes(), []byte("}\n")) {
+		t.Fatal("export does not end with a newline-terminated record")
+	}
+}
+
+func TestStockExportMethod(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleStockExport(rec, httptest.NewRequest(http.MethodPost, "/stock/export", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST got %d, want 405", rec.Code)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// messageWriter is the part of *kafka.Writer the fan-out needs.
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// fanoutWriter publishes every message to each configured topic. Sinks are
+// written concurrently and independently, so a failing analytics topic
+// never holds back inventory.updated.
+type fanoutWriter struct {
+	topics  []string
+	writers []messageWriter
+}
+
+// inventoryTopics reads INVENTORY_TOPICS, falling back to the single
+// primary topic when it is unset.
+func inventoryTopics(primary string) []string {
+	var topics []string
+	for _, t := range strings.Split(getenv("INVENTORY_TOPICS", primary), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			topics = append(topics, t)
+		}
+	}
+	return topics
+}
+
+func newFanoutWriter(brokers []string, topics []string) *fanoutWriter {
+	f := &fanoutWriter{topics: topics}
+	for _, t := range topics {
+		f.writers = append(f.writers, newWriter(brokers, t))
+	}
+	return f
+}
+
+// WriteMessages writes msgs to every topic and joins the per-topic errors.
+// A non-nil error means at least one sink failed; the others still got the
+// messages.
+func (f *fanoutWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	errs := make([]error, len(f.writers))
+	var wg sync.WaitGroup
+	for i, w := range f.writers {
+		wg.Add(1)
+		go func(i int, w messageWriter) {
+			defer wg.Done()
+			if err := w.WriteMessages(ctx, msgs...); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", f.topics[i], err)
+			}
+		}(i, w)
+	}
+	wg.Wait()
+
+	err := errors.Join(errs...)
+	if err != nil && len(f.writers) > 1 {
+		var ok []string
+		for i, e := range errs {
+			if e == nil {
+				ok = append(ok, f.topics[i])
+			} else {
+				slog.Error("fan-out write failed", "topic", f.topics[i], "error", e)
+			}
+		}
+		slog.Warn("fan-out partially succeeded", "written", ok, "topics", len(f.topics))
+	}
+	return err
+}
+
+func (f *fanoutWriter) Close() error {
+	var errs []error
+	for i, w := range f.writers {
+		if err := w.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.topics[i], err))
+		}
+	}
+	return errors.Join(errs...)
+}
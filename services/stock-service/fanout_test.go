@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// sinkWriter records what it is given, or fails with err after waiting for
+// ctx when hang is set.
+type sinkWriter struct {
+	mu   sync.Mutex
+	got  []kafka.Message
+	err  error
+	hang bool
+}
+
+func (s *sinkWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if s.hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if s.err != nil {
+		return s.err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.got = append(s.got, msgs...)
+	return nil
+}
+
+func (s *sinkWriter) Close() error { return nil }
+
+func (s *sinkWriter) written() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.got)
+}
+
+// TestFanoutFailingSinkLeavesOthers writes to inventory.updated and an
+// analytics topic whose writer fails, either at once or by hanging until
+// the deadline. The primary topic still gets the message and the error
+// names only the failing topic.
+func TestFanoutFailingSinkLeavesOthers(t *testing.T) {
+	refused := errors.New("analytics down")
+	for _, tc := range []struct {
+		name    string
+		failing *sinkWriter
+		want    error
+	}{
+		{"error", &sinkWriter{err: refused}, refused},
+		{"hang", &sinkWriter{hang: true}, context.DeadlineExceeded},
+	} {
+		primary := &sinkWriter{}
+		f := &fanoutWriter{topics: []string{"inventory.updated", "inventory.analytics"}, writers: []messageWriter{primary, tc.failing}}
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		err := f.WriteMessages(ctx, kafka.Message{Key: []byte("S1"), Value: []byte(`{}`)})
+		cancel()
+
+		if primary.written() != 1 {
+			t.Errorf("%s: primary got %d messages, want 1", tc.name, primary.written())
+		}
+		if !errors.Is(err, tc.want) || !strings.Contains(err.Error(), "inventory.analytics") || strings.Contains(err.Error(), "inventory.updated") {
+			t.Errorf("%s: err = %v, want %v for inventory.analytics only", tc.name, err, tc.want)
+		}
+	}
+
+	primary, analytics := &sinkWriter{}, &sinkWriter{}
+	f := &fanoutWriter{topics: []string{"inventory.updated", "inventory.analytics"}, writers: []messageWriter{primary, analytics}}
+	if err := f.WriteMessages(context.Background(), kafka.Message{Key: []byte("S1")}); err != nil || primary.written() != 1 || analytics.written() != 1 {
+		t.Fatalf("both healthy: err %v, written %d and %d", err, primary.written(), analytics.written())
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestFetchTuningFromEnv(t *testing.T) {
+	t.Setenv("FETCH_MIN_BYTES", "1024")
+	t.Setenv("FETCH_MAX_BYTES", "2048")
+	t.Setenv("MAX_WAIT", "250ms")
+	cfg := withFetchTuning(kafka.ReaderConfig{Topic: "orders"})
+	if cfg.MinBytes != 1024 || cfg.MaxBytes != 2048 || cfg.MaxWait != 250*time.Millisecond {
+		t.Fatalf("got min %d max %d wait %s", cfg.MinBytes, cfg.MaxBytes, cfg.MaxWait)
+	}
+
+	t.Setenv("FETCH_MIN_BYTES", "4096")
+	t.Setenv("MAX_WAIT", "soon")
+	cfg = withFetchTuning(kafka.ReaderConfig{})
+	if cfg.MinBytes != 2048 || cfg.MaxWait != 10*time.Second {
+		t.Fatalf("min %d wait %s; want min capped at max and the default wait", cfg.MinBytes, cfg.MaxWait)
+	}
+}
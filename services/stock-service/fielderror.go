@@ -0,0 +1,41 @@
+package main
+
+// Reasons a /seed or /stock/import entry is rejected, in FieldError.Code.
+const (
+	ReasonInvalidSKU       = "invalid_sku"
+	ReasonNegativeQuantity = "negative_quantity"
+	ReasonMissingQuantity  = "missing_quantity"
+	ReasonParseError       = "parse_error"
+	ReasonDuplicateSKU     = "duplicate_sku"
+)
+
+// FieldError explains why one entry of a /seed or /stock/import payload was
+// rejected. Line is set for import lines (1-based); SKU and Quantity echo
+// the entry when it could be parsed.
+type FieldError struct {
+	Line     int    `json:"line,omitempty"`
+	SKU      string `json:"sku,omitempty"`
+	Quantity *int   `json:"quantity,omitempty"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+}
+
+// ValidationErrorBody is the 400 body of a rejected /seed or /stock/import.
+type ValidationErrorBody struct {
+	Error  string       `json:"error"`
+	Errors []FieldError `json:"errors"`
+}
+
+// checkEntry validates one sku/quantity pair, returning nil if it may be
+// applied. line is 0 for /seed, which has no lines.
+func checkEntry(line int, sku string, qty *int) *FieldError {
+	switch {
+	case !seedSKUPattern.MatchString(sku):
+		return &FieldError{Line: line, SKU: sku, Quantity: qty, Code: ReasonInvalidSKU, Message: "sku does not match " + seedSKUPattern.String()}
+	case qty == nil:
+		return &FieldError{Line: line, SKU: sku, Code: ReasonMissingQuantity, Message: "quantity is required"}
+	case *qty < 0:
+		return &FieldError{Line: line, SKU: sku, Quantity: qty, Code: ReasonNegativeQuantity, Message: "quantity must be >= 0"}
+	}
+	return nil
+}
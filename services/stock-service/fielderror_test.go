@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func postSeed(t *testing.T, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/seed", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	seedHandler(func(context.Context) {})(rec, req)
+	var got map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("body %s: %v", rec.Body, err)
+	}
+	return rec.Code, got
+}
+
+// TestSeedErrorBodyShape rejects one entry of each class in a single seed
+// and checks the FieldError list, sorted by SKU.
+func TestSeedErrorBodyShape(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 10})
+	code, got := postSeed(t, `{"S1":-1,"bad sku":2," s2 ":1,"S2":3}`)
+	want := map[string]interface{}{
+		"error": "invalid seed, nothing applied",
+		"errors": []interface{}{
+			map[string]interface{}{"sku": "BAD SKU", "quantity": 2.0, "code": ReasonInvalidSKU, "message": "sku does not match " + seedSKUPattern.String()},
+			map[string]interface{}{"sku": "S1", "quantity": -1.0, "code": ReasonNegativeQuantity, "message": "quantity must be >= 0"},
+			map[string]interface{}{"sku": "S2", "code": ReasonDuplicateSKU, "message": "more than one key normalizes to S2"},
+		},
+	}
+	if code != http.StatusBadRequest || !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %d %v\nwant 400 %v", code, got, want)
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	if inventory["S1"] != 10 {
+		t.Fatalf("S1 = %d, want 10 untouched", inventory["S1"])
+	}
+}
+
+func TestSeedParseErrorBody(t *testing.T) {
+	code, got := postSeed(t, `{"S1":`)
+	errs, _ := got["errors"].([]interface{})
+	if code != http.StatusBadRequest || len(errs) != 1 {
+		t.Fatalf("got %d %v", code, got)
+	}
+	fe := errs[0].(map[string]interface{})
+	if fe["code"] != ReasonParseError || fe["message"] == "" {
+		t.Fatalf("error %v, want parse_error with a message", fe)
+	}
+}
+
+func TestImportMissingQuantityBody(t *testing.T) {
+	setInventory(t, map[string]int{})
+	_, summary, _ := postImport(t, "{\"sku\":\"S1\",\"quantity\":1}\n{\"sku\":\"S2\"}\n")
+	want := []FieldError{{Line: 2, SKU: "S2", Code: ReasonMissingQuantity, Message: "quantity is required"}}
+	if !reflect.DeepEqual(summary.Errors, want) {
+		t.Fatalf("errors %+v, want %+v", summary.Errors, want)
+	}
+}
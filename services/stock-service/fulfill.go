@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// fulfiller applies orders and amendments to inventory and publishes what
+// changed through its hooks.
+type fulfiller struct {
+	publishUpdate  func(context.Context, InventoryUpdated) error
+	publishPartial func(context.Context, OrderPartial)
+	publishUnknown func(context.Context, UnknownSKU)
+}
+
+// apply takes items off inventory for orderID and publishes the resulting
+// InventoryUpdated events; a negative quantity puts stock back. Items whose
+// update could not be published are reported in one OrderPartial. key
+// identifies the order or amendment in applied: a redelivered one is
+// skipped, with nothing published.
+func (f *fulfiller) apply(ctx context.Context, key, orderID string, items []OrderItem, evTime, correlationID string) {
+	// hold the order's SKU locks across decrement and publish; see ordering.go
+	start := time.Now()
+	normalizeItems(items)
+	skus, deltas := orderDeltas(items)
+	unlock := perSKU.lockAll(skus)
+	newQty, ok := decrementOnce(key, orderID, items)
+	if !ok {
+		unlock()
+		slog.Info("skipping already applied order", "order", orderID, "key", key)
+		observeFulfill("duplicate", start)
+		return
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	outcome := "ok"
+	result := OrderPartial{OrderID: orderID, EventTime: evTime, ProcessedAt: now}
+	for _, sku := range skus {
+		if _, ok := newQty[sku]; !ok {
+			f.publishUnknown(ctx, UnknownSKU{OrderID: orderID, SKU: sku, Qty: deltas[sku], EventTime: evTime, ProcessedAt: now})
+			outcome = "unknown_sku"
+			continue
+		}
+		upd := InventoryUpdated{SKU: sku, Delta: -deltas[sku], NewQuantity: newQty[sku], OrderID: orderID, EventTime: evTime, ProcessedAt: now, CorrelationID: correlationID, UpdatedAt: now}
+		result.record(PartialItem{SKU: sku, Delta: upd.Delta, NewQuantity: upd.NewQuantity}, f.publishUpdate(ctx, upd))
+	}
+	if len(result.Failed) > 0 {
+		outcome = "publish_error"
+		f.publishPartial(ctx, result)
+	}
+	unlock()
+	observeFulfill(outcome, start)
+}
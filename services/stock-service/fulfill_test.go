@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// TestPartialPublishReportsFailedItems fails the second of three updates and
+// expects one OrderPartial naming it, with every decrement kept.
+func TestPartialPublishReportsFailedItems(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 10, "S2": 10, "S3": 10})
+	var published []string
+	var partials []OrderPartial
+	f := &fulfiller{
+		publishUpdate: func(_ context.Context, upd InventoryUpdated) error {
+			if upd.SKU == "S2" {
+				return errors.New("broker unavailable")
+			}
+			published = append(published, upd.SKU)
+			return nil
+		},
+		publishPartial: func(_ context.Context, p OrderPartial) { partials = append(partials, p) },
+		publishUnknown: func(context.Context, UnknownSKU) {},
+	}
+	f.apply(context.Background(), "o-1", "o-1", []OrderItem{{SKU: "S1", Qty: 1}, {SKU: "S2", Qty: 2}, {SKU: "S3", Qty: 3}}, "", "")
+
+	if len(published) != 2 || published[0] != "S1" || published[1] != "S3" {
+		t.Fatalf("published %v, want S3 still attempted after S2 failed", published)
+	}
+	if len(partials) != 1 {
+		t.Fatalf("%d partial events, want 1", len(partials))
+	}
+	p := partials[0]
+	if len(p.Failed) != 1 || p.Failed[0].SKU != "S2" || p.Failed[0].Error == "" || len(p.Succeeded) != 2 {
+		t.Fatalf("partial %+v, want S2 failed and S1, S3 succeeded", p)
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	if inventory["S1"] != 9 || inventory["S2"] != 8 || inventory["S3"] != 7 {
+		t.Fatalf("inventory %v, want every decrement kept", inventory)
+	}
+}
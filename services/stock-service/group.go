@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// groupID returns GROUP_ID (default def), suffixed "-<GROUP_ID_SUFFIX>" when
+// that is set to give an instance a group of its own.
+func groupID(def string) string {
+	group := getenv("GROUP_ID", def)
+	if suffix := getenv("GROUP_ID_SUFFIX", ""); suffix != "" {
+		group += "-" + suffix
+		slog.Warn("GROUP_ID_SUFFIX set: this instance has its own consumer group and processes every message, independently of other replicas", "group", group)
+	}
+	return group
+}
+
+// groupTimeouts reads SESSION_TIMEOUT (30s), HEARTBEAT_INTERVAL (3s) and
+// REBALANCE_TIMEOUT (30s); a heartbeat not shorter than the session resets
+// both to their defaults.
+func groupTimeouts() (session, heartbeat, rebalance time.Duration) {
+	session = envDuration("SESSION_TIMEOUT", 30*time.Second)
+	heartbeat = envDuration("HEARTBEAT_INTERVAL", 3*time.Second)
+	rebalance = envDuration("REBALANCE_TIMEOUT", 30*time.Second)
+	if heartbeat >= session {
+		slog.Warn("HEARTBEAT_INTERVAL must be shorter than SESSION_TIMEOUT, using 3s and 30s", "heartbeat", heartbeat, "session", session)
+		session, heartbeat = 30*time.Second, 3*time.Second
+	}
+	return session, heartbeat, rebalance
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(getenv(key, def.String()))
+	if err != nil || d <= 0 {
+		slog.Warn("invalid duration, using the default", "key", key, "default", def)
+		return def
+	}
+	return d
+}
+
+// withGroupTuning applies groupTimeouts to a consumer group reader config.
+func withGroupTuning(cfg kafka.ReaderConfig) kafka.ReaderConfig {
+	cfg.SessionTimeout, cfg.HeartbeatInterval, cfg.RebalanceTimeout = groupTimeouts()
+	return cfg
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// stockHistory keeps the latest STOCK_HISTORY_RETAIN quantity changes
+// (default 1000) per SKU, so a busy SKU cannot push a quiet one's history out
+// the way it would in the shared audit log. It is fed by auditLog.record and
+// read by GET /stock/diff.
+type stockHistory struct {
+	mu      sync.Mutex
+	retain  int
+	samples map[string][]stockSample
+}
+
+type stockSample struct {
+	at    time.Time
+	delta int
+}
+
+var history = &stockHistory{retain: func() int {
+	if n, err := strconv.Atoi(getenv("STOCK_HISTORY_RETAIN", "1000")); err == nil && n > 0 {
+		return n
+	}
+	return 1000
+}(), samples: map[string][]stockSample{}}
+
+func (h *stockHistory) record(sku string, delta int, at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := append(h.samples[sku], stockSample{at: at, delta: delta})
+	if len(s) > h.retain {
+		s = s[len(s)-h.retain:]
+	}
+	h.samples[sku] = s
+}
+
+// StockDiff is one SKU's net quantity change since a point in time.
+// Truncated is set when older changes inside the window have already been
+// dropped from the history, so NetChange and Updates are lower bounds.
+type StockDiff struct {
+	NetChange int  `json:"netChange"`
+	Updates   int  `json:"updates"`
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// diff returns the change of every SKU updated at or after since.
+func (h *stockHistory) diff(since time.Time) map[string]StockDiff {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := map[string]StockDiff{}
+	for sku, samples := range h.samples {
+		var d StockDiff
+		for _, s := range samples {
+			if s.at.Before(since) {
+				continue
+			}
+			d.NetChange += s.delta
+			d.Updates++
+		}
+		if d.Updates == 0 {
+			continue
+		}
+		d.Truncated = len(samples) == h.retain && !samples[0].at.Before(since)
+		out[sku] = d
+	}
+	return out
+}
+
+// handleStockDiff serves GET /stock/diff?since=<rfc3339>: per SKU, the net
+// change and number of updates since then. "What sold in the last hour" is
+// the negative net changes for since one hour ago.
+func handleStockDiff(w http.ResponseWriter, r *http.Request) {
+	if cors(w, r, "GET") {
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	since, err := time.Parse(time.RFC3339, r.URL.Query().Get("since"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "since is required and must be an RFC 3339 time"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"since": since.UTC().Format(time.RFC3339), "skus": history.diff(since)})
+}
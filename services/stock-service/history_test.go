@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func withHistory(t *testing.T, retain int) *stockHistory {
+	t.Helper()
+	prev := history
+	history = &stockHistory{retain: retain, samples: map[string][]stockSample{}}
+	t.Cleanup(func() { history = prev })
+	return history
+}
+
+// TestStockDiffReflectsDecrements applies two orders and expects /stock/diff
+// to report what they took, and nothing for a since after them.
+func TestStockDiffReflectsDecrements(t *testing.T) {
+	withHistory(t, 100)
+	setInventory(t, map[string]int{"S1": 10, "S2": 5, "S3": 7})
+	before := time.Now().Add(-time.Second)
+	decrementBatch("o-1", []OrderItem{{SKU: "S1", Qty: 2}, {SKU: "S2", Qty: 1}})
+	decrementBatch("o-2", []OrderItem{{SKU: "S1", Qty: 3}})
+
+	get := func(since time.Time) map[string]StockDiff {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handleStockDiff(rec, httptest.NewRequest(http.MethodGet, "/stock/diff?since="+since.UTC().Format(time.RFC3339), nil))
+		var body struct {
+			SKUs map[string]StockDiff `json:"skus"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); rec.Code != http.StatusOK || err != nil {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		return body.SKUs
+	}
+	got := get(before)
+	if got["S1"] != (StockDiff{NetChange: -5, Updates: 2}) || got["S2"] != (StockDiff{NetChange: -1, Updates: 1}) {
+		t.Fatalf("diff %+v", got)
+	}
+	if _, ok := got["S3"]; ok {
+		t.Fatalf("untouched S3 in diff %+v", got)
+	}
+	if got := get(time.Now().Add(time.Hour)); len(got) != 0 {
+		t.Fatalf("diff after the orders %+v, want none", got)
+	}
+}
+
+func TestStockDiffTruncated(t *testing.T) {
+	h := withHistory(t, 2)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		h.record("S1", -1, now.Add(time.Duration(i)*time.Second))
+	}
+	if d := h.diff(now.Add(-time.Minute))["S1"]; d != (StockDiff{NetChange: -2, Updates: 2, Truncated: true}) {
+		t.Fatalf("diff %+v, want the two retained changes marked truncated", d)
+	}
+	if d := h.diff(now.Add(1500 * time.Millisecond))["S1"]; d != (StockDiff{NetChange: -1, Updates: 1}) {
+		t.Fatalf("diff %+v, want the last change only", d)
+	}
+}
+
+func TestStockDiffRequiresSince(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleStockDiff(rec, httptest.NewRequest(http.MethodGet, "/stock/diff", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// ImportSummary is the body of a POST /stock/import response. Skipped counts
+// blank lines; Errors lists every rejected line, in which case nothing was
+// imported.
+type ImportSummary struct {
+	Imported int          `json:"imported"`
+	Skipped  int          `json:"skipped"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// maxImportBytes caps an import body (MAX_IMPORT_BYTES, default 32MB); it is
+// separate from MAX_BODY_BYTES because a full inventory is much larger than
+// any other request.
+var maxImportBytes = func() int64 {
+	n, err := strconv.ParseInt(getenv("MAX_IMPORT_BYTES", "33554432"), 10, 64)
+	if err != nil || n <= 0 {
+		return 32 << 20
+	}
+	return n
+}()
+
+// parseImport reads NDJSON records in the GET /stock/export format, one per
+// line; at is accepted and ignored. A SKU listed twice takes its last
+// quantity. Every line is checked before anything is applied, so the
+// returned errors cover the whole input.
+func parseImport(body io.Reader) (map[string]int, ImportSummary, error) {
+	var summary ImportSummary
+	records := map[string]int{}
+	sc := bufio.NewScanner(body)
+	for line := 1; sc.Scan(); line++ {
+		raw := bytes.TrimSpace(sc.Bytes())
+		if len(raw) == 0 {
+			summary.Skipped++
+			continue
+		}
+		var rec struct {
+			SKU      string  `json:"sku"`
+			Quantity *int    `json:"quantity"`
+			At       *string `json:"at"`
+		}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&rec); err != nil {
+			summary.Errors = append(summary.Errors, FieldError{Line: line, Code: ReasonParseError, Message: err.Error()})
+			continue
+		}
+		rec.SKU = normalizeSKU(rec.SKU)
+		if fe := checkEntry(line, rec.SKU, rec.Quantity); fe != nil {
+			summary.Errors = append(summary.Errors, *fe)
+			continue
+		}
+		records[rec.SKU] = *rec.Quantity
+		summary.Imported++
+	}
+	return records, summary, sc.Err()
+}
+
+// importHandler serves POST /stock/import. The import is all or nothing: any
+// invalid line rejects it with 400, otherwise every record is applied under
+// one lock and a snapshot is published.
+func importHandler(publishSnapshot func(context.Context)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/x-ndjson" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "Content-Type must be application/x-ndjson"})
+			return
+		}
+		records, summary, err := parseImport(http.MaxBytesReader(w, r.Body, maxImportBytes))
+		if err != nil {
+			status := http.StatusBadRequest
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			w.WriteHeader(status)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "read failed: " + err.Error()})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if len(summary.Errors) > 0 {
+			summary.Imported = 0
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(summary)
+			return
+		}
+		seedInventory(records, false)
+		publishSnapshot(r.Context())
+		_ = json.NewEncoder(w).Encode(summary)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func postImport(t *testing.T, body string) (*httptest.ResponseRecorder, ImportSummary, int) {
+	t.Helper()
+	snapshots := 0
+	h := importHandler(func(context.Context) { snapshots++ })
+	req := httptest.NewRequest(http.MethodPost, "/stock/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	var summary ImportSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("status %d, body %s: %v", rec.Code, rec.Body, err)
+	}
+	return rec, summary, snapshots
+}
+
+func TestImportAppliesValidInput(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 10})
+	rec, summary, snapshots := postImport(t, "{\"sku\":\"S1\",\"quantity\":3}\n\n{\"sku\":\"S2\",\"quantity\":7,\"at\":\"2024-01-01T00:00:00Z\"}\n")
+	if rec.Code != http.StatusOK || summary.Imported != 2 || summary.Skipped != 1 || len(summary.Errors) != 0 || snapshots != 1 {
+		t.Fatalf("status %d, summary %+v, snapshots %d", rec.Code, summary, snapshots)
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	if inventory["S1"] != 3 || inventory["S2"] != 7 {
+		t.Fatalf("inventory %v, want S1=3 S2=7", inventory)
+	}
+}
+
+// TestImportRejectsPartiallyInvalidInput checks that one bad record rejects
+// the whole import, naming its line, and leaves inventory untouched.
+func TestImportRejectsPartiallyInvalidInput(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 10})
+	rec, summary, snapshots := postImport(t, "{\"sku\":\"S1\",\"quantity\":3}\n{\"sku\":\"S2\",\"quantity\":-1}\n")
+	if rec.Code != http.StatusBadRequest || summary.Imported != 0 || snapshots != 0 {
+		t.Fatalf("status %d, summary %+v, snapshots %d; want 400 and nothing imported", rec.Code, summary, snapshots)
+	}
+	if len(summary.Errors) != 1 || summary.Errors[0].Line != 2 || summary.Errors[0].Code != ReasonNegativeQuantity {
+		t.Fatalf("errors %+v, want negative_quantity on line 2", summary.Errors)
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	if inventory["S1"] != 10 {
+		t.Fatalf("S1 = %d, want 10 untouched", inventory["S1"])
+	}
+}
+
+func TestImportRejectsMalformedLine(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 10})
+	rec, summary, _ := postImport(t, "{\"sku\":\"S1\",\"quantity\":3}\n{\"sku\":\"S2\",\n{\"sku\":\"S3\",\"qty\":1}\n")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", rec.Code)
+	}
+	if len(summary.Errors) != 2 || summary.Errors[0].Line != 2 || summary.Errors[0].Code != ReasonParseError ||
+		summary.Errors[1].Line != 3 || summary.Errors[1].Code != ReasonParseError {
+		t.Fatalf("errors %+v, want parse_error on lines 2 and 3", summary.Errors)
+	}
+}
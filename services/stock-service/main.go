@@ -3,17 +3,27 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/segmentio/kafka-go"
+
+	"kafka-microservice/services/stock-service/codec"
+	"kafka-microservice/services/stock-service/logging"
+	"kafka-microservice/services/stock-service/schema"
 )
 
 type OrderItem struct {
@@ -21,17 +31,61 @@ type OrderItem struct {
 	Qty int    `json:"qty"`
 }
 type OrderCreated struct {
-	OrderID string      `json:"orderId"`
-	Items   []OrderItem `json:"items"`
+	OrderID   string      `json:"orderId"`
+	Items     []OrderItem `json:"items"`
+	CreatedAt string      `json:"createdAt"`
+
+	CorrelationID string `json:"correlationId,omitempty"`
+}
+
+// OrderAmended changes the quantities of an order still PENDING; it reaches
+// stock-service only once orders-processor has accepted it. Deltas is the
+// per-SKU change, positive for units added, so a negative delta puts stock
+// back. Version counts the order's amendments; see amendmentKey.
+type OrderAmended struct {
+	OrderID   string      `json:"orderId"`
+	Deltas    []OrderItem `json:"deltas"`
+	Version   int         `json:"version,omitempty"`
+	AmendedAt string      `json:"amendedAt"`
+
+	CorrelationID string `json:"correlationId,omitempty"`
+}
+
+// UnknownSKU is published to UNKNOWN_SKU_TOPIC (default
+// inventory.unknown_sku) for each order line whose SKU has no inventory
+// entry; that line is not decremented.
+type UnknownSKU struct {
+	OrderID     string `json:"orderId"`
+	SKU         string `json:"sku"`
+	Qty         int    `json:"qty"`
+	EventTime   string `json:"eventTime,omitempty"`
+	ProcessedAt string `json:"processedAt"`
 }
+
+// InventoryUpdated carries the triggering order's creation time as
+// EventTime alongside ProcessedAt (and UpdatedAt), when the decrement ran.
 type InventoryUpdated struct {
 	SKU         string `json:"sku"`
 	Delta       int    `json:"delta"`
 	NewQuantity int    `json:"newQuantity"`
 	OrderID     string `json:"orderId"`
-	UpdatedAt   string `json:"updatedAt"`
+	EventTime   string `json:"eventTime,omitempty"`
+	ProcessedAt string `json:"processedAt,omitempty"`
+	// CorrelationID is copied from the triggering order, see correlationOf
+	CorrelationID string `json:"correlationId,omitempty"`
+	UpdatedAt     string `json:"updatedAt"`
+}
+
+// InventorySnapshot carries the full inventory so a consumer starting from
+// scratch can bootstrap without calling /stock. It is always keyed by
+// snapshotKey, so a compacted topic retains just the latest one.
+type InventorySnapshot struct {
+	Inventory map[string]int `json:"inventory"`
+	At        string         `json:"at"`
 }
 
+const snapshotKey = "inventory"
+
 func getenv(key, def string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -39,128 +93,648 @@ func getenv(key, def string) string {
 	return def
 }
 func newReader(brokers []string, topic, group string) *kafka.Reader {
-	return kafka.NewReader(kafka.ReaderConfig{
+	return kafka.NewReader(withGroupTuning(withFetchTuning(withReaderLogging(kafka.ReaderConfig{
 		Brokers:     brokers,
 		GroupID:     group,
 		Topic:       topic,
-		MinBytes:    1,
-		MaxBytes:    10e6,
-		StartOffset: kafka.LastOffset,
-	})
+		StartOffset: startOffset(),
+
+		CommitInterval: commitInterval(),
+
+		GroupBalancers: groupBalancers(),
+	}))))
+}
+
+// startOffset maps START_OFFSET (first|last, default last) onto where a new
+// consumer group begins reading. Groups with committed offsets resume from
+// those regardless of this setting.
+func startOffset() int64 {
+	switch v := getenv("START_OFFSET", "last"); v {
+	case "first":
+		slog.Info("new consumer groups start from the first offset")
+		return kafka.FirstOffset
+	case "last":
+		slog.Info("new consumer groups start from the last offset")
+		return kafka.LastOffset
+	default:
+		slog.Warn("unknown START_OFFSET, using last", "value", v)
+		return kafka.LastOffset
+	}
+}
+
+// groupBalancers maps GROUP_BALANCER onto the partition assignment strategy.
+// Unset keeps kafka-go's default (range, then round-robin); rackaware prefers
+// partitions whose leader shares this consumer's RACK_ID.
+func groupBalancers() []kafka.GroupBalancer {
+	switch v := getenv("GROUP_BALANCER", ""); v {
+	case "":
+		return nil
+	case "range":
+		return []kafka.GroupBalancer{kafka.RangeGroupBalancer{}}
+	case "roundrobin":
+		return []kafka.GroupBalancer{kafka.RoundRobinGroupBalancer{}}
+	case "rackaware":
+		return []kafka.GroupBalancer{kafka.RackAffinityGroupBalancer{Rack: getenv("RACK_ID", "")}}
+	default:
+		slog.Warn("unknown GROUP_BALANCER, using default", "value", v)
+		return nil
+	}
 }
 func newWriter(brokers []string, topic string) *kafka.Writer {
-	return &kafka.Writer{Addr: kafka.TCP(brokers...), Topic: topic, Balancer: &kafka.Hash{}}
+	return withWriterLogging(&kafka.Writer{Addr: kafka.TCP(brokers...), Topic: topic, Balancer: &kafka.Hash{}, Compression: compression(), RequiredAcks: requiredAcks()})
+}
+
+// compression maps COMPRESSION onto the writer codec. Compressing trades CPU on
+// both producer and consumer for smaller batches on the wire and on the broker:
+// snappy and lz4 are cheap and suit small JSON events, gzip and zstd shrink
+// further at noticeably higher CPU cost. Readers decompress transparently.
+func compression() kafka.Compression {
+	switch v := getenv("COMPRESSION", "snappy"); v {
+	case "none":
+		return 0
+	case "gzip":
+		return kafka.Gzip
+	case "snappy":
+		return kafka.Snappy
+	case "lz4":
+		return kafka.Lz4
+	case "zstd":
+		return kafka.Zstd
+	default:
+		slog.Warn("unknown COMPRESSION, using snappy", "value", v)
+		return kafka.Snappy
+	}
+}
+
+// requiredAcks maps PRODUCE_ACKS onto how many replicas must confirm a write
+// before it returns. all (the default) waits for every in-sync replica, so an
+// acknowledged event survives losing the leader, at the cost of a replication
+// round trip on every write; one returns once the leader has it, trading that
+// latency for losing writes the leader had not yet replicated; none does not
+// wait at all and surfaces no broker-side errors.
+func requiredAcks() kafka.RequiredAcks {
+	switch v := getenv("PRODUCE_ACKS", "all"); v {
+	case "none":
+		return kafka.RequireNone
+	case "one":
+		return kafka.RequireOne
+	case "all":
+		return kafka.RequireAll
+	default:
+		slog.Warn("unknown PRODUCE_ACKS, using all", "value", v)
+		return kafka.RequireAll
+	}
+}
+
+// sendToDLQ forwards a message that could not be processed to the dead-letter
+// topic, keeping its key and recording why it was rejected in headers.
+func sendToDLQ(ctx context.Context, w *kafka.Writer, m kafka.Message, reason error) {
+	headers := append(m.Headers,
+		kafka.Header{Key: "x-error", Value: []byte(reason.Error())},
+		kafka.Header{Key: "x-original-topic", Value: []byte(m.Topic)},
+	)
+	if err := w.WriteMessages(ctx, kafka.Message{Key: m.Key, Value: m.Value, Headers: headers}); err != nil {
+		slog.Error("dlq write failed", "error", err)
+	}
 }
 
 var (
 	mu         sync.RWMutex
 	inventory  = map[string]int{"S1": 50, "S2": 30, "S3": 25, "S4": 15}
 	kafkaReady int64 // 0 = not ready, 1 = ready
+	consumer   pauseGate
+	perSKU     skuLocks
 )
 
-func decrement(sku string, qty int) int {
+// ensureCompactedTopic creates topic with cleanup.policy=compact if it does not
+// exist yet. Existing topics are left untouched.
+func ensureCompactedTopic(brokers []string, topic string) error {
+	cc, err := dialController(brokers)
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+	return cc.CreateTopics(kafka.TopicConfig{
+		Topic:             topic,
+		NumPartitions:     1,
+		ReplicationFactor: 1,
+		ConfigEntries:     []kafka.ConfigEntry{{ConfigName: "cleanup.policy", ConfigValue: "compact"}},
+	})
+}
+
+func snapshotInventory() map[string]int {
+	mu.RLock()
+	defer mu.RUnlock()
+	out := make(map[string]int, len(inventory))
+	for k, v := range inventory {
+		out[k] = v
+	}
+	return out
+}
+
+// decrementBatch applies every item of an order under a single acquisition
+// of mu, so readers never see the order half applied. Quantities for a SKU
+// listed more than once are summed; the result maps each SKU to its new
+// quantity. SKUs missing from inventory are skipped rather than driven
+// negative from zero, and are absent from the result.
+func decrementBatch(orderID string, items []OrderItem) map[string]int {
+	mu.Lock()
+	defer mu.Unlock()
+	return decrementLocked(orderID, items)
+}
+
+// decrementOnce is decrementBatch for the order or amendment identified by
+// key, reporting false and changing nothing if key was already applied.
+// Marking key and decrementing under one hold of mu keeps a snapshot from
+// recording one without the other.
+func decrementOnce(key, orderID string, items []OrderItem) (map[string]int, bool) {
 	mu.Lock()
 	defer mu.Unlock()
-	inventory[sku] = inventory[sku] - qty
-	return inventory[sku]
+	if !applied.add(key) {
+		return nil, false
+	}
+	return decrementLocked(orderID, items), true
+}
+
+// decrementLocked is decrementBatch for a caller already holding mu.
+func decrementLocked(orderID string, items []OrderItem) map[string]int {
+	out := make(map[string]int, len(items))
+	for _, it := range items {
+		if _, ok := inventory[it.SKU]; !ok {
+			continue
+		}
+		inventory[it.SKU] -= it.Qty
+		out[it.SKU] = inventory[it.SKU]
+		audit.record(it.SKU, -it.Qty, inventory[it.SKU], auditSourceOrder, orderID)
+		if floor := safetyStock[it.SKU]; floor > 0 && inventory[it.SKU] < floor {
+			// orders-api checks against available stock, so this only
+			// happens when orders race past a stale stock check
+			slog.Warn("order took stock below its safety floor", "order", orderID, "sku", it.SKU, "quantity", inventory[it.SKU], "floor", floor)
+		}
+	}
+	return out
+}
+
+// StockItem is one SKU on a /stock page. Quantity is on hand; Available is
+// what is left for orders above SafetyStock.
+type StockItem struct {
+	SKU         string `json:"sku"`
+	Quantity    int    `json:"quantity"`
+	SafetyStock int    `json:"safetyStock,omitempty"`
+	Available   int    `json:"available"`
+}
+
+// listStock returns one page of SKUs matching prefix, sorted by SKU so that
+// paging is deterministic, along with the total number of matches.
+func listStock(prefix string, limit, offset int) ([]StockItem, int) {
+	mu.RLock()
+	defer mu.RUnlock()
+	skus := make([]string, 0, len(inventory))
+	for sku := range inventory {
+		if strings.HasPrefix(sku, prefix) {
+			skus = append(skus, sku)
+		}
+	}
+	sort.Strings(skus)
+	total := len(skus)
+	// offset may be anything up to MaxInt; add limit to what is left
+	start := min(offset, total)
+	skus = skus[start : start+min(limit, total-start)]
+	items := make([]StockItem, 0, len(skus))
+	for _, sku := range skus {
+		items = append(items, StockItem{SKU: sku, Quantity: inventory[sku], SafetyStock: safetyStock[sku], Available: availableLocked(sku)})
+	}
+	return items, total
+}
+
+// handleStock serves GET /stock as JSON or, per the Accept header, CSV. The
+// plain JSON map stays the default for existing clients; paging or ?view
+// selects the other shapes.
+func handleStock(w http.ResponseWriter, r *http.Request) {
+	if cors(w, r, "GET") {
+		return
+	}
+	format := negotiateStockFormat(r.Header.Get("Accept"))
+	if format == "" {
+		w.WriteHeader(http.StatusNotAcceptable)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "supported types: application/json, text/csv"})
+		return
+	}
+	q := r.URL.Query()
+	paged := q.Has("limit") || q.Has("offset") || q.Has("prefix")
+	if !paged && format == "json" && q.Get("view") == "available" {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(availableInventory())
+		return
+	}
+	if !paged && format == "json" {
+		// no paging requested: keep returning the plain sku->quantity map.
+		// Existing clients, the smoketest among them, decode it as
+		// map[string]int, so safetyStock can't be added here; it is in every
+		// paged response, and ?view=available returns what is left above it
+		w.Header().Set("Content-Type", "application/json")
+		mu.RLock()
+		defer mu.RUnlock()
+		_ = json.NewEncoder(w).Encode(inventory)
+		return
+	}
+	limit, offset := 100, 0
+	if !paged {
+		limit = math.MaxInt
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 1000 {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "limit must be between 1 and 1000"})
+			return
+		}
+		limit = n
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "offset must be a non-negative integer"})
+			return
+		}
+		offset = n
+	}
+	items, total := listStock(q.Get("prefix"), limit, offset)
+	if format == "csv" {
+		writeStockCSV(w, items)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"items":  items,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// drainAndClose shuts srv down first, so requests that publish, such as
+// PUT /stock/{sku}, /seed, /stock/import and reconcile, finish while the
+// writers are open. It then runs stopConsumers and only then closeWriters.
+// Shutdown returns at ctx's deadline even if handlers are still running.
+func drainAndClose(ctx context.Context, srv *http.Server, stopConsumers, closeWriters func()) {
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("server forced to shutdown", "error", err)
+	}
+	stopConsumers()
+	closeWriters()
 }
 
 func main() {
+	logging.Init("stock-service")
 	addr := getenv("HTTP_ADDR", ":8084")
 	brokers := strings.Split(getenv("KAFKA_BROKERS", "localhost:9093"), ",")
 	inTopic := getenv("ORDERS_TOPIC", "orders.created")
-	outTopic := getenv("INVENTORY_TOPIC", "inventory.updated")
-	group := getenv("GROUP_ID", "stock-service-cg")
+	// high-priority orders arrive on their own topic and decrement stock
+	// just the same
+	priorityTopic := getenv("PRIORITY_TOPIC", "orders.created.priority")
+	// amendments orders-processor accepted adjust stock by their deltas
+	amendTopic := getenv("AMEND_ACCEPTED_TOPIC", "orders.amended.accepted")
+	outTopics := inventoryTopics(getenv("INVENTORY_TOPIC", "inventory.updated"))
+	group := groupID("stock-service-cg")
+	dlqTopic := getenv("DLQ_TOPIC", inTopic+".dlq")
+	partialTopic := getenv("PARTIAL_TOPIC", "inventory.order_partial")
+	unknownTopic := getenv("UNKNOWN_SKU_TOPIC", "inventory.unknown_sku")
+
+	// SHUTDOWN_TIMEOUT bounds the whole shutdown sequence once a signal arrives
+	shutdownTimeout, err := time.ParseDuration(getenv("SHUTDOWN_TIMEOUT", "5s"))
+	if err != nil {
+		logging.Fatalf("invalid SHUTDOWN_TIMEOUT: %v", err)
+	}
+
+	if err := startupBrokerCheck(brokers); err != nil {
+		logging.Fatalf("kafka startup check failed: %v", err)
+	}
+	if err := ensureTopics(brokers, append([]string{inTopic, priorityTopic, amendTopic, dlqTopic, partialTopic, unknownTopic}, outTopics...)...); err != nil {
+		logging.Fatalf("ensure topics failed: %v", err)
+	}
+	if err := loadCatalogEnv(); err != nil {
+		logging.Fatalf("%v", err)
+	}
+
+	// SNAPSHOT_PATH, when set, persists inventory to a JSON file every
+	// SNAPSHOT_INTERVAL (default 30s) and restores it on startup in place of
+	// the built-in defaults
+	snapshotPath := getenv("SNAPSHOT_PATH", "")
+	snapshotInterval, err := time.ParseDuration(getenv("SNAPSHOT_INTERVAL", "30s"))
+	if err != nil || snapshotInterval <= 0 {
+		logging.Fatalf("invalid SNAPSHOT_INTERVAL: %q", getenv("SNAPSHOT_INTERVAL", "30s"))
+	}
+	if path := getenv("AUDIT_LOG_PATH", ""); path != "" {
+		if err := audit.open(path); err != nil {
+			logging.Fatalf("open audit log: %v", err)
+		}
+		defer audit.Close()
+	}
+	if snapshotPath != "" {
+		snap, ok, err := loadInventoryFile(snapshotPath)
+		if err != nil {
+			logging.Fatalf("load inventory snapshot: %v", err)
+		}
+		if ok {
+			mu.Lock()
+			inventory, applied = snap.Inventory, newAppliedSet(dedupCapacity(), snap.Applied)
+			if snap.SafetyStock != nil {
+				safetyStock = snap.SafetyStock
+			}
+			mu.Unlock()
+			slog.Info("restored inventory snapshot", "skus", len(snap.Inventory), "applied", len(snap.Applied), "path", snapshotPath)
+		}
+	}
+
+	// SCHEMA_VALIDATION=off leaves validator nil, which accepts every payload
+	var validator *schema.Validator
+	if getenv("SCHEMA_VALIDATION", "on") == "on" {
+		v, err := schema.New()
+		if err != nil {
+			logging.Fatalf("failed to load schemas: %v", err)
+		}
+		validator = v
+	}
+
+	eventCodec, err := codec.New(getenv("EVENT_FORMAT", "json"), getenv("SCHEMA_REGISTRY_URL", ""))
+	if err != nil {
+		logging.Fatalf("invalid event codec config: %v", err)
+	}
+
+	// SNAPSHOT_TOPIC=off disables snapshot publishing entirely
+	snapshotTopic := getenv("SNAPSHOT_TOPIC", "inventory.snapshot")
+	var snapshotWriter *kafka.Writer
+	if snapshotTopic != "off" {
+		if err := ensureCompactedTopic(brokers, snapshotTopic); err != nil {
+			slog.Warn("could not ensure compacted topic", "topic", snapshotTopic, "error", err)
+		}
+		snapshotWriter = newWriter(brokers, snapshotTopic)
+		defer snapshotWriter.Close()
+	}
+	publishSnapshot := func(ctx context.Context) {
+		if snapshotWriter == nil {
+			return
+		}
+		snap := InventorySnapshot{Inventory: snapshotInventory(), At: time.Now().UTC().Format(time.RFC3339)}
+		payload, _ := json.Marshal(snap)
+		value, err := eventCodec.Encode(ctx, "InventorySnapshot", payload)
+		if err != nil {
+			slog.Error("snapshot encode failed", "error", err)
+			return
+		}
+		if err := snapshotWriter.WriteMessages(ctx, buildMessage(snapshotKey, "InventorySnapshot", value)); err != nil {
+			slog.Error("snapshot write failed", "error", err)
+		}
+	}
 
-	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	var health HealthChecker
+	health.Register("kafka", func(ctx context.Context) error { return checkBrokers(brokers, 2*time.Second) })
+	http.HandleFunc("/healthz", health.Handler())
+	http.Handle("/metrics", promhttp.Handler())
 	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if consumer.isPaused() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_ = json.NewEncoder(w).Encode(map[string]string{"status": "paused"})
+			return
+		}
 		if atomic.LoadInt64(&kafkaReady) == 1 {
 			w.WriteHeader(http.StatusOK)
 		} else {
 			w.WriteHeader(http.StatusServiceUnavailable)
 		}
 	})
-	http.HandleFunc("/stock", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		mu.RLock()
-		defer mu.RUnlock()
-		_ = json.NewEncoder(w).Encode(inventory)
-	})
-	http.HandleFunc("/seed", func(w http.ResponseWriter, r *http.Request) {
-		// CORS for local dev
-		if r.Method == http.MethodOptions {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-			w.WriteHeader(http.StatusNoContent)
+	http.HandleFunc("/admin/pause", requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+		consumer.pause()
+		slog.Info("consumer paused")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	http.HandleFunc("/admin/resume", requireAdmin(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
-		var in map[string]int
-		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+		consumer.resume()
+		slog.Info("consumer resumed")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	// inventory before any order is consumed is the default reconcile baseline
+	baseline, baselineAt := snapshotInventory(), time.Now()
+	http.HandleFunc("/admin/reconcile", requireAdmin(reconcileHandler(kafkaReplay(brokers, group), []string{inTopic, priorityTopic, amendTopic}, eventCodec, validator, baseline, baselineAt, publishSnapshot)))
+	http.HandleFunc("/stock", handleStock)
+	http.HandleFunc("/stock/export", handleStockExport)
+	http.HandleFunc("/stock/audit", handleAudit)
+	http.HandleFunc("/stock/diff", handleStockDiff)
+	http.HandleFunc("/stock/import", requireAdmin(importHandler(publishSnapshot)))
+	http.HandleFunc("/catalog", catalogHandler())
+	http.HandleFunc("/seed", seedHandler(publishSnapshot))
+
+	// every InventoryUpdated goes to each INVENTORY_TOPICS entry
+	w := newFanoutWriter(brokers, outTopics)
+	defer w.Close()
+	dlq := newWriter(brokers, dlqTopic)
+	defer dlq.Close()
+	partialWriter := newWriter(brokers, partialTopic)
+	defer partialWriter.Close()
+	unknownWriter := newWriter(brokers, unknownTopic)
+	defer unknownWriter.Close()
+	poison := newPoisonHandler(func(ctx context.Context, m kafka.Message, reason error) {
+		sendToDLQ(ctx, dlq, m, reason)
+	})
+
+	// failed InventoryUpdated writes are retried in the background; see
+	// retryQueue. Dead letters name the first inventory topic as their origin.
+	retries := newRetryQueue(w, func(ctx context.Context, m kafka.Message, reason error) {
+		m.Topic = outTopics[0]
+		sendToDLQ(ctx, dlq, m, reason)
+	})
+	retryCtx, stopRetries := context.WithCancel(context.Background())
+	defer stopRetries()
+	go retries.run(retryCtx)
+
+	// publishUpdate writes one InventoryUpdated keyed by SKU. A failed write
+	// is handed to the retry queue and counts as published; only when the
+	// queue is full does it go to the DLQ and the error reach the caller.
+	publishUpdate := func(ctx context.Context, upd InventoryUpdated) error {
+		payload, _ := json.Marshal(upd)
+		value, err := eventCodec.Encode(ctx, "InventoryUpdated", payload)
+		if err != nil {
+			slog.Error("encode failed", "error", err)
+			return err
+		}
+		msg := withCorrelation(buildMessage(upd.SKU, "InventoryUpdated", value), upd.CorrelationID)
+		// an earlier update for this SKU is still queued; stay behind it
+		if retries.pending(upd.SKU) {
+			err = errors.New("earlier update pending retry")
+		} else {
+			err = w.WriteMessages(ctx, msg)
+		}
+		if err == nil {
+			return nil
+		}
+		if qerr := retries.enqueue(upd.SKU, msg, err); qerr != nil {
+			slog.Error("write failed and retry queue full", "error", err, "queueError", qerr)
+			msg.Topic = outTopics[0]
+			sendToDLQ(ctx, dlq, msg, err)
+			return err
+		}
+		slog.Warn("inventory update queued for retry", "sku", upd.SKU, "error", err)
+		return nil
+	}
+
+	// publishPartial reports an order whose updates were only partly written,
+	// followed by a snapshot so the failed SKUs' quantities still reach
+	// downstream readers
+	publishPartial := func(ctx context.Context, p OrderPartial) {
+		slog.Warn("inventory updates failed to publish", "order", p.OrderID, "failed", len(p.Failed), "total", len(p.Failed)+len(p.Succeeded))
+		payload, _ := json.Marshal(p)
+		value, err := eventCodec.Encode(ctx, "OrderPartial", payload)
+		if err != nil {
+			slog.Error("partial encode failed", "error", err)
+		} else if err := partialWriter.WriteMessages(ctx, buildMessage(p.OrderID, "OrderPartial", value)); err != nil {
+			slog.Error("partial write failed", "error", err)
+		}
+		publishSnapshot(ctx)
+	}
+
+	http.HandleFunc("/stock/", requireAdmin(stockHandler(publishUpdate, publishSnapshot)))
+
+	// publishUnknown reports an order line whose SKU is not in inventory
+	publishUnknown := func(ctx context.Context, u UnknownSKU) {
+		slog.Warn("order references unknown sku, skipping decrement", "order", u.OrderID, "sku", u.SKU)
+		payload, _ := json.Marshal(u)
+		value, err := eventCodec.Encode(ctx, "UnknownSKU", payload)
+		if err != nil {
+			slog.Error("unknown sku encode failed", "error", err)
 			return
 		}
-		mu.Lock()
-		for k, v := range in {
-			inventory[k] = v
+		if err := unknownWriter.WriteMessages(ctx, buildMessage(u.OrderID, "UnknownSKU", value)); err != nil {
+			slog.Error("unknown sku write failed", "error", err)
 		}
-		mu.Unlock()
-		w.WriteHeader(http.StatusNoContent)
-	})
+	}
 
-	w := newWriter(brokers, outTopic)
-	defer w.Close()
+	drainTimeout, err := time.ParseDuration(getenv("DRAIN_TIMEOUT", "10s"))
+	if err != nil {
+		logging.Fatalf("invalid DRAIN_TIMEOUT: %v", err)
+	}
 
 	// Create context that can be cancelled
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	if snapshotPath != "" {
+		go persistInventory(ctx, snapshotPath, snapshotInterval)
+	}
 
-	// Start Kafka consumer in goroutine
-	go func() {
+	// drainCtx outlives ctx: once a message has been read, its writes run on
+	// drainCtx so shutdown lets the current order finish publishing. It is
+	// only cancelled if DRAIN_TIMEOUT expires first.
+	drainCtx, drainCancel := context.WithCancel(context.Background())
+	defer drainCancel()
+	consumerDone := make(chan struct{})
+	health.Register("consumer", func(ctx context.Context) error {
+		select {
+		case <-consumerDone:
+			return errors.New("consumer goroutine exited")
+		default:
+			return nil
+		}
+	})
+
+	// Publish the starting inventory before consuming so downstream readers
+	// see a baseline that precedes the first InventoryUpdated
+	startupCtx, startupCancel := context.WithTimeout(ctx, 10*time.Second)
+	publishSnapshot(startupCtx)
+	startupCancel()
+
+	// ful applies orders to inventory; its writes run on drainCtx, see above
+	ful := &fulfiller{publishUpdate: publishUpdate, publishPartial: publishPartial, publishUnknown: publishUnknown}
+
+	// processOrder applies one OrderCreated; bad messages go to the poison
+	// handler.
+	processOrder := func(m kafka.Message) {
+		if et := headerValue(m, headerEventType); et != "" && et != "OrderCreated" {
+			poison.handle(drainCtx, m, "event_type", fmt.Errorf("unexpected event type %q", et))
+			return
+		}
+		body, err := eventCodec.Decode(drainCtx, m.Value)
+		if err != nil {
+			poison.handle(drainCtx, m, "decode", err)
+			return
+		}
+		if err := validator.Validate("OrderCreated", body); err != nil {
+			poison.handle(drainCtx, m, "schema", err)
+			return
+		}
+		var oc OrderCreated
+		if err := json.Unmarshal(body, &oc); err != nil {
+			poison.handle(drainCtx, m, "unmarshal", err)
+			return
+		}
+		ful.apply(drainCtx, oc.OrderID, oc.OrderID, oc.Items, eventTime(oc.CreatedAt, m), correlationOf(oc.CorrelationID, m))
+	}
+
+	// processAmendment applies the deltas of one accepted OrderAmended
+	processAmendment := func(m kafka.Message) {
+		if et := headerValue(m, headerEventType); et != "" && et != "OrderAmended" {
+			poison.handle(drainCtx, m, "event_type", fmt.Errorf("unexpected event type %q", et))
+			return
+		}
+		body, err := eventCodec.Decode(drainCtx, m.Value)
+		if err != nil {
+			poison.handle(drainCtx, m, "decode", err)
+			return
+		}
+		if err := validator.Validate("OrderAmended", body); err != nil {
+			poison.handle(drainCtx, m, "schema", err)
+			return
+		}
+		var oa OrderAmended
+		if err := json.Unmarshal(body, &oa); err != nil {
+			poison.handle(drainCtx, m, "unmarshal", err)
+			return
+		}
+		slog.Info("applying amendment", "order", oa.OrderID)
+		ful.apply(drainCtx, amendmentKey(oa), oa.OrderID, oa.Deltas, eventTime(oa.AmendedAt, m), correlationOf(oa.CorrelationID, m))
+	}
+
+	// consume reads one topic, handing each message to process, until ctx
+	// ends
+	consume := func(inTopic string, process func(kafka.Message)) {
 		r := newReader(brokers, inTopic, group)
 		defer r.Close()
-		log.Printf("stock-service consuming %s, producing %s", inTopic, outTopic)
-		for {
-			m, err := r.ReadMessage(ctx)
-			if err != nil {
-				if ctx.Err() != nil {
-					log.Println("context cancelled, stopping kafka consumer")
-					return
-				}
-				log.Printf("read error: %v", err)
-				continue
-			}
-			var oc OrderCreated
-			if err := json.Unmarshal(m.Value, &oc); err != nil {
-				log.Printf("json error: %v", err)
-				continue
-			}
-			for _, it := range oc.Items {
-				newQty := decrement(it.SKU, it.Qty)
-				upd := InventoryUpdated{SKU: it.SKU, Delta: -it.Qty, NewQuantity: newQty, OrderID: oc.OrderID, UpdatedAt: time.Now().UTC().Format(time.RFC3339)}
-				payload, _ := json.Marshal(upd)
-				if err := w.WriteMessages(ctx, kafka.Message{Key: []byte(it.SKU), Value: payload}); err != nil {
-					log.Printf("write error: %v", err)
-				}
-			}
-		}
+		slog.Info("stock-service consuming", "topic", inTopic, "producing", strings.Join(outTopics, ","))
+		consumeLoop(ctx, drainCtx, r, poison, process)
+	}
+	// the topics are consumed concurrently; fulfiller.apply is safe for that
+	// since it serializes per SKU, see ordering.go
+	var consumers sync.WaitGroup
+	for t, process := range map[string]func(kafka.Message){inTopic: processOrder, priorityTopic: processOrder, amendTopic: processAmendment} {
+		consumers.Add(1)
+		go func(topic string, process func(kafka.Message)) {
+			defer consumers.Done()
+			consume(topic, process)
+		}(t, process)
+	}
+	go func() {
+		consumers.Wait()
+		close(consumerDone)
 	}()
 
 	// Mark as ready after successful initialization
 	atomic.StoreInt64(&kafkaReady, 1)
 
-	srv := &http.Server{Addr: addr}
+	srv := &http.Server{Addr: addr, Handler: logging.AccessLog(http.DefaultServeMux)}
 
 	// Start server in a goroutine
 	go func() {
-		log.Printf("stock-service listening on %s", addr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("server failed: %v", err)
+		slog.Info("stock-service listening", "addr", addr)
+		if err := listenAndServe(srv); err != nil && err != http.ErrServerClosed {
+			logging.Fatalf("server failed: %v", err)
 		}
 	}()
 
@@ -169,23 +743,49 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("shutting down stock-service...")
+	slog.Info("shutting down stock-service")
 
-	// Cancel context to stop Kafka consumer
-	cancel()
+	// SHUTDOWN_TIMEOUT covers the HTTP server, the drain and closing writers
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer shutdownCancel()
 
-	// Close Kafka writer
-	if err := w.Close(); err != nil {
-		log.Printf("error closing kafka writer: %v", err)
-	}
+	drainAndClose(shutdownCtx, srv, func() {
+		// Cancel context to stop Kafka consumer, then let it finish the
+		// order in hand before the writers go away, within both
+		// DRAIN_TIMEOUT and the shutdown budget
+		cancel()
+		awaitDrain(shutdownCtx, consumerDone, drainTimeout, drainCancel)
 
-	// Shutdown HTTP server with timeout
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer shutdownCancel()
+		// the consumer has stopped; give up on queued retries,
+		// dead-lettering what is left, before the writers close
+		stopRetries()
+		retries.Close(shutdownCtx)
 
-	if err := srv.Shutdown(shutdownCtx); err != nil {
-		log.Printf("server forced to shutdown: %v", err)
-	}
+		// the consumer has stopped, so this snapshot is final
+		if snapshotPath != "" {
+			if err := saveInventoryFile(snapshotPath, snapshotState()); err != nil {
+				slog.Error("final inventory snapshot failed", "error", err)
+			}
+		}
+	}, func() {
+		if err := w.Close(); err != nil {
+			slog.Warn("error closing kafka writer", "error", err)
+		}
+		if err := dlq.Close(); err != nil {
+			slog.Warn("error closing dlq writer", "error", err)
+		}
+		if err := partialWriter.Close(); err != nil {
+			slog.Warn("error closing partial writer", "error", err)
+		}
+		if err := unknownWriter.Close(); err != nil {
+			slog.Warn("error closing unknown sku writer", "error", err)
+		}
+		if snapshotWriter != nil {
+			if err := snapshotWriter.Close(); err != nil {
+				slog.Warn("error closing snapshot writer", "error", err)
+			}
+		}
+	})
 
-	log.Println("stock-service shutdown complete")
+	slog.Info("stock-service shutdown complete")
 }
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func setInventory(t testing.TB, inv map[string]int) {
+	t.Helper()
+	mu.Lock()
+	prev, prevApplied := inventory, applied
+	inventory, applied = inv, newAppliedSet(16, nil)
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		inventory, applied = prev, prevApplied
+		mu.Unlock()
+	})
+}
+
+// TestAmendmentAdjustsStockByDelta applies an order and then an amendment's
+// deltas the way processAmendment does: added units are taken, released
+// units are put back.
+func TestAmendmentAdjustsStockByDelta(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 10, "S2": 10})
+	decrementBatch("o-1", []OrderItem{{SKU: "S1", Qty: 2}, {SKU: "S2", Qty: 1}})
+
+	// amended from S1x2,S2x1 to S1x5
+	got := decrementBatch("o-1", []OrderItem{{SKU: "S1", Qty: 3}, {SKU: "S2", Qty: -1}})
+	if got["S1"] != 5 || got["S2"] != 10 {
+		t.Fatalf("after amendment %v, want S1=5 S2=10", got)
+	}
+}
+
+func TestDecrementBatchSkipsUnknownSKUs(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 10})
+	got := decrementBatch("o-1", []OrderItem{{SKU: "S1", Qty: 1}, {SKU: "S1", Qty: 2}, {SKU: "NOPE", Qty: 1}})
+	if got["S1"] != 7 {
+		t.Fatalf("S1 = %d, want repeated lines summed to 7", got["S1"])
+	}
+	if _, ok := got["NOPE"]; ok {
+		t.Fatal("unknown SKU in result")
+	}
+}
+
+func TestListStockPagesPastTheEnd(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 1, "S2": 2, "T1": 3})
+	items, total := listStock("S", 1, 1)
+	if total != 2 || len(items) != 1 || items[0].SKU != "S2" {
+		t.Fatalf("page %v of %d", items, total)
+	}
+	for _, offset := range []int{3, math.MaxInt} {
+		if items, total := listStock("", 1000, offset); total != 3 || len(items) != 0 {
+			t.Fatalf("offset %d: page %v of %d", offset, items, total)
+		}
+	}
+	if items, _ := listStock("", math.MaxInt, 1); len(items) != 2 {
+		t.Fatalf("unbounded limit returned %d items", len(items))
+	}
+}
+
+// BenchmarkDecrement compares applying an order in one decrementBatch, one
+// hold of mu for all its items, with taking mu once per item, for orders of
+// 1, 10 and 100 items. The parallel cases add contention from concurrent
+// orders.
+func BenchmarkDecrement(b *testing.B) {
+	for _, n := range []int{1, 10, 100} {
+		inv := make(map[string]int, n)
+		items := make([]OrderItem, n)
+		for i := range items {
+			sku := fmt.Sprintf("S%d", i)
+			inv[sku] = math.MaxInt32
+			items[i] = OrderItem{SKU: sku, Qty: 1}
+		}
+		perItem := func() {
+			for _, it := range items {
+				decrementBatch("o-bench", []OrderItem{it})
+			}
+		}
+		batch := func() { decrementBatch("o-bench", items) }
+		for _, bc := range []struct {
+			name  string
+			apply func()
+		}{{"batch", batch}, {"per-item", perItem}} {
+			b.Run(fmt.Sprintf("%s/items=%d", bc.name, n), func(b *testing.B) {
+				setInventory(b, inv)
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					bc.apply()
+				}
+			})
+			b.Run(fmt.Sprintf("%s/items=%d/parallel", bc.name, n), func(b *testing.B) {
+				setInventory(b, inv)
+				b.ReportAllocs()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						bc.apply()
+					}
+				})
+			})
+		}
+	}
+}
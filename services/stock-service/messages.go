@@ -0,0 +1,80 @@
+package main
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+
+	"kafka-microservice/services/stock-service/codec"
+)
+
+// serviceName is stamped on every produced message as the producer header.
+const serviceName = "stock-service"
+
+// Standard headers carried by every event this service produces.
+const (
+	headerContentType   = "content-type"
+	headerEventType     = "event-type"
+	headerProducer      = "producer"
+	headerEventID       = "event-id"
+	headerCorrelationID = "correlation-id"
+)
+
+// buildMessage wraps an encoded event with the standard headers. The
+// content type follows the wire format the codec produced.
+func buildMessage(key, eventType string, payload []byte) kafka.Message {
+	contentType := "application/json"
+	if codec.IsAvro(payload) {
+		contentType = "application/vnd.confluent.avro"
+	}
+	return kafka.Message{
+		Key:   []byte(key),
+		Value: payload,
+		Time:  time.Now(),
+		Headers: []kafka.Header{
+			{Key: headerContentType, Value: []byte(contentType)},
+			{Key: headerEventType, Value: []byte(eventType)},
+			{Key: headerProducer, Value: []byte(serviceName)},
+			{Key: headerEventID, Value: []byte(uuid.NewString())},
+		},
+	}
+}
+
+// headerValue returns the value of the named header, or "" when absent.
+func headerValue(m kafka.Message, key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// eventTime is the creation time of the event that triggered m: the
+// createdAt it carries, or the message timestamp for events without one.
+func eventTime(createdAt string, m kafka.Message) string {
+	if createdAt != "" {
+		return createdAt
+	}
+	return m.Time.UTC().Format(time.RFC3339)
+}
+
+// withCorrelation returns m carrying id in its correlation-id header. An
+// empty id leaves m unchanged.
+func withCorrelation(m kafka.Message, id string) kafka.Message {
+	if id != "" {
+		m.Headers = append(m.Headers, kafka.Header{Key: headerCorrelationID, Value: []byte(id)})
+	}
+	return m
+}
+
+// correlationOf returns the correlation id of an inbound event: the
+// correlationId field of its body when set, otherwise its correlation-id
+// header.
+func correlationOf(bodyID string, m kafka.Message) string {
+	if bodyID != "" {
+		return bodyID
+	}
+	return headerValue(m, headerCorrelationID)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fulfillSeconds measures applying one order: waiting for its SKU locks, the
+// batch decrement and publishing every InventoryUpdated. outcome is ok,
+// duplicate for a redelivered order that was skipped, or publish_error when
+// any of the order's updates failed to write.
+var fulfillSeconds = func() *prometheus.HistogramVec {
+	h := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "stock_service_fulfill_seconds",
+		Help:    "Time to decrement inventory for an order and publish its updates.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"outcome"})
+	prometheus.MustRegister(h)
+	return h
+}()
+
+func observeFulfill(outcome string, start time.Time) {
+	fulfillSeconds.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// Ordering guarantee
+//
+// OrderCreated is keyed by orderId, so two orders touching the same SKU can
+// sit on different partitions and reach this service in any relative order.
+// What stock-service does guarantee is that, per SKU, the in-memory decrement
+// and the InventoryUpdated it publishes happen under one lock: the sequence of
+// NewQuantity values written for a SKU is exactly the sequence of mutations
+// applied to it, with no interleaving from another order. InventoryUpdated is
+// keyed by SKU, so that sequence is preserved on the topic as well.
+//
+// An order's SKUs are locked together and decremented in one batch, one
+// InventoryUpdated per distinct SKU. Locks are always taken in sorted SKU
+// order so two orders sharing SKUs cannot deadlock.
+//
+// Writes from the HTTP side take the same locks. A /seed or /stock/import
+// waits for any order in progress on its SKUs to finish publishing, and an
+// order arriving meanwhile waits for the seed, so each seed lands entirely
+// before or entirely after a given order. An order's NewQuantity is always
+// the decrement of whatever quantity was in place when it took the locks: a
+// seed never overwrites a decrement whose InventoryUpdated is still to be
+// published, and the decrement after a seed starts from the seeded value.
+// PUT /stock/{sku} locks its one SKU in the same way.
+
+// orderDeltas returns the distinct SKUs of items, sorted, with the total
+// quantity ordered for each.
+func orderDeltas(items []OrderItem) ([]string, map[string]int) {
+	deltas := make(map[string]int, len(items))
+	skus := make([]string, 0, len(items))
+	for _, it := range items {
+		if _, ok := deltas[it.SKU]; !ok {
+			skus = append(skus, it.SKU)
+		}
+		deltas[it.SKU] += it.Qty
+	}
+	sort.Strings(skus)
+	return skus, deltas
+}
+
+// skuLocks hands out one mutex per SKU, created on first use.
+type skuLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// lock acquires the mutex for sku and returns the function that releases it.
+func (l *skuLocks) lock(sku string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = map[string]*sync.Mutex{}
+	}
+	m, ok := l.locks[sku]
+	if !ok {
+		m = &sync.Mutex{}
+		l.locks[sku] = m
+	}
+	l.mu.Unlock()
+	m.Lock()
+	return m.Unlock
+}
+
+// lockAll acquires the mutexes for skus, which must be sorted and distinct,
+// and returns the function that releases them all.
+func (l *skuLocks) lockAll(skus []string) func() {
+	unlocks := make([]func(), 0, len(skus))
+	for _, sku := range skus {
+		unlocks = append(unlocks, l.lock(sku))
+	}
+	return func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestSeedInterleavedWithOrders races seeds against orders on the same SKUs;
+// run it with -race. Each InventoryUpdated must carry the quantity in place
+// while it is published, which a seed landing between an order's decrement
+// and its publish would break.
+func TestSeedInterleavedWithOrders(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 1000, "S2": 1000})
+	var stale []string
+	var staleMu sync.Mutex
+	f := &fulfiller{
+		publishUpdate: func(_ context.Context, upd InventoryUpdated) error {
+			mu.RLock()
+			cur := inventory[upd.SKU]
+			mu.RUnlock()
+			if cur != upd.NewQuantity {
+				staleMu.Lock()
+				stale = append(stale, fmt.Sprintf("%s published %d while holding %d", upd.SKU, upd.NewQuantity, cur))
+				staleMu.Unlock()
+			}
+			return nil
+		},
+		publishPartial: func(context.Context, OrderPartial) {},
+		publishUnknown: func(context.Context, UnknownSKU) {},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				id := fmt.Sprintf("o-%d-%d", i, j)
+				f.apply(context.Background(), id, id, []OrderItem{{SKU: "S2", Qty: 1}, {SKU: "S1", Qty: 1}}, "", "")
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				seedInventory(map[string]int{"S1": 1000 + j, "S2": 2000 + j}, false)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(stale) > 0 {
+		t.Fatalf("%d stale updates, first: %s", len(stale), stale[0])
+	}
+}
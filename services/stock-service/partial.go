@@ -0,0 +1,35 @@
+package main
+
+// PartialItem is the publish outcome for one SKU of an order.
+type PartialItem struct {
+	SKU         string `json:"sku"`
+	Delta       int    `json:"delta"`
+	NewQuantity int    `json:"newQuantity"`
+	Error       string `json:"error,omitempty"`
+}
+
+// OrderPartial is published to PARTIAL_TOPIC (default
+// inventory.order_partial) when some of an order's InventoryUpdated events
+// could not be written, so downstream views can be reconciled for that
+// order. The in-memory decrement is not rolled back for the failed items:
+// the order has been consumed and the stock really is committed to it, so
+// undoing it would let the same units be sold twice. What is missing is
+// only the event, which the snapshot published alongside this one restores
+// for consumers that bootstrap from it.
+type OrderPartial struct {
+	OrderID     string        `json:"orderId"`
+	Succeeded   []PartialItem `json:"succeeded"`
+	Failed      []PartialItem `json:"failed"`
+	EventTime   string        `json:"eventTime,omitempty"`
+	ProcessedAt string        `json:"processedAt"`
+}
+
+// record files one item under Succeeded or Failed depending on err.
+func (p *OrderPartial) record(item PartialItem, err error) {
+	if err != nil {
+		item.Error = err.Error()
+		p.Failed = append(p.Failed, item)
+		return
+	}
+	p.Succeeded = append(p.Succeeded, item)
+}
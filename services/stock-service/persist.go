@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// inventoryFile is the on-disk snapshot: the inventory, the keys of the
+// orders already applied to it (see appliedSet) and the safety stock set at
+// runtime. Snapshots written before Applied existed hold the inventory map
+// alone; ones without SafetyStock leave SAFETY_STOCK in force.
+type inventoryFile struct {
+	Inventory   map[string]int `json:"inventory"`
+	Applied     []string       `json:"applied,omitempty"`
+	SafetyStock map[string]int `json:"safetyStock"`
+}
+
+// snapshotState copies the inventory, applied keys and safety stock under
+// one hold of mu, so they agree.
+func snapshotState() inventoryFile {
+	mu.RLock()
+	defer mu.RUnlock()
+	inv := make(map[string]int, len(inventory))
+	for k, v := range inventory {
+		inv[k] = v
+	}
+	safety := make(map[string]int, len(safetyStock))
+	for k, v := range safetyStock {
+		safety[k] = v
+	}
+	return inventoryFile{Inventory: inv, Applied: applied.keys(), SafetyStock: safety}
+}
+
+// saveInventoryFile writes snap to path as JSON. The data goes to a temp file
+// in the same directory which is then renamed over path, so a crash mid-write
+// never leaves a truncated snapshot behind.
+func saveInventoryFile(path string, snap inventoryFile) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadInventoryFile reads a snapshot written by saveInventoryFile. A missing
+// file is not an error; ok reports whether one was found.
+func loadInventoryFile(path string) (snap inventoryFile, ok bool, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return inventoryFile{}, false, nil
+	}
+	if err != nil {
+		return inventoryFile{}, false, err
+	}
+	if err = json.Unmarshal(data, &snap); err == nil && snap.Inventory == nil {
+		// an older snapshot: the bare inventory map
+		err = json.Unmarshal(data, &snap.Inventory)
+	}
+	if err != nil {
+		return inventoryFile{}, false, fmt.Errorf("snapshot %s: %w", path, err)
+	}
+	// only SKUs are checked: an order that raced past a stale stock check
+	// can leave a quantity negative, and that must survive a restart
+	for sku := range snap.Inventory {
+		if !seedSKUPattern.MatchString(sku) {
+			return inventoryFile{}, false, fmt.Errorf("snapshot %s: invalid sku %q", path, sku)
+		}
+	}
+	for sku, floor := range snap.SafetyStock {
+		if !seedSKUPattern.MatchString(sku) || floor < 0 {
+			return inventoryFile{}, false, fmt.Errorf("snapshot %s: invalid safety stock %q=%d", path, sku, floor)
+		}
+	}
+	return snap, true, nil
+}
+
+// persistInventory saves the inventory to path every interval until ctx is
+// cancelled. Failures are logged and retried on the next tick.
+func persistInventory(ctx context.Context, path string, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := saveInventoryFile(path, snapshotState()); err != nil {
+				slog.Warn("inventory snapshot failed", "path", path, "error", err)
+			}
+		}
+	}
+}
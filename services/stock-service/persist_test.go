@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestSnapshotRoundTrip saves and restores an inventory an oversold order
+// left negative.
+func TestSnapshotRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	if _, ok, err := loadInventoryFile(path); ok || err != nil {
+		t.Fatalf("missing file: ok=%v, %v", ok, err)
+	}
+	want := map[string]int{"S1": 5, "S2": 0, "S3": -2}
+	if err := saveInventoryFile(path, inventoryFile{Inventory: want}); err != nil {
+		t.Fatal(err)
+	}
+	snap, ok, err := loadInventoryFile(path)
+	if err != nil || !ok {
+		t.Fatalf("load: ok=%v, %v", ok, err)
+	}
+	if len(snap.Inventory) != len(want) {
+		t.Fatalf("restored %v, want %v", snap.Inventory, want)
+	}
+	for sku, qty := range want {
+		if snap.Inventory[sku] != qty {
+			t.Fatalf("restored %v, want %v", snap.Inventory, want)
+		}
+	}
+	if matches, _ := filepath.Glob(path + ".tmp-*"); len(matches) != 0 {
+		t.Fatalf("temp files left behind: %v", matches)
+	}
+}
+
+func TestSnapshotRejectsInvalidSKU(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	if err := os.WriteFile(path, []byte(`{"inventory":{"S1":1,"not a sku!":2}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := loadInventoryFile(path); err == nil {
+		t.Fatal("want an error for an invalid sku")
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"kafka-microservice/services/stock-service/codec"
+	"kafka-microservice/services/stock-service/schema"
+)
+
+// ReconcileRequest is the optional body of POST /admin/reconcile. Baseline
+// and Since describe a known inventory and when it held; they default to the
+// inventory at startup. Window caps how far back the replay reads (default
+// RECONCILE_WINDOW, 24h). Correct applies the expected quantities instead
+// of only reporting them.
+type ReconcileRequest struct {
+	Baseline map[string]int `json:"baseline,omitempty"`
+	Since    string         `json:"since,omitempty"`
+	Window   string         `json:"window,omitempty"`
+	Correct  bool           `json:"correct"`
+}
+
+// ReconcileItem compares one SKU's current quantity with the quantity its
+// baseline and replayed orders imply.
+type ReconcileItem struct {
+	SKU      string `json:"sku"`
+	Baseline int    `json:"baseline"`
+	Ordered  int    `json:"ordered"`
+	Expected int    `json:"expected"`
+	Actual   int    `json:"actual"`
+	Diff     int    `json:"diff"` // actual - expected
+}
+
+type ReconcileReport struct {
+	Since     string          `json:"since"`
+	Orders    int             `json:"orders"`
+	Corrected bool            `json:"corrected"`
+	Items     []ReconcileItem `json:"items"`
+}
+
+// manualWriteAt is when inventory was last set by hand, through /seed,
+// /stock/import or PUT /stock/{sku}, in unix nanoseconds. Replaying orders
+// cannot account for those writes, so a baseline older than this one is
+// not corrected against.
+var manualWriteAt int64
+
+func markManualWrite() { atomic.StoreInt64(&manualWriteAt, time.Now().UnixNano()) }
+
+// consumedOffsets records, per topic partition, the first and last offsets
+// this process has applied. Replaying exactly that range reproduces what
+// was applied since startup, including orders produced before it.
+type consumedOffsets struct {
+	mu     sync.Mutex
+	ranges map[string][2]int64
+}
+
+var consumed = &consumedOffsets{ranges: map[string][2]int64{}}
+
+func (c *consumedOffsets) record(m kafka.Message) {
+	key := fmt.Sprintf("%s/%d", m.Topic, m.Partition)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.ranges[key]
+	if !ok {
+		r[0] = m.Offset
+	}
+	r[1] = m.Offset
+	c.ranges[key] = r
+}
+
+// replayRange picks the offsets [start, end) of one partition to replay;
+// conn is connected to that partition's leader.
+type replayRange func(conn *kafka.Conn, topic string, partition int) (start, end int64, err error)
+
+// sinceTime replays from the first message at or after since up to the end
+// offset observed at the start of the call.
+func sinceTime(since time.Time) replayRange {
+	return func(conn *kafka.Conn, _ string, _ int) (int64, int64, error) {
+		start, err := conn.ReadOffset(since)
+		if err != nil {
+			return 0, 0, err
+		}
+		end, err := conn.ReadLastOffset()
+		return start, end, err
+	}
+}
+
+// sinceStartup replays what this process has consumed; see consumedOffsets.
+func sinceStartup(conn *kafka.Conn, topic string, partition int) (int64, int64, error) {
+	consumed.mu.Lock()
+	defer consumed.mu.Unlock()
+	r, ok := consumed.ranges[fmt.Sprintf("%s/%d", topic, partition)]
+	if !ok {
+		return 0, 0, nil
+	}
+	return r[0], r[1] + 1, nil
+}
+
+// replaying holds the consumers back while a reconcile replays and
+// compares. consumeLoop applies each message and records it in consumed
+// under the read lock, so the inventory a reconcile reads is exactly what
+// the offsets it replays produced.
+var replaying sync.RWMutex
+
+// replaySource calls visit for each message of topic in the offsets bounds
+// picks.
+type replaySource func(ctx context.Context, topic string, bounds replayRange, visit func(kafka.Message)) error
+
+// kafkaReplay reads with throwaway partition readers, so the live consumer
+// group's offsets are untouched. No partition is read past what the
+// service has applied, see appliedEnd: an order still waiting for the
+// consumer is not in inventory yet, and correcting for it would take its
+// stock twice.
+func kafkaReplay(brokers []string, group string) replaySource {
+	return func(ctx context.Context, topic string, bounds replayRange, visit func(kafka.Message)) error {
+		conn, err := kafka.DialContext(ctx, "tcp", brokers[0])
+		if err != nil {
+			return err
+		}
+		partitions, err := conn.ReadPartitions(topic)
+		conn.Close()
+		if err != nil {
+			return err
+		}
+		ids := make([]int, 0, len(partitions))
+		for _, p := range partitions {
+			ids = append(ids, p.ID)
+		}
+		client := &kafka.Client{Addr: kafka.TCP(brokers...)}
+		committed, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{GroupID: group, Topics: map[string][]int{topic: ids}})
+		if err != nil {
+			return fmt.Errorf("fetch committed offsets: %w", err)
+		}
+		groupAt := make(map[int]int64)
+		for _, p := range committed.Topics[topic] {
+			groupAt[p.Partition] = p.CommittedOffset
+		}
+
+		for _, p := range partitions {
+			leader, err := kafka.DialLeader(ctx, "tcp", brokers[0], topic, p.ID)
+			if err != nil {
+				return err
+			}
+			start, last, err := bounds(leader, topic, p.ID)
+			leader.Close()
+			if err != nil {
+				return err
+			}
+			last = min(last, appliedEnd(topic, p.ID, groupAt[p.ID]))
+			if start < 0 || last <= start {
+				continue
+			}
+
+			r := kafka.NewReader(withReaderLogging(kafka.ReaderConfig{Brokers: brokers, Topic: topic, Partition: p.ID, MinBytes: 1, MaxBytes: 10e6}))
+			if err := r.SetOffset(start); err != nil {
+				r.Close()
+				return err
+			}
+			for {
+				m, err := r.ReadMessage(ctx)
+				if err != nil {
+					r.Close()
+					return fmt.Errorf("replay %s[%d]: %w", topic, p.ID, err)
+				}
+				visit(m)
+				if m.Offset+1 >= last {
+					break
+				}
+			}
+			r.Close()
+		}
+		return nil
+	}
+}
+
+// appliedEnd is the offset after the last message of topic[partition] the
+// service has applied: the end of what this process consumed, or the
+// group's committed offset when that is further, which covers the
+// processes before it.
+func appliedEnd(topic string, partition int, committed int64) int64 {
+	consumed.mu.Lock()
+	defer consumed.mu.Unlock()
+	if r, ok := consumed.ranges[fmt.Sprintf("%s/%d", topic, partition)]; ok {
+		return max(r[1]+1, committed)
+	}
+	return committed
+}
+
+// replayTally sums, per SKU, the items of every replayed OrderCreated and
+// the deltas of every accepted OrderAmended, under the consumer's rules:
+// messages that fail to decode or validate are skipped, an order or
+// amendment seen before is counted once, and SKUs missing from stocked are
+// left out, as decrementLocked leaves them.
+type replayTally struct {
+	eventCodec codec.Codec
+	validator  *schema.Validator
+	stocked    map[string]int
+	seen       map[string]bool // keys as in applied
+	ordered    map[string]int
+	orders     int
+}
+
+func newReplayTally(eventCodec codec.Codec, validator *schema.Validator, stocked map[string]int) *replayTally {
+	return &replayTally{eventCodec: eventCodec, validator: validator, stocked: stocked, seen: map[string]bool{}, ordered: map[string]int{}}
+}
+
+func (t *replayTally) add(ctx context.Context, m kafka.Message) {
+	body, err := t.eventCodec.Decode(ctx, m.Value)
+	if err != nil {
+		return
+	}
+	var key string
+	var items []OrderItem
+	switch headerValue(m, headerEventType) {
+	case "OrderAmended":
+		var oa OrderAmended
+		if t.validator.Validate("OrderAmended", body) != nil || json.Unmarshal(body, &oa) != nil {
+			return
+		}
+		key, items = amendmentKey(oa), oa.Deltas
+	case "", "OrderCreated":
+		var oc OrderCreated
+		if t.validator.Validate("OrderCreated", body) != nil || json.Unmarshal(body, &oc) != nil {
+			return
+		}
+		key, items = oc.OrderID, oc.Items
+		if !t.seen[key] {
+			t.orders++
+		}
+	default:
+		return
+	}
+	if t.seen[key] {
+		return
+	}
+	t.seen[key] = true
+	normalizeItems(items)
+	for _, it := range items {
+		if _, ok := t.stocked[it.SKU]; ok {
+			t.ordered[it.SKU] += it.Qty
+		}
+	}
+}
+
+// reconcileHandler serves POST /admin/reconcile. baseline is the inventory
+// captured at baselineAt, before any order was consumed; against it the
+// orders consumed since are replayed from every topic in topics. A baseline
+// older than the replay window is rejected rather than compared against a
+// partial replay, and so is correcting against one that a later /seed,
+// /stock/import or PUT /stock/{sku} has overtaken. Consumption pauses from
+// the start of the replay until the report, and any correction, is done.
+func reconcileHandler(source replaySource, topics []string, eventCodec codec.Codec, validator *schema.Validator, baseline map[string]int, baselineAt time.Time, publishSnapshot func(context.Context)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var req ReconcileRequest
+		if r.ContentLength != 0 {
+			if status, err := decodeJSONBody(w, r, &req); err != nil {
+				w.WriteHeader(status)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				return
+			}
+		}
+
+		window, err := time.ParseDuration(req.Window)
+		if req.Window == "" {
+			window, err = time.ParseDuration(getenv("RECONCILE_WINDOW", "24h"))
+		}
+		if err != nil || window <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid window"})
+			return
+		}
+		base, since, bounds := baseline, baselineAt, replayRange(sinceStartup)
+		if req.Baseline != nil {
+			base, since = req.Baseline, time.Now().Add(-window)
+		}
+		if req.Since != "" {
+			t, err := time.Parse(time.RFC3339, req.Since)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": "since must be RFC3339"})
+				return
+			}
+			since = t
+		}
+		if req.Baseline != nil || req.Since != "" {
+			bounds = sinceTime(since)
+		}
+		if since.Before(time.Now().Add(-window)) {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "baseline predates the replay window; pass a newer baseline and since, or a longer window"})
+			return
+		}
+		if req.Correct && atomic.LoadInt64(&manualWriteAt) > since.UnixNano() {
+			w.WriteHeader(http.StatusConflict)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "inventory was set by hand after the baseline; correcting would undo it. Pass a baseline and since taken after the last seed"})
+			return
+		}
+
+		// the consumers wait until the comparison, and any correction, is
+		// done; an order applied mid-replay would otherwise be missing from
+		// the replay but present in inventory, and a correction would undo it
+		replaying.Lock()
+		defer replaying.Unlock()
+		tally := newReplayTally(eventCodec, validator, base)
+		for _, topic := range topics {
+			if err = source(r.Context(), topic, bounds, func(m kafka.Message) { tally.add(r.Context(), m) }); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			slog.Error("reconcile replay failed", "error", err)
+			w.WriteHeader(http.StatusBadGateway)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		ordered, orders := tally.ordered, tally.orders
+
+		report := ReconcileReport{Since: since.UTC().Format(time.RFC3339), Orders: orders, Corrected: req.Correct}
+		mu.RLock()
+		seen := make(map[string]bool)
+		for _, m := range []map[string]int{base, ordered, inventory} {
+			for sku := range m {
+				seen[sku] = true
+			}
+		}
+		mu.RUnlock()
+		skus := make([]string, 0, len(seen))
+		for sku := range seen {
+			skus = append(skus, sku)
+		}
+		sort.Strings(skus)
+		// corrections take the SKU locks like any other write; see
+		// ordering.go. A write by hand that landed during the replay is
+		// caught here, once no other can.
+		if req.Correct {
+			defer perSKU.lockAll(skus)()
+			if atomic.LoadInt64(&manualWriteAt) > since.UnixNano() {
+				w.WriteHeader(http.StatusConflict)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": "inventory was set by hand during the reconcile; nothing was corrected"})
+				return
+			}
+		}
+		mu.Lock()
+		for _, sku := range skus {
+			item := ReconcileItem{SKU: sku, Baseline: base[sku], Ordered: ordered[sku], Actual: inventory[sku]}
+			item.Expected = item.Baseline - item.Ordered
+			item.Diff = item.Actual - item.Expected
+			if req.Correct && item.Diff != 0 {
+				inventory[sku] = item.Expected
+				audit.record(sku, item.Expected-item.Actual, item.Expected, auditSourceReconcile, "")
+			}
+			report.Items = append(report.Items, item)
+		}
+		mu.Unlock()
+
+		drift := 0
+		for _, it := range report.Items {
+			if it.Diff != 0 {
+				drift++
+			}
+		}
+		slog.Info("reconcile finished", "orders", orders, "since", report.Since, "drifted", drift, "corrected", req.Correct)
+		if req.Correct && drift > 0 {
+			publishSnapshot(r.Context())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(report)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"kafka-microservice/services/stock-service/codec"
+)
+
+func reconcile(t *testing.T, baselineAt time.Time, body string) int {
+	t.Helper()
+	h := reconcileHandler(nil, nil, nil, nil, map[string]int{}, baselineAt, func(context.Context) {})
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPost, "/admin/reconcile", strings.NewReader(body)))
+	return rec.Code
+}
+
+func TestReconcileRejectsABaselineOlderThanTheWindow(t *testing.T) {
+	if code := reconcile(t, time.Now().Add(-2*time.Hour), `{"window":"1h"}`); code != http.StatusBadRequest {
+		t.Fatalf("startup baseline 2h back: status %d, want 400", code)
+	}
+	since := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	if code := reconcile(t, time.Now(), `{"window":"1h","since":"`+since+`"}`); code != http.StatusBadRequest {
+		t.Fatalf("since 2h back: status %d, want 400", code)
+	}
+}
+
+func TestReconcileWillNotCorrectOverASeed(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 10})
+	baselineAt := time.Now()
+	time.Sleep(time.Millisecond)
+	setQuantity("S1", 50)
+	if code := reconcile(t, baselineAt, `{"correct":true}`); code != http.StatusConflict {
+		t.Fatalf("status %d, want 409", code)
+	}
+}
+
+func TestConsumedOffsetsSpanFirstToLast(t *testing.T) {
+	c := &consumedOffsets{ranges: map[string][2]int64{}}
+	for _, off := range []int64{7, 8, 12} {
+		c.record(kafka.Message{Topic: "orders", Partition: 1, Offset: off})
+	}
+	if got := c.ranges["orders/1"]; got != [2]int64{7, 12} {
+		t.Fatalf("range %v, want [7 12]", got)
+	}
+}
+
+func orderMessage(t *testing.T, oc OrderCreated) kafka.Message {
+	t.Helper()
+	payload, _ := json.Marshal(oc)
+	value, err := codec.JSONCodec{}.Encode(context.Background(), "OrderCreated", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kafka.Message{Key: []byte(oc.OrderID), Value: value}
+}
+
+// TestReconcileWithOrderLandingMidReplay replays two applied orders, one
+// of them redelivered and one partly for a SKU that is not stocked, while a
+// third order reaches the consumer. The replay counts what the consumer
+// applied and nothing else, so nothing has drifted; the third order waits
+// for the reconcile and is applied after it instead of being corrected
+// away.
+func TestReconcileWithOrderLandingMidReplay(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 10, "S2": 10})
+	baseline, baselineAt := snapshotInventory(), time.Now()
+	o1 := OrderCreated{OrderID: "o-1", Items: []OrderItem{{SKU: "S1", Qty: 2}}}
+	o2 := OrderCreated{OrderID: "o-2", Items: []OrderItem{{SKU: "NOPE", Qty: 5}, {SKU: " s2 ", Qty: 1}}}
+	for _, oc := range []OrderCreated{o1, o1, o2} {
+		items := append([]OrderItem(nil), oc.Items...)
+		normalizeItems(items)
+		decrementOnce(oc.OrderID, oc.OrderID, items)
+	}
+	if stockOf("S1") != 8 {
+		t.Fatalf("S1 = %d before reconcile, want 8", stockOf("S1"))
+	}
+
+	src := newChanSource()
+	runConsumeLoop(t, src, func(m kafka.Message) {
+		decrementOnce(string(m.Key), string(m.Key), []OrderItem{{SKU: "S1", Qty: 3}})
+	})
+	replay := func(_ context.Context, topic string, _ replayRange, visit func(kafka.Message)) error {
+		// o-3 is fetched while the replay runs and has to wait for it
+		src.msgs <- kafka.Message{Key: []byte("o-3"), Offset: 3}
+		time.Sleep(20 * time.Millisecond)
+		if got := stockOf("S1"); got != 8 {
+			t.Errorf("S1 = %d during replay, want o-3 held back", got)
+		}
+		for _, m := range []kafka.Message{orderMessage(t, o1), orderMessage(t, o1), orderMessage(t, o2), {Value: []byte("{")}} {
+			visit(m)
+		}
+		return nil
+	}
+
+	h := reconcileHandler(replay, []string{"orders.created"}, codec.JSONCodec{}, nil, baseline, baselineAt, func(context.Context) {})
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPost, "/admin/reconcile", strings.NewReader(`{"correct":true}`)))
+	var report ReconcileReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("status %d, %v", rec.Code, err)
+	}
+	if report.Orders != 2 {
+		t.Errorf("orders = %d, want 2 with the redelivery counted once", report.Orders)
+	}
+	want := map[string][2]int{"S1": {2, 0}, "S2": {1, 0}}
+	if len(report.Items) != len(want) {
+		t.Fatalf("items %+v, want S1 and S2 only", report.Items)
+	}
+	for _, it := range report.Items {
+		if w := want[it.SKU]; it.Ordered != w[0] || it.Diff != w[1] {
+			t.Errorf("%+v, want ordered %d and diff %d", it, w[0], w[1])
+		}
+	}
+	waitStock(t, "S1", 5)
+}
+
+// TestAppliedEndStopsAtTheConsumer expects the replay of a partition to end
+// after what this process consumed, or at the group's committed offset when
+// that is further or this process consumed nothing there.
+func TestAppliedEndStopsAtTheConsumer(t *testing.T) {
+	prev := consumed
+	consumed = &consumedOffsets{ranges: map[string][2]int64{}}
+	t.Cleanup(func() { consumed = prev })
+	consumed.record(kafka.Message{Topic: "orders", Partition: 0, Offset: 41})
+
+	for _, tc := range []struct {
+		partition int
+		committed int64
+		want      int64
+	}{
+		{0, 30, 42},
+		{0, 50, 50},
+		{1, 17, 17},
+	} {
+		if got := appliedEnd("orders", tc.partition, tc.committed); got != tc.want {
+			t.Errorf("partition %d committed %d: got %d, want %d", tc.partition, tc.committed, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// retryQueue holds InventoryUpdated messages whose write failed and retries
+// them in order from a background goroutine, so a broker blip neither drops
+// the event nor blocks the consumer. It holds at most RETRY_QUEUE_SIZE
+// messages (default 1000; 0 disables the queue). Each is tried up to
+// RETRY_MAX_ATTEMPTS times (default 10) with a delay doubling from 200ms to
+// RETRY_BACKOFF_MAX (default 30s); a message that runs out of attempts, or
+// does not fit, goes to the DLQ.
+//
+// Retries run head of line: nothing behind a failing message is sent until
+// it succeeds or is dead-lettered. Together with pending, which sends every
+// later update for a queued SKU through the queue too, this keeps each SKU's
+// NewQuantity sequence in order on the topic. A nil queue does nothing.
+type retryQueue struct {
+	w           messageWriter
+	deadLetter  func(ctx context.Context, m kafka.Message, reason error)
+	size        int
+	maxAttempts int
+	backoffMax  time.Duration
+
+	mu      sync.Mutex
+	items   []retryItem
+	bySKU   map[string]int
+	wake    chan struct{}
+	stopped chan struct{}
+}
+
+type retryItem struct {
+	sku      string
+	m        kafka.Message
+	attempts int
+	lastErr  error
+}
+
+const retryBackoffMin = 200 * time.Millisecond
+
+var errRetryQueueFull = errors.New("retry queue full")
+
+// newRetryQueue returns nil when RETRY_QUEUE_SIZE is 0.
+func newRetryQueue(w messageWriter, deadLetter func(ctx context.Context, m kafka.Message, reason error)) *retryQueue {
+	size, err := strconv.Atoi(getenv("RETRY_QUEUE_SIZE", "1000"))
+	if err != nil || size < 0 {
+		size = 1000
+	}
+	if size == 0 {
+		return nil
+	}
+	q := &retryQueue{w: w, deadLetter: deadLetter, size: size, maxAttempts: 10, backoffMax: 30 * time.Second,
+		bySKU: map[string]int{}, wake: make(chan struct{}, 1), stopped: make(chan struct{})}
+	if n, err := strconv.Atoi(getenv("RETRY_MAX_ATTEMPTS", "10")); err == nil && n > 0 {
+		q.maxAttempts = n
+	}
+	if d, err := time.ParseDuration(getenv("RETRY_BACKOFF_MAX", "30s")); err == nil && d >= retryBackoffMin {
+		q.backoffMax = d
+	}
+	return q
+}
+
+// pending reports whether an update for sku is waiting in the queue.
+func (q *retryQueue) pending(sku string) bool {
+	if q == nil {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.bySKU[sku] > 0
+}
+
+// enqueue adds m, the update for sku that failed with cause, or returns
+// errRetryQueueFull, in which case the caller still owns m.
+func (q *retryQueue) enqueue(sku string, m kafka.Message, cause error) error {
+	if q == nil {
+		return errRetryQueueFull
+	}
+	q.mu.Lock()
+	if len(q.items) >= q.size {
+		q.mu.Unlock()
+		return errRetryQueueFull
+	}
+	q.items = append(q.items, retryItem{sku: sku, m: m, lastErr: cause})
+	q.bySKU[sku]++
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (q *retryQueue) head() (retryItem, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return retryItem{}, false
+	}
+	return q.items[0], true
+}
+
+// pop removes the head after it was delivered or dead-lettered.
+func (q *retryQueue) pop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	sku := q.items[0].sku
+	q.items = q.items[1:]
+	if q.bySKU[sku]--; q.bySKU[sku] == 0 {
+		delete(q.bySKU, sku)
+	}
+}
+
+func (q *retryQueue) recordFailure(err error) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items[0].attempts++
+	q.items[0].lastErr = err
+	return q.items[0].attempts
+}
+
+// run retries queued messages until ctx ends.
+func (q *retryQueue) run(ctx context.Context) {
+	if q == nil {
+		return
+	}
+	defer close(q.stopped)
+	delay := retryBackoffMin
+	for {
+		it, ok := q.head()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.wake:
+				continue
+			}
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		err := q.w.WriteMessages(ctx, it.m)
+		if err == nil {
+			q.pop()
+			delay = retryBackoffMin
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if attempts := q.recordFailure(err); attempts >= q.maxAttempts {
+			slog.Error("inventory update failed its retries, sending to dlq", "sku", it.sku, "attempts", attempts, "error", err)
+			q.deadLetter(ctx, it.m, err)
+			q.pop()
+			delay = retryBackoffMin
+			continue
+		}
+		delay = min(delay*2, q.backoffMax)
+	}
+}
+
+// Close waits for run to stop, its context having been cancelled, and sends
+// whatever is still queued to the DLQ.
+func (q *retryQueue) Close(ctx context.Context) {
+	if q == nil {
+		return
+	}
+	<-q.stopped
+	q.mu.Lock()
+	items := q.items
+	q.items, q.bySKU = nil, map[string]int{}
+	q.mu.Unlock()
+	if len(items) > 0 {
+		slog.Warn("shutting down with inventory updates unsent, sending to dlq", "count", len(items))
+	}
+	for _, it := range items {
+		reason := it.lastErr
+		if reason == nil {
+			reason = errors.New("not retried before shutdown")
+		}
+		q.deadLetter(ctx, it.m, reason)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// blipWriter fails its first fails writes, then records what it is sent.
+type blipWriter struct {
+	mu        sync.Mutex
+	fails     int
+	delivered []string
+}
+
+func (w *blipWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.fails > 0 {
+		w.fails--
+		return errors.New("leader not available")
+	}
+	for _, m := range msgs {
+		w.delivered = append(w.delivered, string(m.Value))
+	}
+	return nil
+}
+
+func (w *blipWriter) Close() error { return nil }
+
+// TestRetryQueueDeliversAfterFailure queues two updates whose first write
+// failed; the queue's own first attempt fails too, and both must still be
+// delivered, in order, without reaching the DLQ.
+func TestRetryQueueDeliversAfterFailure(t *testing.T) {
+	w := &blipWriter{fails: 1}
+	var deadLettered int
+	q := newRetryQueue(w, func(context.Context, kafka.Message, error) { deadLettered++ })
+	cause := errors.New("broker blip")
+	if err := q.enqueue("S1", kafka.Message{Value: []byte("S1=9")}, cause); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.enqueue("S1", kafka.Message{Value: []byte("S1=8")}, cause); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go q.run(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for q.pending("S1") {
+		if time.Now().After(deadline) {
+			t.Fatal("updates still queued")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	q.Close(context.Background())
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.delivered) != 2 || w.delivered[0] != "S1=9" || w.delivered[1] != "S1=8" || deadLettered != 0 {
+		t.Fatalf("delivered %v, dead-lettered %d", w.delivered, deadLettered)
+	}
+}
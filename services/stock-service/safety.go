@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// safetyStock is the per-SKU floor held back from ordinary orders, e.g. for
+// VIP channels. It starts from SAFETY_STOCK ("S1=5,S2=2") and is changed with
+// PUT /stock/{sku}/safety; runtime changes are kept in the inventory
+// snapshot. Guarded by mu.
+var safetyStock = parseSafetyStock(getenv("SAFETY_STOCK", ""))
+
+func parseSafetyStock(spec string) map[string]int {
+	out := map[string]int{}
+	for _, part := range strings.Split(spec, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		sku, v, ok := strings.Cut(part, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if !ok || err != nil || n < 0 {
+			slog.Warn("ignoring invalid SAFETY_STOCK entry", "entry", part)
+			continue
+		}
+		out[normalizeSKU(sku)] = n
+	}
+	return out
+}
+
+// availableLocked is what orders may still take from sku: the quantity on
+// hand above its safety stock, never below zero. Callers hold mu.
+func availableLocked(sku string) int {
+	return max(inventory[sku]-safetyStock[sku], 0)
+}
+
+// availableInventory is /stock?view=available: the sellable quantity per
+// SKU, which is what orders-api checks orders against.
+func availableInventory() map[string]int {
+	mu.RLock()
+	defer mu.RUnlock()
+	out := make(map[string]int, len(inventory))
+	for sku := range inventory {
+		out[sku] = availableLocked(sku)
+	}
+	return out
+}
+
+// handleSafetyStock serves PUT /stock/{sku}/safety with {"safetyStock": n};
+// 0 removes the floor. Like any other write it takes the SKU lock; see
+// ordering.go.
+func handleSafetyStock(w http.ResponseWriter, r *http.Request, sku string) {
+	var body struct {
+		SafetyStock *int `json:"safetyStock"`
+	}
+	if status, err := decodeJSONBody(w, r, &body); err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid json: " + err.Error()})
+		return
+	}
+	if body.SafetyStock == nil || *body.SafetyStock < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "safetyStock must be >= 0"})
+		return
+	}
+	unlock := perSKU.lockAll([]string{sku})
+	mu.Lock()
+	if *body.SafetyStock == 0 {
+		delete(safetyStock, sku)
+	} else {
+		safetyStock[sku] = *body.SafetyStock
+	}
+	item := StockItem{SKU: sku, Quantity: inventory[sku], SafetyStock: safetyStock[sku], Available: availableLocked(sku)}
+	mu.Unlock()
+	unlock()
+	slog.Info("safety stock set", "sku", sku, "safetyStock", item.SafetyStock)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(item)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setSafetyStock(t *testing.T, floors map[string]int) {
+	t.Helper()
+	mu.Lock()
+	prev := safetyStock
+	safetyStock = floors
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		safetyStock = prev
+		mu.Unlock()
+	})
+}
+
+// TestOrderRejectedBelowSafetyFloor puts a floor of 3 under 5 units on hand:
+// an order for 3 must be refused though the raw quantity would cover it,
+// because orders are checked against the available view.
+func TestOrderRejectedBelowSafetyFloor(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 5})
+	setSafetyStock(t, map[string]int{})
+
+	rec := httptest.NewRecorder()
+	stockHandler(nil, nil)(rec, httptest.NewRequest(http.MethodPut, "/stock/s1/safety", strings.NewReader(`{"safetyStock":3}`)))
+	var item StockItem
+	if err := json.Unmarshal(rec.Body.Bytes(), &item); rec.Code != http.StatusOK || err != nil {
+		t.Fatalf("PUT safety: %d %s", rec.Code, rec.Body)
+	}
+	if item != (StockItem{SKU: "S1", Quantity: 5, SafetyStock: 3, Available: 2}) {
+		t.Fatalf("PUT safety returned %+v", item)
+	}
+
+	order := 3
+	if got := availableInventory()["S1"]; got >= order {
+		t.Fatalf("available %d covers an order for %d that would dip below the floor", got, order)
+	}
+	if got := availableInventory()["S1"]; got != 2 {
+		t.Fatalf("available %d, want 2", got)
+	}
+
+	// removing the floor frees the held-back units again
+	rec = httptest.NewRecorder()
+	stockHandler(nil, nil)(rec, httptest.NewRequest(http.MethodPut, "/stock/S1/safety", strings.NewReader(`{"safetyStock":0}`)))
+	if got := availableInventory()["S1"]; rec.Code != http.StatusOK || got != 5 {
+		t.Fatalf("after removing the floor: %d, available %d", rec.Code, got)
+	}
+}
+
+// TestSafetyStockSurvivesSnapshot expects a floor set at runtime to be
+// restored from the snapshot, and an older snapshot to leave the configured
+// floors alone.
+func TestSafetyStockSurvivesSnapshot(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 5})
+	setSafetyStock(t, map[string]int{"S1": 3})
+
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	if err := saveInventoryFile(path, snapshotState()); err != nil {
+		t.Fatal(err)
+	}
+	snap, ok, err := loadInventoryFile(path)
+	if err != nil || !ok {
+		t.Fatalf("load: ok=%v, %v", ok, err)
+	}
+	if snap.SafetyStock["S1"] != 3 {
+		t.Fatalf("restored safety stock %v", snap.SafetyStock)
+	}
+
+	if err := saveInventoryFile(path, inventoryFile{Inventory: map[string]int{"S1": 5}}); err != nil {
+		t.Fatal(err)
+	}
+	if snap, _, err = loadInventoryFile(path); err != nil || snap.SafetyStock != nil {
+		t.Fatalf("snapshot without safety stock restored %v, %v", snap.SafetyStock, err)
+	}
+}
+
+// TestStockListsSafetyStock expects safetyStock on each paged /stock item,
+// while the plain map keeps its sku->quantity shape for existing clients
+// and view=available nets the floor off.
+func TestStockListsSafetyStock(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 5, "S2": 4})
+	setSafetyStock(t, map[string]int{"S1": 2})
+
+	var paged struct {
+		Items []StockItem `json:"items"`
+	}
+	if err := json.NewDecoder(getStock("", "?limit=10").Body).Decode(&paged); err != nil {
+		t.Fatal(err)
+	}
+	want := []StockItem{{SKU: "S1", Quantity: 5, SafetyStock: 2, Available: 3}, {SKU: "S2", Quantity: 4, Available: 4}}
+	if len(paged.Items) != 2 || paged.Items[0] != want[0] || paged.Items[1] != want[1] {
+		t.Fatalf("paged items %+v, want %+v", paged.Items, want)
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  map[string]int
+	}{
+		{"", map[string]int{"S1": 5, "S2": 4}},
+		{"?view=available", map[string]int{"S1": 3, "S2": 4}},
+	} {
+		var got map[string]int
+		if err := json.NewDecoder(getStock("", tc.query).Body).Decode(&got); err != nil {
+			t.Fatalf("/stock%s no longer decodes as map[string]int: %v", tc.query, err)
+		}
+		if len(got) != len(tc.want) || got["S1"] != tc.want["S1"] || got["S2"] != tc.want["S2"] {
+			t.Fatalf("/stock%s = %v, want %v", tc.query, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Package schema validates event payloads against the JSON Schema documents
+// embedded alongside it. Each schema declares the event type it describes in
+// its "title", so adding a new event only requires dropping a file here.
+package schema
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+//go:embed *.json
+var files embed.FS
+
+// Validator holds the compiled schema for every embedded event type. A nil
+// *Validator accepts everything, which is how SCHEMA_VALIDATION=off is wired.
+type Validator struct {
+	schemas map[string]*jsonschema.Schema
+}
+
+// New compiles all embedded schemas, keyed by their title.
+func New() (*Validator, error) {
+	entries, err := files.ReadDir(".")
+	if err != nil {
+		return nil, err
+	}
+	c := jsonschema.NewCompiler()
+	c.AssertFormat = true
+	titles := map[string]string{}
+	for _, e := range entries {
+		raw, err := files.ReadFile(e.Name())
+		if err != nil {
+			return nil, err
+		}
+		var doc struct {
+			Title string `json:"title"`
+		}
+		if err := json.Unmarshal(raw, &doc); err != nil || doc.Title == "" {
+			return nil, fmt.Errorf("schema %s: missing title", e.Name())
+		}
+		if err := c.AddResource("mem://schema/"+e.Name(), bytes.NewReader(raw)); err != nil {
+			return nil, fmt.Errorf("schema %s: %w", e.Name(), err)
+		}
+		titles[doc.Title] = "mem://schema/" + e.Name()
+	}
+	v := &Validator{schemas: map[string]*jsonschema.Schema{}}
+	for title, name := range titles {
+		s, err := c.Compile(name)
+		if err != nil {
+			return nil, fmt.Errorf("schema %s: %w", name, err)
+		}
+		v.schemas[title] = s
+	}
+	return v, nil
+}
+
+// Validate checks payload against the schema registered for eventType.
+func (v *Validator) Validate(eventType string, payload []byte) error {
+	if v == nil {
+		return nil
+	}
+	s, ok := v.schemas[eventType]
+	if !ok {
+		return fmt.Errorf("no schema for event type %q", eventType)
+	}
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return fmt.Errorf("invalid json: %w", err)
+	}
+	return s.Validate(doc)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SeedChange is one SKU's quantity before and after a seed.
+type SeedChange struct {
+	SKU      string `json:"sku"`
+	Current  int    `json:"current"`
+	Proposed int    `json:"proposed"`
+	Delta    int    `json:"delta"`
+	Created  bool   `json:"created,omitempty"`
+}
+
+// SeedResult is the body of a /seed response.
+type SeedResult struct {
+	DryRun  bool         `json:"dryRun"`
+	Changes []SeedChange `json:"changes"`
+}
+
+// seedSKUPattern is what a seeded SKU must look like (SEED_SKU_PATTERN,
+// default letters, digits, '-' and '_', up to 64 characters).
+var seedSKUPattern = func() *regexp.Regexp {
+	const def = `[A-Za-z0-9][A-Za-z0-9_-]{0,63}`
+	re, err := regexp.Compile("^(?:" + getenv("SEED_SKU_PATTERN", def) + ")$")
+	if err != nil {
+		slog.Warn("invalid SEED_SKU_PATTERN, using the default", "error", err)
+		re = regexp.MustCompile("^(?:" + def + ")$")
+	}
+	return re
+}()
+
+// validateSeed returns in keyed by normalized SKU along with every entry that
+// may not be applied, sorted by SKU. Keys that normalize to the same SKU are
+// rejected as duplicates. A seed with any invalid entry is rejected as a
+// whole.
+func validateSeed(in map[string]int) (map[string]int, []FieldError) {
+	in, dups := normalizeQuantities(in)
+	var invalid []FieldError
+	for _, sku := range dups {
+		invalid = append(invalid, FieldError{SKU: sku, Code: ReasonDuplicateSKU, Message: "more than one key normalizes to " + sku})
+	}
+	for sku, qty := range in {
+		qty := qty
+		if fe := checkEntry(0, sku, &qty); fe != nil {
+			invalid = append(invalid, *fe)
+		}
+	}
+	sort.Slice(invalid, func(i, j int) bool { return invalid[i].SKU < invalid[j].SKU })
+	return in, invalid
+}
+
+// seedInventory diffs in against current inventory and, unless dryRun,
+// applies it. The diff and the update happen under one lock so the reported
+// current quantities are the ones that were replaced and no reader sees a
+// partially applied seed. Callers validate first.
+func seedInventory(in map[string]int, dryRun bool) []SeedChange {
+	if !dryRun {
+		// wait out in-flight orders on these SKUs; see ordering.go
+		skus := make([]string, 0, len(in))
+		for sku := range in {
+			skus = append(skus, sku)
+		}
+		sort.Strings(skus)
+		defer perSKU.lockAll(skus)()
+		markManualWrite()
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	changes := make([]SeedChange, 0, len(in))
+	for sku, qty := range in {
+		cur, ok := inventory[sku]
+		changes = append(changes, SeedChange{SKU: sku, Current: cur, Proposed: qty, Delta: qty - cur, Created: !ok})
+		if !dryRun {
+			inventory[sku] = qty
+			audit.record(sku, qty-cur, qty, auditSourceSeed, "")
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].SKU < changes[j].SKU })
+	return changes
+}
+
+// StockUpdate is the result of setting one SKU via PUT /stock/{sku}.
+type StockUpdate struct {
+	SKU      string `json:"sku"`
+	Quantity int    `json:"quantity"`
+	Previous int    `json:"previous"`
+	Delta    int    `json:"delta"`
+	Created  bool   `json:"created,omitempty"`
+}
+
+// setQuantity sets one SKU, creating it if absent. Callers validate sku and
+// qty first.
+func setQuantity(sku string, qty int) StockUpdate {
+	markManualWrite()
+	mu.Lock()
+	defer mu.Unlock()
+	cur, ok := inventory[sku]
+	inventory[sku] = qty
+	audit.record(sku, qty-cur, qty, auditSourceRestock, "")
+	return StockUpdate{SKU: sku, Quantity: qty, Previous: cur, Delta: qty - cur, Created: !ok}
+}
+
+// stockHandler serves PUT /stock/{sku}, which sets a single SKU as a
+// targeted alternative to /seed, and PUT /stock/{sku}/safety. The SKU lock
+// keeps its InventoryUpdated ordered with the consumer's.
+func stockHandler(publishUpdate func(context.Context, InventoryUpdated) error, publishSnapshot func(context.Context)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		sku := strings.TrimPrefix(r.URL.Path, "/stock/")
+		sku, safety := strings.CutSuffix(sku, "/safety")
+		sku = normalizeSKU(sku)
+		if !seedSKUPattern.MatchString(sku) {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "sku does not match " + seedSKUPattern.String()})
+			return
+		}
+		if safety {
+			handleSafetyStock(w, r, sku)
+			return
+		}
+		var body struct {
+			Quantity *int `json:"quantity"`
+		}
+		if status, err := decodeJSONBody(w, r, &body); err != nil {
+			w.WriteHeader(status)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid json: " + err.Error()})
+			return
+		}
+		if body.Quantity == nil || *body.Quantity < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "quantity must be >= 0"})
+			return
+		}
+		unlock := perSKU.lockAll([]string{sku})
+		upd := setQuantity(sku, *body.Quantity)
+		now := time.Now().UTC().Format(time.RFC3339)
+		err := publishUpdate(r.Context(), InventoryUpdated{SKU: sku, Delta: upd.Delta, NewQuantity: upd.Quantity, EventTime: now, ProcessedAt: now, UpdatedAt: now})
+		unlock()
+		slog.Info("stock set", "sku", sku, "quantity", upd.Quantity, "previous", upd.Previous)
+		if err != nil {
+			// the quantity is applied; a snapshot carries it downstream instead
+			publishSnapshot(r.Context())
+			w.WriteHeader(http.StatusBadGateway)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "quantity set but InventoryUpdated not published: " + err.Error()})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(upd)
+	}
+}
+
+// seedHandler serves POST /seed, which sets the quantities of the SKUs in a
+// JSON object, all or nothing, and publishes a snapshot. ?dryRun=true only
+// reports the diff.
+func seedHandler(publishSnapshot func(context.Context)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cors(w, r, "POST") {
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !isJSONRequest(r) {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "Content-Type must be application/json"})
+			return
+		}
+		var in map[string]int
+		if status, err := decodeJSONBody(w, r, &in); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			_ = json.NewEncoder(w).Encode(ValidationErrorBody{Error: "invalid seed, nothing applied", Errors: []FieldError{{Code: ReasonParseError, Message: err.Error()}}})
+			return
+		}
+		in, invalid := validateSeed(in)
+		if len(invalid) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(ValidationErrorBody{Error: "invalid seed, nothing applied", Errors: invalid})
+			return
+		}
+		// ?dryRun=true previews the diff without touching inventory
+		dryRun := r.URL.Query().Get("dryRun") == "true"
+		changes := seedInventory(in, dryRun)
+		if !dryRun {
+			publishSnapshot(r.Context())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(SeedResult{DryRun: dryRun, Changes: changes})
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func putStock(t *testing.T, path, body string) (*httptest.ResponseRecorder, []InventoryUpdated) {
+	t.Helper()
+	var published []InventoryUpdated
+	h := stockHandler(func(_ context.Context, upd InventoryUpdated) error {
+		published = append(published, upd)
+		return nil
+	}, func(context.Context) {})
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPut, path, strings.NewReader(body)))
+	return rec, published
+}
+
+func TestPutStockCreatesAndUpdates(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 10})
+
+	rec, published := putStock(t, "/stock/S9", `{"quantity":5}`)
+	var upd StockUpdate
+	if err := json.NewDecoder(rec.Body).Decode(&upd); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("create: status %d, %v", rec.Code, err)
+	}
+	if !upd.Created || upd.Quantity != 5 || len(published) != 1 || published[0].Delta != 5 {
+		t.Fatalf("create: %+v, published %+v", upd, published)
+	}
+
+	rec, published = putStock(t, "/stock/S1", `{"quantity":4}`)
+	upd = StockUpdate{}
+	if err := json.NewDecoder(rec.Body).Decode(&upd); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("update: status %d, %v", rec.Code, err)
+	}
+	if upd.Created || upd.Previous != 10 || upd.Quantity != 4 || len(published) != 1 || published[0].Delta != -6 || published[0].NewQuantity != 4 {
+		t.Fatalf("update: %+v, published %+v", upd, published)
+	}
+}
+
+func TestPutStockRejectsNegativeQuantity(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 10})
+	rec, published := putStock(t, "/stock/S1", `{"quantity":-1}`)
+	if rec.Code != http.StatusBadRequest || len(published) != 0 {
+		t.Fatalf("status %d, published %v; want 400 and nothing published", rec.Code, published)
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	if inventory["S1"] != 10 {
+		t.Fatalf("S1 = %d, want 10 untouched", inventory["S1"])
+	}
+}
+
+func TestSeedContentType(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 10})
+	for _, tc := range []struct {
+		contentType string
+		want        int
+	}{
+		{"", http.StatusUnsupportedMediaType},
+		{"application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"application/json; charset=utf-8", http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/seed?dryRun=true", strings.NewReader(`{"S1":5}`))
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		rec := httptest.NewRecorder()
+		seedHandler(func(context.Context) {})(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("Content-Type %q: got %d %s, want %d", tc.contentType, rec.Code, rec.Body, tc.want)
+		}
+	}
+}
+
+// TestSeedBodyLimits covers the request hardening of the seed endpoints: a
+// body over MAX_BODY_BYTES is 413 and an undeclared field is 400, with
+// nothing applied either way.
+func TestSeedBodyLimits(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 10})
+	prev := maxBodyBytes
+	maxBodyBytes = 64
+	t.Cleanup(func() { maxBodyBytes = prev })
+
+	req := httptest.NewRequest(http.MethodPost, "/seed", strings.NewReader(`{"S1":5,"`+strings.Repeat("S", 100)+`":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	seedHandler(func(context.Context) {})(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized seed: got %d %s, want 413", rec.Code, rec.Body)
+	}
+
+	rec, published := putStock(t, "/stock/S1", `{"quantity":5,"note":"recount"}`)
+	if rec.Code != http.StatusBadRequest || len(published) != 0 {
+		t.Fatalf("unknown field: got %d %s, published %v; want 400 and nothing published", rec.Code, rec.Body, published)
+	}
+
+	rec, _ = putStock(t, "/stock/S1", `{"quantity":5}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("valid: got %d %s, want 200", rec.Code, rec.Body)
+	}
+	if stockOf("S1") != 5 {
+		t.Fatalf("S1 = %d, want 5 from the valid request only", stockOf("S1"))
+	}
+}
+
+func postSeedQuery(t *testing.T, query, body string, published *int) SeedResult {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/seed"+query, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	seedHandler(func(context.Context) { *published++ })(rec, req)
+	var res SeedResult
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("POST /seed%s: status %d, %v", query, rec.Code, err)
+	}
+	return res
+}
+
+// TestSeedDryRunPreviewsTheAppliedDiff expects ?dryRun=true to report the
+// same diff a real seed then applies, without changing inventory or
+// publishing, and the real seed to apply and publish it.
+func TestSeedDryRunPreviewsTheAppliedDiff(t *testing.T) {
+	setInventory(t, map[string]int{"S1": 10, "S2": 4})
+	const body = `{"S1":7,"S9":3}`
+	want := []SeedChange{
+		{SKU: "S1", Current: 10, Proposed: 7, Delta: -3},
+		{SKU: "S9", Current: 0, Proposed: 3, Delta: 3, Created: true},
+	}
+	var published int
+
+	preview := postSeedQuery(t, "?dryRun=true", body, &published)
+	if !preview.DryRun || !reflect.DeepEqual(preview.Changes, want) {
+		t.Fatalf("preview %+v, want %+v", preview, want)
+	}
+	if got := snapshotInventory(); !reflect.DeepEqual(got, map[string]int{"S1": 10, "S2": 4}) || published != 0 {
+		t.Fatalf("after dry run: inventory %v, %d snapshots published; want untouched", got, published)
+	}
+
+	applied := postSeedQuery(t, "", body, &published)
+	if applied.DryRun || !reflect.DeepEqual(applied.Changes, preview.Changes) {
+		t.Fatalf("applied %+v, want the previewed changes %+v", applied, preview.Changes)
+	}
+	if got := snapshotInventory(); !reflect.DeepEqual(got, map[string]int{"S1": 7, "S2": 4, "S9": 3}) || published != 1 {
+		t.Fatalf("after seed: inventory %v, %d snapshots published", got, published)
+	}
+}
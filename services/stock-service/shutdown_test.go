@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestShutdownClosesWritersAfterHTTP starts a slow PUT /stock/{sku} that
+// publishes at its end, begins shutdown while it runs and expects the
+// publish, then the consumer stop, then the writers closing.
+func TestShutdownClosesWritersAfterHTTP(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	record := func(e string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	}
+	started := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		record("published")
+		w.WriteHeader(http.StatusOK)
+	})}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve(l) }()
+
+	status := make(chan int, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodPut, "http://"+l.Addr().String()+"/stock/S1", nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	drainAndClose(ctx, srv, func() { record("consumers stopped") }, func() { record("writers closed") })
+
+	if got := <-status; got != http.StatusOK {
+		t.Fatalf("in-flight request got status %d, want 200", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"published", "consumers stopped", "writers closed"}
+	if len(events) != len(want) {
+		t.Fatalf("events %v, want %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("events %v, want %v", events, want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import "strings"
+
+// normalizeSKUs is SKU_NORMALIZE (default true). orders-api reads the same
+// variable and applies the same rule, so both sides agree on what " s1 " is.
+var normalizeSKUs = getenv("SKU_NORMALIZE", "true") == "true"
+
+// normalizeSKU trims and upper-cases sku unless SKU_NORMALIZE is false.
+func normalizeSKU(sku string) string {
+	if !normalizeSKUs {
+		return sku
+	}
+	return strings.ToUpper(strings.TrimSpace(sku))
+}
+
+// normalizeItems normalizes every item's SKU in place.
+func normalizeItems(items []OrderItem) {
+	for i := range items {
+		items[i].SKU = normalizeSKU(items[i].SKU)
+	}
+}
+
+// normalizeQuantities returns in keyed by normalized SKU. Two keys that
+// normalize alike are reported in dup, since a seed or import setting both
+// is ambiguous.
+func normalizeQuantities(in map[string]int) (out map[string]int, dup []string) {
+	out = make(map[string]int, len(in))
+	for sku, qty := range in {
+		n := normalizeSKU(sku)
+		if _, ok := out[n]; ok {
+			dup = append(dup, n)
+		}
+		out[n] = qty
+	}
+	return out, dup
+}
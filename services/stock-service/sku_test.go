@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeSKU(t *testing.T) {
+	for in, want := range map[string]string{" s1 ": "S1", "S1": "S1", "\ts-2\n": "S-2", "": ""} {
+		if got := normalizeSKU(in); got != want {
+			t.Errorf("normalizeSKU(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// TestSKUVariantsShareStock seeds " s1 " and orders "s1" and "S1 ", and
+// expects all three to land on the one S1.
+func TestSKUVariantsShareStock(t *testing.T) {
+	setInventory(t, map[string]int{})
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/seed", strings.NewReader(`{" s1 ":10}`))
+	req.Header.Set("Content-Type", "application/json")
+	seedHandler(func(context.Context) {})(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("seed: %d %s", rec.Code, rec.Body)
+	}
+
+	var updates []InventoryUpdated
+	f := &fulfiller{
+		publishUpdate:  func(_ context.Context, u InventoryUpdated) error { updates = append(updates, u); return nil },
+		publishPartial: func(context.Context, OrderPartial) {},
+		publishUnknown: func(_ context.Context, u UnknownSKU) { t.Errorf("unknown sku %q", u.SKU) },
+	}
+	f.apply(context.Background(), "o-1", "o-1", []OrderItem{{SKU: "s1", Qty: 2}}, "", "")
+	f.apply(context.Background(), "o-2", "o-2", []OrderItem{{SKU: "S1 ", Qty: 3}}, "", "")
+
+	mu.RLock()
+	defer mu.RUnlock()
+	if len(inventory) != 1 || inventory["S1"] != 5 {
+		t.Fatalf("inventory %v, want S1:5 only", inventory)
+	}
+	if len(updates) != 2 || updates[0].SKU != "S1" || updates[1].SKU != "S1" {
+		t.Fatalf("updates %+v", updates)
+	}
+}
+
+func TestSKUNormalizeDisabled(t *testing.T) {
+	prev := normalizeSKUs
+	normalizeSKUs = false
+	t.Cleanup(func() { normalizeSKUs = prev })
+	if got := normalizeSKU(" s1 "); got != " s1 " {
+		t.Fatalf("got %q with SKU_NORMALIZE=false", got)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// listenAndServe serves HTTPS when TLS_CERT_FILE and TLS_KEY_FILE are set
+// (TLS_MIN_VERSION 1.2 or 1.3), plain HTTP otherwise.
+func listenAndServe(srv *http.Server) error {
+	cert, key := getenv("TLS_CERT_FILE", ""), getenv("TLS_KEY_FILE", "")
+	if cert == "" && key == "" {
+		return srv.ListenAndServe()
+	}
+	if cert == "" || key == "" {
+		return errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	var minVersion uint16
+	switch v := getenv("TLS_MIN_VERSION", "1.2"); v {
+	case "1.2":
+		minVersion = tls.VersionTLS12
+	case "1.3":
+		minVersion = tls.VersionTLS13
+	default:
+		return fmt.Errorf("unsupported TLS_MIN_VERSION %q", v)
+	}
+	srv.TLSConfig = &tls.Config{MinVersion: minVersion}
+	return srv.ListenAndServeTLS(cert, key)
+}